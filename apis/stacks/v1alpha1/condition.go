@@ -0,0 +1,141 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	runtimev1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+)
+
+// Condition types.
+const (
+	// TypeDependenciesMet stacks have all of their dependencies installed.
+	TypeDependenciesMet runtimev1alpha1.ConditionType = "DependenciesMet"
+
+	// TypeUpgradeSafe stack installs are not upgrading their stack to a
+	// version that makes unsafe changes to its CRDs.
+	TypeUpgradeSafe runtimev1alpha1.ConditionType = "UpgradeSafe"
+
+	// TypeImagePinned stack installs run the image that the tag of their
+	// package was resolved to, rather than whatever image the tag refers to
+	// when it is pulled.
+	TypeImagePinned runtimev1alpha1.ConditionType = "ImagePinned"
+)
+
+// Reasons a stack's dependencies are or are not met.
+const (
+	ReasonDependenciesMet   runtimev1alpha1.ConditionReason = "All dependencies are installed"
+	ReasonDependenciesUnmet runtimev1alpha1.ConditionReason = "Waiting for dependencies to be installed"
+)
+
+// Reasons a stack upgrade is or is not safe.
+const (
+	ReasonUpgradeSafe    runtimev1alpha1.ConditionReason = "Upgrade makes no unsafe changes to CRDs"
+	ReasonUpgradeBlocked runtimev1alpha1.ConditionReason = "Upgrade blocked by unsafe changes to CRDs"
+	ReasonUpgradeAllowed runtimev1alpha1.ConditionReason = "Unsafe upgrade allowed by annotation"
+)
+
+// Reasons a stack install's images are or are not pinned.
+const (
+	ReasonImagePinned   runtimev1alpha1.ConditionReason = "Images are pinned to the resolved package digest"
+	ReasonImageUnpinned runtimev1alpha1.ConditionReason = "Package digest could not be resolved; images are pulled by tag"
+)
+
+// DependenciesMet returns a condition indicating that all of a stack's
+// dependencies are installed.
+func DependenciesMet() runtimev1alpha1.Condition {
+	return runtimev1alpha1.Condition{
+		Type:               TypeDependenciesMet,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonDependenciesMet,
+	}
+}
+
+// DependenciesUnmet returns a condition indicating that one or more of a
+// stack's dependencies are not installed, or are installed at a version that
+// does not satisfy the stack.
+func DependenciesUnmet(msg string) runtimev1alpha1.Condition {
+	return runtimev1alpha1.Condition{
+		Type:               TypeDependenciesMet,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonDependenciesUnmet,
+		Message:            msg,
+	}
+}
+
+// UpgradeSafe returns a condition indicating that a stack upgrade makes no
+// unsafe changes to the stack's CRDs.
+func UpgradeSafe() runtimev1alpha1.Condition {
+	return runtimev1alpha1.Condition{
+		Type:               TypeUpgradeSafe,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonUpgradeSafe,
+	}
+}
+
+// UpgradeBlocked returns a condition indicating that a stack upgrade makes
+// unsafe changes to the stack's CRDs, and will not proceed.
+func UpgradeBlocked(msg string) runtimev1alpha1.Condition {
+	return runtimev1alpha1.Condition{
+		Type:               TypeUpgradeSafe,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonUpgradeBlocked,
+		Message:            msg,
+	}
+}
+
+// UpgradeAllowed returns a condition indicating that a stack upgrade makes
+// unsafe changes to the stack's CRDs, but was allowed to proceed.
+func UpgradeAllowed(msg string) runtimev1alpha1.Condition {
+	return runtimev1alpha1.Condition{
+		Type:               TypeUpgradeSafe,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonUpgradeAllowed,
+		Message:            msg,
+	}
+}
+
+// ImagePinned returns a condition indicating that a stack install runs the
+// image its package was resolved to.
+func ImagePinned() runtimev1alpha1.Condition {
+	return runtimev1alpha1.Condition{
+		Type:               TypeImagePinned,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonImagePinned,
+	}
+}
+
+// ImageUnpinned returns a condition indicating that the digest of a stack
+// install's package could not be resolved, and that its images are pulled by
+// tag instead.
+func ImageUnpinned(msg string) runtimev1alpha1.Condition {
+	return runtimev1alpha1.Condition{
+		Type:               TypeImagePinned,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonImageUnpinned,
+		Message:            msg,
+	}
+}
@@ -69,9 +69,18 @@ var (
 	StackDefinitionGroupVersionKind = SchemeGroupVersion.WithKind(StackDefinitionKind)
 )
 
+// StackRevision type metadata.
+var (
+	StackRevisionKind             = reflect.TypeOf(StackRevision{}).Name()
+	StackRevisionGroupKind        = schema.GroupKind{Group: Group, Kind: StackRevisionKind}.String()
+	StackRevisionKindAPIVersion   = StackRevisionKind + "." + SchemeGroupVersion.String()
+	StackRevisionGroupVersionKind = SchemeGroupVersion.WithKind(StackRevisionKind)
+)
+
 func init() {
 	SchemeBuilder.Register(&ClusterStackInstall{}, &ClusterStackInstallList{})
 	SchemeBuilder.Register(&StackInstall{}, &StackInstallList{})
 	SchemeBuilder.Register(&Stack{}, &StackList{})
 	SchemeBuilder.Register(&StackDefinition{}, &StackDefinitionList{})
+	SchemeBuilder.Register(&StackRevision{}, &StackRevisionList{})
 }
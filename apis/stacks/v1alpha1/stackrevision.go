@@ -0,0 +1,62 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// StackRevisionSpec specifies a version of a stack that was installed by a
+// StackInstall or ClusterStackInstall, and the resources it was installed as.
+type StackRevisionSpec struct {
+	StackVersion `json:",inline"`
+
+	// Stack is the Stack or StackDefinition that was installed, including the
+	// controller configuration the install applied to it.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Stack runtime.RawExtension `json:"stack"`
+
+	// CRDs are the CustomResourceDefinitions that were installed.
+	// +optional
+	// +kubebuilder:pruning:PreserveUnknownFields
+	CRDs []runtime.RawExtension `json:"crds,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// A StackRevision records a version of a stack that was installed, so that
+// the stack can be rolled back to it.
+// +kubebuilder:printcolumn:name="REVISION",type="integer",JSONPath=".spec.revision"
+// +kubebuilder:printcolumn:name="VERSION",type="string",JSONPath=".spec.version"
+// +kubebuilder:printcolumn:name="PACKAGE",type="string",JSONPath=".spec.package"
+// +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+type StackRevision struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec StackRevisionSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// StackRevisionList contains a list of StackRevision.
+type StackRevisionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []StackRevision `json:"items"`
+}
@@ -20,7 +20,9 @@ import (
 	"strings"
 
 	"github.com/docker/distribution/reference"
+	admissionregistration "k8s.io/api/admissionregistration/v1beta1"
 	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	rbac "k8s.io/api/rbac/v1"
 	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
@@ -39,6 +41,7 @@ import (
 // +kubebuilder:printcolumn:name="SOURCE",type="string",JSONPath=".spec.source"
 // +kubebuilder:printcolumn:name="PACKAGE",type="string",JSONPath=".spec.package"
 // +kubebuilder:printcolumn:name="CRD",type="string",JSONPath=".spec.crd"
+// +kubebuilder:printcolumn:name="VERSION",type="string",JSONPath=".status.currentVersion.version"
 // +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
 type StackInstall struct {
 	metav1.TypeMeta   `json:",inline"`
@@ -75,6 +78,170 @@ type StackInstallSpec struct {
 	// CRD is known, but the package name that contains it is not known.
 	// Either Package or CustomResourceDefinition can be specified.
 	CustomResourceDefinition string `json:"crd,omitempty"`
+
+	// SignatureVerification configures verification of the signature shipped
+	// in the stack package. The stack will not be installed if a signature is
+	// present but cannot be verified by one of the trusted keys.
+	// +optional
+	SignatureVerification *SignatureVerification `json:"signatureVerification,omitempty"`
+
+	// InstallDependencies determines whether the stack packages that the
+	// stack depends on are installed when they are not already present.
+	// Dependencies are installed using the same kind of install and the same
+	// controller options as this install. Never is the default.
+	// +optional
+	// +kubebuilder:validation:Enum=Never;IfNotPresent
+	InstallDependencies DependencyInstallPolicy `json:"installDependencies,omitempty"`
+
+	// Approval determines whether the stack is installed as soon as its
+	// package is unpacked, or only once the permissions it will be granted
+	// have been reviewed and approved. Automatic is the default.
+	// +optional
+	// +kubebuilder:validation:Enum=Automatic;Manual
+	Approval ApprovalPolicy `json:"approval,omitempty"`
+
+	// Approved approves the installation of a stack whose approval policy is
+	// Manual. The permissions the stack will be granted are summarised in the
+	// status of the install once its package has been unpacked. Approval is
+	// revoked when a different package, or a package that will be granted
+	// different permissions, is to be installed.
+	// +optional
+	Approved bool `json:"approved,omitempty"`
+
+	// PackageSource installs the stack package directly from its source,
+	// rather than from a published stack image. When PackageSource is set,
+	// Package is optional and is only used as the image of controller
+	// containers that do not specify one.
+	// +optional
+	PackageSource *PackageSource `json:"packageSource,omitempty"`
+
+	// RollbackTo rolls the stack back to the numbered StackRevision of this
+	// install, without unpacking its package again. The revision must be
+	// approved like any other version if the approval policy is Manual.
+	// Changes to the requested package are not installed while RollbackTo is
+	// set.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	RollbackTo int64 `json:"rollbackTo,omitempty"`
+
+	// UpgradePolicy determines whether the stack is automatically upgraded
+	// when newer versions of its package are published. Policies other than
+	// Manual periodically list the tags of the package's repository, and
+	// update Package to the greatest semantic version tag in the allowed
+	// range. The package must be tagged with a semantic version. Stacks
+	// installed from a PackageSource are not upgraded automatically. Manual
+	// is the default.
+	// +optional
+	// +kubebuilder:validation:Enum=Manual;Patch;Minor;Latest
+	UpgradePolicy UpgradePolicy `json:"upgradePolicy,omitempty"`
+}
+
+// A PackageSource is a source of stack package content other than a stack
+// image. Exactly one source must be specified.
+type PackageSource struct {
+	// Git is a Git repository containing the stack package.
+	// +optional
+	Git *GitSource `json:"git,omitempty"`
+
+	// HTTP is a tarball containing the stack package, served over HTTP(S).
+	// +optional
+	HTTP *HTTPSource `json:"http,omitempty"`
+}
+
+// A GitSource is a Git repository containing a stack package.
+type GitSource struct {
+	// URL of the Git repository, e.g. https://github.com/crossplane/sample-stack.git
+	URL string `json:"url"`
+
+	// Ref is the branch, tag, or commit of the repository to install. The
+	// default branch of the repository is installed if Ref is unset.
+	// +optional
+	Ref string `json:"ref,omitempty"`
+
+	// Path of the directory within the repository that contains the stack
+	// package. The root of the repository is used if Path is unset.
+	// +optional
+	Path string `json:"path,omitempty"`
+}
+
+// An HTTPSource is a tarball containing a stack package, served over HTTP(S).
+// The tarball may be gzip compressed.
+type HTTPSource struct {
+	// URL of the tarball, e.g. https://example.org/sample-stack-1.0.tar.gz
+	URL string `json:"url"`
+
+	// SHA256 is the hex encoded SHA-256 checksum of the tarball. The stack
+	// is not installed if the tarball does not match the checksum.
+	// +kubebuilder:validation:Pattern=`^[a-f0-9]{64}$`
+	SHA256 string `json:"sha256"`
+
+	// Path of the directory within the tarball that contains the stack
+	// package. The root of the tarball is used if Path is unset.
+	// +optional
+	Path string `json:"path,omitempty"`
+}
+
+// A DependencyInstallPolicy determines whether the stack packages that a stack
+// depends on are installed automatically.
+type DependencyInstallPolicy string
+
+// Dependency install policies.
+const (
+	// DependencyInstallPolicyNever requires that dependencies are installed
+	// separately.
+	DependencyInstallPolicyNever DependencyInstallPolicy = "Never"
+
+	// DependencyInstallPolicyIfNotPresent installs any dependencies that are
+	// not already installed.
+	DependencyInstallPolicyIfNotPresent DependencyInstallPolicy = "IfNotPresent"
+)
+
+// An ApprovalPolicy determines whether the installation of a stack must be
+// approved.
+type ApprovalPolicy string
+
+// Approval policies.
+const (
+	// ApprovalAutomatic installs a stack as soon as its package is unpacked.
+	ApprovalAutomatic ApprovalPolicy = "Automatic"
+
+	// ApprovalManual installs a stack only once it has been approved.
+	ApprovalManual ApprovalPolicy = "Manual"
+)
+
+// An UpgradePolicy determines which newer versions of a stack package a stack
+// is automatically upgraded to.
+type UpgradePolicy string
+
+// Upgrade policies.
+const (
+	// UpgradePolicyManual upgrades a stack only when its package is changed.
+	UpgradePolicyManual UpgradePolicy = "Manual"
+
+	// UpgradePolicyPatch upgrades a stack to newer patch versions of its
+	// package, e.g. from 1.2.0 to 1.2.3.
+	UpgradePolicyPatch UpgradePolicy = "Patch"
+
+	// UpgradePolicyMinor upgrades a stack to newer minor and patch versions
+	// of its package, e.g. from 1.2.0 to 1.4.1.
+	UpgradePolicyMinor UpgradePolicy = "Minor"
+
+	// UpgradePolicyLatest upgrades a stack to the newest version of its
+	// package, e.g. from 1.2.0 to 2.0.0.
+	UpgradePolicyLatest UpgradePolicy = "Latest"
+)
+
+// SignatureVerification configures how stack package signatures are verified.
+type SignatureVerification struct {
+	// Required refuses to install stack packages that are not signed by one
+	// of the trusted keys.
+	// +optional
+	Required bool `json:"required,omitempty"`
+
+	// TrustedKeysConfigMap is the name of a ConfigMap whose values are PEM
+	// encoded public keys that are trusted to sign stack packages. The
+	// ConfigMap must exist in the namespace the install job runs in.
+	TrustedKeysConfigMap string `json:"trustedKeysConfigMap"`
 }
 
 // StackControllerOptions allow for changes in the Stack extraction and
@@ -102,6 +269,75 @@ type StackInstallStatus struct {
 
 	InstallJob  *corev1.ObjectReference `json:"installJob,omitempty"`
 	StackRecord *corev1.ObjectReference `json:"stackRecord,omitempty"`
+
+	// Dependencies are the installs that were created for the stack packages
+	// that this stack depends on.
+	Dependencies []corev1.ObjectReference `json:"dependencies,omitempty"`
+
+	// PermissionsSummary is a human-readable summary of the RBAC roles,
+	// bindings, and admission webhooks that will be created for the stack,
+	// followed by warnings about any permissions that may allow the stack to
+	// escalate its privileges.
+	PermissionsSummary string `json:"permissionsSummary,omitempty"`
+
+	// CurrentVersion is the version of the stack that is currently
+	// installed. The stack is upgraded in place when the requested package
+	// differs from the package the current version was installed from.
+	CurrentVersion *StackVersion `json:"currentVersion,omitempty"`
+
+	// PreviousVersion is the version of the stack that was installed before
+	// it was most recently upgraded.
+	PreviousVersion *StackVersion `json:"previousVersion,omitempty"`
+
+	// LastUpgradeCheck is the time the registry was last checked for newer
+	// versions of the stack package, if the install's upgrade policy is not
+	// Manual.
+	// +optional
+	LastUpgradeCheck *metav1.Time `json:"lastUpgradeCheck,omitempty"`
+
+	// ImageDigest is the digest that the tag of the requested package was
+	// resolved to when its install job was created. The install job and the
+	// stack's controller run the package image pinned to this digest. It is
+	// empty if the digest could not be resolved, in which case the
+	// ImagePinned condition explains why.
+	// +optional
+	ImageDigest string `json:"imageDigest,omitempty"`
+
+	// ApprovedDigest identifies the package and the permissions that were
+	// approved, if the install's approval policy is Manual. The install must
+	// be approved again before a different package, or a package that will be
+	// granted different permissions, is installed.
+	// +optional
+	ApprovedDigest string `json:"approvedDigest,omitempty"`
+}
+
+// A StackVersion identifies an installed version of a stack.
+type StackVersion struct {
+	// Package is the stack package the version was installed from.
+	// +optional
+	Package string `json:"package,omitempty"`
+
+	// PackageSource is the source the version was installed from, if it was
+	// not installed from a stack package image.
+	// +optional
+	PackageSource *PackageSource `json:"packageSource,omitempty"`
+
+	// Version is the version of the stack declared by its metadata.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Digest is the digest of the stack package contents.
+	// +optional
+	Digest string `json:"digest,omitempty"`
+
+	// ImageDigest is the digest of the stack package image the version was
+	// installed from.
+	// +optional
+	ImageDigest string `json:"imageDigest,omitempty"`
+
+	// Revision is the number of the StackRevision that records the version.
+	// +optional
+	Revision int64 `json:"revision,omitempty"`
 }
 
 // Image returns the Package prefixed with a source (if available).
@@ -153,6 +389,16 @@ func (si *ClusterStackInstall) GetPackage() string {
 	return si.Spec.Package
 }
 
+// SetPackage sets the Package of the ClusterStackInstall Spec
+func (si *ClusterStackInstall) SetPackage(pkg string) {
+	si.Spec.Package = pkg
+}
+
+// SetPackage sets the Package of the StackInstall Spec
+func (si *StackInstall) SetPackage(pkg string) {
+	si.Spec.Package = pkg
+}
+
 // SetSource sets the Source of the StackInstall Spec
 func (si *StackInstall) SetSource(src string) {
 	si.Spec.Source = src
@@ -189,6 +435,17 @@ func (si *ClusterStackInstall) SetConditions(c ...runtimev1alpha1.Condition) {
 	si.Status.SetConditions(c...)
 }
 
+// GetCondition gets the StackInstall's Status condition of the supplied type
+func (si *StackInstall) GetCondition(ct runtimev1alpha1.ConditionType) runtimev1alpha1.Condition {
+	return si.Status.GetCondition(ct)
+}
+
+// GetCondition gets the ClusterStackInstall's Status condition of the
+// supplied type
+func (si *ClusterStackInstall) GetCondition(ct runtimev1alpha1.ConditionType) runtimev1alpha1.Condition {
+	return si.Status.GetCondition(ct)
+}
+
 // GetImagePullSecrets gets the ImagePullSecrets of the ClusterStackInstall Spec
 func (si *ClusterStackInstall) GetImagePullSecrets() []corev1.LocalObjectReference {
 	return si.Spec.ImagePullSecrets
@@ -263,6 +520,221 @@ func (si *ClusterStackInstall) SetServiceAccountAnnotations(annotations map[stri
 	si.Spec.ServiceAccount.Annotations = annotations
 }
 
+// GetSignatureVerification gets the SignatureVerification of the
+// ClusterStackInstall Spec
+func (si *ClusterStackInstall) GetSignatureVerification() *SignatureVerification {
+	return si.Spec.SignatureVerification
+}
+
+// GetSignatureVerification gets the SignatureVerification of the StackInstall
+// Spec
+func (si *StackInstall) GetSignatureVerification() *SignatureVerification {
+	return si.Spec.SignatureVerification
+}
+
+// GetPackageSource gets the PackageSource of the ClusterStackInstall Spec
+func (si *ClusterStackInstall) GetPackageSource() *PackageSource {
+	return si.Spec.PackageSource
+}
+
+// GetPackageSource gets the PackageSource of the StackInstall Spec
+func (si *StackInstall) GetPackageSource() *PackageSource {
+	return si.Spec.PackageSource
+}
+
+// GetInstallDependencies gets the InstallDependencies policy of the
+// ClusterStackInstall Spec
+func (si *ClusterStackInstall) GetInstallDependencies() DependencyInstallPolicy {
+	return si.Spec.InstallDependencies
+}
+
+// GetInstallDependencies gets the InstallDependencies policy of the
+// StackInstall Spec
+func (si *StackInstall) GetInstallDependencies() DependencyInstallPolicy {
+	return si.Spec.InstallDependencies
+}
+
+// GetApproval gets the Approval policy of the ClusterStackInstall Spec
+func (si *ClusterStackInstall) GetApproval() ApprovalPolicy {
+	return si.Spec.Approval
+}
+
+// GetApproval gets the Approval policy of the StackInstall Spec
+func (si *StackInstall) GetApproval() ApprovalPolicy {
+	return si.Spec.Approval
+}
+
+// IsApproved returns true if the ClusterStackInstall has been approved.
+func (si *ClusterStackInstall) IsApproved() bool {
+	return si.Spec.Approved
+}
+
+// IsApproved returns true if the StackInstall has been approved.
+func (si *StackInstall) IsApproved() bool {
+	return si.Spec.Approved
+}
+
+// SetApproved sets the ClusterStackInstall's Spec Approved
+func (si *ClusterStackInstall) SetApproved(approved bool) {
+	si.Spec.Approved = approved
+}
+
+// SetApproved sets the StackInstall's Spec Approved
+func (si *StackInstall) SetApproved(approved bool) {
+	si.Spec.Approved = approved
+}
+
+// SetPermissionsSummary sets the ClusterStackInstall's Status
+// PermissionsSummary
+func (si *ClusterStackInstall) SetPermissionsSummary(summary string) {
+	si.Status.PermissionsSummary = summary
+}
+
+// SetPermissionsSummary sets the StackInstall's Status PermissionsSummary
+func (si *StackInstall) SetPermissionsSummary(summary string) {
+	si.Status.PermissionsSummary = summary
+}
+
+// Dependencies gets the ClusterStackInstall's Status Dependencies
+func (si *ClusterStackInstall) Dependencies() []corev1.ObjectReference {
+	return si.Status.Dependencies
+}
+
+// Dependencies gets the StackInstall's Status Dependencies
+func (si *StackInstall) Dependencies() []corev1.ObjectReference {
+	return si.Status.Dependencies
+}
+
+// SetDependencies sets the ClusterStackInstall's Status Dependencies
+func (si *ClusterStackInstall) SetDependencies(deps []corev1.ObjectReference) {
+	si.Status.Dependencies = deps
+}
+
+// SetDependencies sets the StackInstall's Status Dependencies
+func (si *StackInstall) SetDependencies(deps []corev1.ObjectReference) {
+	si.Status.Dependencies = deps
+}
+
+// GetRollbackTo gets the ClusterStackInstall's Spec RollbackTo
+func (si *ClusterStackInstall) GetRollbackTo() int64 {
+	return si.Spec.RollbackTo
+}
+
+// GetRollbackTo gets the StackInstall's Spec RollbackTo
+func (si *StackInstall) GetRollbackTo() int64 {
+	return si.Spec.RollbackTo
+}
+
+// GetUpgradePolicy gets the UpgradePolicy of the ClusterStackInstall Spec
+func (si *ClusterStackInstall) GetUpgradePolicy() UpgradePolicy {
+	return si.Spec.UpgradePolicy
+}
+
+// GetUpgradePolicy gets the UpgradePolicy of the StackInstall Spec
+func (si *StackInstall) GetUpgradePolicy() UpgradePolicy {
+	return si.Spec.UpgradePolicy
+}
+
+// LastUpgradeCheck gets the ClusterStackInstall's Status LastUpgradeCheck
+func (si *ClusterStackInstall) LastUpgradeCheck() *metav1.Time {
+	return si.Status.LastUpgradeCheck
+}
+
+// LastUpgradeCheck gets the StackInstall's Status LastUpgradeCheck
+func (si *StackInstall) LastUpgradeCheck() *metav1.Time {
+	return si.Status.LastUpgradeCheck
+}
+
+// SetLastUpgradeCheck sets the ClusterStackInstall's Status LastUpgradeCheck
+func (si *ClusterStackInstall) SetLastUpgradeCheck(t *metav1.Time) {
+	si.Status.LastUpgradeCheck = t
+}
+
+// SetLastUpgradeCheck sets the StackInstall's Status LastUpgradeCheck
+func (si *StackInstall) SetLastUpgradeCheck(t *metav1.Time) {
+	si.Status.LastUpgradeCheck = t
+}
+
+// ImageDigest gets the ClusterStackInstall's Status ImageDigest
+func (si *ClusterStackInstall) ImageDigest() string {
+	return si.Status.ImageDigest
+}
+
+// ImageDigest gets the StackInstall's Status ImageDigest
+func (si *StackInstall) ImageDigest() string {
+	return si.Status.ImageDigest
+}
+
+// SetImageDigest sets the ClusterStackInstall's Status ImageDigest
+func (si *ClusterStackInstall) SetImageDigest(d string) {
+	si.Status.ImageDigest = d
+}
+
+// SetImageDigest sets the StackInstall's Status ImageDigest
+func (si *StackInstall) SetImageDigest(d string) {
+	si.Status.ImageDigest = d
+}
+
+// ApprovedDigest gets the ClusterStackInstall's Status ApprovedDigest
+func (si *ClusterStackInstall) ApprovedDigest() string {
+	return si.Status.ApprovedDigest
+}
+
+// ApprovedDigest gets the StackInstall's Status ApprovedDigest
+func (si *StackInstall) ApprovedDigest() string {
+	return si.Status.ApprovedDigest
+}
+
+// SetApprovedDigest sets the ClusterStackInstall's Status ApprovedDigest
+func (si *ClusterStackInstall) SetApprovedDigest(d string) {
+	si.Status.ApprovedDigest = d
+}
+
+// SetApprovedDigest sets the StackInstall's Status ApprovedDigest
+func (si *StackInstall) SetApprovedDigest(d string) {
+	si.Status.ApprovedDigest = d
+}
+
+// CurrentVersion gets the ClusterStackInstall's Status CurrentVersion
+func (si *ClusterStackInstall) CurrentVersion() *StackVersion {
+	return si.Status.CurrentVersion
+}
+
+// CurrentVersion gets the StackInstall's Status CurrentVersion
+func (si *StackInstall) CurrentVersion() *StackVersion {
+	return si.Status.CurrentVersion
+}
+
+// SetCurrentVersion sets the ClusterStackInstall's Status CurrentVersion
+func (si *ClusterStackInstall) SetCurrentVersion(v *StackVersion) {
+	si.Status.CurrentVersion = v
+}
+
+// SetCurrentVersion sets the StackInstall's Status CurrentVersion
+func (si *StackInstall) SetCurrentVersion(v *StackVersion) {
+	si.Status.CurrentVersion = v
+}
+
+// PreviousVersion gets the ClusterStackInstall's Status PreviousVersion
+func (si *ClusterStackInstall) PreviousVersion() *StackVersion {
+	return si.Status.PreviousVersion
+}
+
+// PreviousVersion gets the StackInstall's Status PreviousVersion
+func (si *StackInstall) PreviousVersion() *StackVersion {
+	return si.Status.PreviousVersion
+}
+
+// SetPreviousVersion sets the ClusterStackInstall's Status PreviousVersion
+func (si *ClusterStackInstall) SetPreviousVersion(v *StackVersion) {
+	si.Status.PreviousVersion = v
+}
+
+// SetPreviousVersion sets the StackInstall's Status PreviousVersion
+func (si *StackInstall) SetPreviousVersion(v *StackVersion) {
+	si.Status.PreviousVersion = v
+}
+
 // InstallJob gets the ClusterStackInstall's Status InstallJob
 func (si *ClusterStackInstall) InstallJob() *corev1.ObjectReference {
 	return si.Status.InstallJob
@@ -321,21 +793,44 @@ type StackInstaller interface {
 	metav1.Object
 	runtime.Object
 
+	ApprovedDigest() string
+	SetApprovedDigest(string)
+	Dependencies() []corev1.ObjectReference
+	GetApproval() ApprovalPolicy
+	GetCondition(runtimev1alpha1.ConditionType) runtimev1alpha1.Condition
+	GetInstallDependencies() DependencyInstallPolicy
 	GetPackage() string
+	GetPackageSource() *PackageSource
+	GetRollbackTo() int64
+	GetUpgradePolicy() UpgradePolicy
 	GetImagePullPolicy() corev1.PullPolicy
 	GetImagePullSecrets() []corev1.LocalObjectReference
 	GetServiceAccountAnnotations() map[string]string
+	GetSignatureVerification() *SignatureVerification
 	GroupVersionKind() schema.GroupVersionKind
+	ImageDigest() string
+	SetImageDigest(string)
 	ImageWithSource(string) (string, error)
 	InstallJob() *corev1.ObjectReference
+	IsApproved() bool
+	SetApproved(bool)
 	PermissionScope() string
 	SetConditions(c ...runtimev1alpha1.Condition)
+	CurrentVersion() *StackVersion
+	SetCurrentVersion(*StackVersion)
+	LastUpgradeCheck() *metav1.Time
+	SetLastUpgradeCheck(*metav1.Time)
+	PreviousVersion() *StackVersion
+	SetPreviousVersion(*StackVersion)
+	SetDependencies([]corev1.ObjectReference)
 	SetImagePullPolicy(corev1.PullPolicy)
 	SetImagePullSecrets([]corev1.LocalObjectReference)
 	SetServiceAccountAnnotations(map[string]string)
 	SetSource(string)
 	SetStackRecord(*corev1.ObjectReference)
 	SetInstallJob(*corev1.ObjectReference)
+	SetPackage(string)
+	SetPermissionsSummary(string)
 	StackRecord() *corev1.ObjectReference
 }
 
@@ -347,6 +842,7 @@ type StackInstaller interface {
 // +kubebuilder:printcolumn:name="SOURCE",type="string",JSONPath=".spec.source"
 // +kubebuilder:printcolumn:name="PACKAGE",type="string",JSONPath=".spec.package"
 // +kubebuilder:printcolumn:name="CRD",type="string",JSONPath=".spec.crd"
+// +kubebuilder:printcolumn:name="VERSION",type="string",JSONPath=".status.currentVersion.version"
 // +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
 type ClusterStackInstall struct {
 	metav1.TypeMeta   `json:",inline"`
@@ -395,6 +891,7 @@ type StackSpec struct {
 	CRDs            CRDList         `json:"customresourcedefinitions,omitempty"`
 	Controller      ControllerSpec  `json:"controller,omitempty"`
 	Permissions     PermissionsSpec `json:"permissions,omitempty"`
+	Webhooks        *WebhooksSpec   `json:"webhooks,omitempty"`
 }
 
 // ServiceAccountAnnotations guarantees a map of annotations from a StackSpec
@@ -412,6 +909,15 @@ func (spec StackSpec) ServiceAccountAnnotations() map[string]string {
 type StackStatus struct {
 	runtimev1alpha1.ConditionedStatus `json:"conditionedStatus,omitempty"`
 	ControllerRef                     *corev1.ObjectReference `json:"controllerRef,omitempty"`
+
+	// ControllerRefs refer to every Deployment and Job created for the
+	// Stack's controllers.
+	ControllerRefs []corev1.ObjectReference `json:"controllerRefs,omitempty"`
+
+	// ObservedGeneration is the generation of the Stack that its controller,
+	// RBAC roles, and bindings were most recently processed for. They are
+	// processed again when the Stack's spec changes, e.g. on upgrade.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 }
 
 // PackageMetadataSpec defines metadata about the stack application
@@ -439,9 +945,10 @@ type AppMetadataSpec struct {
 	Source        string            `json:"source,omitempty"`
 	License       string            `json:"license,omitempty"`
 
-	// DependsOn is the list of CRDs that this stack depends on. This data
-	// drives the RBAC generation process.
-	DependsOn []StackInstallSpec `json:"dependsOn,omitempty"`
+	// DependsOn is the list of stack packages and CRDs that this stack
+	// depends on. CRD dependencies drive the RBAC generation process. The
+	// Stack will not be deployed until all of its dependencies are met.
+	DependsOn []Dependency `json:"dependsOn,omitempty"`
 
 	// +kubebuilder:validation:Enum=Provider;Stack;Application
 	PackageType string `json:"packageType,omitempty"`
@@ -450,6 +957,29 @@ type AppMetadataSpec struct {
 	PermissionScope string `json:"permissionScope,omitempty"`
 }
 
+// Dependency is a stack package or CRD that a stack depends on. A dependency
+// may specify either a Package or a CustomResourceDefinition.
+type Dependency struct {
+	// Package is the name of the stack package that is depended on, e.g.
+	// crossplane/stack-gcp:v0.1.0. Any installed version of the package's
+	// repository that satisfies Version meets the dependency; the tag is the
+	// version that is installed if dependencies are installed automatically.
+	// +optional
+	Package string `json:"package,omitempty"`
+
+	// CustomResourceDefinition is the full name of a CRD that is depended
+	// on, e.g. kind.group.com. It may be suffixed with the minimum version
+	// that must be served, e.g. kind.group.com/v1beta1.
+	// +optional
+	CustomResourceDefinition string `json:"crd,omitempty"`
+
+	// Version is a semantic version constraint that the installed version of
+	// the Package must satisfy, e.g. ">=1.2.0 <2.0.0". Any installed version
+	// satisfies the dependency when Version is omitted.
+	// +optional
+	Version string `json:"version,omitempty"`
+}
+
 // CRDList is the full list of CRDs that this stack owns and depends on
 type CRDList []metav1.TypeMeta
 
@@ -477,7 +1007,16 @@ type ControllerSpec struct {
 	// the Stack Manager creates for the Stack's controller
 	ServiceAccount *ServiceAccountOptions `json:"serviceAccount,omitempty"`
 
+	// Deployment is the Stack's primary controller.
 	Deployment *ControllerDeployment `json:"deployment,omitempty"`
+
+	// Deployments are additional long running processes of the Stack, such
+	// as a webhook server.
+	Deployments []ControllerDeployment `json:"deployments,omitempty"`
+
+	// Jobs are run to completion before any of the Stack's Deployments are
+	// created, for example to migrate existing resources.
+	Jobs []ControllerJob `json:"jobs,omitempty"`
 }
 
 // ServiceAccountOptions augment the ServiceAccount created by the Stack controller
@@ -491,6 +1030,25 @@ type ControllerDeployment struct {
 	Spec apps.DeploymentSpec `json:"spec"`
 }
 
+// ControllerJob defines a Job that is run to completion before the
+// controllers of a stack are started.
+type ControllerJob struct {
+	Name string        `json:"name"`
+	Spec batch.JobSpec `json:"spec"`
+}
+
+// WebhooksSpec defines the admission webhooks of a stack. The admission
+// webhooks, and the conversion webhooks of the stack's CRDs, are served by one
+// of the stack's controller Deployments.
+type WebhooksSpec struct {
+	// Deployment is the name of the controller Deployment that serves the
+	// stack's webhooks, e.g. "controller" for the primary controller.
+	Deployment string `json:"deployment,omitempty"`
+
+	Validating []admissionregistration.ValidatingWebhook `json:"validating,omitempty"`
+	Mutating   []admissionregistration.MutatingWebhook   `json:"mutating,omitempty"`
+}
+
 // PermissionsSpec defines the permissions that a stack will require to operate.
 type PermissionsSpec struct {
 	Rules []rbac.PolicyRule `json:"rules,omitempty"`
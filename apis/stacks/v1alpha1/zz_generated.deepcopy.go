@@ -21,6 +21,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/api/admissionregistration/v1beta1"
 	"k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -51,10 +52,8 @@ func (in *AppMetadataSpec) DeepCopyInto(out *AppMetadataSpec) {
 	}
 	if in.DependsOn != nil {
 		in, out := &in.DependsOn, &out.DependsOn
-		*out = make([]StackInstallSpec, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
+		*out = make([]Dependency, len(*in))
+		copy(*out, *in)
 	}
 }
 
@@ -210,6 +209,22 @@ func (in *ControllerDeployment) DeepCopy() *ControllerDeployment {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ControllerJob) DeepCopyInto(out *ControllerJob) {
+	*out = *in
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ControllerJob.
+func (in *ControllerJob) DeepCopy() *ControllerJob {
+	if in == nil {
+		return nil
+	}
+	out := new(ControllerJob)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ControllerSpec) DeepCopyInto(out *ControllerSpec) {
 	*out = *in
@@ -223,6 +238,20 @@ func (in *ControllerSpec) DeepCopyInto(out *ControllerSpec) {
 		*out = new(ControllerDeployment)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Deployments != nil {
+		in, out := &in.Deployments, &out.Deployments
+		*out = make([]ControllerDeployment, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Jobs != nil {
+		in, out := &in.Jobs, &out.Jobs
+		*out = make([]ControllerJob, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ControllerSpec.
@@ -235,6 +264,21 @@ func (in *ControllerSpec) DeepCopy() *ControllerSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Dependency) DeepCopyInto(out *Dependency) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Dependency.
+func (in *Dependency) DeepCopy() *Dependency {
+	if in == nil {
+		return nil
+	}
+	out := new(Dependency)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FieldBinding) DeepCopyInto(out *FieldBinding) {
 	*out = *in
@@ -250,6 +294,36 @@ func (in *FieldBinding) DeepCopy() *FieldBinding {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GitSource) DeepCopyInto(out *GitSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GitSource.
+func (in *GitSource) DeepCopy() *GitSource {
+	if in == nil {
+		return nil
+	}
+	out := new(GitSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HTTPSource) DeepCopyInto(out *HTTPSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HTTPSource.
+func (in *HTTPSource) DeepCopy() *HTTPSource {
+	if in == nil {
+		return nil
+	}
+	out := new(HTTPSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IconSpec) DeepCopyInto(out *IconSpec) {
 	*out = *in
@@ -327,6 +401,31 @@ func (in *PackageMetadataSpec) DeepCopy() *PackageMetadataSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PackageSource) DeepCopyInto(out *PackageSource) {
+	*out = *in
+	if in.Git != nil {
+		in, out := &in.Git, &out.Git
+		*out = new(GitSource)
+		**out = **in
+	}
+	if in.HTTP != nil {
+		in, out := &in.HTTP, &out.HTTP
+		*out = new(HTTPSource)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PackageSource.
+func (in *PackageSource) DeepCopy() *PackageSource {
+	if in == nil {
+		return nil
+	}
+	out := new(PackageSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PermissionsSpec) DeepCopyInto(out *PermissionsSpec) {
 	*out = *in
@@ -371,6 +470,21 @@ func (in *ServiceAccountOptions) DeepCopy() *ServiceAccountOptions {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SignatureVerification) DeepCopyInto(out *SignatureVerification) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SignatureVerification.
+func (in *SignatureVerification) DeepCopy() *SignatureVerification {
+	if in == nil {
+		return nil
+	}
+	out := new(SignatureVerification)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Stack) DeepCopyInto(out *Stack) {
 	*out = *in
@@ -592,6 +706,16 @@ func (in *StackInstallList) DeepCopyObject() runtime.Object {
 func (in *StackInstallSpec) DeepCopyInto(out *StackInstallSpec) {
 	*out = *in
 	in.StackControllerOptions.DeepCopyInto(&out.StackControllerOptions)
+	if in.SignatureVerification != nil {
+		in, out := &in.SignatureVerification, &out.SignatureVerification
+		*out = new(SignatureVerification)
+		**out = **in
+	}
+	if in.PackageSource != nil {
+		in, out := &in.PackageSource, &out.PackageSource
+		*out = new(PackageSource)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackInstallSpec.
@@ -618,6 +742,25 @@ func (in *StackInstallStatus) DeepCopyInto(out *StackInstallStatus) {
 		*out = new(v1.ObjectReference)
 		**out = **in
 	}
+	if in.Dependencies != nil {
+		in, out := &in.Dependencies, &out.Dependencies
+		*out = make([]v1.ObjectReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.CurrentVersion != nil {
+		in, out := &in.CurrentVersion, &out.CurrentVersion
+		*out = new(StackVersion)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PreviousVersion != nil {
+		in, out := &in.PreviousVersion, &out.PreviousVersion
+		*out = new(StackVersion)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LastUpgradeCheck != nil {
+		in, out := &in.LastUpgradeCheck, &out.LastUpgradeCheck
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackInstallStatus.
@@ -682,6 +825,88 @@ func (in *StackResourceEngineConfiguration) DeepCopy() *StackResourceEngineConfi
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackRevision) DeepCopyInto(out *StackRevision) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackRevision.
+func (in *StackRevision) DeepCopy() *StackRevision {
+	if in == nil {
+		return nil
+	}
+	out := new(StackRevision)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *StackRevision) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackRevisionList) DeepCopyInto(out *StackRevisionList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]StackRevision, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackRevisionList.
+func (in *StackRevisionList) DeepCopy() *StackRevisionList {
+	if in == nil {
+		return nil
+	}
+	out := new(StackRevisionList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *StackRevisionList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackRevisionSpec) DeepCopyInto(out *StackRevisionSpec) {
+	*out = *in
+	in.StackVersion.DeepCopyInto(&out.StackVersion)
+	in.Stack.DeepCopyInto(&out.Stack)
+	if in.CRDs != nil {
+		in, out := &in.CRDs, &out.CRDs
+		*out = make([]runtime.RawExtension, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackRevisionSpec.
+func (in *StackRevisionSpec) DeepCopy() *StackRevisionSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(StackRevisionSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StackSpec) DeepCopyInto(out *StackSpec) {
 	*out = *in
@@ -693,6 +918,11 @@ func (in *StackSpec) DeepCopyInto(out *StackSpec) {
 	}
 	in.Controller.DeepCopyInto(&out.Controller)
 	in.Permissions.DeepCopyInto(&out.Permissions)
+	if in.Webhooks != nil {
+		in, out := &in.Webhooks, &out.Webhooks
+		*out = new(WebhooksSpec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackSpec.
@@ -714,6 +944,11 @@ func (in *StackStatus) DeepCopyInto(out *StackStatus) {
 		*out = new(v1.ObjectReference)
 		**out = **in
 	}
+	if in.ControllerRefs != nil {
+		in, out := &in.ControllerRefs, &out.ControllerRefs
+		*out = make([]v1.ObjectReference, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackStatus.
@@ -725,3 +960,52 @@ func (in *StackStatus) DeepCopy() *StackStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackVersion) DeepCopyInto(out *StackVersion) {
+	*out = *in
+	if in.PackageSource != nil {
+		in, out := &in.PackageSource, &out.PackageSource
+		*out = new(PackageSource)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackVersion.
+func (in *StackVersion) DeepCopy() *StackVersion {
+	if in == nil {
+		return nil
+	}
+	out := new(StackVersion)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebhooksSpec) DeepCopyInto(out *WebhooksSpec) {
+	*out = *in
+	if in.Validating != nil {
+		in, out := &in.Validating, &out.Validating
+		*out = make([]v1beta1.ValidatingWebhook, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Mutating != nil {
+		in, out := &in.Mutating, &out.Mutating
+		*out = make([]v1beta1.MutatingWebhook, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebhooksSpec.
+func (in *WebhooksSpec) DeepCopy() *WebhooksSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(WebhooksSpec)
+	in.DeepCopyInto(out)
+	return out
+}
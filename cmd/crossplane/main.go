@@ -70,10 +70,46 @@ func main() {
 		//
 		// Unpack does not interact with the Kubernetes API.
 		extUnpackCmd                 = extCmd.Command("unpack", "Unpack a Stack").Alias("unstack")
-		extUnpackDir                 = extUnpackCmd.Flag("content-dir", "The absolute path of the directory that contains the stack contents").Required().String()
-		extUnpackOutfile             = extUnpackCmd.Flag("outfile", "The file where the YAML Stack record and CRD artifacts will be written").String()
+		extUnpackDir                 = extUnpackCmd.Flag("content-dir", "The absolute path of the directory that contains the stack contents. Defaults to "+stack.RegistryDirName+" when --image-tarball is set. When reading from a Git repository or archive, the path within the repository or archive, which defaults to its root.").String()
+		extUnpackImageTarball        = extUnpackCmd.Flag("image-tarball", "The path of an OCI image layout or `docker save` tarball to read the stack contents from, rather than the local filesystem").ExistingFileOrDir()
+		extUnpackGitURL              = extUnpackCmd.Flag("git-url", "The URL of a Git repository to read the stack contents from, rather than the local filesystem").String()
+		extUnpackGitRef              = extUnpackCmd.Flag("git-ref", "The branch, tag, or commit of the Git repository to read. Defaults to the default branch.").String()
+		extUnpackArchiveURL          = extUnpackCmd.Flag("archive-url", "The HTTP(S) URL of a tarball to read the stack contents from, rather than the local filesystem").String()
+		extUnpackArchiveSHA256       = extUnpackCmd.Flag("archive-sha256", "The hex encoded SHA-256 checksum the tarball must match (required with --archive-url)").String()
+		extUnpackOutfile             = extUnpackCmd.Flag("outfile", "The file where the Stack record and CRD artifacts will be written").String()
+		extUnpackOutputFormat        = extUnpackCmd.Flag("output-format", "The format the Stack record and CRD artifacts will be written in").Default(stack.OutputFormatYAML).Enum(stack.OutputFormats...)
+		extUnpackTrustedKeysDir      = extUnpackCmd.Flag("trusted-keys-dir", "The path of a directory of PEM encoded public keys that are trusted to sign stacks. A stack that includes a signature must be signed by one of these keys.").ExistingDir()
+		extUnpackRequireSignature    = extUnpackCmd.Flag("require-signature", "Refuse to unpack stacks that are not signed by a trusted key").Bool()
 		extUnpackPermissionScope     = extUnpackCmd.Flag("permission-scope", "The permission-scope that the stack must request (Namespaced, Cluster)").Default("Namespaced").String()
 		extUnpackTemplatesController = extUnpackCmd.Flag("templating-controller-image", "The image of the Template Stacks controller").Default("").String()
+		extUnpackMaxPackageSize      = extUnpackCmd.Flag("max-package-size", "The maximum size of all stack content files combined, e.g. 64MiB. 0B disables the limit.").Default("64MiB").Bytes()
+		extUnpackMaxFileSize         = extUnpackCmd.Flag("max-file-size", "The maximum size of any one stack content file, e.g. 16MiB. 0B disables the limit.").Default("16MiB").Bytes()
+		extUnpackMaxIconSize         = extUnpackCmd.Flag("max-icon-size", "The maximum size of a stack icon file, e.g. 128KiB. 0B disables the limit.").Default("128KiB").Bytes()
+
+		// Validate the given stack package content, reporting every problem
+		// that unpack would fail on. This command is intended for stack
+		// authors and CI pipelines, and exits non-zero if any problems are
+		// found.
+		//
+		// Validate does not interact with the Kubernetes API.
+		extValidateCmd             = extCmd.Command("validate", "Validate the contents of a Stack")
+		extValidateDir             = extValidateCmd.Flag("content-dir", "The absolute path of the directory that contains the stack contents").Required().String()
+		extValidatePermissionScope = extValidateCmd.Flag("permission-scope", "The permission-scope that the stack must request (Namespaced, Cluster). Any valid scope is accepted if unset.").String()
+		extValidateOutputFormat    = extValidateCmd.Flag("output-format", "The format of the validation report").Default(stack.ValidationFormatText).Enum(stack.ValidationFormatText, stack.ValidationFormatJSON)
+
+		// Build an image from the given stack package content without the
+		// need for a Dockerfile or container runtime. The image is written in
+		// OCI image layout format, and building the same content always
+		// produces the same image. This command is intended for stack authors
+		// and CI pipelines.
+		//
+		// Build does not interact with the Kubernetes API.
+		extBuildCmd             = extCmd.Command("build", "Build a Stack image from the contents of a directory")
+		extBuildDir             = extBuildCmd.Flag("content-dir", "The absolute path of the directory that contains the stack contents").Required().ExistingDir()
+		extBuildOutput          = extBuildCmd.Flag("output", "The directory the OCI image layout will be written to. It must not exist or must be empty.").Short('o').Required().String()
+		extBuildBaseImage       = extBuildCmd.Flag("base-image", "The path of an OCI image layout directory containing the image to build the stack image on. Stack images that will be installed must provide `cp`.").ExistingDir()
+		extBuildTag             = extBuildCmd.Flag("tag", "The tag recorded as the reference name of the image in the OCI image layout").String()
+		extBuildPermissionScope = extBuildCmd.Flag("permission-scope", "The permission-scope that the stack must request (Namespaced, Cluster). Any valid scope is accepted if unset.").String()
 	)
 	cmd := kingpin.MustParse(app.Parse(os.Args[1:]))
 
@@ -146,8 +182,78 @@ func main() {
 
 		// TODO(displague) afero.NewBasePathFs could avoid the need to track Base
 		fs := afero.NewOsFs()
-		rd := &walker.ResourceDir{Base: filepath.Clean(*extUnpackDir), Walker: afero.Afero{Fs: fs}}
-		kingpin.FatalIfError(stack.Unpack(rd, outFile, rd.Base, *extUnpackPermissionScope, *extUnpackTemplatesController, log), "failed to unpack stacks")
+		var rw walker.ResourceWalker
+		base := filepath.Clean(*extUnpackDir)
+
+		switch {
+		case *extUnpackImageTarball != "":
+			if *extUnpackDir == "" {
+				base = stack.RegistryDirName
+			}
+			rw = &walker.ResourceImage{Base: base, Image: *extUnpackImageTarball, Fs: fs}
+		case *extUnpackGitURL != "":
+			base = filepath.Join("/", *extUnpackDir)
+			rw = &walker.ResourceGit{URL: *extUnpackGitURL, Ref: *extUnpackGitRef, Base: base}
+		case *extUnpackArchiveURL != "":
+			if *extUnpackArchiveSHA256 == "" {
+				kingpin.Fatalf("--archive-sha256 is required with --archive-url")
+			}
+			base = filepath.Join("/", *extUnpackDir)
+			rw = &walker.ResourceArchive{URL: *extUnpackArchiveURL, SHA256: *extUnpackArchiveSHA256, Base: base}
+		case *extUnpackDir != "":
+			rw = &walker.ResourceDir{Base: base, Walker: afero.Afero{Fs: fs}}
+		default:
+			kingpin.Fatalf("one of --content-dir, --image-tarball, --git-url, or --archive-url is required")
+		}
+
+		opts := []stack.UnpackOption{
+			stack.WithOutputFormat(*extUnpackOutputFormat),
+			stack.WithLimits(stack.UnpackLimits{
+				MaxPackageSize: int64(*extUnpackMaxPackageSize),
+				MaxFileSize:    int64(*extUnpackMaxFileSize),
+				MaxIconSize:    int64(*extUnpackMaxIconSize),
+			}),
+		}
+		if *extUnpackTrustedKeysDir != "" {
+			keys, err := stack.LoadTrustedKeys(fs, *extUnpackTrustedKeysDir)
+			kingpin.FatalIfError(err, "Cannot load trusted keys")
+			opts = append(opts, stack.WithTrustedKeys(keys...))
+		}
+		if *extUnpackRequireSignature {
+			opts = append(opts, stack.WithRequireSignature())
+		}
+
+		kingpin.FatalIfError(stack.Unpack(rw, outFile, base, *extUnpackPermissionScope, *extUnpackTemplatesController, log, opts...), "failed to unpack stacks")
+
+	case extValidateCmd.FullCommand():
+		log := logging.NewLogrLogger(zl.WithName("stacks"))
+
+		fs := afero.NewOsFs()
+		rd := &walker.ResourceDir{Base: filepath.Clean(*extValidateDir), Walker: afero.Afero{Fs: fs}}
+		report, err := stack.Validate(rd, rd.Base, *extValidatePermissionScope, log)
+		kingpin.FatalIfError(err, "failed to validate stack")
+		kingpin.FatalIfError(report.Write(os.Stdout, *extValidateOutputFormat), "failed to write validation report")
+		if !report.Valid() {
+			kingpin.Fatalf("stack is not valid: %d problem(s) found", len(report.Problems))
+		}
+
+	case extBuildCmd.FullCommand():
+		log := logging.NewLogrLogger(zl.WithName("stacks"))
+
+		opts := []stack.BuildOption{}
+		if *extBuildBaseImage != "" {
+			opts = append(opts, stack.WithBaseImage(*extBuildBaseImage))
+		}
+		if *extBuildTag != "" {
+			opts = append(opts, stack.WithImageTag(*extBuildTag))
+		}
+
+		report, err := stack.Build(afero.NewOsFs(), filepath.Clean(*extBuildDir), *extBuildOutput, *extBuildPermissionScope, log, opts...)
+		kingpin.FatalIfError(err, "failed to build stack")
+		if !report.Valid() {
+			kingpin.FatalIfError(report.Write(os.Stderr, stack.ValidationFormatText), "failed to write validation report")
+			kingpin.Fatalf("stack is not valid: %d problem(s) found", len(report.Problems))
+		}
 
 	default:
 		kingpin.FatalUsage("unknown command %s", cmd)
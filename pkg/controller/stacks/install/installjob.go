@@ -17,8 +17,8 @@ limitations under the License.
 package install
 
 import (
-	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"path/filepath"
@@ -28,11 +28,14 @@ import (
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/core/v1"
+	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
@@ -43,13 +46,25 @@ import (
 
 var (
 	jobBackoff                = int32(0)
-	registryDirName           = "/.registry"
+	registryDirName           = stacks.RegistryDirName
 	packageContentsVolumeName = "package-contents"
+	trustedKeysVolumeName     = "trusted-keys"
+	trustedKeysDirName        = "/trusted-keys"
 )
 
+// maxJobOutputSize is the maximum size in bytes of the output of an install
+// job. Stack package content is limited when it is unpacked, but embedded
+// icons are base64 encoded and may appear in several objects, so the output
+// may be larger than the package.
+const maxJobOutputSize = 4 * stacks.DefaultMaxPackageSize
+
 // JobCompleter is an interface for handling job completion
 type jobCompleter interface {
 	handleJobCompletion(ctx context.Context, i v1alpha1.StackInstaller, job *batchv1.Job) error
+	revisionFromJob(ctx context.Context, i v1alpha1.StackInstaller, job *batchv1.Job) (*v1alpha1.StackRevision, error)
+	checkRevision(ctx context.Context, rev *v1alpha1.StackRevision) ([]string, error)
+	applyRevision(ctx context.Context, rev *v1alpha1.StackRevision) error
+	summarizePermissions(ctx context.Context, i v1alpha1.StackInstaller, job *batchv1.Job) (string, error)
 }
 
 // StackInstallJobCompleter is a concrete implementation of the jobCompleter interface
@@ -58,6 +73,10 @@ type stackInstallJobCompleter struct {
 	hostClient   client.Client
 	podLogReader Reader
 	log          logging.Logger
+
+	// output caches the decoded output of each job that has been read, so
+	// that the output is read from the job's pod logs once per reconcile.
+	output map[types.NamespacedName][]*unstructured.Unstructured
 }
 
 type prepareInstallJobParams struct {
@@ -71,10 +90,12 @@ type prepareInstallJobParams struct {
 	imagePullPolicy        corev1.PullPolicy
 	labels                 map[string]string
 	imagePullSecrets       []corev1.LocalObjectReference
+	signatureVerification  *v1alpha1.SignatureVerification
+	packageSource          *v1alpha1.PackageSource
 }
 
 func prepareInstallJob(p prepareInstallJobParams) *batchv1.Job {
-	return &batchv1.Job{
+	job := &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      p.name,
 			Namespace: p.namespace,
@@ -114,6 +135,7 @@ func prepareInstallJob(p prepareInstallJobParams) *batchv1.Job {
 								fmt.Sprintf("--content-dir=%s", filepath.Join("/ext-pkg", registryDirName)),
 								"--permission-scope=" + p.permissionScope,
 								"--templating-controller-image=" + p.tscImage,
+								"--output-format=" + stacks.OutputFormatJSONLines,
 							},
 							VolumeMounts: []corev1.VolumeMount{
 								{
@@ -141,42 +163,369 @@ func prepareInstallJob(p prepareInstallJobParams) *batchv1.Job {
 			},
 		},
 	}
+
+	if src := p.packageSource; src != nil {
+		usePackageSource(job, src)
+	}
+
+	if sv := p.signatureVerification; sv != nil {
+		addSignatureVerification(job, sv)
+	}
+
+	return job
+}
+
+// validatePackageSource returns an error unless exactly one source of the
+// supplied package source is specified.
+func validatePackageSource(src *v1alpha1.PackageSource) error {
+	if src == nil {
+		return nil
+	}
+	if (src.Git == nil) == (src.HTTP == nil) {
+		return errors.New("exactly one of git or http must be specified by packageSource")
+	}
+	return nil
+}
+
+// usePackageSource configures the unpack container of the install job to
+// read the stack package directly from the supplied source, rather than from
+// a copy of the stack image contents.
+func usePackageSource(job *batchv1.Job, src *v1alpha1.PackageSource) {
+	spec := &job.Spec.Template.Spec
+	spec.InitContainers = nil
+	spec.Volumes = nil
+
+	c := &spec.Containers[0]
+	c.VolumeMounts = nil
+	c.Env = nil
+
+	args := []string{}
+	for _, a := range c.Args {
+		if !strings.HasPrefix(a, "--content-dir=") {
+			args = append(args, a)
+		}
+	}
+
+	dir := ""
+	switch {
+	case src.Git != nil:
+		args = append(args, "--git-url="+src.Git.URL)
+		if src.Git.Ref != "" {
+			args = append(args, "--git-ref="+src.Git.Ref)
+		}
+		dir = src.Git.Path
+	case src.HTTP != nil:
+		args = append(args, "--archive-url="+src.HTTP.URL, "--archive-sha256="+src.HTTP.SHA256)
+		dir = src.HTTP.Path
+	}
+	if dir != "" {
+		args = append(args, "--content-dir="+dir)
+	}
+	c.Args = args
+}
+
+// addSignatureVerification mounts the trusted keys ConfigMap into the unpack
+// container of the install job and instructs unpack to verify the stack
+// package signature against them.
+func addSignatureVerification(job *batchv1.Job, sv *v1alpha1.SignatureVerification) {
+	spec := &job.Spec.Template.Spec
+	spec.Volumes = append(spec.Volumes, corev1.Volume{
+		Name: trustedKeysVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: sv.TrustedKeysConfigMap},
+			},
+		},
+	})
+
+	c := &spec.Containers[0]
+	c.VolumeMounts = append(c.VolumeMounts, corev1.VolumeMount{
+		Name:      trustedKeysVolumeName,
+		MountPath: trustedKeysDirName,
+		ReadOnly:  true,
+	})
+	c.Args = append(c.Args, "--trusted-keys-dir="+trustedKeysDirName)
+	if sv.Required {
+		c.Args = append(c.Args, "--require-signature")
+	}
 }
 
+// handleJobCompletion creates the resources in the output of the supplied
+// job. The Stack is the last resource in the output, so it is not created if
+// an earlier resource could not be.
 func (jc *stackInstallJobCompleter) handleJobCompletion(ctx context.Context, i v1alpha1.StackInstaller, job *batchv1.Job) error {
-	// find the pod associated with the given job
-	podName, err := jc.findPodNameForJob(ctx, job)
+	return jc.forEachJobOutputObject(ctx, job, func(obj *unstructured.Unstructured) error {
+		// process and create the object that we just decoded
+		return jc.createJobOutputObject(ctx, obj, i, job)
+	})
+}
+
+// revisionFromJob returns a revision of the stack that records the resources
+// in the output of the supplied job, as they would be installed by the
+// supplied install. The revision is not numbered.
+func (jc *stackInstallJobCompleter) revisionFromJob(ctx context.Context, i v1alpha1.StackInstaller, job *batchv1.Job) (*v1alpha1.StackRevision, error) {
+	rev := &v1alpha1.StackRevision{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            job.Name,
+			Namespace:       i.GetNamespace(),
+			Labels:          stacks.ParentLabels(i),
+			OwnerReferences: []metav1.OwnerReference{meta.AsController(meta.ReferenceTo(i, i.GroupVersionKind()))},
+		},
+		Spec: v1alpha1.StackRevisionSpec{
+			StackVersion: v1alpha1.StackVersion{
+				Package:       i.GetPackage(),
+				PackageSource: i.GetPackageSource().DeepCopy(),
+				ImageDigest:   i.ImageDigest(),
+			},
+		},
+	}
+
+	err := jc.forEachJobOutputObject(ctx, job, func(obj *unstructured.Unstructured) error {
+		if err := prepareJobOutputObject(obj, i); err != nil {
+			return err
+		}
+		raw, err := obj.MarshalJSON()
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse output from job %s", job.Name)
+		}
+
+		switch {
+		case isStackObject(obj) || isStackDefinitionObject(obj):
+			rev.Spec.Version, _, _ = unstructured.NestedString(obj.Object, "spec", "version")
+			rev.Spec.Digest = obj.GetAnnotations()[stacks.AnnotationPackageDigest]
+			rev.Spec.Stack = runtime.RawExtension{Raw: raw}
+		case obj.GetKind() == "CustomResourceDefinition":
+			rev.Spec.CRDs = append(rev.Spec.CRDs, runtime.RawExtension{Raw: raw})
+		}
+		return nil
+	})
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if rev.Spec.Stack.Raw == nil {
+		return nil, errors.Errorf("output from job %s does not contain a Stack", job.Name)
+	}
+	return rev, nil
+}
+
+// checkRevision returns a description of each unsafe change that installing
+// the supplied revision would make to the CRDs that are currently installed.
+func (jc *stackInstallJobCompleter) checkRevision(ctx context.Context, rev *v1alpha1.StackRevision) ([]string, error) {
+	issues := []string{}
+	for _, raw := range rev.Spec.CRDs {
+		crd := &apiextensions.CustomResourceDefinition{}
+		if err := json.Unmarshal(raw.Raw, crd); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse CRD from stack revision %s", rev.GetName())
+		}
+		crdIssues, err := jc.checkCRDUpgrade(ctx, crd)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, crdIssues...)
+	}
+	return issues, nil
+}
+
+// checkCRDUpgrade returns a description of each unsafe change the supplied CRD
+// would make to the installed CRD of the same name. A CRD that is not yet
+// installed cannot be changed unsafely.
+func (jc *stackInstallJobCompleter) checkCRDUpgrade(ctx context.Context, upgraded *apiextensions.CustomResourceDefinition) ([]string, error) {
+	current := &apiextensions.CustomResourceDefinition{}
+	if err := jc.client.Get(ctx, types.NamespacedName{Name: upgraded.GetName()}, current); err != nil {
+		if kerrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to get CRD %s", upgraded.GetName())
 	}
 
-	// read full output from job by retrieving the logs for the job's pod
-	b, err := jc.readPodLogs(job.Namespace, podName)
+	hasObjects, err := jc.crdHasObjects(ctx, current)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return stacks.CRDUpgradeIssues(current, upgraded, hasObjects), nil
+}
 
-	// decode and process all resources from job output
-	d := yaml.NewYAMLOrJSONDecoder(b, 4096)
-	for {
+// crdHasObjects returns true if any objects of the supplied CRD exist. A CRD
+// that serves no versions is assumed to have objects, because they cannot be
+// listed.
+func (jc *stackInstallJobCompleter) crdHasObjects(ctx context.Context, crd *apiextensions.CustomResourceDefinition) (bool, error) {
+	version := ""
+	for _, v := range crd.Spec.Versions {
+		if v.Served {
+			version = v.Name
+			break
+		}
+	}
+	if len(crd.Spec.Versions) == 0 {
+		version = crd.Spec.Version
+	}
+	if version == "" {
+		return true, nil
+	}
+
+	listKind := crd.Spec.Names.ListKind
+	if listKind == "" {
+		listKind = crd.Spec.Names.Kind + "List"
+	}
+	l := &unstructured.UnstructuredList{}
+	l.SetGroupVersionKind(schema.GroupVersionKind{Group: crd.Spec.Group, Version: version, Kind: listKind})
+	if err := jc.client.List(ctx, l, client.Limit(1)); err != nil {
+		return false, errors.Wrapf(err, "failed to list objects of CRD %s", crd.GetName())
+	}
+	return len(l.Items) > 0, nil
+}
+
+// applyRevision creates or updates the resources recorded by the supplied
+// revision, so that they match the revision. The CRDs are applied before the
+// Stack, as they are in the output of an install job.
+func (jc *stackInstallJobCompleter) applyRevision(ctx context.Context, rev *v1alpha1.StackRevision) error {
+	for _, raw := range append(append([]runtime.RawExtension{}, rev.Spec.CRDs...), rev.Spec.Stack) {
 		obj := &unstructured.Unstructured{}
-		if err := d.Decode(&obj); err != nil {
-			if err == io.EOF {
-				// we reached the end of the job output
-				break
-			}
-			return errors.Wrapf(err, "failed to parse output from job %s", job.Name)
+		if err := obj.UnmarshalJSON(raw.Raw); err != nil {
+			return errors.Wrapf(err, "failed to parse stack revision %s", rev.GetName())
+		}
+		if err := jc.applyRevisionObject(ctx, obj, rev); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		// process and create the object that we just decoded
-		if err := jc.createJobOutputObject(ctx, obj, i, job); err != nil {
+// summarizePermissions returns a human-readable summary of the permissions
+// the Stack in the job output will be granted once it is created.
+func (jc *stackInstallJobCompleter) summarizePermissions(ctx context.Context, i v1alpha1.StackInstaller, job *batchv1.Job) (string, error) {
+	ps := &permissionsSummarizer{}
+	if err := jc.forEachJobOutputObject(ctx, job, ps.add); err != nil {
+		return "", err
+	}
+	if ps.stack == nil {
+		return "", errors.Errorf("output from job %s does not contain a Stack", job.Name)
+	}
+	return ps.summary(i), nil
+}
+
+// A permissionsSummarizer collects the Stack, or StackDefinition, and CRDs of
+// a stack package in order to summarize the permissions the Stack will be
+// granted.
+type permissionsSummarizer struct {
+	stack *v1alpha1.Stack
+	crds  []apiextensions.CustomResourceDefinition
+}
+
+// add collects the supplied object if it is needed to summarize permissions.
+func (ps *permissionsSummarizer) add(obj *unstructured.Unstructured) error {
+	switch {
+	case isStackObject(obj):
+		st, err := convertToStack(obj)
+		if err != nil {
 			return err
 		}
+		ps.stack = st
+	case isStackDefinitionObject(obj):
+		sd, err := convertToStackDefinition(obj)
+		if err != nil {
+			return err
+		}
+		// The StackDefinition controller creates a Stack with the
+		// same spec.
+		ps.stack = &v1alpha1.Stack{Spec: sd.Spec.StackSpec}
+	case obj.GetKind() == "CustomResourceDefinition":
+		crd := apiextensions.CustomResourceDefinition{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), &crd); err != nil {
+			return errors.Wrapf(err, "failed to parse CRD %s", obj.GetName())
+		}
+		// Only the names and subresources of the CRD are needed to
+		// summarize permissions; drop the rest, such as schemas, to
+		// bound memory use.
+		versions := make([]apiextensions.CustomResourceDefinitionVersion, len(crd.Spec.Versions))
+		for i, v := range crd.Spec.Versions {
+			versions[i] = apiextensions.CustomResourceDefinitionVersion{Name: v.Name, Subresources: v.Subresources}
+		}
+		ps.crds = append(ps.crds, apiextensions.CustomResourceDefinition{
+			Spec: apiextensions.CustomResourceDefinitionSpec{
+				Group:        crd.Spec.Group,
+				Names:        crd.Spec.Names,
+				Versions:     versions,
+				Subresources: crd.Spec.Subresources,
+			},
+		})
 	}
+	return nil
+}
+
+// summary returns a human-readable summary of the permissions the collected
+// Stack will be granted once it is created by the supplied install.
+func (ps *permissionsSummarizer) summary(i v1alpha1.StackInstaller) string {
+	s := ps.stack.DeepCopy()
+
+	// The Stack is named for the install that creates it.
+	s.SetName(i.GetName())
+	s.SetNamespace(i.GetNamespace())
+	return stacks.PermissionsSummary(s, ps.crds)
+}
 
+// forEachJobOutputObject calls fn with a copy of each resource in the output
+// of the supplied job, in order. Calls stop at the first error.
+func (jc *stackInstallJobCompleter) forEachJobOutputObject(ctx context.Context, job *batchv1.Job, fn func(obj *unstructured.Unstructured) error) error {
+	objs, err := jc.jobOutput(ctx, job)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objs {
+		if err := fn(obj.DeepCopy()); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// jobOutput returns the resources decoded from the output of the supplied
+// job. The output is streamed from the logs of the job's pod, and decoded one
+// resource at a time, the first time it is requested. Subsequent requests
+// return the resources decoded by the first.
+func (jc *stackInstallJobCompleter) jobOutput(ctx context.Context, job *batchv1.Job) ([]*unstructured.Unstructured, error) {
+	nn := types.NamespacedName{Namespace: job.Namespace, Name: job.Name}
+	if objs, ok := jc.output[nn]; ok {
+		return objs, nil
+	}
+
+	// find the pod associated with the given job
+	podName, err := jc.findPodNameForJob(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+
+	// stream the output from the job by reading the logs for the job's pod
+	logs, err := jc.readPodLogs(job.Namespace, podName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = logs.Close() }()
+
+	r, err := stacks.NewObjectReader(&limitedReader{r: logs, limit: maxJobOutputSize})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse output from job %s", job.Name)
+	}
+	objs := []*unstructured.Unstructured{}
+	for {
+		obj, err := r.Read()
+		if err == io.EOF {
+			// we reached the end of the job output
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse output from job %s", job.Name)
+		}
+		objs = append(objs, obj)
+	}
+
+	if jc.output == nil {
+		jc.output = map[types.NamespacedName][]*unstructured.Unstructured{}
+	}
+	jc.output[nn] = objs
+	return objs, nil
+}
+
 // findPodNameForJob finds the pod name associated with the given job.  Note that this functions
 // assumes only a single pod will be associated with the job.
 func (jc *stackInstallJobCompleter) findPodNameForJob(ctx context.Context, job *batchv1.Job) (string, error) {
@@ -205,24 +554,38 @@ func (jc *stackInstallJobCompleter) findPodsForJob(ctx context.Context, job *bat
 	return podList, nil
 }
 
-func (jc *stackInstallJobCompleter) readPodLogs(namespace, name string) (*bytes.Buffer, error) {
+func (jc *stackInstallJobCompleter) readPodLogs(namespace, name string) (io.ReadCloser, error) {
 	podLogs, err := jc.podLogReader.GetReader(namespace, name)
-	if err != nil {
-		return nil, errors.Wrapf(err, "failed to get logs request stream from pod %s", name)
-	}
-	defer func() { _ = podLogs.Close() }()
+	return podLogs, errors.Wrapf(err, "failed to get logs request stream from pod %s", name)
+}
 
-	b := new(bytes.Buffer)
-	if _, err = io.Copy(b, podLogs); err != nil {
-		return nil, errors.Wrapf(err, "failed to copy logs request stream from pod %s", name)
-	}
+// limitedReader reads from r until limit bytes have been read, after which it
+// returns an error. Unlike io.LimitedReader it does not silently truncate, so
+// that oversized job output cannot be mistaken for complete output.
+type limitedReader struct {
+	r     io.Reader
+	limit int64
+	read  int64
+}
 
-	return b, nil
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.read >= l.limit {
+		// Allow the reader to signal EOF exactly at the limit.
+		if n, err := l.r.Read(make([]byte, 1)); n == 0 && err != nil {
+			return 0, err
+		}
+		return 0, errors.Errorf("job output exceeds the limit of %d bytes", l.limit)
+	}
+	if int64(len(p)) > l.limit-l.read {
+		p = p[:l.limit-l.read]
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	return n, err
 }
 
 // createJobOutputObject names, labels, and creates resources in the API
 // Expected resources are CRD, Stack, & StackDefinition
-// nolint:gocyclo
 func (jc *stackInstallJobCompleter) createJobOutputObject(ctx context.Context, obj *unstructured.Unstructured,
 	i v1alpha1.StackInstaller, job *batchv1.Job) error {
 
@@ -231,6 +594,65 @@ func (jc *stackInstallJobCompleter) createJobOutputObject(ctx context.Context, o
 		return nil
 	}
 
+	if err := prepareJobOutputObject(obj, i); err != nil {
+		return err
+	}
+
+	jc.log.Debug(
+		"creating object from job output",
+		"job", job.Name,
+		"name", obj.GetName(),
+		"namespace", obj.GetNamespace(),
+		"apiVersion", obj.GetAPIVersion(),
+		"kind", obj.GetKind(),
+	)
+	if err := jc.client.Create(ctx, obj); err != nil && !kerrors.IsAlreadyExists(err) {
+		return errors.Wrapf(err, "failed to create object %s from job output %s", obj.GetName(), job.Name)
+	}
+
+	return nil
+}
+
+// applyRevisionObject creates the supplied resource from a stack revision, or
+// updates the existing resource to match it. Labels and annotations of existing
+// resources are merged with those of the revision, so that those added by other
+// stacks, e.g. parent labels of shared CRDs, are preserved.
+func (jc *stackInstallJobCompleter) applyRevisionObject(ctx context.Context, obj *unstructured.Unstructured, rev *v1alpha1.StackRevision) error {
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(obj.GroupVersionKind())
+	err := jc.client.Get(ctx, types.NamespacedName{Name: obj.GetName(), Namespace: obj.GetNamespace()}, existing)
+	if kerrors.IsNotFound(err) {
+		jc.log.Debug("creating object from stack revision", "revision", rev.GetName(), "name", obj.GetName(), "kind", obj.GetKind())
+		return errors.Wrapf(jc.client.Create(ctx, obj), "failed to create object %s from stack revision %s", obj.GetName(), rev.GetName())
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to get object %s from stack revision %s", obj.GetName(), rev.GetName())
+	}
+
+	upgraded := existing.DeepCopy()
+	for k, v := range obj.Object {
+		switch k {
+		case "apiVersion", "kind", "metadata", "status":
+			continue
+		}
+		upgraded.Object[k] = v
+	}
+	meta.AddLabels(upgraded, obj.GetLabels())
+	meta.AddAnnotations(upgraded, obj.GetAnnotations())
+
+	if equality.Semantic.DeepEqual(existing, upgraded) {
+		jc.log.Debug("object from stack revision is unchanged", "revision", rev.GetName(), "name", obj.GetName(), "kind", obj.GetKind())
+		return nil
+	}
+
+	jc.log.Debug("updating object from stack revision", "revision", rev.GetName(), "name", obj.GetName(), "kind", obj.GetKind())
+	return errors.Wrapf(jc.client.Update(ctx, upgraded), "failed to update object %s from stack revision %s", obj.GetName(), rev.GetName())
+}
+
+// prepareJobOutputObject names and labels a Stack or StackDefinition from job
+// output, and configures its controller based on the supplied install. Other
+// resources are left unmodified.
+func prepareJobOutputObject(obj *unstructured.Unstructured, i v1alpha1.StackInstaller) error {
 	// Modify Stack and StackDefinition resources based on StackInstall
 	isStack := isStackObject(obj)
 	isStackDefinition := !isStack && isStackDefinitionObject(obj)
@@ -245,7 +667,10 @@ func (jc *stackInstallJobCompleter) createJobOutputObject(ctx context.Context, o
 			obj.SetNamespace(ns)
 		}
 
-		stackImg := i.GetPackage()
+		stackImg, err := pinnedImage(i, i.GetPackage())
+		if err != nil {
+			return err
+		}
 
 		modifiers := []stackSpecModifier{
 			controllerImageInjector(stackImg),
@@ -269,21 +694,21 @@ func (jc *stackInstallJobCompleter) createJobOutputObject(ctx context.Context, o
 		}
 	}
 
-	jc.log.Debug(
-		"creating object from job output",
-		"job", job.Name,
-		"name", obj.GetName(),
-		"namespace", obj.GetNamespace(),
-		"apiVersion", obj.GetAPIVersion(),
-		"kind", obj.GetKind(),
-	)
-	if err := jc.client.Create(ctx, obj); err != nil && !kerrors.IsAlreadyExists(err) {
-		return errors.Wrapf(err, "failed to create object %s from job output %s", obj.GetName(), job.Name)
-	}
-
 	return nil
 }
 
+// pinnedImage returns the supplied package image pinned to the digest that the
+// install's package was resolved to, if any. An image that cannot be pinned is
+// an error rather than falling back to its mutable tag, which may no longer
+// refer to the image whose digest was resolved and approved.
+func pinnedImage(i v1alpha1.StackInstaller, img string) (string, error) {
+	d := i.ImageDigest()
+	if d == "" || img == "" {
+		return img, nil
+	}
+	return stacks.PinnedImage(img, d)
+}
+
 type imageWithSourcer interface {
 	ImageWithSource(string) (string, error)
 }
@@ -361,6 +786,23 @@ func setupStackController(obj *unstructured.Unstructured, modifiers ...stackSpec
 	return err
 }
 
+// controllerPodSpecs returns the pod specs of every controller of the supplied
+// stack spec; its primary Deployment, any additional Deployments, and any Jobs.
+func controllerPodSpecs(spec *v1alpha1.StackSpec) []*corev1.PodSpec {
+	c := &spec.Controller
+	specs := []*corev1.PodSpec{}
+	if c.Deployment != nil {
+		specs = append(specs, &c.Deployment.Spec.Template.Spec)
+	}
+	for i := range c.Deployments {
+		specs = append(specs, &c.Deployments[i].Spec.Template.Spec)
+	}
+	for i := range c.Jobs {
+		specs = append(specs, &c.Jobs[i].Spec.Template.Spec)
+	}
+	return specs
+}
+
 func controllerEnvSetter(namespace, name string) stackSpecModifier {
 	return func(spec *v1alpha1.StackSpec) error {
 		env := []corev1.EnvVar{{
@@ -371,9 +813,10 @@ func controllerEnvSetter(namespace, name string) stackSpecModifier {
 			Value: name,
 		}}
 
-		if d := spec.Controller.Deployment; d != nil {
-			cs := d.Spec.Template.Spec.Containers
-			cs[0].Env = append(cs[0].Env, env...)
+		for _, ps := range controllerPodSpecs(spec) {
+			if cs := ps.Containers; len(cs) > 0 {
+				cs[0].Env = append(cs[0].Env, env...)
+			}
 		}
 		return nil
 	}
@@ -381,22 +824,19 @@ func controllerEnvSetter(namespace, name string) stackSpecModifier {
 
 func controllerImageSourcer(src imageWithSourcer) stackSpecModifier {
 	return func(spec *v1alpha1.StackSpec) error {
-		d := spec.Controller.Deployment
-		if d == nil {
-			return nil
-		}
-
-		ics := d.Spec.Template.Spec.InitContainers
-		for i := range ics {
-			if img, err := src.ImageWithSource(ics[i].Image); err == nil {
-				ics[i].Image = img
+		for _, ps := range controllerPodSpecs(spec) {
+			ics := ps.InitContainers
+			for i := range ics {
+				if img, err := src.ImageWithSource(ics[i].Image); err == nil {
+					ics[i].Image = img
+				}
 			}
-		}
 
-		cs := d.Spec.Template.Spec.Containers
-		for i := range cs {
-			if img, err := src.ImageWithSource(cs[i].Image); err == nil {
-				cs[i].Image = img
+			cs := ps.Containers
+			for i := range cs {
+				if img, err := src.ImageWithSource(cs[i].Image); err == nil {
+					cs[i].Image = img
+				}
 			}
 		}
 		return nil
@@ -417,18 +857,16 @@ func controllerImageInjector(stackImage string) stackSpecModifier {
 			return nil
 		}
 
-		if d := spec.Controller.Deployment; d != nil {
-			spec := &d.Spec.Template.Spec
-
-			for i := range spec.InitContainers {
-				if spec.InitContainers[i].Image == "" {
-					spec.InitContainers[i].Image = stackImage
+		for _, ps := range controllerPodSpecs(spec) {
+			for i := range ps.InitContainers {
+				if ps.InitContainers[i].Image == "" {
+					ps.InitContainers[i].Image = stackImage
 				}
 			}
 
-			for i := range spec.Containers {
-				if spec.Containers[i].Image == "" {
-					spec.Containers[i].Image = stackImage
+			for i := range ps.Containers {
+				if ps.Containers[i].Image == "" {
+					ps.Containers[i].Image = stackImage
 				}
 			}
 		}
@@ -439,17 +877,15 @@ func controllerImageInjector(stackImage string) stackSpecModifier {
 
 func controllerPullSetter(imagePullPolicy v1.PullPolicy, imagePullSecrets []v1.LocalObjectReference) stackSpecModifier {
 	return func(spec *v1alpha1.StackSpec) error {
-		if d := spec.Controller.Deployment; d != nil {
-			spec := &d.Spec.Template.Spec
-
-			spec.ImagePullSecrets = append(spec.ImagePullSecrets, imagePullSecrets...)
+		for _, ps := range controllerPodSpecs(spec) {
+			ps.ImagePullSecrets = append(ps.ImagePullSecrets, imagePullSecrets...)
 
-			for i := range spec.InitContainers {
-				spec.InitContainers[i].ImagePullPolicy = imagePullPolicy
+			for i := range ps.InitContainers {
+				ps.InitContainers[i].ImagePullPolicy = imagePullPolicy
 			}
 
-			for i := range spec.Containers {
-				spec.Containers[i].ImagePullPolicy = imagePullPolicy
+			for i := range ps.Containers {
+				ps.Containers[i].ImagePullPolicy = imagePullPolicy
 			}
 		}
 
@@ -27,8 +27,10 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -55,6 +57,7 @@ const (
 	stackEnvelopeImage           = "crossplane/sample-stack:latest"
 	stackDefinitionEnvelopeImage = "crossplane/sample-stack-wordpress:0.1.0"
 	crdName                      = "mytypes.samples.upbound.io"
+	imageDigest                  = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
 
 	crdRaw = `---
 apiVersion: apiextensions.k8s.io/v1beta1
@@ -182,10 +185,25 @@ status: {}
 )
 
 var (
-	_            jobCompleter = &stackInstallJobCompleter{}
-	podLogOutput              = crdRaw + "\n" + stackRaw("crossplane/sample-stack:latest")
+	_                     jobCompleter = &stackInstallJobCompleter{}
+	podLogOutput                       = crdRaw + "\n" + stackRaw("crossplane/sample-stack:latest")
+	podLogOutputJSONLines              = jsonLinesRaw(crdRaw, stackRaw("crossplane/sample-stack:latest"))
 )
 
+// jsonLinesRaw returns the supplied YAML documents as stack unpack output in
+// the JSON lines format.
+func jsonLinesRaw(docs ...string) string {
+	out := "# stacks.crossplane.io/unpack-output: jsonl/v1\n"
+	for _, d := range docs {
+		j, err := yaml.ToJSON([]byte(d))
+		if err != nil {
+			panic(err)
+		}
+		out += string(j) + "\n"
+	}
+	return out
+}
+
 func stackRaw(controllerImage string) string {
 	tmpl := `---
 apiVersion: stacks.crossplane.io/v1alpha1
@@ -466,13 +484,33 @@ func unstructuredObj(raw string, uom ...unstructuredObjModifier) *unstructured.U
 }
 
 type mockJobCompleter struct {
-	MockHandleJobCompletion func(ctx context.Context, i v1alpha1.StackInstaller, job *batchv1.Job) error
+	MockHandleJobCompletion  func(ctx context.Context, i v1alpha1.StackInstaller, job *batchv1.Job) error
+	MockRevisionFromJob      func(ctx context.Context, i v1alpha1.StackInstaller, job *batchv1.Job) (*v1alpha1.StackRevision, error)
+	MockCheckRevision        func(ctx context.Context, rev *v1alpha1.StackRevision) ([]string, error)
+	MockApplyRevision        func(ctx context.Context, rev *v1alpha1.StackRevision) error
+	MockSummarizePermissions func(ctx context.Context, i v1alpha1.StackInstaller, job *batchv1.Job) (string, error)
 }
 
 func (m *mockJobCompleter) handleJobCompletion(ctx context.Context, i v1alpha1.StackInstaller, job *batchv1.Job) error {
 	return m.MockHandleJobCompletion(ctx, i, job)
 }
 
+func (m *mockJobCompleter) revisionFromJob(ctx context.Context, i v1alpha1.StackInstaller, job *batchv1.Job) (*v1alpha1.StackRevision, error) {
+	return m.MockRevisionFromJob(ctx, i, job)
+}
+
+func (m *mockJobCompleter) checkRevision(ctx context.Context, rev *v1alpha1.StackRevision) ([]string, error) {
+	return m.MockCheckRevision(ctx, rev)
+}
+
+func (m *mockJobCompleter) applyRevision(ctx context.Context, rev *v1alpha1.StackRevision) error {
+	return m.MockApplyRevision(ctx, rev)
+}
+
+func (m *mockJobCompleter) summarizePermissions(ctx context.Context, i v1alpha1.StackInstaller, job *batchv1.Job) (string, error) {
+	return m.MockSummarizePermissions(ctx, i, job)
+}
+
 type mockPodLogReader struct {
 	MockGetPodLogReader func(string, string) (io.ReadCloser, error)
 }
@@ -587,7 +625,7 @@ func TestHandleJobCompletion(t *testing.T) {
 			job: job(),
 			want: want{
 				ext: resource(),
-				err: errors.Wrapf(errBoom, "failed to copy logs request stream from pod %s", jobPodName),
+				err: errors.Wrapf(errors.Wrap(errBoom, "could not read output header"), "failed to parse output from job %s", resourceName),
 			},
 		},
 		{
@@ -616,6 +654,32 @@ func TestHandleJobCompletion(t *testing.T) {
 				err: errors.WithStack(errors.Errorf("failed to parse output from job %s: error unmarshaling JSON: while decoding JSON: json: cannot unmarshal string into Go value of type map[string]interface {}", resourceName)),
 			},
 		},
+		{
+			name: "FailToParseJobPodLogOutputVersion",
+			jc: &stackInstallJobCompleter{
+				hostClient: &test.MockClient{
+					MockList: func(ctx context.Context, list runtime.Object, _ ...client.ListOption) error {
+						// LIST pods returns a pod for the job
+						*list.(*corev1.PodList) = corev1.PodList{
+							Items: []corev1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: jobPodName}}},
+						}
+						return nil
+					},
+				},
+				podLogReader: &mockPodLogReader{
+					MockGetPodLogReader: func(string, string) (io.ReadCloser, error) {
+						return ioutil.NopCloser(strings.NewReader("# stacks.crossplane.io/unpack-output: yaml/v2\n" + podLogOutput)), nil
+					},
+				},
+				log: logging.NewNopLogger(),
+			},
+			ext: resource(),
+			job: job(),
+			want: want{
+				ext: resource(),
+				err: errors.Wrapf(errors.New(`unsupported output version "yaml/v2", expected format/v1`), "failed to parse output from job %s", resourceName),
+			},
+		},
 		{
 			name: "FailToCreate",
 			jc: &stackInstallJobCompleter{
@@ -686,6 +750,45 @@ func TestHandleJobCompletion(t *testing.T) {
 				err: nil,
 			},
 		},
+		{
+			name: "HandleJobCompletionJSONLines",
+			jc: &stackInstallJobCompleter{
+				client: &test.MockClient{
+					MockCreate: func(ctx context.Context, obj runtime.Object, _ ...client.CreateOption) error {
+						return nil
+					},
+					MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+						// GET stack returns the stack instance that was created from the pod log output
+						*obj.(*v1alpha1.Stack) = v1alpha1.Stack{
+							ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: namespace},
+						}
+						return nil
+					},
+					MockStatusUpdate: func(ctx context.Context, obj runtime.Object, _ ...client.UpdateOption) error { return nil },
+				},
+				hostClient: &test.MockClient{
+					MockList: func(ctx context.Context, list runtime.Object, _ ...client.ListOption) error {
+						// LIST pods returns a pod for the job
+						*list.(*corev1.PodList) = corev1.PodList{
+							Items: []corev1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: jobPodName}}},
+						}
+						return nil
+					},
+				},
+				podLogReader: &mockPodLogReader{
+					MockGetPodLogReader: func(string, string) (io.ReadCloser, error) {
+						return ioutil.NopCloser(bytes.NewReader([]byte(podLogOutputJSONLines))), nil
+					},
+				},
+				log: logging.NewNopLogger(),
+			},
+			ext: resource(),
+			job: job(),
+			want: want{
+				ext: resource(),
+				err: nil,
+			},
+		},
 		{
 			name: "HandleJobCompletionWithSource",
 			jc: &stackInstallJobCompleter{
@@ -831,6 +934,12 @@ func TestHandleJobCompletion(t *testing.T) {
 	}
 }
 
+type digestResolverFn func(ctx context.Context, image string, auth stacks.RegistryAuth) (string, error)
+
+func (fn digestResolverFn) ResolveDigest(ctx context.Context, image string, auth stacks.RegistryAuth) (string, error) {
+	return fn(ctx, image, auth)
+}
+
 func TestCreate(t *testing.T) {
 	type want struct {
 		result reconcile.Result
@@ -841,6 +950,19 @@ func TestCreate(t *testing.T) {
 	noJobs := func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
 		return kerrors.NewNotFound(schema.GroupResource{Group: "batch", Resource: "Job"}, key.String())
 	}
+	installed := &v1alpha1.StackVersion{Version: "1.0.0", Revision: 1}
+	resolved := digestResolverFn(func(_ context.Context, _ string, _ stacks.RegistryAuth) (string, error) {
+		return imageDigest, nil
+	})
+	revisionFromJob := func(_ context.Context, _ v1alpha1.StackInstaller, job *batchv1.Job) (*v1alpha1.StackRevision, error) {
+		return &v1alpha1.StackRevision{
+			ObjectMeta: metav1.ObjectMeta{Name: job.GetName(), Namespace: namespace},
+			Spec:       v1alpha1.StackRevisionSpec{StackVersion: v1alpha1.StackVersion{Version: installed.Version}},
+		}, nil
+	}
+	summarizePermissions := func(_ context.Context, _ v1alpha1.StackInstaller, _ *batchv1.Job) (string, error) {
+		return "summary", nil
+	}
 
 	tests := []struct {
 		name    string
@@ -857,19 +979,28 @@ func TestCreate(t *testing.T) {
 					MockStatusUpdate: func(ctx context.Context, obj runtime.Object, _ ...client.UpdateOption) error { return nil },
 				},
 				hostKube: &test.MockClient{
-					MockGet:    noJobs,
-					MockCreate: func(ctx context.Context, obj runtime.Object, _ ...client.CreateOption) error { return nil },
+					MockGet: noJobs,
+					MockCreate: func(ctx context.Context, obj runtime.Object, _ ...client.CreateOption) error {
+						want := stackEnvelopeImage + "@" + imageDigest
+						if got := obj.(*batchv1.Job).Spec.Template.Spec.InitContainers[0].Image; got != want {
+							return errors.Errorf("want install job image %q, got %q", want, got)
+						}
+						return nil
+					},
 				},
-				executorInfo: &stacks.ExecutorInfo{Image: stackPackageImage},
-				ext:          resource(),
-				log:          logging.NewNopLogger(),
+				digestResolver: resolved,
+				executorInfo:   &stacks.ExecutorInfo{Image: stackPackageImage},
+				ext:            resource(withPackage(stackEnvelopeImage)),
+				log:            logging.NewNopLogger(),
 			},
 			want: want{
 				result: requeueOnSuccess,
 				err:    nil,
 				ext: resource(
 					withFinalizers(installFinalizer),
-					withConditions(runtimev1alpha1.Creating(), runtimev1alpha1.ReconcileSuccess()),
+					withPackage(stackEnvelopeImage),
+					withImageDigest(imageDigest),
+					withConditions(runtimev1alpha1.Creating(), v1alpha1.ImagePinned(), runtimev1alpha1.ReconcileSuccess()),
 					withInstallJob(&corev1.ObjectReference{Name: resourceName, Namespace: namespace}),
 				),
 			},
@@ -903,6 +1034,79 @@ func TestCreate(t *testing.T) {
 				),
 			},
 		},
+		{
+			name: "ResolveDigestFailed",
+			handler: &stackInstallHandler{
+				kube: &test.MockClient{
+					MockPatch: func(_ context.Context, obj runtime.Object, patch client.Patch, _ ...client.PatchOption) error {
+						return nil
+					},
+					MockStatusUpdate: func(ctx context.Context, obj runtime.Object, _ ...client.UpdateOption) error { return nil },
+				},
+				hostKube: &test.MockClient{
+					MockGet: noJobs,
+					MockCreate: func(ctx context.Context, obj runtime.Object, _ ...client.CreateOption) error {
+						want := stackEnvelopeImage
+						if got := obj.(*batchv1.Job).Spec.Template.Spec.InitContainers[0].Image; got != want {
+							return errors.Errorf("want install job image %q, got %q", want, got)
+						}
+						return nil
+					},
+				},
+				digestResolver: digestResolverFn(func(_ context.Context, _ string, _ stacks.RegistryAuth) (string, error) {
+					return "", errBoom
+				}),
+				executorInfo: &stacks.ExecutorInfo{Image: stackPackageImage},
+				ext:          resource(withPackage(stackEnvelopeImage), withImageDigest(imageDigest)),
+				log:          logging.NewNopLogger(),
+			},
+			want: want{
+				result: requeueOnSuccess,
+				err:    nil,
+				ext: resource(
+					withFinalizers(installFinalizer),
+					withPackage(stackEnvelopeImage),
+					withConditions(runtimev1alpha1.Creating(), v1alpha1.ImageUnpinned(errBoom.Error()), runtimev1alpha1.ReconcileSuccess()),
+					withInstallJob(&corev1.ObjectReference{Name: resourceName, Namespace: namespace}),
+				),
+			},
+		},
+		{
+			name: "PinImageFailed",
+			handler: &stackInstallHandler{
+				kube: &test.MockClient{
+					MockPatch: func(_ context.Context, obj runtime.Object, patch client.Patch, _ ...client.PatchOption) error {
+						return nil
+					},
+					MockStatusUpdate: func(ctx context.Context, obj runtime.Object, _ ...client.UpdateOption) error { return nil },
+				},
+				hostKube: &test.MockClient{
+					MockGet: noJobs,
+					MockCreate: func(ctx context.Context, obj runtime.Object, _ ...client.CreateOption) error {
+						return errors.New("install job must not be created with an unpinned image")
+					},
+				},
+				digestResolver: digestResolverFn(func(_ context.Context, _ string, _ stacks.RegistryAuth) (string, error) {
+					return "sha256:invalid", nil
+				}),
+				executorInfo: &stacks.ExecutorInfo{Image: stackPackageImage},
+				ext:          resource(withPackage(stackEnvelopeImage)),
+				log:          logging.NewNopLogger(),
+			},
+			want: want{
+				result: resultRequeue,
+				err:    nil,
+				ext: resource(
+					withFinalizers(installFinalizer),
+					withPackage(stackEnvelopeImage),
+					withImageDigest("sha256:invalid"),
+					withConditions(runtimev1alpha1.Creating(), v1alpha1.ImagePinned(), runtimev1alpha1.ReconcileError(func() error {
+						_, err := stacks.PinnedImage(stackEnvelopeImage, "sha256:invalid")
+						return err
+					}())),
+				),
+			},
+		},
 		{
 			name: "ExistingInstallJobHosted",
 			handler: &stackInstallHandler{
@@ -1027,6 +1231,90 @@ func TestCreate(t *testing.T) {
 						return nil
 					},
 					MockStatusUpdate: func(ctx context.Context, obj runtime.Object, _ ...client.UpdateOption) error { return nil },
+					MockList:         test.NewMockListFn(nil),
+					MockCreate:       test.NewMockCreateFn(nil),
+				},
+				hostKube: &test.MockClient{
+					MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+						// GET Job returns a successful/completed job
+						*obj.(*batchv1.Job) = *(job(withJobConditions(batchv1.JobComplete, "")))
+						return nil
+					},
+				},
+				jobCompleter: &mockJobCompleter{
+					MockHandleJobCompletion:  func(ctx context.Context, i v1alpha1.StackInstaller, job *batchv1.Job) error { return nil },
+					MockRevisionFromJob:      revisionFromJob,
+					MockSummarizePermissions: summarizePermissions,
+				},
+				executorInfo: &stacks.ExecutorInfo{Image: stackPackageImage},
+				ext: resource(
+					withInstallJob(&corev1.ObjectReference{Name: resourceName, Namespace: namespace})),
+				log: logging.NewNopLogger(),
+			},
+			want: want{
+				result: requeueOnSuccess,
+				err:    nil,
+				ext: resource(
+					withFinalizers(installFinalizer),
+					withConditions(runtimev1alpha1.Creating(), runtimev1alpha1.ReconcileSuccess()),
+					withInstallJob(&corev1.ObjectReference{Name: resourceName, Namespace: namespace}),
+					withCurrentVersion(installed),
+					withPermissionsSummary("summary"),
+				),
+			},
+		},
+		{
+			name: "InstallJobAwaitingApproval",
+			handler: &stackInstallHandler{
+				kube: &test.MockClient{
+					MockPatch: func(_ context.Context, obj runtime.Object, patch client.Patch, _ ...client.PatchOption) error {
+						return nil
+					},
+					MockStatusUpdate: func(ctx context.Context, obj runtime.Object, _ ...client.UpdateOption) error { return nil },
+				},
+				hostKube: &test.MockClient{
+					MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+						// GET Job returns a successful/completed job
+						*obj.(*batchv1.Job) = *(job(withJobConditions(batchv1.JobComplete, "")))
+						return nil
+					},
+				},
+				jobCompleter: &mockJobCompleter{
+					MockHandleJobCompletion: func(ctx context.Context, i v1alpha1.StackInstaller, job *batchv1.Job) error {
+						return errors.New("stack created before approval")
+					},
+					MockSummarizePermissions: func(ctx context.Context, i v1alpha1.StackInstaller, job *batchv1.Job) (string, error) {
+						return "summary", nil
+					},
+				},
+				executorInfo: &stacks.ExecutorInfo{Image: stackPackageImage},
+				ext: resource(
+					withApproval(v1alpha1.ApprovalManual, false),
+					withInstallJob(&corev1.ObjectReference{Name: resourceName, Namespace: namespace})),
+				log: logging.NewNopLogger(),
+			},
+			want: want{
+				result: reconcile.Result{},
+				err:    nil,
+				ext: resource(
+					withFinalizers(installFinalizer),
+					withApproval(v1alpha1.ApprovalManual, false),
+					withConditions(runtimev1alpha1.Unavailable().WithMessage(waitingForApproval), runtimev1alpha1.ReconcileSuccess()),
+					withInstallJob(&corev1.ObjectReference{Name: resourceName, Namespace: namespace}),
+					withPermissionsSummary("summary"),
+				),
+			},
+		},
+		{
+			name: "HandleApprovedInstallJob",
+			handler: &stackInstallHandler{
+				kube: &test.MockClient{
+					MockPatch: func(_ context.Context, obj runtime.Object, patch client.Patch, _ ...client.PatchOption) error {
+						return nil
+					},
+					MockStatusUpdate: func(ctx context.Context, obj runtime.Object, _ ...client.UpdateOption) error { return nil },
+					MockList:         test.NewMockListFn(nil),
+					MockCreate:       test.NewMockCreateFn(nil),
 				},
 				hostKube: &test.MockClient{
 					MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
@@ -1037,9 +1325,14 @@ func TestCreate(t *testing.T) {
 				},
 				jobCompleter: &mockJobCompleter{
 					MockHandleJobCompletion: func(ctx context.Context, i v1alpha1.StackInstaller, job *batchv1.Job) error { return nil },
+					MockRevisionFromJob:     revisionFromJob,
+					MockSummarizePermissions: func(ctx context.Context, i v1alpha1.StackInstaller, job *batchv1.Job) (string, error) {
+						return "summary", nil
+					},
 				},
 				executorInfo: &stacks.ExecutorInfo{Image: stackPackageImage},
 				ext: resource(
+					withApproval(v1alpha1.ApprovalManual, true),
 					withInstallJob(&corev1.ObjectReference{Name: resourceName, Namespace: namespace})),
 				log: logging.NewNopLogger(),
 			},
@@ -1048,8 +1341,12 @@ func TestCreate(t *testing.T) {
 				err:    nil,
 				ext: resource(
 					withFinalizers(installFinalizer),
+					withApproval(v1alpha1.ApprovalManual, true),
 					withConditions(runtimev1alpha1.Creating(), runtimev1alpha1.ReconcileSuccess()),
 					withInstallJob(&corev1.ObjectReference{Name: resourceName, Namespace: namespace}),
+					withPermissionsSummary("summary"),
+					withApprovedDigest(approvalDigest(requestedVersion(resource()), "summary")),
+					withCurrentVersion(installed),
 				),
 			},
 		},
@@ -1246,6 +1543,65 @@ func TestCreateJobOutputObject(t *testing.T) {
 				),
 			},
 		},
+		{
+			name: "CreateSuccessfulStackWithPinnedControllerImage",
+			jobCompleter: &stackInstallJobCompleter{
+				client: &test.MockClient{
+					MockCreate: func(ctx context.Context, obj runtime.Object, _ ...client.CreateOption) error { return nil },
+				},
+				log: logging.NewNopLogger(),
+			},
+			stackInstaller: resource(withPackage(stackEnvelopeImage), withImageDigest(imageDigest)),
+			job:            job(),
+			obj:            unstructuredObj(stackRaw("")),
+			want: want{
+				err: nil,
+				obj: unstructuredObj(stackRaw("crossplane/sample-stack:latest@"+imageDigest),
+					withUnstructuredObjLabels(wantedParentLabels),
+					withUnstructuredObjNamespacedName(types.NamespacedName{Namespace: namespace, Name: resourceName}),
+				),
+			},
+		},
+		{
+			name: "CreateSuccessfulStackWithPinnedControllerImageAndSource",
+			jobCompleter: &stackInstallJobCompleter{
+				client: &test.MockClient{
+					MockCreate: func(ctx context.Context, obj runtime.Object, _ ...client.CreateOption) error { return nil },
+				},
+				log: logging.NewNopLogger(),
+			},
+			stackInstaller: resource(withPackage(stackEnvelopeImage), withSource(stackInstallSource), withImageDigest(imageDigest)),
+			job:            job(),
+			obj:            unstructuredObj(stackRaw("")),
+			want: want{
+				err: nil,
+				obj: unstructuredObj(stackRaw(stackInstallSource+"/crossplane/sample-stack:latest@"+imageDigest),
+					withUnstructuredObjLabels(wantedParentLabels),
+					withUnstructuredObjNamespacedName(types.NamespacedName{Namespace: namespace, Name: resourceName}),
+				),
+			},
+		},
+		{
+			name: "CannotPinControllerImage",
+			jobCompleter: &stackInstallJobCompleter{
+				client: &test.MockClient{
+					MockCreate: func(ctx context.Context, obj runtime.Object, _ ...client.CreateOption) error { return nil },
+				},
+				log: logging.NewNopLogger(),
+			},
+			stackInstaller: resource(withPackage(stackEnvelopeImage), withImageDigest("sha256:invalid")),
+			job:            job(),
+			obj:            unstructuredObj(stackRaw("")),
+			want: want{
+				err: func() error {
+					_, err := stacks.PinnedImage(stackEnvelopeImage, "sha256:invalid")
+					return err
+				}(),
+				obj: unstructuredObj(stackRaw(""),
+					withUnstructuredObjNamespacedName(types.NamespacedName{Namespace: namespace, Name: resourceName}),
+				),
+			},
+		},
 		{
 			name: "CreateSuccessfulStackDefinitionWithInjectedControllerImage",
 			jobCompleter: &stackInstallJobCompleter{
@@ -1321,3 +1677,677 @@ func TestCreateJobOutputObject(t *testing.T) {
 		})
 	}
 }
+
+// Test that the install configures every controller of a Stack or
+// StackDefinition; its primary Deployment, additional Deployments, and Jobs.
+func TestPrepareJobOutputObjectControllers(t *testing.T) {
+	podSpec := func() corev1.PodTemplateSpec {
+		return corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "init"}},
+			Containers:     []corev1.Container{{Name: "controller"}},
+		}}
+	}
+	spec := func() v1alpha1.StackSpec {
+		return v1alpha1.StackSpec{Controller: v1alpha1.ControllerSpec{
+			Deployment:  &v1alpha1.ControllerDeployment{Spec: appsv1.DeploymentSpec{Template: podSpec()}},
+			Deployments: []v1alpha1.ControllerDeployment{{Name: "webhook", Spec: appsv1.DeploymentSpec{Template: podSpec()}}},
+			Jobs:        []v1alpha1.ControllerJob{{Name: "migrate", Spec: batchv1.JobSpec{Template: podSpec()}}},
+		}}
+	}
+	secrets := []corev1.LocalObjectReference{{Name: "pull-secret"}}
+	i := resource(
+		withPackage(stackEnvelopeImage),
+		withSource(stackInstallSource),
+		withImageDigest(imageDigest),
+		withImagePullPolicy(corev1.PullAlways),
+		withImagePullSecrets(secrets),
+	)
+
+	stack, err := convertStackToUnstructured(&v1alpha1.Stack{
+		TypeMeta: metav1.TypeMeta{APIVersion: v1alpha1.SchemeGroupVersion.String(), Kind: v1alpha1.StackKind},
+		Spec:     spec(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd, err := convertStackDefinitionToUnstructured(&v1alpha1.StackDefinition{
+		TypeMeta: metav1.TypeMeta{APIVersion: v1alpha1.SchemeGroupVersion.String(), Kind: v1alpha1.StackDefinitionKind},
+		Spec:     v1alpha1.StackDefinitionSpec{StackSpec: spec()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantImage := stackInstallSource + "/" + stackEnvelopeImage + "@" + imageDigest
+	wantEnv := []corev1.EnvVar{
+		{Name: stacks.StackDefinitionNamespaceEnv, Value: namespace},
+		{Name: stacks.StackDefinitionNameEnv, Value: resourceName},
+	}
+
+	cases := map[string]struct {
+		obj     *unstructured.Unstructured
+		spec    func(*unstructured.Unstructured) (*v1alpha1.StackSpec, error)
+		wantEnv []corev1.EnvVar
+	}{
+		"Stack": {
+			obj: stack,
+			spec: func(u *unstructured.Unstructured) (*v1alpha1.StackSpec, error) {
+				s, err := convertToStack(u)
+				if err != nil {
+					return nil, err
+				}
+				return &s.Spec, nil
+			},
+		},
+		"StackDefinition": {
+			obj: sd,
+			spec: func(u *unstructured.Unstructured) (*v1alpha1.StackSpec, error) {
+				sd, err := convertToStackDefinition(u)
+				if err != nil {
+					return nil, err
+				}
+				return &sd.Spec.StackSpec, nil
+			},
+			wantEnv: wantEnv,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if err := prepareJobOutputObject(tc.obj, i); err != nil {
+				t.Fatalf("prepareJobOutputObject(): %s", err)
+			}
+			got, err := tc.spec(tc.obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pss := controllerPodSpecs(got)
+			if len(pss) != 3 {
+				t.Fatalf("prepareJobOutputObject(): want 3 controllers, got %d", len(pss))
+			}
+			for _, ps := range pss {
+				if diff := cmp.Diff(secrets, ps.ImagePullSecrets); diff != "" {
+					t.Errorf("prepareJobOutputObject(): -want pull secrets, +got:\n%s", diff)
+				}
+				for _, c := range append(ps.InitContainers, ps.Containers...) {
+					if c.Image != wantImage {
+						t.Errorf("prepareJobOutputObject(): container %s: want image %q, got %q", c.Name, wantImage, c.Image)
+					}
+					if c.ImagePullPolicy != corev1.PullAlways {
+						t.Errorf("prepareJobOutputObject(): container %s: want pull policy %q, got %q", c.Name, corev1.PullAlways, c.ImagePullPolicy)
+					}
+				}
+				if diff := cmp.Diff(tc.wantEnv, ps.Containers[0].Env); diff != "" {
+					t.Errorf("prepareJobOutputObject(): -want env, +got:\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestRevisionFromJob(t *testing.T) {
+	jobOutput := func(out string) *stackInstallJobCompleter {
+		return &stackInstallJobCompleter{
+			hostClient: &test.MockClient{
+				MockList: func(_ context.Context, list runtime.Object, _ ...client.ListOption) error {
+					*list.(*corev1.PodList) = corev1.PodList{
+						Items: []corev1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: jobPodName}}},
+					}
+					return nil
+				},
+			},
+			podLogReader: &mockPodLogReader{
+				MockGetPodLogReader: func(string, string) (io.ReadCloser, error) {
+					return ioutil.NopCloser(strings.NewReader(out)), nil
+				},
+			},
+			log: logging.NewNopLogger(),
+		}
+	}
+
+	type want struct {
+		meta    metav1.ObjectMeta
+		version v1alpha1.StackVersion
+		stack   string
+		crds    []string
+		err     error
+	}
+
+	cases := map[string]struct {
+		jc   *stackInstallJobCompleter
+		want want
+	}{
+		"Success": {
+			jc: jobOutput(podLogOutput),
+			want: want{
+				meta: metav1.ObjectMeta{
+					Name:            resourceName,
+					Namespace:       namespace,
+					Labels:          stacks.ParentLabels(resource()),
+					OwnerReferences: []metav1.OwnerReference{meta.AsController(meta.ReferenceTo(resource(), v1alpha1.StackInstallGroupVersionKind))},
+				},
+				version: v1alpha1.StackVersion{Package: stackPackageImage, Version: "0.0.1", ImageDigest: imageDigest},
+				stack:   resourceName,
+				crds:    []string{crdName},
+			},
+		},
+		"NoStack": {
+			jc: jobOutput(crdRaw),
+			want: want{
+				err: errors.Errorf("output from job %s does not contain a Stack", resourceName),
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rev, err := tc.jc.revisionFromJob(context.Background(), resource(withPackage(stackPackageImage), withImageDigest(imageDigest)), job())
+
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Fatalf("revisionFromJob(): -want error, +got error:\n%s", diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tc.want.meta, rev.ObjectMeta); diff != "" {
+				t.Errorf("revisionFromJob(): -want meta, +got meta:\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want.version, rev.Spec.StackVersion); diff != "" {
+				t.Errorf("revisionFromJob(): -want version, +got version:\n%s", diff)
+			}
+
+			stack := &unstructured.Unstructured{}
+			if err := stack.UnmarshalJSON(rev.Spec.Stack.Raw); err != nil {
+				t.Fatalf("UnmarshalJSON(...): %s", err)
+			}
+			if stack.GetName() != tc.want.stack {
+				t.Errorf("revisionFromJob(): want Stack named %q, got %q", tc.want.stack, stack.GetName())
+			}
+			crds := []string{}
+			for _, raw := range rev.Spec.CRDs {
+				crd := &unstructured.Unstructured{}
+				if err := crd.UnmarshalJSON(raw.Raw); err != nil {
+					t.Fatalf("UnmarshalJSON(...): %s", err)
+				}
+				crds = append(crds, crd.GetName())
+			}
+			if diff := cmp.Diff(tc.want.crds, crds); diff != "" {
+				t.Errorf("revisionFromJob(): -want CRDs, +got CRDs:\n%s", diff)
+			}
+		})
+	}
+}
+
+// Test that the permissions summary includes the subresources that personas
+// are granted, including those enabled for individual CRD versions.
+func TestSummarizePermissions(t *testing.T) {
+	versionedCRD := crdRaw + `  versions:
+  - name: v1alpha1
+    served: true
+    storage: true
+    subresources:
+      status: {}
+`
+	jc := &stackInstallJobCompleter{
+		hostClient: &test.MockClient{
+			MockList: func(_ context.Context, list runtime.Object, _ ...client.ListOption) error {
+				*list.(*corev1.PodList) = corev1.PodList{
+					Items: []corev1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: jobPodName}}},
+				}
+				return nil
+			},
+		},
+		podLogReader: &mockPodLogReader{
+			MockGetPodLogReader: func(string, string) (io.ReadCloser, error) {
+				return ioutil.NopCloser(strings.NewReader(versionedCRD + "\n" + stackRaw(stackPackageImage))), nil
+			},
+		},
+		log: logging.NewNopLogger(),
+	}
+
+	summary, err := jc.summarizePermissions(context.Background(), resource(), job())
+	if err != nil {
+		t.Fatalf("summarizePermissions(): %s", err)
+	}
+	want := "- get, list, watch on mytypes, mytypes/status in API groups samples.upbound.io\n"
+	if !strings.Contains(summary, want) {
+		t.Errorf("summarizePermissions(): want summary containing %q, got:\n%s", want, summary)
+	}
+}
+
+// Test that the output of a job is read once, and that each consumer of the
+// output is given its own copy of the decoded resources.
+func TestJobOutputReadOnce(t *testing.T) {
+	reads := 0
+	created := []string{}
+	jc := &stackInstallJobCompleter{
+		client: &test.MockClient{
+			MockCreate: func(_ context.Context, obj runtime.Object, _ ...client.CreateOption) error {
+				created = append(created, obj.GetObjectKind().GroupVersionKind().Kind)
+				return nil
+			},
+		},
+		hostClient: &test.MockClient{
+			MockList: func(_ context.Context, list runtime.Object, _ ...client.ListOption) error {
+				*list.(*corev1.PodList) = corev1.PodList{
+					Items: []corev1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: jobPodName}}},
+				}
+				return nil
+			},
+		},
+		podLogReader: &mockPodLogReader{
+			MockGetPodLogReader: func(string, string) (io.ReadCloser, error) {
+				reads++
+				return ioutil.NopCloser(strings.NewReader(crdRaw + "\n" + stackRaw(""))), nil
+			},
+		},
+		log: logging.NewNopLogger(),
+	}
+
+	i := resource(withPackage(stackEnvelopeImage))
+	if _, err := jc.summarizePermissions(context.Background(), i, job()); err != nil {
+		t.Fatalf("summarizePermissions(): %s", err)
+	}
+	if err := jc.handleJobCompletion(context.Background(), i, job()); err != nil {
+		t.Fatalf("handleJobCompletion(): %s", err)
+	}
+	rev, err := jc.revisionFromJob(context.Background(), i, job())
+	if err != nil {
+		t.Fatalf("revisionFromJob(): %s", err)
+	}
+
+	if reads != 1 {
+		t.Errorf("job output was read %d times, want 1", reads)
+	}
+	if diff := cmp.Diff([]string{"CustomResourceDefinition", "Stack"}, created); diff != "" {
+		t.Errorf("handleJobCompletion(): -want created, +got created:\n%s", diff)
+	}
+
+	if rev.Spec.Stack.Raw == nil {
+		t.Errorf("revisionFromJob(): revision does not record a Stack")
+	}
+
+	// Consumers prepare and create their copies of the resources; the
+	// decoded output must not be modified.
+	for _, obj := range jc.output[types.NamespacedName{Namespace: namespace, Name: resourceName}] {
+		if len(obj.GetLabels()) != 0 {
+			t.Errorf("job output %s %s was modified: labels %v", obj.GetKind(), obj.GetName(), obj.GetLabels())
+		}
+	}
+}
+
+// Test that the CRDs of a revision are applied before its Stack.
+func TestApplyRevision(t *testing.T) {
+	rev := &v1alpha1.StackRevision{
+		ObjectMeta: metav1.ObjectMeta{Name: resourceName},
+		Spec: v1alpha1.StackRevisionSpec{
+			Stack: runtime.RawExtension{Raw: []byte(`{"apiVersion":"stacks.crossplane.io/v1alpha1","kind":"Stack","metadata":{"name":"cool-stack"}}`)},
+			CRDs:  []runtime.RawExtension{{Raw: []byte(`{"apiVersion":"apiextensions.k8s.io/v1beta1","kind":"CustomResourceDefinition","metadata":{"name":"mytypes.samples.upbound.io"}}`)}},
+		},
+	}
+
+	created := []string{}
+	jc := &stackInstallJobCompleter{
+		client: &test.MockClient{
+			MockGet: func(_ context.Context, key client.ObjectKey, _ runtime.Object) error {
+				return kerrors.NewNotFound(schema.GroupResource{}, key.Name)
+			},
+			MockCreate: func(_ context.Context, obj runtime.Object, _ ...client.CreateOption) error {
+				created = append(created, obj.GetObjectKind().GroupVersionKind().Kind)
+				return nil
+			},
+		},
+		log: logging.NewNopLogger(),
+	}
+
+	if err := jc.applyRevision(context.Background(), rev); err != nil {
+		t.Fatalf("applyRevision(...): %s", err)
+	}
+	if diff := cmp.Diff([]string{"CustomResourceDefinition", "Stack"}, created); diff != "" {
+		t.Errorf("applyRevision(...): -want created, +got created:\n%s", diff)
+	}
+}
+
+func TestApplyRevisionObject(t *testing.T) {
+	otherParent := map[string]string{"other-parent": "true"}
+	clusterScoped := func(u *unstructured.Unstructured) {
+		_ = unstructured.SetNestedField(u.Object, "Cluster", "spec", "scope")
+	}
+	existing := func(uom ...unstructuredObjModifier) func(context.Context, client.ObjectKey, runtime.Object) error {
+		return func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+			unstructuredObj(crdRaw, uom...).DeepCopyInto(obj.(*unstructured.Unstructured))
+			return nil
+		}
+	}
+
+	type want struct {
+		err     error
+		created *unstructured.Unstructured
+		updated *unstructured.Unstructured
+	}
+
+	cases := map[string]struct {
+		get    func(context.Context, client.ObjectKey, runtime.Object) error
+		update error
+		want   want
+	}{
+		"NotFound": {
+			get: func(_ context.Context, key client.ObjectKey, _ runtime.Object) error {
+				return kerrors.NewNotFound(schema.GroupResource{Resource: "customresourcedefinitions"}, key.Name)
+			},
+			want: want{created: unstructuredObj(crdRaw)},
+		},
+		"GetError": {
+			get: func(_ context.Context, _ client.ObjectKey, _ runtime.Object) error { return errBoom },
+			want: want{
+				err: errors.Wrapf(errBoom, "failed to get object %s from stack revision %s", crdName, resourceName),
+			},
+		},
+		"Unchanged": {
+			get:  existing(withUnstructuredObjLabels(otherParent)),
+			want: want{},
+		},
+		"Changed": {
+			get:  existing(withUnstructuredObjLabels(otherParent), clusterScoped),
+			want: want{updated: unstructuredObj(crdRaw, withUnstructuredObjLabels(otherParent))},
+		},
+		"UpdateError": {
+			get:    existing(clusterScoped),
+			update: errBoom,
+			want: want{
+				err:     errors.Wrapf(errBoom, "failed to update object %s from stack revision %s", crdName, resourceName),
+				updated: unstructuredObj(crdRaw),
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := want{}
+			jc := &stackInstallJobCompleter{
+				client: &test.MockClient{
+					MockGet: tc.get,
+					MockCreate: func(_ context.Context, obj runtime.Object, _ ...client.CreateOption) error {
+						got.created = obj.(*unstructured.Unstructured)
+						return nil
+					},
+					MockUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+						got.updated = obj.(*unstructured.Unstructured)
+						return tc.update
+					},
+				},
+				log: logging.NewNopLogger(),
+			}
+
+			got.err = jc.applyRevisionObject(context.Background(), unstructuredObj(crdRaw), &v1alpha1.StackRevision{ObjectMeta: metav1.ObjectMeta{Name: resourceName}})
+
+			if diff := cmp.Diff(tc.want.err, got.err, test.EquateErrors()); diff != "" {
+				t.Errorf("applyRevisionObject(): -want error, +got error:\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want.created, got.created); diff != "" {
+				t.Errorf("applyRevisionObject(): -want created, +got created:\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want.updated, got.updated); diff != "" {
+				t.Errorf("applyRevisionObject(): -want updated, +got updated:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCheckCRDUpgrade(t *testing.T) {
+	installed := func(version string) func(context.Context, client.ObjectKey, runtime.Object) error {
+		return func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+			*obj.(*apiextensions.CustomResourceDefinition) = apiextensions.CustomResourceDefinition{
+				ObjectMeta: metav1.ObjectMeta{Name: crdName},
+				Spec: apiextensions.CustomResourceDefinitionSpec{
+					Group:    "samples.upbound.io",
+					Names:    apiextensions.CustomResourceDefinitionNames{Kind: "Mytype", ListKind: "MytypeList"},
+					Scope:    apiextensions.NamespaceScoped,
+					Versions: []apiextensions.CustomResourceDefinitionVersion{{Name: version, Served: true, Storage: true}},
+				},
+			}
+			return nil
+		}
+	}
+	objects := func(n int) func(context.Context, runtime.Object, ...client.ListOption) error {
+		return func(_ context.Context, list runtime.Object, _ ...client.ListOption) error {
+			l := list.(*unstructured.UnstructuredList)
+			if l.GroupVersionKind() != (schema.GroupVersionKind{Group: "samples.upbound.io", Version: "v1", Kind: "MytypeList"}) {
+				return errors.Errorf("unexpected list kind %s", l.GroupVersionKind())
+			}
+			for i := 0; i < n; i++ {
+				l.Items = append(l.Items, unstructured.Unstructured{})
+			}
+			return nil
+		}
+	}
+
+	type want struct {
+		issues []string
+		err    error
+	}
+
+	cases := map[string]struct {
+		get  func(context.Context, client.ObjectKey, runtime.Object) error
+		list func(context.Context, runtime.Object, ...client.ListOption) error
+		want want
+	}{
+		"NotInstalled": {
+			get: func(_ context.Context, key client.ObjectKey, _ runtime.Object) error {
+				return kerrors.NewNotFound(schema.GroupResource{Resource: "customresourcedefinitions"}, key.Name)
+			},
+			want: want{},
+		},
+		"GetError": {
+			get: func(_ context.Context, _ client.ObjectKey, _ runtime.Object) error { return errBoom },
+			want: want{
+				err: errors.Wrapf(errBoom, "failed to get CRD %s", crdName),
+			},
+		},
+		"ListError": {
+			get:  installed("v1"),
+			list: func(_ context.Context, _ runtime.Object, _ ...client.ListOption) error { return errBoom },
+			want: want{
+				err: errors.Wrapf(errBoom, "failed to list objects of CRD %s", crdName),
+			},
+		},
+		"VersionRemovedWithoutObjects": {
+			get:  installed("v1"),
+			list: objects(0),
+			want: want{issues: []string{}},
+		},
+		"VersionRemovedWithObjects": {
+			get:  installed("v1"),
+			list: objects(1),
+			want: want{issues: []string{"CRD " + crdName + ": version v1 is removed while objects are stored"}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			jc := &stackInstallJobCompleter{
+				client: &test.MockClient{MockGet: tc.get, MockList: tc.list},
+				log:    logging.NewNopLogger(),
+			}
+
+			crd := &apiextensions.CustomResourceDefinition{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(unstructuredObj(crdRaw).Object, crd); err != nil {
+				t.Fatalf("FromUnstructured(...): %s", err)
+			}
+			issues, err := jc.checkCRDUpgrade(context.Background(), crd)
+
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("checkCRDUpgrade(): -want error, +got error:\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want.issues, issues); diff != "" {
+				t.Errorf("checkCRDUpgrade(): -want issues, +got issues:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPrepareInstallJobSignatureVerification(t *testing.T) {
+	tests := []struct {
+		name     string
+		sv       *v1alpha1.SignatureVerification
+		wantArgs []string
+		wantVols int
+	}{
+		{
+			name:     "NoVerification",
+			wantArgs: []string{},
+			wantVols: 1,
+		},
+		{
+			name:     "VerifyIfSigned",
+			sv:       &v1alpha1.SignatureVerification{TrustedKeysConfigMap: "trusted"},
+			wantArgs: []string{"--trusted-keys-dir=/trusted-keys"},
+			wantVols: 2,
+		},
+		{
+			name:     "RequireSignature",
+			sv:       &v1alpha1.SignatureVerification{TrustedKeysConfigMap: "trusted", Required: true},
+			wantArgs: []string{"--trusted-keys-dir=/trusted-keys", "--require-signature"},
+			wantVols: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := prepareInstallJob(prepareInstallJobParams{name: resourceName, namespace: namespace, signatureVerification: tt.sv})
+			spec := job.Spec.Template.Spec
+
+			gotArgs := []string{}
+			for _, a := range spec.Containers[0].Args {
+				if strings.HasPrefix(a, "--trusted-keys-dir") || a == "--require-signature" {
+					gotArgs = append(gotArgs, a)
+				}
+			}
+			if diff := cmp.Diff(tt.wantArgs, gotArgs); diff != "" {
+				t.Errorf("prepareInstallJob() -want args, +got args:\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantVols, len(spec.Volumes)); diff != "" {
+				t.Errorf("prepareInstallJob() -want volumes, +got volumes:\n%s", diff)
+			}
+			if tt.sv != nil {
+				if got := spec.Volumes[1].ConfigMap.Name; got != tt.sv.TrustedKeysConfigMap {
+					t.Errorf("prepareInstallJob(): want trusted keys ConfigMap %q, got %q", tt.sv.TrustedKeysConfigMap, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPrepareInstallJobPackageSource(t *testing.T) {
+	sum := strings.Repeat("a", 64)
+	tests := []struct {
+		name         string
+		src          *v1alpha1.PackageSource
+		wantArgs     []string
+		wantInit     int
+		wantVols     int
+		wantStackEnv bool
+	}{
+		{
+			name:         "Image",
+			wantArgs:     []string{"--content-dir=/ext-pkg/.registry"},
+			wantInit:     1,
+			wantVols:     1,
+			wantStackEnv: true,
+		},
+		{
+			name:     "Git",
+			src:      &v1alpha1.PackageSource{Git: &v1alpha1.GitSource{URL: "https://example.org/stack.git", Ref: "v1", Path: "stack"}},
+			wantArgs: []string{"--git-url=https://example.org/stack.git", "--git-ref=v1", "--content-dir=stack"},
+		},
+		{
+			name:     "GitDefaultBranch",
+			src:      &v1alpha1.PackageSource{Git: &v1alpha1.GitSource{URL: "https://example.org/stack.git"}},
+			wantArgs: []string{"--git-url=https://example.org/stack.git"},
+		},
+		{
+			name:     "HTTP",
+			src:      &v1alpha1.PackageSource{HTTP: &v1alpha1.HTTPSource{URL: "https://example.org/stack.tgz", SHA256: sum, Path: "stack-1.0"}},
+			wantArgs: []string{"--archive-url=https://example.org/stack.tgz", "--archive-sha256=" + sum, "--content-dir=stack-1.0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := prepareInstallJob(prepareInstallJobParams{name: resourceName, namespace: namespace, img: "stack:v1", packageSource: tt.src})
+			spec := job.Spec.Template.Spec
+
+			gotArgs := []string{}
+			for _, a := range spec.Containers[0].Args {
+				for _, prefix := range []string{"--content-dir", "--git-", "--archive-"} {
+					if strings.HasPrefix(a, prefix) {
+						gotArgs = append(gotArgs, a)
+					}
+				}
+			}
+			if diff := cmp.Diff(tt.wantArgs, gotArgs); diff != "" {
+				t.Errorf("prepareInstallJob() -want args, +got args:\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantInit, len(spec.InitContainers)); diff != "" {
+				t.Errorf("prepareInstallJob() -want init containers, +got init containers:\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantVols, len(spec.Volumes)); diff != "" {
+				t.Errorf("prepareInstallJob() -want volumes, +got volumes:\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantStackEnv, len(spec.Containers[0].Env) > 0); diff != "" {
+				t.Errorf("prepareInstallJob() -want %s env, +got:\n%s", stacks.StackImageEnv, diff)
+			}
+		})
+	}
+}
+
+func TestValidatePackageSource(t *testing.T) {
+	git := &v1alpha1.GitSource{URL: "https://example.org/stack.git"}
+	http := &v1alpha1.HTTPSource{URL: "https://example.org/stack.tgz"}
+	errNoSource := errors.New("exactly one of git or http must be specified by packageSource")
+
+	cases := map[string]struct {
+		src  *v1alpha1.PackageSource
+		want error
+	}{
+		"NoPackageSource": {},
+		"Git":             {src: &v1alpha1.PackageSource{Git: git}},
+		"HTTP":            {src: &v1alpha1.PackageSource{HTTP: http}},
+		"Neither":         {src: &v1alpha1.PackageSource{}, want: errNoSource},
+		"Both":            {src: &v1alpha1.PackageSource{Git: git, HTTP: http}, want: errNoSource},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, validatePackageSource(tc.src), test.EquateErrors()); diff != "" {
+				t.Errorf("validatePackageSource(): -want, +got:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLimitedReader(t *testing.T) {
+	cases := map[string]struct {
+		input string
+		limit int64
+		want  error
+	}{
+		"WithinLimit": {input: "stack", limit: 6},
+		"AtLimit":     {input: "stack", limit: 5},
+		"ExceedsLimit": {
+			input: "stacks",
+			limit: 5,
+			want:  errors.New("job output exceeds the limit of 5 bytes"),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := ioutil.ReadAll(&limitedReader{r: strings.NewReader(tc.input), limit: tc.limit})
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("Read(): -want error, +got error:\n%s", diff)
+			}
+		})
+	}
+}
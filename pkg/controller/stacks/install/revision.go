@@ -0,0 +1,245 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	runtimev1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	runtimeresource "github.com/crossplane/crossplane-runtime/pkg/resource"
+	"github.com/crossplane/crossplane/apis/stacks/v1alpha1"
+	"github.com/crossplane/crossplane/pkg/stacks"
+)
+
+// revisionHistoryLimit is the number of revisions of a stack that are kept
+// for each install. The current revision, and the revision the install is
+// rolled back to, are always kept.
+const revisionHistoryLimit = 10
+
+// rollback reinstalls the revision of the stack that the install is rolled
+// back to. The resources recorded by the revision are applied as they are,
+// so no install job is needed. The resources must have been unpacked from the
+// package digest the revision recorded when it was installed, and, like any
+// other install, must be approved if the install's approval policy is Manual.
+func (h *stackInstallHandler) rollback(ctx context.Context) (reconcile.Result, error) {
+	revs, err := h.listRevisions(ctx)
+	if err != nil {
+		return fail(ctx, h.kube, h.ext, err)
+	}
+
+	var rev *v1alpha1.StackRevision
+	for i := range revs {
+		if revs[i].Spec.Revision == h.ext.GetRollbackTo() {
+			rev = &revs[i]
+			break
+		}
+	}
+	if rev == nil {
+		return fail(ctx, h.kube, h.ext, errors.Errorf("cannot roll back to revision %d: revision does not exist", h.ext.GetRollbackTo()))
+	}
+	if err := verifyRevision(rev); err != nil {
+		return fail(ctx, h.kube, h.ext, errors.Wrapf(err, "cannot roll back to revision %d", rev.Spec.Revision))
+	}
+
+	ps := &permissionsSummarizer{}
+	if err := forEachRevisionObject(rev, ps.add); err != nil {
+		return fail(ctx, h.kube, h.ext, errors.Wrapf(err, "cannot roll back to revision %d", rev.Spec.Revision))
+	}
+	if ps.stack == nil {
+		return fail(ctx, h.kube, h.ext, errors.Errorf("cannot roll back to revision %d: revision does not contain a Stack", rev.Spec.Revision))
+	}
+	summary := ps.summary(h.ext)
+	h.ext.SetPermissionsSummary(summary)
+
+	waiting, err := h.awaitApproval(ctx, rev.Spec.StackVersion, summary)
+	if err != nil {
+		return fail(ctx, h.kube, h.ext, err)
+	}
+	if waiting {
+		h.ext.SetConditions(runtimev1alpha1.Unavailable().WithMessage(waitingForApproval), runtimev1alpha1.ReconcileSuccess())
+		return reconcile.Result{}, h.kube.Status().Update(ctx, h.ext)
+	}
+
+	installed, err := h.installRevision(ctx, rev)
+	if err != nil {
+		return fail(ctx, h.kube, h.ext, err)
+	}
+	if installed {
+		h.debugWithName("rolled back stack", "revision", rev.Spec.Revision, "from", h.ext.CurrentVersion().Version, "to", rev.Spec.Version)
+		h.setCurrentRevision(rev)
+	}
+
+	h.ext.SetConditions(runtimev1alpha1.ReconcileSuccess())
+	return requeueOnSuccess, h.kube.Status().Update(ctx, h.ext)
+}
+
+// verifyRevision returns an error unless the Stack and every CRD recorded by
+// the supplied revision were unpacked from the package digest the revision
+// recorded when it was installed.
+func verifyRevision(rev *v1alpha1.StackRevision) error {
+	if rev.Spec.Digest == "" {
+		return errors.New("revision does not record a package digest")
+	}
+	return forEachRevisionObject(rev, func(obj *unstructured.Unstructured) error {
+		if d := obj.GetAnnotations()[stacks.AnnotationPackageDigest]; d != rev.Spec.Digest {
+			return errors.Errorf("%s %s was unpacked from package digest %q, not %q", obj.GetKind(), obj.GetName(), d, rev.Spec.Digest)
+		}
+		return nil
+	})
+}
+
+// forEachRevisionObject decodes the Stack and CRDs recorded by the supplied
+// revision one at a time, calling fn with each. Decoding stops at the first
+// error.
+func forEachRevisionObject(rev *v1alpha1.StackRevision, fn func(obj *unstructured.Unstructured) error) error {
+	raws := append([]runtime.RawExtension{rev.Spec.Stack}, rev.Spec.CRDs...)
+	for _, raw := range raws {
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(raw.Raw); err != nil {
+			return errors.Wrapf(err, "failed to parse stack revision %s", rev.GetName())
+		}
+		if err := fn(obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// completeInstall creates the resources in the output of the supplied install
+// job, and records them as the first revision of the stack.
+func (h *stackInstallHandler) completeInstall(ctx context.Context, job *batchv1.Job) error {
+	if err := h.jobCompleter.handleJobCompletion(ctx, h.ext, job); err != nil {
+		return err
+	}
+
+	// The install job is awaited until its Stack is observed, which may take
+	// several reconciles, but its output need only be recorded once.
+	if h.ext.CurrentVersion() != nil {
+		return nil
+	}
+
+	rev, err := h.jobCompleter.revisionFromJob(ctx, h.ext, job)
+	if err != nil {
+		return err
+	}
+	if err := h.recordRevision(ctx, rev); err != nil {
+		return err
+	}
+
+	h.setCurrentRevision(rev)
+	return nil
+}
+
+// recordRevision adds the supplied revision to the revision history of the
+// install, numbering it after the latest revision. A revision that is already
+// recorded keeps its number. The oldest revisions are deleted once the history
+// exceeds its limit.
+func (h *stackInstallHandler) recordRevision(ctx context.Context, rev *v1alpha1.StackRevision) error {
+	revs, err := h.listRevisions(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range revs {
+		if r.GetName() == rev.GetName() {
+			rev.Spec.Revision = r.Spec.Revision
+			return nil
+		}
+	}
+
+	rev.Spec.Revision = 1
+	if len(revs) > 0 {
+		rev.Spec.Revision = revs[0].Spec.Revision + 1
+	}
+	if err := h.kube.Create(ctx, rev); err != nil {
+		return errors.Wrapf(err, "failed to create stack revision %s", rev.GetName())
+	}
+	h.debugWithName("recorded stack revision", "revision", rev.Spec.Revision, "name", rev.GetName())
+
+	return h.pruneRevisions(ctx, append([]v1alpha1.StackRevision{*rev}, revs...))
+}
+
+// pruneRevisions deletes the oldest of the supplied revisions, which must be
+// sorted from newest to oldest, until no more than revisionHistoryLimit
+// remain. The current revision and the revision the install is rolled back to
+// are never deleted.
+func (h *stackInstallHandler) pruneRevisions(ctx context.Context, revs []v1alpha1.StackRevision) error {
+	kept := 0
+	for i := range revs {
+		if h.keepRevision(&revs[i]) {
+			kept++
+		}
+	}
+
+	for i := range revs {
+		r := &revs[i]
+		if h.keepRevision(r) {
+			continue
+		}
+		if kept < revisionHistoryLimit {
+			kept++
+			continue
+		}
+		if err := h.kube.Delete(ctx, r); runtimeresource.IgnoreNotFound(err) != nil {
+			return errors.Wrapf(err, "failed to delete stack revision %s", r.GetName())
+		}
+		h.debugWithName("deleted stack revision", "revision", r.Spec.Revision, "name", r.GetName())
+	}
+	return nil
+}
+
+// listRevisions returns the revisions of the stack recorded by the install,
+// sorted from newest to oldest.
+func (h *stackInstallHandler) listRevisions(ctx context.Context) ([]v1alpha1.StackRevision, error) {
+	l := &v1alpha1.StackRevisionList{}
+	if err := h.kube.List(ctx, l, client.InNamespace(h.ext.GetNamespace()), client.MatchingLabels(stacks.ParentLabels(h.ext))); err != nil {
+		return nil, errors.Wrap(err, "failed to list stack revisions")
+	}
+	sort.Slice(l.Items, func(i, j int) bool { return l.Items[i].Spec.Revision > l.Items[j].Spec.Revision })
+	return l.Items, nil
+}
+
+// keepRevision returns true if the supplied revision is the current version of
+// the install, or the revision it is rolled back to.
+func (h *stackInstallHandler) keepRevision(rev *v1alpha1.StackRevision) bool {
+	cur := h.ext.CurrentVersion()
+	return (cur != nil && cur.Revision == rev.Spec.Revision) || rev.Spec.Revision == h.ext.GetRollbackTo()
+}
+
+// setCurrentRevision records the supplied revision as the current version of
+// the install, and the current version as its previous version.
+func (h *stackInstallHandler) setCurrentRevision(rev *v1alpha1.StackRevision) {
+	if cur := h.ext.CurrentVersion(); cur != nil {
+		h.ext.SetPreviousVersion(cur)
+	}
+	h.ext.SetCurrentVersion(rev.Spec.StackVersion.DeepCopy())
+}
+
+// rollbackRequested returns true if the supplied install is rolled back to a
+// revision other than its current version.
+func rollbackRequested(i v1alpha1.StackInstaller) bool {
+	cur := i.CurrentVersion()
+	return cur != nil && i.GetRollbackTo() != 0 && cur.Revision != i.GetRollbackTo()
+}
@@ -0,0 +1,403 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	runtimev1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/crossplane/crossplane/apis/stacks/v1alpha1"
+	"github.com/crossplane/crossplane/pkg/stacks"
+)
+
+func withRollbackTo(revision int64) resourceModifier {
+	return func(r v1alpha1.StackInstaller) { r.(*v1alpha1.StackInstall).Spec.RollbackTo = revision }
+}
+
+// revisionObject returns the raw JSON of an object that was unpacked from a
+// stack package with the supplied digest.
+func revisionObject(apiVersion, kind, name, digest string) runtime.RawExtension {
+	return runtime.RawExtension{Raw: []byte(fmt.Sprintf(
+		`{"apiVersion":%q,"kind":%q,"metadata":{"name":%q,"annotations":{%q:%q}}}`,
+		apiVersion, kind, name, stacks.AnnotationPackageDigest, digest,
+	))}
+}
+
+func stackRevision(name string, v *v1alpha1.StackVersion, crds ...runtime.RawExtension) *v1alpha1.StackRevision {
+	return &v1alpha1.StackRevision{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: stacks.ParentLabels(resource())},
+		Spec: v1alpha1.StackRevisionSpec{
+			StackVersion: *v,
+			Stack:        revisionObject(v1alpha1.SchemeGroupVersion.String(), v1alpha1.StackKind, resourceName, v.Digest),
+			CRDs:         crds,
+		},
+	}
+}
+
+func TestStackInstallRollback(t *testing.T) {
+	stackRecord := &corev1.ObjectReference{Name: resourceName, Namespace: namespace, UID: uid}
+	stack := &v1alpha1.Stack{ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: namespace}}
+	v1 := &v1alpha1.StackVersion{Package: "cool/stack:v1", Version: "1.0.0", Digest: "sha256:v1", Revision: 1}
+	v2 := &v1alpha1.StackVersion{Package: "cool/stack:v2", Version: "2.0.0", Digest: "sha256:v2", Revision: 2}
+	issues := []string{"CRD mytypes.samples.upbound.io: version v2 is removed while objects are stored"}
+
+	installed := func(rm ...resourceModifier) *v1alpha1.StackInstall {
+		return resource(append([]resourceModifier{
+			withPackage(v2.Package),
+			withStackRecord(stackRecord),
+			withCurrentVersion(v2),
+		}, rm...)...)
+	}
+	completer := func(issues []string, applyErr error) jobCompleter {
+		return &mockJobCompleter{
+			MockCheckRevision: func(_ context.Context, _ *v1alpha1.StackRevision) ([]string, error) {
+				return issues, nil
+			},
+			MockApplyRevision: func(_ context.Context, rev *v1alpha1.StackRevision) error {
+				if rev.Spec.Revision != v1.Revision {
+					return errors.Errorf("applied revision %d", rev.Spec.Revision)
+				}
+				return applyErr
+			},
+		}
+	}
+	errNoRevision := errors.New("cannot roll back to revision 3: revision does not exist")
+	tampered := revisionObject("apiextensions.k8s.io/v1beta1", "CustomResourceDefinition", "mytypes.samples.upbound.io", "sha256:other")
+	errTampered := errors.Wrap(
+		errors.New(`CustomResourceDefinition mytypes.samples.upbound.io was unpacked from package digest "sha256:other", not "sha256:v1"`),
+		"cannot roll back to revision 1",
+	)
+
+	type want struct {
+		result reconcile.Result
+		err    error
+		si     *v1alpha1.StackInstall
+	}
+
+	cases := map[string]struct {
+		handler *stackInstallHandler
+		want    want
+	}{
+		"NotRequested": {
+			handler: &stackInstallHandler{
+				ext:          installed(withRollbackTo(v2.Revision), withPackage("cool/stack:v3")),
+				kube:         fake.NewFakeClient(installed(withRollbackTo(v2.Revision), withPackage("cool/stack:v3")), stack),
+				jobCompleter: completer(nil, nil),
+				log:          logging.NewNopLogger(),
+			},
+			want: want{
+				result: reconcile.Result{},
+				si:     installed(withRollbackTo(v2.Revision), withPackage("cool/stack:v3")),
+			},
+		},
+		"RevisionDoesNotExist": {
+			handler: &stackInstallHandler{
+				ext:          installed(withRollbackTo(3)),
+				kube:         fake.NewFakeClient(installed(withRollbackTo(3)), stack, stackRevision("v1", v1), stackRevision("v2", v2)),
+				jobCompleter: completer(nil, nil),
+				log:          logging.NewNopLogger(),
+			},
+			want: want{
+				result: resultRequeue,
+				si:     installed(withRollbackTo(3), withConditions(runtimev1alpha1.ReconcileError(errNoRevision))),
+			},
+		},
+		"RevisionTampered": {
+			handler: &stackInstallHandler{
+				ext:          installed(withRollbackTo(v1.Revision)),
+				kube:         fake.NewFakeClient(installed(withRollbackTo(v1.Revision)), stack, stackRevision("v1", v1, tampered), stackRevision("v2", v2)),
+				jobCompleter: completer(nil, nil),
+				log:          logging.NewNopLogger(),
+			},
+			want: want{
+				result: resultRequeue,
+				si:     installed(withRollbackTo(v1.Revision), withConditions(runtimev1alpha1.ReconcileError(errTampered))),
+			},
+		},
+		"AwaitApproval": {
+			handler: &stackInstallHandler{
+				ext:          installed(withRollbackTo(v1.Revision), withApproval(v1alpha1.ApprovalManual, false)),
+				kube:         fake.NewFakeClient(installed(withRollbackTo(v1.Revision), withApproval(v1alpha1.ApprovalManual, false)), stack, stackRevision("v1", v1), stackRevision("v2", v2)),
+				jobCompleter: completer(nil, nil),
+				log:          logging.NewNopLogger(),
+			},
+			want: want{
+				result: reconcile.Result{},
+				si: installed(
+					withRollbackTo(v1.Revision),
+					withApproval(v1alpha1.ApprovalManual, false),
+					withConditions(runtimev1alpha1.Unavailable().WithMessage(waitingForApproval), runtimev1alpha1.ReconcileSuccess()),
+				),
+			},
+		},
+		"ApprovalRevoked": {
+			handler: &stackInstallHandler{
+				ext:          installed(withRollbackTo(v1.Revision), withApproval(v1alpha1.ApprovalManual, true), withApprovedDigest(approvalDigest(*v2, ""))),
+				kube:         fake.NewFakeClient(installed(withRollbackTo(v1.Revision), withApproval(v1alpha1.ApprovalManual, true), withApprovedDigest(approvalDigest(*v2, ""))), stack, stackRevision("v1", v1), stackRevision("v2", v2)),
+				jobCompleter: completer(nil, nil),
+				log:          logging.NewNopLogger(),
+			},
+			want: want{
+				result: reconcile.Result{},
+				si: installed(
+					withRollbackTo(v1.Revision),
+					withApproval(v1alpha1.ApprovalManual, false),
+					withConditions(runtimev1alpha1.Unavailable().WithMessage(waitingForApproval), runtimev1alpha1.ReconcileSuccess()),
+				),
+			},
+		},
+		"ApprovedRollback": {
+			handler: &stackInstallHandler{
+				ext:          installed(withRollbackTo(v1.Revision), withApproval(v1alpha1.ApprovalManual, true)),
+				kube:         fake.NewFakeClient(installed(withRollbackTo(v1.Revision), withApproval(v1alpha1.ApprovalManual, true)), stack, stackRevision("v1", v1), stackRevision("v2", v2)),
+				jobCompleter: completer(nil, nil),
+				log:          logging.NewNopLogger(),
+			},
+			want: want{
+				result: requeueOnSuccess,
+				si: installed(
+					withRollbackTo(v1.Revision),
+					withApproval(v1alpha1.ApprovalManual, true),
+					withApprovedDigest(approvalDigest(*v1, "")),
+					withCurrentVersion(v1),
+					withPreviousVersion(v2),
+					withConditions(v1alpha1.UpgradeSafe(), runtimev1alpha1.ReconcileSuccess()),
+				),
+			},
+		},
+		"RollbackBlocked": {
+			handler: &stackInstallHandler{
+				ext:          installed(withRollbackTo(v1.Revision)),
+				kube:         fake.NewFakeClient(installed(withRollbackTo(v1.Revision)), stack, stackRevision("v1", v1), stackRevision("v2", v2)),
+				jobCompleter: completer(issues, nil),
+				log:          logging.NewNopLogger(),
+			},
+			want: want{
+				result: requeueOnSuccess,
+				si: installed(
+					withRollbackTo(v1.Revision),
+					withConditions(v1alpha1.UpgradeBlocked(issues[0]), runtimev1alpha1.ReconcileSuccess()),
+				),
+			},
+		},
+		"RollbackFailed": {
+			handler: &stackInstallHandler{
+				ext:          installed(withRollbackTo(v1.Revision)),
+				kube:         fake.NewFakeClient(installed(withRollbackTo(v1.Revision)), stack, stackRevision("v1", v1), stackRevision("v2", v2)),
+				jobCompleter: completer(nil, errBoom),
+				log:          logging.NewNopLogger(),
+			},
+			want: want{
+				result: resultRequeue,
+				si: installed(
+					withRollbackTo(v1.Revision),
+					withConditions(v1alpha1.UpgradeSafe(), runtimev1alpha1.ReconcileError(errBoom)),
+				),
+			},
+		},
+		"RolledBack": {
+			handler: &stackInstallHandler{
+				ext:          installed(withRollbackTo(v1.Revision)),
+				kube:         fake.NewFakeClient(installed(withRollbackTo(v1.Revision)), stack, stackRevision("v1", v1), stackRevision("v2", v2)),
+				jobCompleter: completer(nil, nil),
+				log:          logging.NewNopLogger(),
+			},
+			want: want{
+				result: requeueOnSuccess,
+				si: installed(
+					withRollbackTo(v1.Revision),
+					withCurrentVersion(v1),
+					withPreviousVersion(v2),
+					withConditions(v1alpha1.UpgradeSafe(), runtimev1alpha1.ReconcileSuccess()),
+				),
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			gotResult, gotErr := tc.handler.update(ctx)
+
+			if diff := cmp.Diff(tc.want.err, gotErr, test.EquateErrors()); diff != "" {
+				t.Errorf("update() -want error, +got error:\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tc.want.result, gotResult); diff != "" {
+				t.Errorf("update() -want result, +got result:\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tc.want.si, tc.handler.ext, test.EquateConditions(), cmpopts.IgnoreFields(metav1.ObjectMeta{}, "ResourceVersion")); diff != "" {
+				t.Errorf("update() -want stackInstall, +got stackInstall:\n%v", diff)
+			}
+
+			stored := &v1alpha1.StackInstall{}
+			if err := tc.handler.kube.Get(ctx, types.NamespacedName{Name: resourceName, Namespace: namespace}, stored); err != nil {
+				t.Fatalf("Get(...): %s", err)
+			}
+			if diff := cmp.Diff(tc.want.si.Spec, stored.Spec); diff != "" {
+				t.Errorf("update() -want stored spec, +got stored spec:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRecordRevision(t *testing.T) {
+	history := func(n int) []runtime.Object {
+		objs := []runtime.Object{}
+		for i := 1; i <= n; i++ {
+			objs = append(objs, stackRevision(fmt.Sprintf("r%d", i), &v1alpha1.StackVersion{Revision: int64(i)}))
+		}
+		return objs
+	}
+
+	type want struct {
+		revision  int64
+		revisions map[string]int64
+	}
+
+	cases := map[string]struct {
+		si   *v1alpha1.StackInstall
+		kube client.Client
+		name string
+		want want
+	}{
+		"FirstRevision": {
+			si:   resource(),
+			kube: fake.NewFakeClient(),
+			name: "new",
+			want: want{
+				revision:  1,
+				revisions: map[string]int64{"new": 1},
+			},
+		},
+		"NextRevision": {
+			si:   resource(),
+			kube: fake.NewFakeClient(history(2)...),
+			name: "new",
+			want: want{
+				revision:  3,
+				revisions: map[string]int64{"r1": 1, "r2": 2, "new": 3},
+			},
+		},
+		"AlreadyRecorded": {
+			si:   resource(),
+			kube: fake.NewFakeClient(history(2)...),
+			name: "r1",
+			want: want{
+				revision:  1,
+				revisions: map[string]int64{"r1": 1, "r2": 2},
+			},
+		},
+		"PruneOldest": {
+			si:   resource(withCurrentVersion(&v1alpha1.StackVersion{Revision: 1})),
+			kube: fake.NewFakeClient(history(revisionHistoryLimit)...),
+			name: "new",
+			want: want{
+				revision: revisionHistoryLimit + 1,
+				revisions: map[string]int64{
+					"r1": 1, "r3": 3, "r4": 4, "r5": 5, "r6": 6, "r7": 7, "r8": 8, "r9": 9, "r10": 10,
+					"new": revisionHistoryLimit + 1,
+				},
+			},
+		},
+		"PruneKeepsRollbackTarget": {
+			si:   resource(withCurrentVersion(&v1alpha1.StackVersion{Revision: 10}), withRollbackTo(2)),
+			kube: fake.NewFakeClient(history(revisionHistoryLimit)...),
+			name: "new",
+			want: want{
+				revision: revisionHistoryLimit + 1,
+				revisions: map[string]int64{
+					"r2": 2, "r3": 3, "r4": 4, "r5": 5, "r6": 6, "r7": 7, "r8": 8, "r9": 9, "r10": 10,
+					"new": revisionHistoryLimit + 1,
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			h := &stackInstallHandler{ext: tc.si, kube: tc.kube, log: logging.NewNopLogger()}
+			rev := stackRevision(tc.name, &v1alpha1.StackVersion{})
+
+			if err := h.recordRevision(ctx, rev); err != nil {
+				t.Fatalf("recordRevision(...): %s", err)
+			}
+			if rev.Spec.Revision != tc.want.revision {
+				t.Errorf("recordRevision(...): want revision %d, got %d", tc.want.revision, rev.Spec.Revision)
+			}
+
+			l := &v1alpha1.StackRevisionList{}
+			if err := tc.kube.List(ctx, l); err != nil {
+				t.Fatalf("List(...): %s", err)
+			}
+			got := map[string]int64{}
+			for _, r := range l.Items {
+				got[r.GetName()] = r.Spec.Revision
+			}
+			if diff := cmp.Diff(tc.want.revisions, got); diff != "" {
+				t.Errorf("recordRevision(...): -want revisions, +got revisions:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRollbackRequested(t *testing.T) {
+	cases := map[string]struct {
+		i    v1alpha1.StackInstaller
+		want bool
+	}{
+		"NotInstalled": {
+			i:    resource(withRollbackTo(1)),
+			want: false,
+		},
+		"NotRolledBack": {
+			i:    resource(withCurrentVersion(&v1alpha1.StackVersion{Revision: 2})),
+			want: false,
+		},
+		"RolledBack": {
+			i:    resource(withCurrentVersion(&v1alpha1.StackVersion{Revision: 1}), withRollbackTo(1)),
+			want: false,
+		},
+		"RollbackRequested": {
+			i:    resource(withCurrentVersion(&v1alpha1.StackVersion{Revision: 2}), withRollbackTo(1)),
+			want: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := rollbackRequested(tc.i); got != tc.want {
+				t.Errorf("rollbackRequested(...): want %t, got %t", tc.want, got)
+			}
+		})
+	}
+}
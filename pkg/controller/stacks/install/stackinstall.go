@@ -18,6 +18,8 @@ package install
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"sync"
@@ -30,6 +32,7 @@ import (
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -49,6 +52,8 @@ const (
 	reconcileTimeout      = 1 * time.Minute
 	requeueAfterOnSuccess = 10 * time.Second
 	installFinalizer      = "finalizer.stackinstall.crossplane.io"
+
+	waitingForApproval = "Waiting for the permissions of the Stack to be approved"
 )
 
 var (
@@ -206,6 +211,8 @@ type stackInstallHandler struct {
 	hostKube                 client.Client
 	hostAwareConfig          *hosted.Config
 	jobCompleter             jobCompleter
+	tagLister                stacks.TagLister
+	digestResolver           stacks.DigestResolver
 	executorInfo             *stacks.ExecutorInfo
 	ext                      v1alpha1.StackInstaller
 	templatesControllerImage string
@@ -221,6 +228,7 @@ type factory interface {
 type handlerFactory struct{}
 
 func (f *handlerFactory) newHandler(log logging.Logger, ext v1alpha1.StackInstaller, k8s k8sClients, hostAwareConfig *hosted.Config, ei *stacks.ExecutorInfo, templatesControllerImage string) handler {
+	registry := &stacks.RegistryClient{}
 
 	return &stackInstallHandler{
 		ext:             ext,
@@ -236,6 +244,8 @@ func (f *handlerFactory) newHandler(log logging.Logger, ext v1alpha1.StackInstal
 			},
 			log: log,
 		},
+		tagLister:                registry,
+		digestResolver:           registry,
 		log:                      log,
 		templatesControllerImage: templatesControllerImage,
 	}
@@ -262,7 +272,13 @@ func (h *stackInstallHandler) sync(ctx context.Context) (reconcile.Result, error
 				Namespace:  s.Namespace,
 				UID:        s.ObjectMeta.UID,
 			})
+			if h.ext.CurrentVersion() == nil {
+				h.ext.SetCurrentVersion(installedVersion(h.ext, s))
+			}
 			h.ext.SetConditions(runtimev1alpha1.Available(), runtimev1alpha1.ReconcileSuccess())
+			if _, err := h.syncDependencies(ctx, s); err != nil {
+				return fail(ctx, h.kube, h.ext, err)
+			}
 
 			return requeueOnSuccess, h.kube.Status().Update(ctx, h.ext)
 		}
@@ -273,6 +289,199 @@ func (h *stackInstallHandler) sync(ctx context.Context) (reconcile.Result, error
 	return h.update(ctx)
 }
 
+// syncDependencies reflects the state of the supplied Stack's dependencies on
+// the StackInstall, installing them first if the StackInstall's policy allows.
+// It returns true while the StackInstall is waiting for its dependencies.
+func (h *stackInstallHandler) syncDependencies(ctx context.Context, s *v1alpha1.Stack) (bool, error) {
+	waiting := h.propagateDependencies(s)
+	if h.ext.GetInstallDependencies() != v1alpha1.DependencyInstallPolicyIfNotPresent {
+		return waiting, nil
+	}
+
+	pending, err := h.installDependencies(ctx, s)
+	if err != nil {
+		return false, err
+	}
+	if len(pending) > 0 {
+		h.ext.SetConditions(runtimev1alpha1.Unavailable().WithMessage("waiting for dependencies to become ready: " + strings.Join(pending, ", ")))
+		return true, nil
+	}
+	h.ext.SetConditions(runtimev1alpha1.Available())
+	return waiting, nil
+}
+
+// installDependencies creates an install of the same kind as this one for each
+// stack package the supplied Stack depends on that is not installed. The
+// installs it created are recorded in the StackInstall's status. It returns
+// the names of the installs that are not yet ready.
+//
+// Dependencies are installed with the permission scope of this install; a
+// StackInstall cannot install a stack that is granted permissions in all
+// namespaces. The install job of a dependency whose package declares another
+// permissionScope fails, and is reported as an error here. Each install that
+// depends on an install it or another install created is an owner of that
+// install, so that it is garbage collected once nothing depends on it.
+func (h *stackInstallHandler) installDependencies(ctx context.Context, s *v1alpha1.Stack) ([]string, error) {
+	pkgs, err := stacks.InstalledPackages(ctx, h.kube)
+	if err != nil {
+		return nil, err
+	}
+
+	owner := meta.AsOwner(meta.ReferenceTo(h.ext, installGroupVersionKind(h.ext)))
+	refs := []corev1.ObjectReference{}
+	pending := []string{}
+	failed := []string{}
+	for _, d := range s.Spec.DependsOn {
+		// CRD dependencies can't be installed because the package that owns
+		// them is unknown.
+		if d.Package == "" {
+			continue
+		}
+
+		unmet, err := stacks.UnmetDependencies([]v1alpha1.Dependency{d}, pkgs, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		dep, err := h.dependencyInstall(d)
+		if err != nil {
+			return nil, err
+		}
+		want := dep.GetPackage()
+		gvk := installGroupVersionKind(dep)
+
+		switch err := h.kube.Get(ctx, types.NamespacedName{Namespace: dep.GetNamespace(), Name: dep.GetName()}, dep); {
+		case kerrors.IsNotFound(err) && len(unmet) == 0:
+			// The dependency was installed by other means.
+			continue
+		case kerrors.IsNotFound(err):
+			meta.AddOwnerReference(dep, owner)
+			if err := h.kube.Create(ctx, dep); err != nil {
+				return nil, errors.Wrapf(err, "cannot install dependency %q", d.Package)
+			}
+			h.debugWithName("installed dependency", "dependency", dep.GetName(), "package", dep.GetPackage())
+		case err != nil:
+			return nil, errors.Wrapf(err, "cannot get dependency %q", d.Package)
+		case stacks.PackageRepository(dep.GetPackage()) != stacks.PackageRepository(want):
+			return nil, errors.Errorf("cannot install dependency %q: %s %q already installs package %q", d.Package, gvk.Kind, dep.GetName(), dep.GetPackage())
+		case installedAsDependency(dep) && !ownedBy(dep, owner.UID):
+			// Installs that were created as a dependency are shared by
+			// every install that depends on them. Installs that were
+			// created by other means are left alone.
+			meta.AddOwnerReference(dep, owner)
+			if err := h.kube.Update(ctx, dep); err != nil {
+				return nil, errors.Wrapf(err, "cannot update dependency %q", d.Package)
+			}
+		}
+
+		apiVersion, kind := gvk.ToAPIVersionAndKind()
+		refs = append(refs, corev1.ObjectReference{
+			APIVersion: apiVersion,
+			Kind:       kind,
+			Name:       dep.GetName(),
+			Namespace:  dep.GetNamespace(),
+			UID:        dep.GetUID(),
+		})
+		if c := dep.GetCondition(runtimev1alpha1.TypeSynced); c.Status == corev1.ConditionFalse && c.Reason == runtimev1alpha1.ReasonReconcileError {
+			failed = append(failed, fmt.Sprintf("%s: %s", dep.GetName(), c.Message))
+			continue
+		}
+		if dep.GetCondition(runtimev1alpha1.TypeReady).Status != corev1.ConditionTrue {
+			pending = append(pending, dep.GetName())
+		}
+	}
+
+	h.ext.SetDependencies(refs)
+	if len(failed) > 0 {
+		return nil, errors.Errorf("cannot install dependencies with permission scope %q: %s", h.ext.PermissionScope(), strings.Join(failed, "; "))
+	}
+	return pending, nil
+}
+
+// dependencyInstall returns an install of the same kind as this one for the
+// supplied dependency. Only the package is taken from the dependency. The
+// source, image pull settings, and dependency, approval, and signature
+// verification policies are inherited from this install, so that a stack
+// cannot weaken how its dependencies are installed. The service account
+// options, upgrade policy, and package source of this install are specific to
+// its stack, and are not inherited.
+func (h *stackInstallHandler) dependencyInstall(d v1alpha1.Dependency) (v1alpha1.StackInstaller, error) {
+	img, err := h.ext.ImageWithSource(d.Package)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid dependency package %q", d.Package)
+	}
+	spec := v1alpha1.StackInstallSpec{
+		StackControllerOptions: v1alpha1.StackControllerOptions{
+			ImagePullSecrets: h.ext.GetImagePullSecrets(),
+			ImagePullPolicy:  h.ext.GetImagePullPolicy(),
+		},
+		Package:               img,
+		SignatureVerification: h.ext.GetSignatureVerification(),
+		InstallDependencies:   h.ext.GetInstallDependencies(),
+
+		// Dependencies are approved like the stack that depends on them;
+		// a stack cannot approve its own dependencies.
+		Approval: h.ext.GetApproval(),
+	}
+
+	om := metav1.ObjectMeta{Name: dependencyInstallName(img), Namespace: h.ext.GetNamespace()}
+	if _, ok := h.ext.(*v1alpha1.ClusterStackInstall); ok {
+		return &v1alpha1.ClusterStackInstall{ObjectMeta: om, Spec: spec}, nil
+	}
+	return &v1alpha1.StackInstall{ObjectMeta: om, Spec: spec}, nil
+}
+
+// installGroupVersionKind returns the kind of the supplied install, which is
+// not set on typed objects read from the API server.
+func installGroupVersionKind(i v1alpha1.StackInstaller) schema.GroupVersionKind {
+	if _, ok := i.(*v1alpha1.ClusterStackInstall); ok {
+		return v1alpha1.ClusterStackInstallGroupVersionKind
+	}
+	return v1alpha1.StackInstallGroupVersionKind
+}
+
+// installedAsDependency returns true if the supplied install is owned by
+// another install, i.e. it was created as a dependency.
+func installedAsDependency(i v1alpha1.StackInstaller) bool {
+	for _, ref := range i.GetOwnerReferences() {
+		if ref.APIVersion == v1alpha1.SchemeGroupVersion.String() && (ref.Kind == v1alpha1.StackInstallKind || ref.Kind == v1alpha1.ClusterStackInstallKind) {
+			return true
+		}
+	}
+	return false
+}
+
+// ownedBy returns true if the supplied object has an owner with the supplied
+// UID.
+func ownedBy(o metav1.Object, uid types.UID) bool {
+	for _, ref := range o.GetOwnerReferences() {
+		if ref.UID == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// dependencyInstallName derives the name of an install from the repository of
+// its package, e.g. crossplane/stack-gcp:v0.1.0 is named crossplane-stack-gcp.
+func dependencyInstallName(pkg string) string {
+	name := strings.ToLower(stacks.PackageRepository(pkg))
+	name = strings.NewReplacer("/", "-", ".", "-", "_", "-").Replace(name)
+	return strings.Trim(name, "-")
+}
+
+// propagateDependencies copies the DependenciesMet condition of the supplied
+// Stack, if any, so that unmet dependencies are visible on the StackInstall.
+// It returns true if the Stack is waiting for its dependencies.
+func (h *stackInstallHandler) propagateDependencies(s *v1alpha1.Stack) bool {
+	c := s.Status.GetCondition(v1alpha1.TypeDependenciesMet)
+	if c.Status == corev1.ConditionUnknown {
+		return false
+	}
+	h.ext.SetConditions(c)
+	return c.Status == corev1.ConditionFalse
+}
+
 // create resources (Job, StackDefinition) that yield an associated Stack
 // An installjob will be created to unpack the stack image. A Stack or
 // StackDefinition and CRDs should then be output. The output will be awaited
@@ -295,27 +504,17 @@ func (h *stackInstallHandler) create(ctx context.Context) (reconcile.Result, err
 	jobRef := h.ext.InstallJob()
 
 	if jobRef == nil {
+		if err := validatePackageSource(h.ext.GetPackageSource()); err != nil {
+			return fail(ctx, h.kube, h.ext, err)
+		}
+		h.pinImageDigest(ctx)
+
 		// there is no install job created yet, create it now
-		job := h.createInstallJob()
-
-		// if an install job with our name already exists, compare the labels
-		// (specifically parent labels). If they match, adopt this job - we must
-		// have failed to update the jobref on a previous reconciliation.
-		// if the install job does not belong to this stackinstall, block
-		// reconciliation and report it until the problem is resolved.
-		existingJob := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: job.Name, Namespace: job.Namespace}}
-
-		switch err := h.hostKube.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, existingJob); {
-		case err == nil:
-			if labels.Conflicts(existingJob.GetLabels(), job.GetLabels()) {
-				return fail(ctx, h.kube, h.ext, errors.Errorf("stale job %s/%s prevents stackinstall", existingJob.Namespace, existingJob.Name))
-			}
-			*job = *existingJob
-		case kerrors.IsNotFound(err):
-			if err := h.hostKube.Create(ctx, job); err != nil {
-				return fail(ctx, h.kube, h.ext, err)
-			}
-		case err != nil:
+		job, err := h.createInstallJob(h.ext.GetName())
+		if err != nil {
+			return fail(ctx, h.kube, h.ext, err)
+		}
+		if err := h.ensureInstallJob(ctx, job); err != nil {
 			return fail(ctx, h.kube, h.ext, err)
 		}
 
@@ -332,15 +531,39 @@ func (h *stackInstallHandler) create(ctx context.Context) (reconcile.Result, err
 		return requeueOnSuccess, h.kube.Status().Update(ctx, h.ext)
 	}
 
-	return h.awaitInstallJob(ctx, jobRef)
+	return h.awaitInstallJob(ctx, jobRef, h.completeInstall)
 }
 
-func (h *stackInstallHandler) createInstallJob() *batchv1.Job {
+// ensureInstallJob creates the supplied install job. If an install job with
+// its name already exists, compare the labels (specifically parent labels). If
+// they match, adopt this job - we must have failed to update the jobref on a
+// previous reconciliation. If the install job does not belong to this
+// stackinstall, block reconciliation and report it until the problem is
+// resolved.
+func (h *stackInstallHandler) ensureInstallJob(ctx context.Context, job *batchv1.Job) error {
+	existingJob := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: job.Name, Namespace: job.Namespace}}
+
+	switch err := h.hostKube.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, existingJob); {
+	case err == nil:
+		if labels.Conflicts(existingJob.GetLabels(), job.GetLabels()) {
+			return errors.Errorf("stale job %s/%s prevents stackinstall", existingJob.Namespace, existingJob.Name)
+		}
+		*job = *existingJob
+	case kerrors.IsNotFound(err):
+		return h.hostKube.Create(ctx, job)
+	case err != nil:
+		return err
+	}
+	return nil
+}
+
+// createInstallJob returns an install job with the supplied name that unpacks
+// the requested stack package.
+func (h *stackInstallHandler) createInstallJob(name string) (*batchv1.Job, error) {
 	i := h.ext
 	executorInfo := h.executorInfo
 	hCfg := h.hostAwareConfig
 	tscImage := h.templatesControllerImage
-	name := i.GetName()
 	namespace := i.GetNamespace()
 
 	if hCfg != nil {
@@ -357,6 +580,10 @@ func (h *stackInstallHandler) createInstallJob() *batchv1.Job {
 		h.log.Debug("not applying stackinstall source to installjob image due to error", "pkg", pkg, "err", err)
 		img = pkg
 	}
+	img, err = pinnedImage(i, img)
+	if err != nil {
+		return nil, err
+	}
 
 	return prepareInstallJob(prepareInstallJobParams{
 		name:                   name,
@@ -368,10 +595,138 @@ func (h *stackInstallHandler) createInstallJob() *batchv1.Job {
 		stackManagerPullPolicy: executorInfo.ImagePullPolicy,
 		imagePullPolicy:        i.GetImagePullPolicy(),
 		labels:                 stacks.ParentLabels(i),
-		imagePullSecrets:       i.GetImagePullSecrets()})
+		imagePullSecrets:       i.GetImagePullSecrets(),
+		signatureVerification:  i.GetSignatureVerification(),
+		packageSource:          i.GetPackageSource()}), nil
+}
+
+// resolveImageDigest records the digest that the tag of the requested package
+// currently refers to, so that the install job and the stack's controller run
+// exactly the image that was resolved, even if the tag is later moved.
+// Stacks installed from a package source, or without a package, have no image
+// to resolve.
+func (h *stackInstallHandler) resolveImageDigest(ctx context.Context) error {
+	pkg := h.ext.GetPackage()
+	if h.ext.GetPackageSource() != nil || pkg == "" {
+		h.ext.SetImageDigest("")
+		return nil
+	}
+
+	img, err := h.ext.ImageWithSource(pkg)
+	if err != nil {
+		img = pkg
+	}
+	auth, err := h.registryAuth(ctx)
+	if err != nil {
+		return err
+	}
+	d, err := h.digestResolver.ResolveDigest(ctx, img, auth)
+	if err != nil {
+		return err
+	}
+
+	h.debugWithName("resolved package digest", "package", pkg, "digest", d)
+	h.ext.SetImageDigest(d)
+	return nil
+}
+
+// pinImageDigest resolves the digest that the tag of the requested package
+// refers to, as resolveImageDigest does. A digest that cannot be resolved does
+// not prevent the install, because the Stack Manager may be unable to reach a
+// registry that nodes can pull from, for example when images are loaded onto
+// nodes directly, pulled through a mirror, or authenticated by a node's
+// credential provider. The package's tag is used instead, and the install's
+// ImagePinned condition explains why.
+func (h *stackInstallHandler) pinImageDigest(ctx context.Context) {
+	if err := h.resolveImageDigest(ctx); err != nil {
+		h.log.Info("cannot resolve package digest; pulling images by tag", "namespace", h.ext.GetNamespace(), "name", h.ext.GetName(), "package", h.ext.GetPackage(), "error", err)
+		h.ext.SetImageDigest("")
+		h.ext.SetConditions(v1alpha1.ImageUnpinned(err.Error()))
+		return
+	}
+	if h.ext.ImageDigest() != "" {
+		h.ext.SetConditions(v1alpha1.ImagePinned())
+	}
+}
+
+// registryAuth returns the registry credentials of the install's image pull
+// secrets. Secrets that do not exist are ignored, as they are when pulling
+// images.
+func (h *stackInstallHandler) registryAuth(ctx context.Context) (stacks.RegistryAuth, error) {
+	secrets := []corev1.Secret{}
+	for _, ref := range h.ext.GetImagePullSecrets() {
+		s := corev1.Secret{}
+		nn := types.NamespacedName{Name: ref.Name, Namespace: h.ext.GetNamespace()}
+		if err := h.kube.Get(ctx, nn, &s); err != nil {
+			if kerrors.IsNotFound(err) {
+				continue
+			}
+			return nil, errors.Wrapf(err, "cannot get image pull secret %q", ref.Name)
+		}
+		secrets = append(secrets, s)
+	}
+	return stacks.RegistryAuthFromSecrets(secrets)
+}
+
+// awaitApproval returns true if the install must wait for the supplied version
+// of its package, and the supplied summary of the permissions that version
+// will be granted, to be approved. An approval applies only to the package and
+// permissions it was given for; it is revoked when either changes, for example
+// when the install is upgraded, rolled back, or the tag of its package is
+// moved.
+func (h *stackInstallHandler) awaitApproval(ctx context.Context, v v1alpha1.StackVersion, summary string) (bool, error) {
+	if h.ext.GetApproval() != v1alpha1.ApprovalManual {
+		return false, nil
+	}
+	if !h.ext.IsApproved() {
+		return true, nil
+	}
+
+	d := approvalDigest(v, summary)
+	if a := h.ext.ApprovedDigest(); a == "" || a == d {
+		h.ext.SetApprovedDigest(d)
+		return false, nil
+	}
+
+	h.debugWithName("revoking approval of changed package or permissions", "package", v.Package)
+
+	// The spec is updated using a copy of the install, because updating it
+	// refreshes it from the API server, discarding any status changes that
+	// are yet to be recorded.
+	u := h.ext.DeepCopyObject().(v1alpha1.StackInstaller)
+	u.SetApproved(false)
+	if err := h.kube.Update(ctx, u); err != nil {
+		return false, errors.Wrap(err, "cannot revoke approval")
+	}
+	h.ext.SetApproved(false)
+	h.ext.SetResourceVersion(u.GetResourceVersion())
+	h.ext.SetApprovedDigest("")
+	return true, nil
+}
+
+// approvalDigest returns a digest of the package of the supplied version and
+// the supplied summary of the permissions it will be granted.
+func approvalDigest(v v1alpha1.StackVersion, summary string) string {
+	// Marshalling strings and a struct of strings cannot fail.
+	b, _ := json.Marshal(struct {
+		Version     v1alpha1.StackVersion `json:"version"`
+		Permissions string                `json:"permissions"`
+	}{
+		Version:     v1alpha1.StackVersion{Package: v.Package, PackageSource: v.PackageSource, ImageDigest: v.ImageDigest},
+		Permissions: summary,
+	})
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(b))
+}
+
+// requestedVersion returns the version of the package requested by the
+// supplied install, as far as it is known before the package is unpacked.
+func requestedVersion(i v1alpha1.StackInstaller) v1alpha1.StackVersion {
+	return v1alpha1.StackVersion{Package: i.GetPackage(), PackageSource: i.GetPackageSource(), ImageDigest: i.ImageDigest()}
 }
 
-func (h *stackInstallHandler) awaitInstallJob(ctx context.Context, jobRef *corev1.ObjectReference) (reconcile.Result, error) {
+// awaitInstallJob checks the status of the referenced install job, calling
+// complete to process its output once it has succeeded.
+func (h *stackInstallHandler) awaitInstallJob(ctx context.Context, jobRef *corev1.ObjectReference, complete func(context.Context, *batchv1.Job) error) (reconcile.Result, error) {
 	// the install job already exists, let's check its status and completion
 	job := &batchv1.Job{}
 
@@ -388,8 +743,27 @@ func (h *stackInstallHandler) awaitInstallJob(ctx context.Context, jobRef *corev
 		if c.Status == corev1.ConditionTrue {
 			switch c.Type {
 			case batchv1.JobComplete:
+				// the permissions the stack will be granted, and any
+				// warnings about them, are reported for every install
+				summary, err := h.jobCompleter.summarizePermissions(ctx, h.ext, job)
+				if err != nil {
+					return fail(ctx, h.kube, h.ext, err)
+				}
+				h.ext.SetPermissionsSummary(summary)
+
+				// installs that require approval wait until the
+				// permissions the stack will be granted are approved
+				waiting, err := h.awaitApproval(ctx, requestedVersion(h.ext), summary)
+				if err != nil {
+					return fail(ctx, h.kube, h.ext, err)
+				}
+				if waiting {
+					h.ext.SetConditions(runtimev1alpha1.Unavailable().WithMessage(waitingForApproval), runtimev1alpha1.ReconcileSuccess())
+					return reconcile.Result{}, h.kube.Status().Update(ctx, h.ext)
+				}
+
 				// the installjob succeeded, process the output
-				if err := h.jobCompleter.handleJobCompletion(ctx, h.ext, job); err != nil {
+				if err := complete(ctx, job); err != nil {
 					return fail(ctx, h.kube, h.ext, err)
 				}
 
@@ -411,8 +785,66 @@ func (h *stackInstallHandler) awaitInstallJob(ctx context.Context, jobRef *corev
 }
 
 func (h *stackInstallHandler) update(ctx context.Context) (reconcile.Result, error) {
-	h.debugWithName("updating not supported yet")
-	return reconcile.Result{}, nil
+	nn := types.NamespacedName{Name: h.ext.GetName(), Namespace: h.ext.GetNamespace()}
+	s := &v1alpha1.Stack{}
+	err := h.kube.Get(ctx, nn, s)
+	if runtimeresource.IgnoreNotFound(err) != nil {
+		return fail(ctx, h.kube, h.ext, err)
+	}
+	found := err == nil
+
+	// Stacks installed before versions were recorded are assumed to be the
+	// requested version.
+	recorded := false
+	if found && h.ext.CurrentVersion() == nil {
+		h.ext.SetCurrentVersion(installedVersion(h.ext, s))
+		recorded = true
+	}
+
+	if rollbackRequested(h.ext) {
+		return h.rollback(ctx)
+	}
+	if upgradeRequested(h.ext) {
+		return h.upgrade(ctx)
+	}
+
+	// Installs that track newer versions of their package check for them
+	// periodically.
+	result := reconcile.Result{}
+	if tracksUpgrades(h.ext) {
+		wait, checked, err := h.checkForUpgrade(ctx, time.Now())
+		if err != nil {
+			return fail(ctx, h.kube, h.ext, err)
+		}
+		result.RequeueAfter = wait
+		recorded = recorded || checked
+	}
+
+	// The Stack may be waiting for its dependencies to be installed. Keep
+	// watching it until they are, so the StackInstall reflects when they are
+	// met.
+	if found && h.tracksDependencies(s) {
+		waiting, err := h.syncDependencies(ctx, s)
+		if err != nil {
+			return fail(ctx, h.kube, h.ext, err)
+		}
+		if waiting {
+			result = requeueOnSuccess
+		}
+		return result, h.kube.Status().Update(ctx, h.ext)
+	}
+
+	if recorded {
+		return result, h.kube.Status().Update(ctx, h.ext)
+	}
+	return result, nil
+}
+
+// tracksDependencies returns true if the StackInstall reflects the state of
+// the supplied Stack's dependencies.
+func (h *stackInstallHandler) tracksDependencies(s *v1alpha1.Stack) bool {
+	return h.ext.GetInstallDependencies() == v1alpha1.DependencyInstallPolicyIfNotPresent ||
+		s.Status.GetCondition(v1alpha1.TypeDependenciesMet).Status != corev1.ConditionUnknown
 }
 
 // delete performs clean up (finalizer) actions when a StackInstall is being
@@ -24,6 +24,7 @@ import (
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	. "github.com/onsi/gomega"
 	"github.com/pkg/errors"
 
@@ -93,13 +94,26 @@ func withInstallJob(jobRef *corev1.ObjectReference) resourceModifier {
 	return func(r v1alpha1.StackInstaller) { r.SetInstallJob(jobRef) }
 }
 
-// TODO(displague) this should be used in a test that asserts stackinstalls
-// get status.stacks when the stack already exists and is properly labeled
-//nolint:deadcode,unused
 func withStackRecord(stackRecord *corev1.ObjectReference) resourceModifier {
 	return func(r v1alpha1.StackInstaller) { r.SetStackRecord(stackRecord) }
 }
 
+func withCurrentVersion(v *v1alpha1.StackVersion) resourceModifier {
+	return func(r v1alpha1.StackInstaller) { r.SetCurrentVersion(v) }
+}
+
+func withPreviousVersion(v *v1alpha1.StackVersion) resourceModifier {
+	return func(r v1alpha1.StackInstaller) { r.SetPreviousVersion(v) }
+}
+
+func withImageDigest(d string) resourceModifier {
+	return func(r v1alpha1.StackInstaller) { r.SetImageDigest(d) }
+}
+
+func withAnnotations(a map[string]string) resourceModifier {
+	return func(r v1alpha1.StackInstaller) { r.SetAnnotations(a) }
+}
+
 // withPackage allows a test to set a StackInstaller's package
 // Another option would have been to modify the interface to allow this,
 // but it is preferable if we treat the package field as immutable.
@@ -113,6 +127,24 @@ func withPackage(pkg string) resourceModifier {
 	}
 }
 
+func withApproval(policy v1alpha1.ApprovalPolicy, approved bool) resourceModifier {
+	return func(r v1alpha1.StackInstaller) {
+		if si, ok := r.(*v1alpha1.StackInstall); ok {
+			si.Spec.Approval, si.Spec.Approved = policy, approved
+		} else if csi, ok := r.(*v1alpha1.ClusterStackInstall); ok {
+			csi.Spec.Approval, csi.Spec.Approved = policy, approved
+		}
+	}
+}
+
+func withApprovedDigest(d string) resourceModifier {
+	return func(r v1alpha1.StackInstaller) { r.SetApprovedDigest(d) }
+}
+
+func withPermissionsSummary(summary string) resourceModifier {
+	return func(r v1alpha1.StackInstaller) { r.SetPermissionsSummary(summary) }
+}
+
 func withSource(src string) resourceModifier {
 	return func(r v1alpha1.StackInstaller) { r.SetSource(src) }
 }
@@ -464,6 +496,344 @@ func TestReconcile(t *testing.T) {
 }
 
 // TestStackInstallDelete tests the delete function of the stack install handler
+func TestStackInstallUpdate(t *testing.T) {
+	stackRecord := &corev1.ObjectReference{Name: resourceName, Namespace: namespace, UID: uid}
+	stack := func(c ...runtimev1alpha1.Condition) *v1alpha1.Stack {
+		s := &v1alpha1.Stack{ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: namespace}}
+		s.Status.SetConditions(c...)
+		return s
+	}
+	installed := &v1alpha1.StackVersion{}
+	unmet := v1alpha1.DependenciesUnmet("missing dependencies: crd widgets.example.org")
+	withDependsOn := func(s *v1alpha1.Stack) *v1alpha1.Stack {
+		s.Spec.DependsOn = []v1alpha1.Dependency{
+			{Package: "cool/dependency:v1.0.0", Version: "^1.0.0"},
+			{CustomResourceDefinition: "widgets.example.org"},
+		}
+		return s
+	}
+	withVersion := func(s *v1alpha1.Stack) *v1alpha1.Stack {
+		s.Spec.Version = "1.0.0"
+		s.SetAnnotations(map[string]string{stacks.AnnotationPackageDigest: "sha256:v1"})
+		return s
+	}
+	dependency := func(c ...runtimev1alpha1.Condition) *v1alpha1.StackInstall {
+		si := &v1alpha1.StackInstall{
+			ObjectMeta: metav1.ObjectMeta{Name: "cool-dependency", Namespace: namespace},
+			Spec: v1alpha1.StackInstallSpec{
+				Package:             "cool/dependency:v1.0.0",
+				InstallDependencies: v1alpha1.DependencyInstallPolicyIfNotPresent,
+			},
+		}
+		si.Status.SetConditions(c...)
+		return si
+	}
+	dependencyRef := corev1.ObjectReference{
+		APIVersion: v1alpha1.StackInstallGroupVersionKind.GroupVersion().String(),
+		Kind:       v1alpha1.StackInstallKind,
+		Name:       "cool-dependency",
+		Namespace:  namespace,
+	}
+	owner := func(name string, uid types.UID) metav1.OwnerReference {
+		return meta.AsOwner(&corev1.ObjectReference{
+			APIVersion: v1alpha1.StackInstallGroupVersionKind.GroupVersion().String(),
+			Kind:       v1alpha1.StackInstallKind,
+			Name:       name,
+			UID:        uid,
+		})
+	}
+	ownedDependency := func(owners ...metav1.OwnerReference) *v1alpha1.StackInstall {
+		d := dependency(runtimev1alpha1.Available())
+		d.SetOwnerReferences(owners)
+		return d
+	}
+	withInstallDependencies := func(r v1alpha1.StackInstaller) {
+		r.(*v1alpha1.StackInstall).Spec.InstallDependencies = v1alpha1.DependencyInstallPolicyIfNotPresent
+	}
+	withDependencies := func(refs ...corev1.ObjectReference) resourceModifier {
+		return func(r v1alpha1.StackInstaller) { r.SetDependencies(refs) }
+	}
+
+	type want struct {
+		result     reconcile.Result
+		err        error
+		si         *v1alpha1.StackInstall
+		dependency *v1alpha1.StackInstall
+	}
+
+	tests := []struct {
+		name    string
+		handler *stackInstallHandler
+		want    want
+	}{
+		{
+			name: "StackNotFound",
+			handler: &stackInstallHandler{
+				ext:  resource(withStackRecord(stackRecord)),
+				kube: fake.NewFakeClient(resource(withStackRecord(stackRecord))),
+				log:  logging.NewNopLogger(),
+			},
+			want: want{
+				result: reconcile.Result{},
+				si:     resource(withStackRecord(stackRecord)),
+			},
+		},
+		{
+			name: "RecordCurrentVersion",
+			handler: &stackInstallHandler{
+				ext:  resource(withStackRecord(stackRecord), withPackage("cool/stack:v1")),
+				kube: fake.NewFakeClient(resource(withStackRecord(stackRecord), withPackage("cool/stack:v1")), withVersion(stack())),
+				log:  logging.NewNopLogger(),
+			},
+			want: want{
+				result: reconcile.Result{},
+				si: resource(
+					withStackRecord(stackRecord),
+					withPackage("cool/stack:v1"),
+					withCurrentVersion(&v1alpha1.StackVersion{Package: "cool/stack:v1", Version: "1.0.0", Digest: "sha256:v1"}),
+				),
+			},
+		},
+		{
+			name: "DependenciesUnmet",
+			handler: &stackInstallHandler{
+				ext:  resource(withStackRecord(stackRecord)),
+				kube: fake.NewFakeClient(resource(withStackRecord(stackRecord)), stack(unmet)),
+				log:  logging.NewNopLogger(),
+			},
+			want: want{
+				result: requeueOnSuccess,
+				si:     resource(withStackRecord(stackRecord), withCurrentVersion(installed), withConditions(unmet)),
+			},
+		},
+		{
+			name: "DependenciesMet",
+			handler: &stackInstallHandler{
+				ext:  resource(withStackRecord(stackRecord), withConditions(unmet)),
+				kube: fake.NewFakeClient(resource(withStackRecord(stackRecord)), stack(v1alpha1.DependenciesMet())),
+				log:  logging.NewNopLogger(),
+			},
+			want: want{
+				result: reconcile.Result{},
+				si:     resource(withStackRecord(stackRecord), withCurrentVersion(installed), withConditions(v1alpha1.DependenciesMet())),
+			},
+		},
+		{
+			name: "InstallDependencies",
+			handler: &stackInstallHandler{
+				ext:  resource(withStackRecord(stackRecord), withInstallDependencies),
+				kube: fake.NewFakeClient(resource(withStackRecord(stackRecord), withInstallDependencies), withDependsOn(stack(unmet))),
+				log:  logging.NewNopLogger(),
+			},
+			want: want{
+				result: requeueOnSuccess,
+				si: resource(
+					withStackRecord(stackRecord),
+					withCurrentVersion(installed),
+					withInstallDependencies,
+					withDependencies(dependencyRef),
+					withConditions(unmet, runtimev1alpha1.Unavailable().WithMessage("waiting for dependencies to become ready: cool-dependency")),
+				),
+				dependency: func() *v1alpha1.StackInstall {
+					d := dependency()
+					d.SetOwnerReferences([]metav1.OwnerReference{owner(resourceName, uid)})
+					return d
+				}(),
+			},
+		},
+		{
+			name: "DependenciesReady",
+			handler: &stackInstallHandler{
+				ext:  resource(withStackRecord(stackRecord), withInstallDependencies),
+				kube: fake.NewFakeClient(resource(withStackRecord(stackRecord), withInstallDependencies), withDependsOn(stack(unmet)), dependency(runtimev1alpha1.Available())),
+				log:  logging.NewNopLogger(),
+			},
+			want: want{
+				result: requeueOnSuccess,
+				si: resource(
+					withStackRecord(stackRecord),
+					withCurrentVersion(installed),
+					withInstallDependencies,
+					withDependencies(dependencyRef),
+					withConditions(unmet, runtimev1alpha1.Available()),
+				),
+			},
+		},
+		{
+			name: "SharedDependency",
+			handler: &stackInstallHandler{
+				ext:  resource(withStackRecord(stackRecord), withInstallDependencies),
+				kube: fake.NewFakeClient(resource(withStackRecord(stackRecord), withInstallDependencies), withDependsOn(stack(unmet)), ownedDependency(owner("other", "other-uid"))),
+				log:  logging.NewNopLogger(),
+			},
+			want: want{
+				result: requeueOnSuccess,
+				si: resource(
+					withStackRecord(stackRecord),
+					withCurrentVersion(installed),
+					withInstallDependencies,
+					withDependencies(dependencyRef),
+					withConditions(unmet, runtimev1alpha1.Available()),
+				),
+				dependency: ownedDependency(owner("other", "other-uid"), owner(resourceName, uid)),
+			},
+		},
+		{
+			name: "DependencyInstalledSeparately",
+			handler: &stackInstallHandler{
+				ext:  resource(withStackRecord(stackRecord), withInstallDependencies),
+				kube: fake.NewFakeClient(resource(withStackRecord(stackRecord), withInstallDependencies), withDependsOn(stack(unmet)), ownedDependency()),
+				log:  logging.NewNopLogger(),
+			},
+			want: want{
+				result: requeueOnSuccess,
+				si: resource(
+					withStackRecord(stackRecord),
+					withCurrentVersion(installed),
+					withInstallDependencies,
+					withDependencies(dependencyRef),
+					withConditions(unmet, runtimev1alpha1.Available()),
+				),
+				dependency: ownedDependency(),
+			},
+		},
+		{
+			name: "DependencyFailed",
+			handler: &stackInstallHandler{
+				ext:  resource(withStackRecord(stackRecord), withInstallDependencies),
+				kube: fake.NewFakeClient(resource(withStackRecord(stackRecord), withInstallDependencies), withDependsOn(stack(unmet)), dependency(runtimev1alpha1.ReconcileError(errBoom))),
+				log:  logging.NewNopLogger(),
+			},
+			want: want{
+				result: resultRequeue,
+				si: resource(
+					withStackRecord(stackRecord),
+					withCurrentVersion(installed),
+					withInstallDependencies,
+					withDependencies(dependencyRef),
+					withConditions(unmet, runtimev1alpha1.ReconcileError(errors.Errorf("cannot install dependencies with permission scope %q: cool-dependency: %s", "Namespaced", errBoom))),
+				),
+			},
+		},
+		{
+			name: "DependencyNameConflict",
+			handler: &stackInstallHandler{
+				ext: resource(withStackRecord(stackRecord), withInstallDependencies),
+				kube: func() client.Client {
+					other := dependency()
+					other.Spec.Package = "cool/other:v1.0.0"
+					return fake.NewFakeClient(resource(withStackRecord(stackRecord), withInstallDependencies), withDependsOn(stack(unmet)), other)
+				}(),
+				log: logging.NewNopLogger(),
+			},
+			want: want{
+				result: resultRequeue,
+				si: resource(
+					withStackRecord(stackRecord),
+					withCurrentVersion(installed),
+					withInstallDependencies,
+					withConditions(unmet, runtimev1alpha1.ReconcileError(errors.Errorf("cannot install dependency %q: StackInstall %q already installs package %q", "cool/dependency:v1.0.0", "cool-dependency", "cool/other:v1.0.0"))),
+				),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotResult, gotErr := tt.handler.update(ctx)
+
+			if diff := cmp.Diff(tt.want.err, gotErr, test.EquateErrors()); diff != "" {
+				t.Errorf("update() -want error, +got error:\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.want.result, gotResult); diff != "" {
+				t.Errorf("update() -want result, +got result:\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.want.si, tt.handler.ext, test.EquateConditions(), cmpopts.IgnoreFields(metav1.ObjectMeta{}, "ResourceVersion")); diff != "" {
+				t.Errorf("update() -want stackInstall, +got stackInstall:\n%v", diff)
+			}
+
+			if tt.want.dependency != nil {
+				got := &v1alpha1.StackInstall{}
+				if err := tt.handler.kube.Get(ctx, types.NamespacedName{Namespace: namespace, Name: tt.want.dependency.GetName()}, got); err != nil {
+					t.Fatalf("Get(dependency): %s", err)
+				}
+				if diff := cmp.Diff(tt.want.dependency, got, test.EquateConditions(), cmpopts.IgnoreFields(metav1.ObjectMeta{}, "ResourceVersion"), cmpopts.IgnoreTypes(metav1.TypeMeta{})); diff != "" {
+					t.Errorf("update() -want dependency, +got dependency:\n%v", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestDependencyInstall(t *testing.T) {
+	secrets := []corev1.LocalObjectReference{{Name: "pull"}}
+	verification := &v1alpha1.SignatureVerification{Required: true, TrustedKeysConfigMap: "keys"}
+	parent := func(r v1alpha1.StackInstaller) {
+		withSource("registry.example.org")(r)
+		withPackage("cool/stack:v1.0.0")(r)
+		withImagePullPolicy(corev1.PullAlways)(r)
+		withImagePullSecrets(secrets)(r)
+		withApproval(v1alpha1.ApprovalManual, true)(r)
+		r.SetServiceAccountAnnotations(map[string]string{"iam.example.org/role": "stack"})
+		spec := &r.(*v1alpha1.ClusterStackInstall).Spec
+		spec.UpgradePolicy = v1alpha1.UpgradePolicyLatest
+		spec.RollbackTo = 1
+		spec.InstallDependencies = v1alpha1.DependencyInstallPolicyIfNotPresent
+		spec.SignatureVerification = verification
+	}
+
+	type want struct {
+		install v1alpha1.StackInstaller
+		err     error
+	}
+
+	cases := map[string]struct {
+		ext  v1alpha1.StackInstaller
+		dep  v1alpha1.Dependency
+		want want
+	}{
+		"InheritsFromParent": {
+			ext: clusterInstallResource(parent),
+			dep: v1alpha1.Dependency{Package: "cool/dependency:v1.0.0", Version: "^1.0.0"},
+			want: want{
+				install: &v1alpha1.ClusterStackInstall{
+					ObjectMeta: metav1.ObjectMeta{Name: "cool-dependency", Namespace: namespace},
+					Spec: v1alpha1.StackInstallSpec{
+						StackControllerOptions: v1alpha1.StackControllerOptions{
+							ImagePullSecrets: secrets,
+							ImagePullPolicy:  corev1.PullAlways,
+						},
+						Package:               "registry.example.org/cool/dependency:v1.0.0",
+						SignatureVerification: verification,
+						InstallDependencies:   v1alpha1.DependencyInstallPolicyIfNotPresent,
+						Approval:              v1alpha1.ApprovalManual,
+					},
+				},
+			},
+		},
+		"InvalidPackage": {
+			ext:  resource(withSource("registry.example.org")),
+			dep:  v1alpha1.Dependency{Package: "Cool/Dependency"},
+			want: want{err: errors.Wrapf(errors.New("invalid reference format: repository name must be lowercase"), "invalid dependency package %q", "Cool/Dependency")},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			h := &stackInstallHandler{ext: tc.ext}
+			got, err := h.dependencyInstall(tc.dep)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("dependencyInstall(...): -want error, +got error:\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want.install, got); diff != "" {
+				t.Errorf("dependencyInstall(...): -want, +got:\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestStackInstallDelete(t *testing.T) {
 	tn := time.Now()
 
@@ -698,6 +1068,8 @@ func TestHandlerFactory(t *testing.T) {
 					podLogReader: &K8sReader{Client: nil},
 					log:          logging.NewNopLogger(),
 				},
+				tagLister:                &stacks.RegistryClient{},
+				digestResolver:           &stacks.RegistryClient{},
 				executorInfo:             &stacks.ExecutorInfo{Image: stackPackageImage},
 				ext:                      resource(),
 				log:                      logging.NewNopLogger(),
@@ -0,0 +1,258 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	runtimev1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	runtimeresource "github.com/crossplane/crossplane-runtime/pkg/resource"
+	"github.com/crossplane/crossplane/apis/stacks/v1alpha1"
+	"github.com/crossplane/crossplane/pkg/stacks"
+)
+
+// upgradeCheckInterval is how often installs whose upgrade policy is not
+// Manual check the registry for newer versions of their package.
+const upgradeCheckInterval = 1 * time.Hour
+
+// upgrade replaces the current version of the stack with the requested
+// version. An install job unpacks the requested package, and its output is
+// applied over the resources of the current version once the job succeeds.
+func (h *stackInstallHandler) upgrade(ctx context.Context) (reconcile.Result, error) {
+	if err := validatePackageSource(h.ext.GetPackageSource()); err != nil {
+		return fail(ctx, h.kube, h.ext, err)
+	}
+
+	job, err := h.createInstallJob(upgradeJobName(h.ext))
+	if err != nil {
+		return fail(ctx, h.kube, h.ext, err)
+	}
+	jobRef := h.ext.InstallJob()
+
+	if jobRef == nil || jobRef.Name != job.Name || jobRef.Namespace != job.Namespace {
+		// The upgrade job unpacks the image that the requested package's
+		// tag refers to now.
+		h.pinImageDigest(ctx)
+		if job, err = h.createInstallJob(upgradeJobName(h.ext)); err != nil {
+			return fail(ctx, h.kube, h.ext, err)
+		}
+		if err := h.ensureInstallJob(ctx, job); err != nil {
+			return fail(ctx, h.kube, h.ext, err)
+		}
+
+		// The job that unpacked the current version, or a version that is no
+		// longer requested, is superseded by the upgrade job.
+		if jobRef != nil {
+			old := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: jobRef.Name, Namespace: jobRef.Namespace}}
+			if err := h.hostKube.Delete(ctx, old, client.PropagationPolicy(metav1.DeletePropagationForeground)); runtimeresource.IgnoreNotFound(err) != nil {
+				return fail(ctx, h.kube, h.ext, err)
+			}
+		}
+
+		h.ext.SetInstallJob(&corev1.ObjectReference{Name: job.Name, Namespace: job.Namespace})
+		h.ext.SetConditions(runtimev1alpha1.ReconcileSuccess())
+		h.debugWithName("created upgrade job", "job", job.Name, "from", h.ext.CurrentVersion().Package, "to", h.ext.GetPackage())
+
+		return requeueOnSuccess, h.kube.Status().Update(ctx, h.ext)
+	}
+
+	return h.awaitInstallJob(ctx, jobRef, h.completeUpgrade)
+}
+
+// completeUpgrade installs the revision of the stack unpacked by the supplied
+// upgrade job, and records it in the revision history of the install.
+func (h *stackInstallHandler) completeUpgrade(ctx context.Context, job *batchv1.Job) error {
+	rev, err := h.jobCompleter.revisionFromJob(ctx, h.ext, job)
+	if err != nil {
+		return err
+	}
+
+	installed, err := h.installRevision(ctx, rev)
+	if err != nil || !installed {
+		return err
+	}
+	if err := h.recordRevision(ctx, rev); err != nil {
+		return err
+	}
+
+	h.debugWithName("upgraded stack", "previousVersion", h.ext.CurrentVersion().Version, "currentVersion", rev.Spec.Version)
+	h.setCurrentRevision(rev)
+	return nil
+}
+
+// installRevision applies the supplied revision of the stack over its current
+// version. The revision is not applied if it would make unsafe changes to the
+// stack's CRDs, unless the install allows unsafe upgrades. It returns true if
+// the revision was applied.
+func (h *stackInstallHandler) installRevision(ctx context.Context, rev *v1alpha1.StackRevision) (bool, error) {
+	issues, err := h.jobCompleter.checkRevision(ctx, rev)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case len(issues) == 0:
+		h.ext.SetConditions(v1alpha1.UpgradeSafe())
+	case h.ext.GetAnnotations()[stacks.AnnotationAllowUnsafeUpgrade] == "true":
+		h.ext.SetConditions(v1alpha1.UpgradeAllowed(strings.Join(issues, "; ")))
+	default:
+		// The revision is checked again when the install is next
+		// reconciled, for example because it was annotated to allow
+		// unsafe upgrades.
+		h.debugWithName("blocked unsafe upgrade", "revision", rev.GetName(), "issues", issues)
+		h.ext.SetConditions(v1alpha1.UpgradeBlocked(strings.Join(issues, "; ")))
+		return false, nil
+	}
+
+	if err := h.jobCompleter.applyRevision(ctx, rev); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// upgradeRequested returns true if the package requested by the supplied
+// install differs from the package its current version was installed from, or
+// if the tag of the requested package now refers to a different image.
+// Upgrades are not requested while the install is rolled back.
+func upgradeRequested(i v1alpha1.StackInstaller) bool {
+	cur := i.CurrentVersion()
+	if cur == nil || i.GetRollbackTo() != 0 {
+		return false
+	}
+	return cur.Package != i.GetPackage() ||
+		!equality.Semantic.DeepEqual(cur.PackageSource, i.GetPackageSource()) ||
+		cur.ImageDigest != i.ImageDigest()
+}
+
+// tracksUpgrades returns true if the supplied install is automatically
+// upgraded to newer versions of its package.
+func tracksUpgrades(i v1alpha1.StackInstaller) bool {
+	p := i.GetUpgradePolicy()
+	return p != "" && p != v1alpha1.UpgradePolicyManual && i.GetPackageSource() == nil
+}
+
+// checkForUpgrade lists the tags of the install's package if it has not been
+// checked for upgrades within the check interval, and updates the package to
+// the tag allowed by the install's upgrade policy, if any. Otherwise the digest
+// that the current tag refers to is resolved again, so that a tag that was
+// moved to a different image is upgraded like any other change to the
+// requested package. It returns how long to wait until the next check, and
+// whether the install's status was changed.
+func (h *stackInstallHandler) checkForUpgrade(ctx context.Context, now time.Time) (time.Duration, bool, error) {
+	if last := h.ext.LastUpgradeCheck(); last != nil {
+		if wait := last.Add(upgradeCheckInterval).Sub(now); wait > 0 {
+			return wait, false, nil
+		}
+	}
+
+	// The check is recorded even if it fails, so that a failing registry
+	// is not checked again until the next interval.
+	h.ext.SetLastUpgradeCheck(&metav1.Time{Time: now})
+
+	upgraded, err := h.upgradeTag(ctx)
+	if err != nil {
+		return 0, true, err
+	}
+	if upgraded {
+		return upgradeCheckInterval, true, nil
+	}
+
+	if err := h.resolveImageDigest(ctx); err != nil {
+		return 0, true, errors.Wrapf(err, "cannot check for upgrades of package %q", h.ext.GetPackage())
+	}
+	return upgradeCheckInterval, true, nil
+}
+
+// upgradeTag lists the tags of the install's package, and updates the package
+// to the tag allowed by the install's upgrade policy, if any. It returns true
+// if the package was updated.
+func (h *stackInstallHandler) upgradeTag(ctx context.Context) (bool, error) {
+	pkg := h.ext.GetPackage()
+	tag, err := stacks.PackageTag(pkg)
+	if err != nil {
+		return false, errors.Wrap(err, "cannot track upgrades")
+	}
+	image, err := h.ext.ImageWithSource(pkg)
+	if err != nil {
+		return false, errors.Wrapf(err, "cannot track upgrades of package %q", pkg)
+	}
+	auth, err := h.registryAuth(ctx)
+	if err != nil {
+		return false, err
+	}
+	tags, err := h.tagLister.ListTags(ctx, image, auth)
+	if err != nil {
+		return false, errors.Wrapf(err, "cannot track upgrades of package %q", pkg)
+	}
+	upgrade, ok, err := stacks.UpgradeTag(tag, tags, h.ext.GetUpgradePolicy())
+	if err != nil || !ok {
+		return false, err
+	}
+
+	next, err := stacks.WithPackageTag(pkg, upgrade)
+	if err != nil {
+		return false, err
+	}
+	h.debugWithName("upgrading to newer package", "policy", h.ext.GetUpgradePolicy(), "from", pkg, "to", next)
+
+	// The spec is updated using a copy of the install, because updating it
+	// refreshes it from the API server, discarding any status changes that
+	// are yet to be recorded.
+	u := h.ext.DeepCopyObject().(v1alpha1.StackInstaller)
+	u.SetPackage(next)
+	if err := h.kube.Update(ctx, u); err != nil {
+		return false, errors.Wrapf(err, "cannot update package to %q", next)
+	}
+	h.ext.SetPackage(next)
+	h.ext.SetResourceVersion(u.GetResourceVersion())
+	return true, nil
+}
+
+// installedVersion returns the version of the supplied Stack, which was
+// installed by the supplied install.
+func installedVersion(i v1alpha1.StackInstaller, s *v1alpha1.Stack) *v1alpha1.StackVersion {
+	return &v1alpha1.StackVersion{
+		Package:       i.GetPackage(),
+		PackageSource: i.GetPackageSource().DeepCopy(),
+		Version:       s.Spec.Version,
+		Digest:        s.GetAnnotations()[stacks.AnnotationPackageDigest],
+		ImageDigest:   i.ImageDigest(),
+	}
+}
+
+// upgradeJobName returns the name of the job that upgrades the supplied
+// install to its requested package. The name is derived from the requested
+// package and the image digest its tag was resolved to, so that the output of
+// a job is never mistaken for that of another package or image.
+func upgradeJobName(i v1alpha1.StackInstaller) string {
+	// Marshalling a string and a struct of strings cannot fail.
+	b, _ := json.Marshal(v1alpha1.StackVersion{Package: i.GetPackage(), PackageSource: i.GetPackageSource(), ImageDigest: i.ImageDigest()})
+	sum := sha256.Sum256(b)
+	return fmt.Sprintf("%s-%x", i.GetName(), sum[:4])
+}
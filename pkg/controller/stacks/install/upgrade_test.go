@@ -0,0 +1,673 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/pkg/errors"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	runtimev1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/crossplane/crossplane/apis/stacks/v1alpha1"
+	"github.com/crossplane/crossplane/pkg/stacks"
+)
+
+func TestStackInstallUpgrade(t *testing.T) {
+	stackRecord := &corev1.ObjectReference{Name: resourceName, Namespace: namespace, UID: uid}
+	v1 := &v1alpha1.StackVersion{Package: "cool/stack:v1", Version: "1.0.0", Digest: "sha256:v1"}
+	v2 := &v1alpha1.StackVersion{Package: "cool/stack:v2", Version: "2.0.0", Digest: "sha256:v2"}
+	stack := &v1alpha1.Stack{ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: namespace}}
+
+	installJobRef := &corev1.ObjectReference{Name: resourceName, Namespace: namespace}
+	upgradeJobRef := &corev1.ObjectReference{
+		Name:      upgradeJobName(resource(withPackage(v2.Package))),
+		Namespace: namespace,
+	}
+	resolvedJobRef := &corev1.ObjectReference{
+		Name:      upgradeJobName(resource(withPackage(v2.Package), withImageDigest(imageDigest))),
+		Namespace: namespace,
+	}
+	moved := &v1alpha1.StackVersion{Package: v1.Package, Version: v1.Version, Digest: v1.Digest, ImageDigest: "sha256:moved"}
+	movedJobRef := &corev1.ObjectReference{
+		Name:      upgradeJobName(resource(withPackage(v1.Package), withImageDigest(imageDigest))),
+		Namespace: namespace,
+	}
+	upgradeJob := func(c ...batchv1.JobCondition) *batchv1.Job {
+		j := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: upgradeJobRef.Name, Namespace: namespace}}
+		j.Status.Conditions = c
+		return j
+	}
+	installing := func(rm ...resourceModifier) *v1alpha1.StackInstall {
+		return resource(append([]resourceModifier{
+			withPackage(v2.Package),
+			withStackRecord(stackRecord),
+			withCurrentVersion(v1),
+		}, rm...)...)
+	}
+	allowUnsafe := map[string]string{stacks.AnnotationAllowUnsafeUpgrade: "true"}
+	issues := []string{"CRD mytypes.samples.upbound.io: version v1 is removed while objects are stored"}
+	upgraded := &v1alpha1.StackVersion{Package: v2.Package, Version: v2.Version, Digest: v2.Digest, Revision: 1}
+	completer := func(issues []string, checkErr, applyErr error) jobCompleter {
+		return &mockJobCompleter{
+			MockRevisionFromJob: func(_ context.Context, i v1alpha1.StackInstaller, job *batchv1.Job) (*v1alpha1.StackRevision, error) {
+				return &v1alpha1.StackRevision{
+					ObjectMeta: metav1.ObjectMeta{Name: job.GetName(), Namespace: namespace, Labels: stacks.ParentLabels(i)},
+					Spec: v1alpha1.StackRevisionSpec{
+						StackVersion: v1alpha1.StackVersion{Package: v2.Package, Version: v2.Version, Digest: v2.Digest},
+					},
+				}, nil
+			},
+			MockCheckRevision: func(_ context.Context, _ *v1alpha1.StackRevision) ([]string, error) {
+				return issues, checkErr
+			},
+			MockApplyRevision: func(_ context.Context, _ *v1alpha1.StackRevision) error {
+				return applyErr
+			},
+			MockSummarizePermissions: func(_ context.Context, _ v1alpha1.StackInstaller, _ *batchv1.Job) (string, error) {
+				return "summary", nil
+			},
+		}
+	}
+
+	type want struct {
+		result    reconcile.Result
+		err       error
+		si        *v1alpha1.StackInstall
+		jobs      []string
+		images    []string
+		revisions []string
+	}
+
+	tests := map[string]struct {
+		handler *stackInstallHandler
+		want    want
+	}{
+		"NotRequested": {
+			handler: &stackInstallHandler{
+				ext:      resource(withPackage(v1.Package), withStackRecord(stackRecord), withCurrentVersion(v1)),
+				kube:     fake.NewFakeClient(resource(withPackage(v1.Package), withStackRecord(stackRecord), withCurrentVersion(v1)), stack),
+				hostKube: fake.NewFakeClient(job()),
+				log:      logging.NewNopLogger(),
+			},
+			want: want{
+				result: reconcile.Result{},
+				si:     resource(withPackage(v1.Package), withStackRecord(stackRecord), withCurrentVersion(v1)),
+				jobs:   []string{resourceName},
+			},
+		},
+		"CreateUpgradeJob": {
+			handler: &stackInstallHandler{
+				ext:      installing(withInstallJob(installJobRef)),
+				kube:     fake.NewFakeClient(installing(withInstallJob(installJobRef)), stack),
+				hostKube: fake.NewFakeClient(job()),
+				digestResolver: digestResolverFn(func(_ context.Context, image string, _ stacks.RegistryAuth) (string, error) {
+					if image != v2.Package {
+						return "", errors.Errorf("unexpected image %q", image)
+					}
+					return imageDigest, nil
+				}),
+				executorInfo: &stacks.ExecutorInfo{Image: stackPackageImage},
+				log:          logging.NewNopLogger(),
+			},
+			want: want{
+				result: requeueOnSuccess,
+				si: installing(
+					withInstallJob(resolvedJobRef),
+					withImageDigest(imageDigest),
+					withConditions(v1alpha1.ImagePinned(), runtimev1alpha1.ReconcileSuccess()),
+				),
+				jobs:   []string{resolvedJobRef.Name},
+				images: []string{v2.Package + "@" + imageDigest},
+			},
+		},
+		"CreateUpgradeJobUnresolved": {
+			handler: &stackInstallHandler{
+				ext:      installing(withInstallJob(installJobRef)),
+				kube:     fake.NewFakeClient(installing(withInstallJob(installJobRef)), stack),
+				hostKube: fake.NewFakeClient(job()),
+				digestResolver: digestResolverFn(func(_ context.Context, _ string, _ stacks.RegistryAuth) (string, error) {
+					return "", errBoom
+				}),
+				executorInfo: &stacks.ExecutorInfo{Image: stackPackageImage},
+				log:          logging.NewNopLogger(),
+			},
+			want: want{
+				result: requeueOnSuccess,
+				si: installing(
+					withInstallJob(upgradeJobRef),
+					withConditions(v1alpha1.ImageUnpinned(errBoom.Error()), runtimev1alpha1.ReconcileSuccess()),
+				),
+				jobs:   []string{upgradeJobRef.Name},
+				images: []string{v2.Package},
+			},
+		},
+		"CreateUpgradeJobForMovedTag": {
+			handler: &stackInstallHandler{
+				ext: resource(withPackage(v1.Package), withStackRecord(stackRecord), withCurrentVersion(moved), withImageDigest(imageDigest), withInstallJob(installJobRef)),
+				kube: fake.NewFakeClient(
+					resource(withPackage(v1.Package), withStackRecord(stackRecord), withCurrentVersion(moved), withImageDigest(imageDigest), withInstallJob(installJobRef)),
+					stack,
+				),
+				hostKube: fake.NewFakeClient(job()),
+				digestResolver: digestResolverFn(func(_ context.Context, image string, _ stacks.RegistryAuth) (string, error) {
+					return imageDigest, nil
+				}),
+				executorInfo: &stacks.ExecutorInfo{Image: stackPackageImage},
+				log:          logging.NewNopLogger(),
+			},
+			want: want{
+				result: requeueOnSuccess,
+				si: resource(
+					withPackage(v1.Package),
+					withStackRecord(stackRecord),
+					withCurrentVersion(moved),
+					withImageDigest(imageDigest),
+					withInstallJob(movedJobRef),
+					withConditions(v1alpha1.ImagePinned(), runtimev1alpha1.ReconcileSuccess()),
+				),
+				jobs:   []string{movedJobRef.Name},
+				images: []string{v1.Package + "@" + imageDigest},
+			},
+		},
+		"AwaitUpgradeJob": {
+			handler: &stackInstallHandler{
+				ext:          installing(withInstallJob(upgradeJobRef)),
+				kube:         fake.NewFakeClient(installing(withInstallJob(upgradeJobRef)), stack),
+				hostKube:     fake.NewFakeClient(upgradeJob()),
+				executorInfo: &stacks.ExecutorInfo{Image: stackPackageImage},
+				log:          logging.NewNopLogger(),
+			},
+			want: want{
+				result: requeueOnSuccess,
+				si:     installing(withInstallJob(upgradeJobRef), withConditions(runtimev1alpha1.ReconcileSuccess())),
+				jobs:   []string{upgradeJobRef.Name},
+			},
+		},
+		"UpgradeJobFailed": {
+			handler: &stackInstallHandler{
+				ext:          installing(withInstallJob(upgradeJobRef)),
+				kube:         fake.NewFakeClient(installing(withInstallJob(upgradeJobRef)), stack),
+				hostKube:     fake.NewFakeClient(upgradeJob(batchv1.JobCondition{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "boom"})),
+				executorInfo: &stacks.ExecutorInfo{Image: stackPackageImage},
+				log:          logging.NewNopLogger(),
+			},
+			want: want{
+				result: resultRequeue,
+				si:     installing(withInstallJob(upgradeJobRef), withConditions(runtimev1alpha1.ReconcileError(errBoom))),
+				jobs:   []string{upgradeJobRef.Name},
+			},
+		},
+		"CheckUpgradeFailed": {
+			handler: &stackInstallHandler{
+				ext:          installing(withInstallJob(upgradeJobRef)),
+				kube:         fake.NewFakeClient(installing(withInstallJob(upgradeJobRef)), stack),
+				hostKube:     fake.NewFakeClient(upgradeJob(batchv1.JobCondition{Type: batchv1.JobComplete, Status: corev1.ConditionTrue})),
+				executorInfo: &stacks.ExecutorInfo{Image: stackPackageImage},
+				jobCompleter: completer(nil, errBoom, nil),
+				log:          logging.NewNopLogger(),
+			},
+			want: want{
+				result: resultRequeue,
+				si:     installing(withInstallJob(upgradeJobRef), withPermissionsSummary("summary"), withConditions(runtimev1alpha1.ReconcileError(errBoom))),
+				jobs:   []string{upgradeJobRef.Name},
+			},
+		},
+		"UpgradeBlocked": {
+			handler: &stackInstallHandler{
+				ext:          installing(withInstallJob(upgradeJobRef)),
+				kube:         fake.NewFakeClient(installing(withInstallJob(upgradeJobRef)), stack),
+				hostKube:     fake.NewFakeClient(upgradeJob(batchv1.JobCondition{Type: batchv1.JobComplete, Status: corev1.ConditionTrue})),
+				executorInfo: &stacks.ExecutorInfo{Image: stackPackageImage},
+				jobCompleter: completer(issues, nil, nil),
+				log:          logging.NewNopLogger(),
+			},
+			want: want{
+				result: requeueOnSuccess,
+				si: installing(
+					withInstallJob(upgradeJobRef),
+					withPermissionsSummary("summary"),
+					withConditions(v1alpha1.UpgradeBlocked(issues[0]), runtimev1alpha1.ReconcileSuccess()),
+				),
+				jobs: []string{upgradeJobRef.Name},
+			},
+		},
+		"UnsafeUpgradeAllowed": {
+			handler: &stackInstallHandler{
+				ext:          installing(withInstallJob(upgradeJobRef), withAnnotations(allowUnsafe)),
+				kube:         fake.NewFakeClient(installing(withInstallJob(upgradeJobRef), withAnnotations(allowUnsafe)), stack),
+				hostKube:     fake.NewFakeClient(upgradeJob(batchv1.JobCondition{Type: batchv1.JobComplete, Status: corev1.ConditionTrue})),
+				executorInfo: &stacks.ExecutorInfo{Image: stackPackageImage},
+				jobCompleter: completer(issues, nil, nil),
+				log:          logging.NewNopLogger(),
+			},
+			want: want{
+				result: requeueOnSuccess,
+				si: installing(
+					withInstallJob(upgradeJobRef),
+					withPermissionsSummary("summary"),
+					withAnnotations(allowUnsafe),
+					withCurrentVersion(upgraded),
+					withPreviousVersion(v1),
+					withConditions(v1alpha1.UpgradeAllowed(issues[0]), runtimev1alpha1.ReconcileSuccess()),
+				),
+				jobs:      []string{upgradeJobRef.Name},
+				revisions: []string{upgradeJobRef.Name},
+			},
+		},
+		"UpgradeFailed": {
+			handler: &stackInstallHandler{
+				ext:          installing(withInstallJob(upgradeJobRef)),
+				kube:         fake.NewFakeClient(installing(withInstallJob(upgradeJobRef)), stack),
+				hostKube:     fake.NewFakeClient(upgradeJob(batchv1.JobCondition{Type: batchv1.JobComplete, Status: corev1.ConditionTrue})),
+				executorInfo: &stacks.ExecutorInfo{Image: stackPackageImage},
+				jobCompleter: completer(nil, nil, errBoom),
+				log:          logging.NewNopLogger(),
+			},
+			want: want{
+				result: resultRequeue,
+				si:     installing(withInstallJob(upgradeJobRef), withPermissionsSummary("summary"), withConditions(v1alpha1.UpgradeSafe(), runtimev1alpha1.ReconcileError(errBoom))),
+				jobs:   []string{upgradeJobRef.Name},
+			},
+		},
+		"ApprovalRevoked": {
+			handler: &stackInstallHandler{
+				ext:          installing(withInstallJob(upgradeJobRef), withApproval(v1alpha1.ApprovalManual, true), withApprovedDigest("sha256:v1")),
+				kube:         fake.NewFakeClient(installing(withInstallJob(upgradeJobRef), withApproval(v1alpha1.ApprovalManual, true), withApprovedDigest("sha256:v1")), stack),
+				hostKube:     fake.NewFakeClient(upgradeJob(batchv1.JobCondition{Type: batchv1.JobComplete, Status: corev1.ConditionTrue})),
+				executorInfo: &stacks.ExecutorInfo{Image: stackPackageImage},
+				jobCompleter: completer(nil, nil, nil),
+				log:          logging.NewNopLogger(),
+			},
+			want: want{
+				result: reconcile.Result{},
+				si: installing(
+					withInstallJob(upgradeJobRef),
+					withApproval(v1alpha1.ApprovalManual, false),
+					withPermissionsSummary("summary"),
+					withConditions(runtimev1alpha1.Unavailable().WithMessage(waitingForApproval), runtimev1alpha1.ReconcileSuccess()),
+				),
+				jobs: []string{upgradeJobRef.Name},
+			},
+		},
+		"ApprovedUpgradeComplete": {
+			handler: &stackInstallHandler{
+				ext:          installing(withInstallJob(upgradeJobRef), withApproval(v1alpha1.ApprovalManual, true)),
+				kube:         fake.NewFakeClient(installing(withInstallJob(upgradeJobRef), withApproval(v1alpha1.ApprovalManual, true)), stack),
+				hostKube:     fake.NewFakeClient(upgradeJob(batchv1.JobCondition{Type: batchv1.JobComplete, Status: corev1.ConditionTrue})),
+				executorInfo: &stacks.ExecutorInfo{Image: stackPackageImage},
+				jobCompleter: completer(nil, nil, nil),
+				log:          logging.NewNopLogger(),
+			},
+			want: want{
+				result: requeueOnSuccess,
+				si: installing(
+					withInstallJob(upgradeJobRef),
+					withApproval(v1alpha1.ApprovalManual, true),
+					withApprovedDigest(approvalDigest(requestedVersion(installing()), "summary")),
+					withPermissionsSummary("summary"),
+					withCurrentVersion(upgraded),
+					withPreviousVersion(v1),
+					withConditions(v1alpha1.UpgradeSafe(), runtimev1alpha1.ReconcileSuccess()),
+				),
+				jobs:      []string{upgradeJobRef.Name},
+				revisions: []string{upgradeJobRef.Name},
+			},
+		},
+		"UpgradeComplete": {
+			handler: &stackInstallHandler{
+				ext:          installing(withInstallJob(upgradeJobRef)),
+				kube:         fake.NewFakeClient(installing(withInstallJob(upgradeJobRef)), stack),
+				hostKube:     fake.NewFakeClient(upgradeJob(batchv1.JobCondition{Type: batchv1.JobComplete, Status: corev1.ConditionTrue})),
+				executorInfo: &stacks.ExecutorInfo{Image: stackPackageImage},
+				jobCompleter: completer(nil, nil, nil),
+				log:          logging.NewNopLogger(),
+			},
+			want: want{
+				result: requeueOnSuccess,
+				si: installing(
+					withInstallJob(upgradeJobRef),
+					withPermissionsSummary("summary"),
+					withCurrentVersion(upgraded),
+					withPreviousVersion(v1),
+					withConditions(v1alpha1.UpgradeSafe(), runtimev1alpha1.ReconcileSuccess()),
+				),
+				jobs:      []string{upgradeJobRef.Name},
+				revisions: []string{upgradeJobRef.Name},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			gotResult, gotErr := tc.handler.update(ctx)
+
+			if diff := cmp.Diff(tc.want.err, gotErr, test.EquateErrors()); diff != "" {
+				t.Errorf("update() -want error, +got error:\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tc.want.result, gotResult); diff != "" {
+				t.Errorf("update() -want result, +got result:\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tc.want.si, tc.handler.ext, test.EquateConditions(), cmpopts.IgnoreFields(metav1.ObjectMeta{}, "ResourceVersion")); diff != "" {
+				t.Errorf("update() -want stackInstall, +got stackInstall:\n%v", diff)
+			}
+
+			jobs := &batchv1.JobList{}
+			if err := tc.handler.hostKube.List(ctx, jobs, client.InNamespace(namespace)); err != nil {
+				t.Fatalf("List(...): %s", err)
+			}
+			got := []string{}
+			for _, j := range jobs.Items {
+				got = append(got, j.GetName())
+			}
+			if diff := cmp.Diff(tc.want.jobs, got); diff != "" {
+				t.Errorf("update() -want jobs, +got jobs:\n%s", diff)
+			}
+
+			if tc.want.images != nil {
+				images := []string{}
+				for _, j := range jobs.Items {
+					images = append(images, j.Spec.Template.Spec.InitContainers[0].Image)
+				}
+				if diff := cmp.Diff(tc.want.images, images); diff != "" {
+					t.Errorf("update() -want job images, +got job images:\n%s", diff)
+				}
+			}
+
+			revs := &v1alpha1.StackRevisionList{}
+			if err := tc.handler.kube.List(ctx, revs, client.InNamespace(namespace)); err != nil {
+				t.Fatalf("List(...): %s", err)
+			}
+			got = []string{}
+			for _, r := range revs.Items {
+				got = append(got, r.GetName())
+			}
+			if diff := cmp.Diff(tc.want.revisions, got, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("update() -want revisions, +got revisions:\n%s", diff)
+			}
+
+			stored := &v1alpha1.StackInstall{}
+			if err := tc.handler.kube.Get(ctx, types.NamespacedName{Name: resourceName, Namespace: namespace}, stored); err != nil {
+				t.Fatalf("Get(...): %s", err)
+			}
+			if diff := cmp.Diff(tc.want.si.Spec, stored.Spec); diff != "" {
+				t.Errorf("update() -want stored spec, +got stored spec:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUpgradeRequested(t *testing.T) {
+	git := &v1alpha1.PackageSource{Git: &v1alpha1.GitSource{URL: "https://example.org/stack.git", Ref: "v1"}}
+	otherRef := &v1alpha1.PackageSource{Git: &v1alpha1.GitSource{URL: "https://example.org/stack.git", Ref: "v2"}}
+	withPackageSource := func(src *v1alpha1.PackageSource) resourceModifier {
+		return func(r v1alpha1.StackInstaller) { r.(*v1alpha1.StackInstall).Spec.PackageSource = src }
+	}
+
+	cases := map[string]struct {
+		i    v1alpha1.StackInstaller
+		want bool
+	}{
+		"NotInstalled": {
+			i:    resource(withPackage("cool/stack:v2")),
+			want: false,
+		},
+		"SamePackage": {
+			i:    resource(withPackage("cool/stack:v1"), withCurrentVersion(&v1alpha1.StackVersion{Package: "cool/stack:v1"})),
+			want: false,
+		},
+		"NewPackage": {
+			i:    resource(withPackage("cool/stack:v2"), withCurrentVersion(&v1alpha1.StackVersion{Package: "cool/stack:v1"})),
+			want: true,
+		},
+		"SameImageDigest": {
+			i:    resource(withPackage("cool/stack:v1"), withImageDigest(imageDigest), withCurrentVersion(&v1alpha1.StackVersion{Package: "cool/stack:v1", ImageDigest: imageDigest})),
+			want: false,
+		},
+		"NewImageDigest": {
+			i:    resource(withPackage("cool/stack:v1"), withImageDigest(imageDigest), withCurrentVersion(&v1alpha1.StackVersion{Package: "cool/stack:v1", ImageDigest: "sha256:moved"})),
+			want: true,
+		},
+		"SamePackageSource": {
+			i:    resource(withPackageSource(git), withCurrentVersion(&v1alpha1.StackVersion{PackageSource: git.DeepCopy()})),
+			want: false,
+		},
+		"NewPackageSource": {
+			i:    resource(withPackageSource(otherRef), withCurrentVersion(&v1alpha1.StackVersion{PackageSource: git.DeepCopy()})),
+			want: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := upgradeRequested(tc.i); got != tc.want {
+				t.Errorf("upgradeRequested(...): want %t, got %t", tc.want, got)
+			}
+		})
+	}
+}
+
+type tagListerFn func(ctx context.Context, image string, auth stacks.RegistryAuth) ([]string, error)
+
+func (fn tagListerFn) ListTags(ctx context.Context, image string, auth stacks.RegistryAuth) ([]string, error) {
+	return fn(ctx, image, auth)
+}
+
+func withUpgradePolicy(p v1alpha1.UpgradePolicy) resourceModifier {
+	return func(r v1alpha1.StackInstaller) { r.(*v1alpha1.StackInstall).Spec.UpgradePolicy = p }
+}
+
+func withLastUpgradeCheck(t time.Time) resourceModifier {
+	return func(r v1alpha1.StackInstaller) { r.SetLastUpgradeCheck(&metav1.Time{Time: t}) }
+}
+
+func TestCheckForUpgrade(t *testing.T) {
+	now := time.Now()
+	tags := func(want string, tags ...string) stacks.TagLister {
+		return tagListerFn(func(_ context.Context, image string, _ stacks.RegistryAuth) ([]string, error) {
+			if image != want {
+				return nil, errors.Errorf("unexpected image %q", image)
+			}
+			return tags, nil
+		})
+	}
+	available := tags("cool/stack:1.0.0", "latest", "1.0.0", "1.0.1", "1.0.2-rc.1", "1.1.0", "2.0.0")
+	resolved := digestResolverFn(func(_ context.Context, image string, _ stacks.RegistryAuth) (string, error) {
+		if image != "cool/stack:2.0.0" {
+			return "", errors.Errorf("unexpected image %q", image)
+		}
+		return imageDigest, nil
+	})
+
+	type want struct {
+		wait    time.Duration
+		checked bool
+		err     error
+		si      *v1alpha1.StackInstall
+		pkg     string
+	}
+
+	cases := map[string]struct {
+		ext            *v1alpha1.StackInstall
+		tagLister      stacks.TagLister
+		digestResolver stacks.DigestResolver
+		want           want
+	}{
+		"NotDue": {
+			ext:       resource(withPackage("cool/stack:1.0.0"), withUpgradePolicy(v1alpha1.UpgradePolicyLatest), withLastUpgradeCheck(now.Add(-10*time.Minute))),
+			tagLister: available,
+			want: want{
+				wait: 50 * time.Minute,
+				si:   resource(withPackage("cool/stack:1.0.0"), withUpgradePolicy(v1alpha1.UpgradePolicyLatest), withLastUpgradeCheck(now.Add(-10*time.Minute))),
+				pkg:  "cool/stack:1.0.0",
+			},
+		},
+		"NoNewerVersion": {
+			ext:            resource(withPackage("cool/stack:2.0.0"), withUpgradePolicy(v1alpha1.UpgradePolicyLatest), withLastUpgradeCheck(now.Add(-2*time.Hour))),
+			tagLister:      tags("cool/stack:2.0.0", "1.0.0", "2.0.0", "2.1.0-alpha.1"),
+			digestResolver: resolved,
+			want: want{
+				wait:    upgradeCheckInterval,
+				checked: true,
+				si:      resource(withPackage("cool/stack:2.0.0"), withUpgradePolicy(v1alpha1.UpgradePolicyLatest), withLastUpgradeCheck(now), withImageDigest(imageDigest)),
+				pkg:     "cool/stack:2.0.0",
+			},
+		},
+		"ResolveDigestError": {
+			ext:       resource(withPackage("cool/stack:2.0.0"), withUpgradePolicy(v1alpha1.UpgradePolicyLatest), withImageDigest(imageDigest)),
+			tagLister: tags("cool/stack:2.0.0", "1.0.0", "2.0.0"),
+			digestResolver: digestResolverFn(func(_ context.Context, _ string, _ stacks.RegistryAuth) (string, error) {
+				return "", errBoom
+			}),
+			want: want{
+				checked: true,
+				err:     errors.Wrapf(errBoom, "cannot check for upgrades of package %q", "cool/stack:2.0.0"),
+				si:      resource(withPackage("cool/stack:2.0.0"), withUpgradePolicy(v1alpha1.UpgradePolicyLatest), withLastUpgradeCheck(now), withImageDigest(imageDigest)),
+				pkg:     "cool/stack:2.0.0",
+			},
+		},
+		"PatchUpgrade": {
+			ext:       resource(withPackage("cool/stack:1.0.0"), withUpgradePolicy(v1alpha1.UpgradePolicyPatch)),
+			tagLister: available,
+			want: want{
+				wait:    upgradeCheckInterval,
+				checked: true,
+				si:      resource(withPackage("cool/stack:1.0.1"), withUpgradePolicy(v1alpha1.UpgradePolicyPatch), withLastUpgradeCheck(now)),
+				pkg:     "cool/stack:1.0.1",
+			},
+		},
+		"MinorUpgrade": {
+			ext:       resource(withPackage("cool/stack:1.0.0"), withUpgradePolicy(v1alpha1.UpgradePolicyMinor)),
+			tagLister: available,
+			want: want{
+				wait:    upgradeCheckInterval,
+				checked: true,
+				si:      resource(withPackage("cool/stack:1.1.0"), withUpgradePolicy(v1alpha1.UpgradePolicyMinor), withLastUpgradeCheck(now)),
+				pkg:     "cool/stack:1.1.0",
+			},
+		},
+		"LatestUpgrade": {
+			ext:       resource(withPackage("cool/stack:1.0.0"), withUpgradePolicy(v1alpha1.UpgradePolicyLatest)),
+			tagLister: available,
+			want: want{
+				wait:    upgradeCheckInterval,
+				checked: true,
+				si:      resource(withPackage("cool/stack:2.0.0"), withUpgradePolicy(v1alpha1.UpgradePolicyLatest), withLastUpgradeCheck(now)),
+				pkg:     "cool/stack:2.0.0",
+			},
+		},
+		"UpgradeFromSource": {
+			ext:       resource(withPackage("cool/stack:1.0.0"), withSource("registry.example.org"), withUpgradePolicy(v1alpha1.UpgradePolicyLatest)),
+			tagLister: tags("registry.example.org/cool/stack:1.0.0", "1.0.0", "1.0.1"),
+			want: want{
+				wait:    upgradeCheckInterval,
+				checked: true,
+				si:      resource(withPackage("cool/stack:1.0.1"), withSource("registry.example.org"), withUpgradePolicy(v1alpha1.UpgradePolicyLatest), withLastUpgradeCheck(now)),
+				pkg:     "cool/stack:1.0.1",
+			},
+		},
+		"NotTagged": {
+			ext:       resource(withPackage("cool/stack"), withUpgradePolicy(v1alpha1.UpgradePolicyLatest)),
+			tagLister: available,
+			want: want{
+				checked: true,
+				err:     errors.Wrap(errors.New(`package "cool/stack" is not tagged`), "cannot track upgrades"),
+				si:      resource(withPackage("cool/stack"), withUpgradePolicy(v1alpha1.UpgradePolicyLatest), withLastUpgradeCheck(now)),
+				pkg:     "cool/stack",
+			},
+		},
+		"ListTagsError": {
+			ext: resource(withPackage("cool/stack:1.0.0"), withUpgradePolicy(v1alpha1.UpgradePolicyLatest)),
+			tagLister: tagListerFn(func(_ context.Context, _ string, _ stacks.RegistryAuth) ([]string, error) {
+				return nil, errBoom
+			}),
+			want: want{
+				checked: true,
+				err:     errors.Wrapf(errBoom, "cannot track upgrades of package %q", "cool/stack:1.0.0"),
+				si:      resource(withPackage("cool/stack:1.0.0"), withUpgradePolicy(v1alpha1.UpgradePolicyLatest), withLastUpgradeCheck(now)),
+				pkg:     "cool/stack:1.0.0",
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			h := &stackInstallHandler{
+				ext:            tc.ext,
+				kube:           fake.NewFakeClient(tc.ext.DeepCopy()),
+				tagLister:      tc.tagLister,
+				digestResolver: tc.digestResolver,
+				log:            logging.NewNopLogger(),
+			}
+			wait, checked, err := h.checkForUpgrade(ctx, now)
+
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("checkForUpgrade(...): -want error, +got error:\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want.wait, wait); diff != "" {
+				t.Errorf("checkForUpgrade(...): -want wait, +got wait:\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want.checked, checked); diff != "" {
+				t.Errorf("checkForUpgrade(...): -want checked, +got checked:\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want.si, h.ext, cmpopts.IgnoreFields(metav1.ObjectMeta{}, "ResourceVersion")); diff != "" {
+				t.Errorf("checkForUpgrade(...): -want stackInstall, +got stackInstall:\n%s", diff)
+			}
+
+			got := &v1alpha1.StackInstall{}
+			if err := h.kube.Get(ctx, types.NamespacedName{Name: resourceName, Namespace: namespace}, got); err != nil {
+				t.Fatalf("Get(...): %s", err)
+			}
+			if diff := cmp.Diff(tc.want.pkg, got.Spec.Package); diff != "" {
+				t.Errorf("checkForUpgrade(...): -want package, +got package:\n%s", diff)
+			}
+		})
+	}
+}
+
+// Test that upgrade job names identify the requested package and image.
+func TestUpgradeJobName(t *testing.T) {
+	v1 := upgradeJobName(resource(withPackage("cool/stack:v1")))
+	v2 := upgradeJobName(resource(withPackage("cool/stack:v2")))
+
+	if v1 == v2 {
+		t.Errorf("upgradeJobName(...): want distinct names for distinct packages, got %q", v1)
+	}
+	if want := resourceName + "-"; v1[:len(want)] != want {
+		t.Errorf("upgradeJobName(...): want prefix %q, got %q", want, v1)
+	}
+	if got := upgradeJobName(resource(withPackage("cool/stack:v1"))); got != v1 {
+		t.Errorf("upgradeJobName(...): want %q, got %q", v1, got)
+	}
+	if moved := upgradeJobName(resource(withPackage("cool/stack:v1"), withImageDigest(imageDigest))); moved == v1 {
+		t.Errorf("upgradeJobName(...): want distinct names for distinct image digests, got %q", moved)
+	}
+}
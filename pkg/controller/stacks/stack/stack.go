@@ -23,13 +23,16 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	admissionregistration "k8s.io/api/admissionregistration/v1beta1"
 	apps "k8s.io/api/apps/v1"
 	batch "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -53,6 +56,10 @@ const (
 	reconcileTimeout      = 1 * time.Minute
 	requeueAfterOnSuccess = 10 * time.Second
 
+	// Dependencies are usually installed by a human, so there is little point
+	// checking for them as frequently as we requeue on success.
+	requeueAfterOnUnmetDependencies = 30 * time.Second
+
 	saVolumeName      = "sa-token"
 	envK8SServiceHost = "KUBERNETES_SERVICE_HOST"
 	envK8SServicePort = "KUBERNETES_SERVICE_PORT"
@@ -63,6 +70,12 @@ const (
 	errFailedToPrepareHostAwareDeployment       = "failed to prepare host aware stack controller deployment"
 	errFailedToCreateDeployment                 = "failed to create deployment"
 	errFailedToGetDeployment                    = "failed to get deployment"
+	errFailedToUpdateDeployment                 = "failed to update deployment"
+	errFailedToPrepareHostAwareJob              = "failed to prepare host aware stack controller job"
+	errFailedToCreateJob                        = "failed to create job"
+	errFailedToGetJob                           = "failed to get job"
+	errFailedToDeleteJob                        = "failed to delete job"
+	errJobFailed                                = "job %s failed: %s"
 	errFailedToSyncSASecret                     = "failed sync stack controller service account secret"
 	errServiceAccountNotFound                   = "service account is not found (not created yet?)"
 	errFailedToGetServiceAccount                = "failed to get service account"
@@ -75,11 +88,7 @@ var (
 	resultRequeue    = reconcile.Result{Requeue: true}
 	requeueOnSuccess = reconcile.Result{RequeueAfter: requeueAfterOnSuccess}
 
-	roleVerbs = map[string][]string{
-		"admin": {"get", "list", "watch", "create", "delete", "deletecollection", "patch", "update"},
-		"edit":  {"get", "list", "watch", "create", "delete", "deletecollection", "patch", "update"},
-		"view":  {"get", "list", "watch"},
-	}
+	requeueOnUnmetDependencies = reconcile.Result{RequeueAfter: requeueAfterOnUnmetDependencies}
 
 	disableAutoMount = false
 )
@@ -190,7 +199,9 @@ func (f *stackHandlerFactory) newHandler(log logging.Logger, ext *v1alpha1.Stack
 // Syncing/Creating functions
 // ************************************************************************************************
 func (h *stackHandler) sync(ctx context.Context) (reconcile.Result, error) {
-	if h.ext.Status.ControllerRef == nil {
+	// A Stack whose spec changed since it was created, e.g. because it was
+	// upgraded, is processed again so that its RBAC and controllers match.
+	if h.ext.Status.ControllerRef == nil || h.ext.Status.ObservedGeneration != h.ext.GetGeneration() {
 		return h.create(ctx)
 	}
 
@@ -209,6 +220,18 @@ func (h *stackHandler) create(ctx context.Context) (reconcile.Result, error) {
 		return fail(ctx, h.kube, h.ext, err)
 	}
 
+	// The Stack's controller would fail until its dependencies are installed,
+	// so wait for them rather than deploying it.
+	met, err := h.processDependencies(ctx)
+	if err != nil {
+		h.log.Debug("failed to resolve dependencies", "error", err)
+		return fail(ctx, h.kube, h.ext, err)
+	}
+	if !met {
+		h.log.Debug("waiting for dependencies", "condition", h.ext.Status.GetCondition(v1alpha1.TypeDependenciesMet))
+		return requeueOnUnmetDependencies, h.kube.Status().Update(ctx, h.ext)
+	}
+
 	// create RBAC permissions
 	if err := h.processRBAC(ctx); err != nil {
 		h.log.Debug("failed to create RBAC permissions", "error", err)
@@ -227,19 +250,91 @@ func (h *stackHandler) create(ctx context.Context) (reconcile.Result, error) {
 		return fail(ctx, h.kube, h.ext, err)
 	}
 
-	// create controller deployment or job
+	// run the controller jobs to completion before starting the controllers
+	done, err := h.processJobs(ctx)
+	if err != nil {
+		h.log.Debug("failed to run controller jobs", "error", err)
+		return fail(ctx, h.kube, h.ext, err)
+	}
+	if !done {
+		h.log.Debug("waiting for controller jobs to complete")
+		h.ext.Status.SetConditions(runtimev1alpha1.ReconcileSuccess())
+		return requeueOnSuccess, h.kube.Status().Update(ctx, h.ext)
+	}
+
+	// create controller deployments
 	if err := h.processDeployment(ctx); err != nil {
 		h.log.Debug("failed to create deployment", "error", err)
 		return fail(ctx, h.kube, h.ext, err)
 	}
 
+	// register webhooks once the deployment that serves them exists
+	if err := h.processWebhooks(ctx); err != nil {
+		h.log.Debug("failed to process webhooks", "error", err)
+		return fail(ctx, h.kube, h.ext, err)
+	}
+
+	// remove the controllers and roles of versions the stack was upgraded
+	// from
+	if err := h.deleteStaleControllers(ctx); err != nil {
+		h.log.Debug("failed to delete stale controllers", "error", err)
+		return fail(ctx, h.kube, h.ext, err)
+	}
+	if err := h.deleteStaleClusterRoles(ctx); err != nil {
+		h.log.Debug("failed to delete stale cluster roles", "error", err)
+		return fail(ctx, h.kube, h.ext, err)
+	}
+
 	// the stack has successfully been created, the stack is ready
+	h.ext.Status.ObservedGeneration = h.ext.GetGeneration()
 	h.ext.Status.SetConditions(runtimev1alpha1.Available(), runtimev1alpha1.ReconcileSuccess())
 	return requeueOnSuccess, h.kube.Status().Update(ctx, h.ext)
 }
 
 func (h *stackHandler) update(ctx context.Context) (reconcile.Result, error) {
-	return reconcile.Result{}, nil
+	if !h.servesWebhooks() {
+		return reconcile.Result{}, nil
+	}
+
+	// renew the webhook serving certificate before it expires
+	if err := h.processWebhooks(ctx); err != nil {
+		h.log.Debug("failed to process webhooks", "error", err)
+		return fail(ctx, h.kube, h.ext, err)
+	}
+	return requeueOnWebhookCertCheck, nil
+}
+
+// processDependencies resolves the Stack's dependencies against the installed
+// stack packages and CRDs, and records the result in the DependenciesMet
+// condition. It returns true if all dependencies are met.
+func (h *stackHandler) processDependencies(ctx context.Context) (bool, error) {
+	deps := h.ext.Spec.DependsOn
+	if len(deps) == 0 {
+		return true, nil
+	}
+
+	pkgs, err := stacks.InstalledPackages(ctx, h.kube)
+	if err != nil {
+		return false, err
+	}
+
+	crds := &apiextensions.CustomResourceDefinitionList{}
+	if err := h.kube.List(ctx, crds); err != nil {
+		return false, errors.Wrap(err, "CRDs could not be listed")
+	}
+
+	unmet, err := stacks.UnmetDependencies(deps, pkgs, crds.Items)
+	if err != nil {
+		return false, errors.Wrap(err, "cannot resolve dependencies")
+	}
+
+	if len(unmet) > 0 {
+		h.ext.Status.SetConditions(v1alpha1.DependenciesUnmet("missing dependencies: " + strings.Join(unmet, ", ")))
+		return false, nil
+	}
+
+	h.ext.Status.SetConditions(v1alpha1.DependenciesMet())
+	return true, nil
 }
 
 func copyLabels(labels map[string]string) map[string]string {
@@ -424,7 +519,7 @@ func (h *stackHandler) createPersonaClusterRolesCRDHandler() crdHandler {
 
 	return func(ctx context.Context, crds []apiextensions.CustomResourceDefinition) error {
 
-		for persona := range roleVerbs {
+		for persona := range stacks.PersonaRoleVerbs {
 			name := stacks.PersonaRoleName(h.ext, persona)
 
 			// Use a copy so AddLabels doesn't mutate labels
@@ -449,26 +544,7 @@ func (h *stackHandler) createPersonaClusterRolesCRDHandler() crdHandler {
 			labelsCopy[aggregationLabel] = labelValueAggregationEnabled
 
 			// Each ClusterRole needs persona specific rules for each CRD
-			rules := []rbacv1.PolicyRule{}
-
-			for _, crd := range crds {
-				kinds := []string{crd.Spec.Names.Plural}
-
-				if subs := crd.Spec.Subresources; subs != nil {
-					if subs.Status != nil {
-						kinds = append(kinds, crd.Spec.Names.Plural+"/status")
-					}
-					if subs.Scale != nil {
-						kinds = append(kinds, crd.Spec.Names.Plural+"/scale")
-					}
-				}
-
-				rules = append(rules, rbacv1.PolicyRule{
-					APIGroups: []string{crd.Spec.Group},
-					Resources: kinds,
-					Verbs:     roleVerbs[persona],
-				})
-			}
+			rules := stacks.PersonaRoleRules(crds, persona)
 
 			// Assemble and create the ClusterRole
 			cr := &rbacv1.ClusterRole{
@@ -479,7 +555,7 @@ func (h *stackHandler) createPersonaClusterRolesCRDHandler() crdHandler {
 				Rules: rules,
 			}
 
-			if err := h.kube.Create(ctx, cr); err != nil && !kerrors.IsAlreadyExists(err) {
+			if err := h.syncClusterRole(ctx, cr); err != nil {
 				return errors.Wrap(err, "failed to create persona cluster roles")
 			}
 		}
@@ -498,13 +574,57 @@ func (h *stackHandler) createDeploymentClusterRole(ctx context.Context, labels m
 		Rules: h.ext.Spec.Permissions.Rules,
 	}
 
-	if err := h.kube.Create(ctx, cr); err != nil && !kerrors.IsAlreadyExists(err) {
+	if err := h.syncClusterRole(ctx, cr); err != nil {
 		return "", errors.Wrap(err, "failed to create cluster role")
 	}
 
 	return name, nil
 }
 
+// syncClusterRole creates the supplied ClusterRole, or updates its rules if it
+// already exists.
+func (h *stackHandler) syncClusterRole(ctx context.Context, cr *rbacv1.ClusterRole) error {
+	err := h.kube.Create(ctx, cr)
+	if !kerrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	existing := &rbacv1.ClusterRole{}
+	if err := h.kube.Get(ctx, types.NamespacedName{Name: cr.GetName()}, existing); err != nil {
+		return err
+	}
+	if equality.Semantic.DeepEqual(existing.Rules, cr.Rules) {
+		return nil
+	}
+	existing.Rules = cr.Rules
+	return h.kube.Update(ctx, existing)
+}
+
+// deleteStaleClusterRoles deletes the ClusterRoles of the Stack that are not
+// named for its current version. ClusterRoles are named for the version of the
+// Stack, so those of the versions it was upgraded from are left behind.
+func (h *stackHandler) deleteStaleClusterRoles(ctx context.Context) error {
+	current := map[string]bool{stacks.PersonaRoleName(h.ext, "system"): true}
+	for persona := range stacks.PersonaRoleVerbs {
+		current[stacks.PersonaRoleName(h.ext, persona)] = true
+	}
+
+	crs := &rbacv1.ClusterRoleList{}
+	if err := h.kube.List(ctx, crs, client.MatchingLabels(stacks.ParentLabels(h.ext))); err != nil {
+		return errors.Wrap(err, "failed to list cluster roles")
+	}
+	for i := range crs.Items {
+		if current[crs.Items[i].GetName()] {
+			continue
+		}
+		h.log.Debug("deleting stale cluster role", "name", crs.Items[i].GetName())
+		if err := h.kube.Delete(ctx, &crs.Items[i]); runtimeresource.IgnoreNotFound(err) != nil {
+			return errors.Wrap(err, "failed to delete stale cluster role")
+		}
+	}
+	return nil
+}
+
 func (h *stackHandler) createNamespacedRoleBinding(ctx context.Context, clusterRoleName string, owner metav1.OwnerReference) error {
 	// create rolebinding between service account and role
 	crb := &rbacv1.RoleBinding{
@@ -518,10 +638,24 @@ func (h *stackHandler) createNamespacedRoleBinding(ctx context.Context, clusterR
 			{Name: h.ext.Name, Namespace: h.ext.Namespace, Kind: rbacv1.ServiceAccountKind},
 		},
 	}
-	if err := h.kube.Create(ctx, crb); err != nil && !kerrors.IsAlreadyExists(err) {
-		return errors.Wrap(err, "failed to create role binding")
+	err := h.kube.Create(ctx, crb)
+	if kerrors.IsAlreadyExists(err) {
+		existing := &rbacv1.RoleBinding{}
+		if err := h.kube.Get(ctx, types.NamespacedName{Name: crb.Name, Namespace: crb.Namespace}, existing); err != nil {
+			return errors.Wrap(err, "failed to get role binding")
+		}
+		if existing.RoleRef == crb.RoleRef {
+			return nil
+		}
+
+		// The role of a binding cannot be changed, so the binding is
+		// replaced when the Stack's role changes.
+		if err := h.kube.Delete(ctx, existing); runtimeresource.IgnoreNotFound(err) != nil {
+			return errors.Wrap(err, "failed to delete role binding")
+		}
+		err = h.kube.Create(ctx, crb)
 	}
-	return nil
+	return errors.Wrap(err, "failed to create role binding")
 }
 
 func (h *stackHandler) createClusterRoleBinding(ctx context.Context, clusterRoleName string, labels map[string]string) error {
@@ -536,10 +670,24 @@ func (h *stackHandler) createClusterRoleBinding(ctx context.Context, clusterRole
 			{Name: h.ext.Name, Namespace: h.ext.Namespace, Kind: rbacv1.ServiceAccountKind},
 		},
 	}
-	if err := h.kube.Create(ctx, crb); err != nil && !kerrors.IsAlreadyExists(err) {
-		return errors.Wrap(err, "failed to create cluster role binding")
+	err := h.kube.Create(ctx, crb)
+	if kerrors.IsAlreadyExists(err) {
+		existing := &rbacv1.ClusterRoleBinding{}
+		if err := h.kube.Get(ctx, types.NamespacedName{Name: crb.Name}, existing); err != nil {
+			return errors.Wrap(err, "failed to get cluster role binding")
+		}
+		if existing.RoleRef == crb.RoleRef {
+			return nil
+		}
+
+		// The role of a binding cannot be changed, so the binding is
+		// replaced when the Stack's role changes.
+		if err := h.kube.Delete(ctx, existing); runtimeresource.IgnoreNotFound(err) != nil {
+			return errors.Wrap(err, "failed to delete cluster role binding")
+		}
+		err = h.kube.Create(ctx, crb)
 	}
-	return nil
+	return errors.Wrap(err, "failed to create cluster role binding")
 }
 
 func (h *stackHandler) processRBAC(ctx context.Context) error {
@@ -725,16 +873,16 @@ func (h *stackHandler) prepareHostAwareJob(j *batch.Job, tokenSecret string) err
 	return nil
 }
 
-func (h *stackHandler) prepareDeployment(d *apps.Deployment) {
-	controllerDeployment := h.ext.Spec.Controller.Deployment
-	if controllerDeployment == nil {
-		return
-	}
+// controllerObjectName returns the name of a Deployment or Job of the Stack's
+// controllers.
+func (h *stackHandler) controllerObjectName(name string) string {
+	return h.ext.Name + "-" + name
+}
 
-	controllerDeployment.Spec.DeepCopyInto(&d.Spec)
+func (h *stackHandler) prepareDeployment(cd v1alpha1.ControllerDeployment, name string, d *apps.Deployment) {
+	cd.Spec.DeepCopyInto(&d.Spec)
 
 	// force the deployment to use stack opinionated names and service account
-	name := h.ext.Name + "-controller"
 	matchLabels := map[string]string{"app": name}
 	labels := stacks.ParentLabels(h.ext)
 
@@ -746,16 +894,135 @@ func (h *stackHandler) prepareDeployment(d *apps.Deployment) {
 	d.Spec.Template.SetName(name)
 	meta.AddLabels(&d.Spec.Template, matchLabels)
 	d.Spec.Selector = &metav1.LabelSelector{MatchLabels: matchLabels}
+
+	if h.servesWebhooks() && name == h.controllerObjectName(h.ext.Spec.Webhooks.Deployment) {
+		h.prepareWebhookDeployment(d)
+	}
+}
+
+func (h *stackHandler) prepareJob(cj v1alpha1.ControllerJob, name string, j *batch.Job) {
+	cj.Spec.DeepCopyInto(&j.Spec)
+
+	// force the job to use stack opinionated names and service account
+	j.SetName(name)
+	j.SetNamespace(h.ext.Namespace)
+	meta.AddLabels(j, stacks.ParentLabels(h.ext))
+
+	j.Spec.Template.Spec.ServiceAccountName = h.ext.Name
 }
 
+// hostServiceAccountRefs returns references to the Stack's ServiceAccount and
+// to the secret its token is copied to on the host.
+func (h *stackHandler) hostServiceAccountRefs() (corev1.ObjectReference, corev1.ObjectReference) {
+	saRef := corev1.ObjectReference{Name: h.ext.Name, Namespace: h.ext.Namespace}
+	return saRef, h.hostAwareConfig.ObjectReferenceOnHost(saRef.Name, saRef.Namespace)
+}
+
+// processJobs creates the Stack's controller Jobs, and returns true once all of
+// them have completed.
+func (h *stackHandler) processJobs(ctx context.Context) (bool, error) {
+	gvk := batch.SchemeGroupVersion.WithKind("Job")
+	done := true
+
+	for _, cj := range h.ext.Spec.Controller.Jobs {
+		j := &batch.Job{}
+		h.prepareJob(cj, h.controllerObjectName(cj.Name), j)
+
+		var saRef, saSecretRef corev1.ObjectReference
+		if h.hostAwareConfig != nil {
+			saRef, saSecretRef = h.hostServiceAccountRefs()
+			if err := h.prepareHostAwareJob(j, saSecretRef.Name); err != nil {
+				return false, errors.Wrap(err, errFailedToPrepareHostAwareJob)
+			}
+		}
+
+		existing := &batch.Job{}
+		err := h.hostKube.Get(ctx, types.NamespacedName{Name: j.GetName(), Namespace: j.GetNamespace()}, existing)
+		switch {
+		case kerrors.IsNotFound(err):
+			if err := h.hostKube.Create(ctx, j); err != nil {
+				return false, errors.Wrap(err, errFailedToCreateJob)
+			}
+		case err != nil:
+			return false, errors.Wrap(err, errFailedToGetJob)
+		case !equality.Semantic.DeepDerivative(j.Spec, existing.Spec):
+			// The pod template of a Job cannot be updated, so a Job
+			// whose spec differs from the Stack's, e.g. because the
+			// Stack was upgraded, is deleted. It is created again
+			// with the Stack's spec, and run, once it is gone.
+			h.log.Debug("replacing changed controller job", "name", existing.GetName())
+			if err := h.hostKube.Delete(ctx, existing, client.PropagationPolicy(metav1.DeletePropagationBackground)); runtimeresource.IgnoreNotFound(err) != nil {
+				return false, errors.Wrap(err, errFailedToDeleteJob)
+			}
+			done = false
+			continue
+		default:
+			j = existing
+		}
+
+		if h.hostAwareConfig != nil {
+			owner := meta.AsOwner(meta.ReferenceTo(j, gvk))
+			if err := h.syncSATokenSecret(ctx, owner, saRef, saSecretRef); err != nil {
+				return false, errors.Wrap(err, errFailedToSyncSASecret)
+			}
+		}
+		h.ext.Status.ControllerRefs = setControllerRef(h.ext.Status.ControllerRefs, meta.ReferenceTo(j, gvk))
+
+		complete := false
+		for _, c := range j.Status.Conditions {
+			if c.Status != corev1.ConditionTrue {
+				continue
+			}
+			switch c.Type {
+			case batch.JobComplete:
+				complete = true
+			case batch.JobFailed:
+				return false, errors.Errorf(errJobFailed, j.GetName(), c.Message)
+			}
+		}
+		done = done && complete
+	}
+
+	return done, nil
+}
+
+// processDeployment creates the Stack's primary controller Deployment, and any
+// additional Deployments.
 func (h *stackHandler) processDeployment(ctx context.Context) error {
-	if h.ext.Spec.Controller.Deployment == nil {
-		return nil
+	c := h.ext.Spec.Controller
+	if c.Deployment != nil {
+		ref, err := h.syncDeployment(ctx, *c.Deployment, h.controllerObjectName(stacks.PrimaryControllerName))
+		if err != nil {
+			return err
+		}
+
+		// save a reference to the stack's controller
+		h.ext.Status.ControllerRef = ref
 	}
 
+	for _, cd := range c.Deployments {
+		ref, err := h.syncDeployment(ctx, cd, h.controllerObjectName(cd.Name))
+		if err != nil {
+			return err
+		}
+
+		// a stack without a primary controller is tracked by its first
+		// deployment
+		if h.ext.Status.ControllerRef == nil {
+			h.ext.Status.ControllerRef = ref
+		}
+	}
+
+	return nil
+}
+
+// syncDeployment creates the supplied Deployment, or updates it if its spec
+// differs from the Stack's, e.g. because the Stack was upgraded. It returns a
+// reference to the Deployment.
+func (h *stackHandler) syncDeployment(ctx context.Context, cd v1alpha1.ControllerDeployment, name string) (*corev1.ObjectReference, error) {
 	d := &apps.Deployment{}
 
-	h.prepareDeployment(d)
+	h.prepareDeployment(cd, name, d)
 
 	gvk := apps.SchemeGroupVersion.WithKind("Deployment")
 
@@ -763,41 +1030,115 @@ func (h *stackHandler) processDeployment(ctx context.Context) error {
 	var saSecretRef corev1.ObjectReference
 	if h.hostAwareConfig != nil {
 		// We need to copy SA token secret from host to tenant
-		saRef = corev1.ObjectReference{
-			Name:      d.Spec.Template.Spec.ServiceAccountName,
-			Namespace: d.Namespace,
-		}
-		saSecretRef = h.hostAwareConfig.ObjectReferenceOnHost(saRef.Name, saRef.Namespace)
+		saRef, saSecretRef = h.hostServiceAccountRefs()
 		err := h.prepareHostAwareDeployment(d, saSecretRef.Name)
 
 		if err != nil {
-			return errors.Wrap(err, errFailedToPrepareHostAwareDeployment)
+			return nil, errors.Wrap(err, errFailedToPrepareHostAwareDeployment)
 		}
 	}
 
-	err := h.hostKube.Get(ctx, types.NamespacedName{Name: d.GetName(), Namespace: d.GetNamespace()}, d)
-	if kerrors.IsNotFound(err) {
+	existing := &apps.Deployment{}
+	err := h.hostKube.Get(ctx, types.NamespacedName{Name: d.GetName(), Namespace: d.GetNamespace()}, existing)
+	switch {
+	case kerrors.IsNotFound(err):
 		if err := h.hostKube.Create(ctx, d); err != nil {
-			return errors.Wrap(err, errFailedToCreateDeployment)
+			return nil, errors.Wrap(err, errFailedToCreateDeployment)
 		}
-	}
-	if err != nil && !kerrors.IsNotFound(err) {
-		return errors.Wrap(err, errFailedToGetDeployment)
+	case err != nil:
+		return nil, errors.Wrap(err, errFailedToGetDeployment)
+	case !equality.Semantic.DeepDerivative(d.Spec, existing.Spec):
+		// Updating the pod template rolls the deployment.
+		meta.AddLabels(existing, d.GetLabels())
+		existing.Spec = d.Spec
+		if err := h.hostKube.Update(ctx, existing); err != nil {
+			return nil, errors.Wrap(err, errFailedToUpdateDeployment)
+		}
+		d = existing
+	default:
+		d = existing
 	}
 
 	if h.hostAwareConfig != nil {
 		owner := meta.AsOwner(meta.ReferenceTo(d, gvk))
 		err := h.syncSATokenSecret(ctx, owner, saRef, saSecretRef)
 		if err != nil {
-			return errors.Wrap(err, errFailedToSyncSASecret)
+			return nil, errors.Wrap(err, errFailedToSyncSASecret)
 		}
 	}
-	// save a reference to the stack's controller
-	h.ext.Status.ControllerRef = meta.ReferenceTo(d, gvk)
 
+	ref := meta.ReferenceTo(d, gvk)
+	h.ext.Status.ControllerRefs = setControllerRef(h.ext.Status.ControllerRefs, ref)
+	return ref, nil
+}
+
+// deleteStaleControllers deletes the Deployments and Jobs referenced by the
+// Stack's status that its spec no longer declares, e.g. because the version it
+// was upgraded to dropped them, and removes the references to them.
+func (h *stackHandler) deleteStaleControllers(ctx context.Context) error {
+	current := map[corev1.ObjectReference]bool{}
+	add := func(kind, name string) {
+		ref := corev1.ObjectReference{Name: h.controllerObjectName(name), Namespace: h.ext.Namespace}
+		if h.hostAwareConfig != nil {
+			ref = h.hostAwareConfig.ObjectReferenceOnHost(ref.Name, ref.Namespace)
+		}
+		current[corev1.ObjectReference{Kind: kind, Name: ref.Name, Namespace: ref.Namespace}] = true
+	}
+	c := h.ext.Spec.Controller
+	if c.Deployment != nil {
+		add("Deployment", stacks.PrimaryControllerName)
+	}
+	for _, cd := range c.Deployments {
+		add("Deployment", cd.Name)
+	}
+	for _, cj := range c.Jobs {
+		add("Job", cj.Name)
+	}
+
+	var refs []corev1.ObjectReference
+	for _, ref := range h.ext.Status.ControllerRefs {
+		if current[corev1.ObjectReference{Kind: ref.Kind, Name: ref.Name, Namespace: ref.Namespace}] {
+			refs = append(refs, ref)
+			continue
+		}
+
+		om := metav1.ObjectMeta{Name: ref.Name, Namespace: ref.Namespace}
+		var obj runtime.Object
+		switch ref.Kind {
+		case "Deployment":
+			obj = &apps.Deployment{ObjectMeta: om}
+		case "Job":
+			obj = &batch.Job{ObjectMeta: om}
+		default:
+			refs = append(refs, ref)
+			continue
+		}
+
+		// Jobs orphan their pods unless deletion is propagated.
+		h.log.Debug("deleting stale controller", "kind", ref.Kind, "name", ref.Name)
+		if err := h.hostKube.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationBackground)); runtimeresource.IgnoreNotFound(err) != nil {
+			return errors.Wrapf(err, "failed to delete stale controller %s %s", ref.Kind, ref.Name)
+		}
+		if r := h.ext.Status.ControllerRef; r != nil && r.Kind == ref.Kind && r.Name == ref.Name && r.Namespace == ref.Namespace {
+			h.ext.Status.ControllerRef = nil
+		}
+	}
+	h.ext.Status.ControllerRefs = refs
 	return nil
 }
 
+// setControllerRef adds the supplied reference to refs, replacing any existing
+// reference to the same object.
+func setControllerRef(refs []corev1.ObjectReference, ref *corev1.ObjectReference) []corev1.ObjectReference {
+	for i := range refs {
+		if refs[i].Kind == ref.Kind && refs[i].Namespace == ref.Namespace && refs[i].Name == ref.Name {
+			refs[i] = *ref
+			return refs
+		}
+	}
+	return append(refs, *ref)
+}
+
 // delete performs clean up (finalizer) actions when a Stack is being deleted.
 // This function ensures that all the resources (ClusterRoles,
 // ClusterRoleBindings) that this Stack owns are also cleaned up.
@@ -810,6 +1151,18 @@ func (h *stackHandler) delete(ctx context.Context) (reconcile.Result, error) {
 		stackControllerNamespace = h.hostAwareConfig.HostControllerNamespace
 	}
 
+	// Webhooks must be removed before the deployment that serves them, or
+	// requests they intercept would fail.
+	if err := h.kube.DeleteAllOf(ctx, &admissionregistration.ValidatingWebhookConfiguration{}, client.MatchingLabels(labels)); runtimeresource.IgnoreNotFound(err) != nil {
+		h.log.Debug("failed to delete stack validating webhook configurations", "error", err, "namespace", h.ext.GetNamespace(), "name", h.ext.GetName())
+		return fail(ctx, h.kube, h.ext, err)
+	}
+
+	if err := h.kube.DeleteAllOf(ctx, &admissionregistration.MutatingWebhookConfiguration{}, client.MatchingLabels(labels)); runtimeresource.IgnoreNotFound(err) != nil {
+		h.log.Debug("failed to delete stack mutating webhook configurations", "error", err, "namespace", h.ext.GetNamespace(), "name", h.ext.GetName())
+		return fail(ctx, h.kube, h.ext, err)
+	}
+
 	if err := h.hostKube.DeleteAllOf(ctx, &apps.Deployment{}, client.MatchingLabels(labels), client.InNamespace(stackControllerNamespace)); runtimeresource.IgnoreNotFound(err) != nil {
 		h.log.Debug("deleting stack controller deployment", "namespace", h.ext.GetNamespace(), "name", h.ext.GetName())
 		return fail(ctx, h.kube, h.ext, err)
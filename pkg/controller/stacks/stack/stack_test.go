@@ -24,6 +24,7 @@ import (
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	. "github.com/onsi/gomega"
 	"github.com/pkg/errors"
 
@@ -59,6 +60,7 @@ const (
 	uid                     = types.UID("definitely-a-uuid")
 	resourceName            = "cool-stack"
 	roleName                = "stack:cool-namespace:cool-stack:0.0.1:system"
+	previousRoleName        = "stack:cool-namespace:cool-stack:0.0.0:system"
 
 	controllerDeploymentName = "cool-stack-controller"
 	controllerContainerName  = "cool-container"
@@ -123,6 +125,10 @@ func withPermissionScope(permissionScope string) resourceModifier {
 	return func(r *v1alpha1.Stack) { r.Spec.PermissionScope = permissionScope }
 }
 
+func withDependsOn(deps ...v1alpha1.Dependency) resourceModifier {
+	return func(r *v1alpha1.Stack) { r.Spec.DependsOn = deps }
+}
+
 type saModifier func(*corev1.ServiceAccount)
 
 func withTokenSecret(ref corev1.ObjectReference) saModifier {
@@ -496,6 +502,83 @@ func TestCreate(t *testing.T) {
 				),
 			},
 		},
+		{
+			name: "UnmetDependencies",
+			r: resource(withDependsOn(
+				v1alpha1.Dependency{Package: "crossplane/other-stack", Version: ">=1.0.0"},
+				v1alpha1.Dependency{CustomResourceDefinition: "widgets.other.example.org/v1beta1"},
+			)),
+			clientFunc: func(r *v1alpha1.Stack) client.Client {
+				other := &v1alpha1.Stack{
+					ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "other-stack"},
+					Spec:       v1alpha1.StackSpec{AppMetadataSpec: v1alpha1.AppMetadataSpec{Version: "0.9.0"}},
+				}
+				otherInstall := &v1alpha1.StackInstall{
+					ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "other-stack"},
+					Spec:       v1alpha1.StackInstallSpec{Package: "crossplane/other-stack:v0.9.0"},
+					Status:     v1alpha1.StackInstallStatus{StackRecord: &corev1.ObjectReference{Name: "other-stack"}},
+				}
+				return fake.NewFakeClient(r, other, otherInstall)
+			},
+			want: want{
+				result: requeueOnUnmetDependencies,
+				err:    nil,
+				r: resource(
+					withGVK(v1alpha1.StackGroupVersionKind),
+					withDependsOn(
+						v1alpha1.Dependency{Package: "crossplane/other-stack", Version: ">=1.0.0"},
+						v1alpha1.Dependency{CustomResourceDefinition: "widgets.other.example.org/v1beta1"},
+					),
+					withConditions(
+						runtimev1alpha1.Creating(),
+						v1alpha1.DependenciesUnmet("missing dependencies: package crossplane/other-stack >=1.0.0, crd widgets.other.example.org/v1beta1"),
+					),
+					withFinalizers(stacksFinalizer),
+					withResourceVersion("2"),
+				),
+			},
+		},
+		{
+			name: "MetDependencies",
+			r: resource(withDependsOn(
+				v1alpha1.Dependency{Package: "crossplane/other-stack", Version: "^0.9"},
+				v1alpha1.Dependency{CustomResourceDefinition: "widgets.other.example.org/v1beta1"},
+			)),
+			clientFunc: func(r *v1alpha1.Stack) client.Client {
+				other := &v1alpha1.Stack{
+					ObjectMeta: metav1.ObjectMeta{Name: "other-stack"},
+					Spec:       v1alpha1.StackSpec{AppMetadataSpec: v1alpha1.AppMetadataSpec{Version: "0.9.0"}},
+				}
+				otherInstall := &v1alpha1.ClusterStackInstall{
+					ObjectMeta: metav1.ObjectMeta{Name: "other-stack"},
+					Spec:       v1alpha1.StackInstallSpec{Package: "crossplane/other-stack:v0.9.0"},
+					Status:     v1alpha1.StackInstallStatus{StackRecord: &corev1.ObjectReference{Name: "other-stack"}},
+				}
+				crd := &apiextensionsv1beta1.CustomResourceDefinition{
+					ObjectMeta: metav1.ObjectMeta{Name: "widgets.other.example.org"},
+					Spec: apiextensionsv1beta1.CustomResourceDefinitionSpec{
+						Group:    "other.example.org",
+						Names:    apiextensionsv1beta1.CustomResourceDefinitionNames{Kind: "Widget", Plural: "widgets"},
+						Versions: []apiextensionsv1beta1.CustomResourceDefinitionVersion{{Name: "v1", Served: true}},
+					},
+				}
+				return fake.NewFakeClient(r, other, otherInstall, crd)
+			},
+			want: want{
+				result: requeueOnSuccess,
+				err:    nil,
+				r: resource(
+					withGVK(v1alpha1.StackGroupVersionKind),
+					withDependsOn(
+						v1alpha1.Dependency{Package: "crossplane/other-stack", Version: "^0.9"},
+						v1alpha1.Dependency{CustomResourceDefinition: "widgets.other.example.org/v1beta1"},
+					),
+					withConditions(runtimev1alpha1.Available(), runtimev1alpha1.ReconcileSuccess(), v1alpha1.DependenciesMet()),
+					withFinalizers(stacksFinalizer),
+					withResourceVersion("2"),
+				),
+			},
+		},
 		{
 			name:       "SuccessfulClusterCreate",
 			r:          resource(withPermissionScope("Cluster")),
@@ -681,6 +764,42 @@ func TestProcessRBAC_Namespaced(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "Upgraded",
+			r:    resource(withPermissionScope("Namespaced"), withPolicyRules(defaultPolicyRules())),
+			clientFunc: func(r *v1alpha1.Stack) client.Client {
+				tns := targetNamespace(namespace)
+				cr := &rbac.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: roleName}}
+				rb := &rbac.RoleBinding{
+					ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: namespace},
+					RoleRef:    rbac.RoleRef{APIGroup: rbac.GroupName, Kind: "ClusterRole", Name: previousRoleName},
+				}
+				return fake.NewFakeClient(r, &tns, cr, rb)
+			},
+			want: want{
+				cr: []*rbac.ClusterRole{
+					{
+						ObjectMeta: metav1.ObjectMeta{Name: roleName},
+						Rules:      defaultPolicyRules(),
+					},
+				},
+				crb: &rbac.RoleBinding{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      resourceName,
+						Namespace: namespace,
+						OwnerReferences: []metav1.OwnerReference{
+							meta.AsOwner(meta.ReferenceTo(resource(), v1alpha1.StackGroupVersionKind)),
+						},
+					},
+					RoleRef: rbac.RoleRef{
+						APIGroup: rbac.GroupName,
+						Kind:     "ClusterRole",
+						Name:     roleName,
+					},
+					Subjects: []rbac.Subject{{Name: resourceName, Namespace: namespace, Kind: rbac.ServiceAccountKind}},
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -849,6 +968,31 @@ func TestProcessRBAC_Cluster(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "Upgraded",
+			r:    resource(withPermissionScope("Cluster"), withPolicyRules(defaultPolicyRules())),
+			clientFunc: func(r *v1alpha1.Stack) client.Client {
+				crb := &rbac.ClusterRoleBinding{
+					ObjectMeta: metav1.ObjectMeta{Name: resourceName},
+					RoleRef:    rbac.RoleRef{APIGroup: rbac.GroupName, Kind: "ClusterRole", Name: previousRoleName},
+				}
+				return fake.NewFakeClient(r, crb)
+			},
+			want: want{
+				crb: &rbac.ClusterRoleBinding{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:   resourceName,
+						Labels: stackspkg.ParentLabels(resource(withPermissionScope("Cluster"))),
+					},
+					RoleRef: rbac.RoleRef{
+						APIGroup: rbac.GroupName,
+						Kind:     "ClusterRole",
+						Name:     roleName,
+					},
+					Subjects: []rbac.Subject{{Name: resourceName, Namespace: namespace, Kind: rbac.ServiceAccountKind}},
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -1042,13 +1186,16 @@ func TestSyncSATokenSecret(t *testing.T) {
 // ************************************************************************************************
 func TestProcessDeployment(t *testing.T) {
 	errBoom := errors.New("boom")
-	testDep := &apps.Deployment{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      resourceName,
-			Namespace: namespace,
-			UID:       uid,
-		},
-	}
+
+	// testDep is the Deployment of a Stack with the default controller spec.
+	testDep := &apps.Deployment{}
+	sh := &stackHandler{ext: resource(withControllerSpec(defaultControllerSpec()))}
+	sh.prepareDeployment(*sh.ext.Spec.Controller.Deployment, sh.controllerObjectName(stackspkg.PrimaryControllerName), testDep)
+	testDep.SetUID(uid)
+
+	// outdatedDep is the Deployment of a previous version of the Stack.
+	outdatedDep := testDep.DeepCopy()
+	outdatedDep.Spec.Template.Spec.Containers[0].Image = "cool/stack:v0.0.1"
 
 	type want struct {
 		err           error
@@ -1089,12 +1236,44 @@ func TestProcessDeployment(t *testing.T) {
 							return errors.New("unexpected client GET call")
 						}
 					},
+					MockUpdate: func(_ context.Context, _ runtime.Object, _ ...client.UpdateOption) error {
+						return errors.New("unexpected client UPDATE call")
+					},
 				}
 			},
 			want: want{
 				controllerRef: meta.ReferenceTo(testDep, apps.SchemeGroupVersion.WithKind("Deployment")),
 			},
 		},
+		{
+			name: "UpdateOutdatedDeployment",
+			r:    resource(withControllerSpec(defaultControllerSpec())),
+			clientFunc: func(initObjs ...runtime.Object) client.Client {
+				return fake.NewFakeClient(append(initObjs, outdatedDep.DeepCopy())...)
+			},
+			want: want{
+				d:             testDep,
+				controllerRef: meta.ReferenceTo(testDep, apps.SchemeGroupVersion.WithKind("Deployment")),
+			},
+		},
+		{
+			name: "UpdateDeploymentError",
+			r:    resource(withControllerSpec(defaultControllerSpec())),
+			clientFunc: func(initObjs ...runtime.Object) client.Client {
+				return &test.MockClient{
+					MockGet: func(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+						outdatedDep.DeepCopyInto(obj.(*apps.Deployment))
+						return nil
+					},
+					MockUpdate: func(_ context.Context, _ runtime.Object, _ ...client.UpdateOption) error {
+						return errBoom
+					},
+				}
+			},
+			want: want{
+				err: errors.Wrap(errBoom, "failed to update deployment"),
+			},
+		},
 		{
 			name: "CreateDeploymentError",
 			r:    resource(withControllerSpec(defaultControllerSpec())),
@@ -1154,7 +1333,8 @@ func TestProcessDeployment(t *testing.T) {
 			clientFunc: fake.NewFakeClient,
 			hostClientFunc: func() client.Client {
 				return &test.MockClient{
-					MockGet: test.NewMockGetFn(nil),
+					MockGet:    test.NewMockGetFn(nil),
+					MockUpdate: test.NewMockUpdateFn(nil),
 					MockCreate: func(ctx context.Context, obj runtime.Object, _ ...client.CreateOption) error {
 						if _, ok := obj.(*corev1.Secret); ok {
 							return errBoom
@@ -1201,6 +1381,37 @@ func TestProcessDeployment(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "SuccessAdditionalDeployments",
+			r: resource(withControllerSpec(func() v1alpha1.ControllerSpec {
+				cs := defaultControllerSpec()
+				cs.Deployments = []v1alpha1.ControllerDeployment{{Name: "webhook", Spec: *deploymentSpec(withDeploymentContainer("webhook", controllerImageName))}}
+				return cs
+			}())),
+			clientFunc: fake.NewFakeClient,
+			want: want{
+				err: nil,
+				d: &apps.Deployment{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      resourceName + "-webhook",
+						Namespace: namespace,
+						Labels:    stackspkg.ParentLabels(resource()),
+					},
+					Spec: *deploymentSpec(
+						withDeploymentTmplMeta(resourceName+"-webhook", "", nil),
+						withDeploymentMatchLabels(map[string]string{"app": resourceName + "-webhook"}),
+						withDeploymentSA(resourceName),
+						withDeploymentContainer("webhook", controllerImageName),
+					),
+				},
+				controllerRef: &corev1.ObjectReference{
+					Name:       controllerDeploymentName,
+					Namespace:  namespace,
+					Kind:       "Deployment",
+					APIVersion: "apps/v1",
+				},
+			},
+		},
 		{
 			name:       "SuccessPullPolicy",
 			r:          resource(withControllerSpec(defaultControllerSpec(withDeploymentPullPolicy(corev1.PullAlways)))),
@@ -1374,6 +1585,164 @@ func TestProcessDeployment(t *testing.T) {
 	}
 }
 
+func TestProcessJobs(t *testing.T) {
+	errBoom := errors.New("boom")
+	jobSpec := func(name, image string) batch.JobSpec {
+		return batch.JobSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: name, Image: image}},
+		}}}
+	}
+	jobs := func(names ...string) v1alpha1.ControllerSpec {
+		cs := v1alpha1.ControllerSpec{}
+		for _, n := range names {
+			cs.Jobs = append(cs.Jobs, v1alpha1.ControllerJob{Name: n, Spec: jobSpec(n, controllerImageName)})
+		}
+		return cs
+	}
+	jobWithCondition := func(c batch.JobConditionType, msg string) func(context.Context, client.ObjectKey, runtime.Object) error {
+		return func(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+			j := obj.(*batch.Job)
+			j.SetName(key.Name)
+			j.SetNamespace(key.Namespace)
+			j.Spec = jobSpec(strings.TrimPrefix(key.Name, resourceName+"-"), controllerImageName)
+			j.Spec.Template.Spec.ServiceAccountName = resourceName
+			j.Status.Conditions = []batch.JobCondition{{Type: c, Status: corev1.ConditionTrue, Message: msg}}
+			return nil
+		}
+	}
+	changedJob := &batch.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: resourceName + "-migrate", Namespace: namespace},
+		Spec:       jobSpec("migrate", "cool/old-image:v1"),
+		Status:     batch.JobStatus{Conditions: []batch.JobCondition{{Type: batch.JobComplete, Status: corev1.ConditionTrue}}},
+	}
+	jobRef := func(name string) corev1.ObjectReference {
+		return corev1.ObjectReference{Name: name, Namespace: namespace, Kind: "Job", APIVersion: "batch/v1"}
+	}
+
+	type want struct {
+		done    bool
+		err     error
+		j       *batch.Job
+		deleted bool
+		refs    []corev1.ObjectReference
+	}
+
+	tests := []struct {
+		name   string
+		r      *v1alpha1.Stack
+		client client.Client
+		want   want
+	}{
+		{
+			name:   "NoJobs",
+			r:      resource(),
+			client: fake.NewFakeClient(),
+			want:   want{done: true},
+		},
+		{
+			name:   "CreateJob",
+			r:      resource(withControllerSpec(jobs("migrate"))),
+			client: fake.NewFakeClient(),
+			want: want{
+				done: false,
+				j: &batch.Job{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      resourceName + "-migrate",
+						Namespace: namespace,
+						Labels:    stackspkg.ParentLabels(resource()),
+					},
+					Spec: batch.JobSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+						ServiceAccountName: resourceName,
+						Containers:         []corev1.Container{{Name: "migrate", Image: controllerImageName}},
+					}}},
+				},
+				refs: []corev1.ObjectReference{jobRef(resourceName + "-migrate")},
+			},
+		},
+		{
+			name:   "CreateJobError",
+			r:      resource(withControllerSpec(jobs("migrate"))),
+			client: &test.MockClient{MockGet: test.NewMockGetFn(kerrors.NewNotFound(schema.GroupResource{Group: "batch", Resource: "Job"}, "")), MockCreate: test.NewMockCreateFn(errBoom)},
+			want:   want{err: errors.Wrap(errBoom, errFailedToCreateJob)},
+		},
+		{
+			name:   "GetJobError",
+			r:      resource(withControllerSpec(jobs("migrate"))),
+			client: &test.MockClient{MockGet: test.NewMockGetFn(errBoom)},
+			want:   want{err: errors.Wrap(errBoom, errFailedToGetJob)},
+		},
+		{
+			name:   "JobsComplete",
+			r:      resource(withControllerSpec(jobs("migrate", "seed"))),
+			client: &test.MockClient{MockGet: jobWithCondition(batch.JobComplete, "")},
+			want: want{
+				done: true,
+				refs: []corev1.ObjectReference{jobRef(resourceName + "-migrate"), jobRef(resourceName + "-seed")},
+			},
+		},
+		{
+			name:   "ReplaceChangedJob",
+			r:      resource(withControllerSpec(jobs("migrate"))),
+			client: fake.NewFakeClient(changedJob),
+			want:   want{done: false, deleted: true},
+		},
+		{
+			name: "DeleteChangedJobError",
+			r:    resource(withControllerSpec(jobs("migrate"))),
+			client: &test.MockClient{
+				MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+					changedJob.DeepCopyInto(obj.(*batch.Job))
+					return nil
+				},
+				MockDelete: test.NewMockDeleteFn(errBoom),
+			},
+			want: want{err: errors.Wrap(errBoom, errFailedToDeleteJob)},
+		},
+		{
+			name:   "JobFailed",
+			r:      resource(withControllerSpec(jobs("migrate"))),
+			client: &test.MockClient{MockGet: jobWithCondition(batch.JobFailed, "boom")},
+			want:   want{err: errors.Errorf(errJobFailed, resourceName+"-migrate", "boom")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGomegaWithT(t)
+			handler := &stackHandler{
+				kube:     tt.client,
+				hostKube: tt.client,
+				ext:      tt.r,
+				log:      logging.NewNopLogger(),
+			}
+
+			done, err := handler.processJobs(ctx)
+
+			if diff := cmp.Diff(tt.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("processJobs -want error, +got error:\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.want.done, done); diff != "" {
+				t.Errorf("processJobs -want, +got:\n%s", diff)
+			}
+			if tt.want.j != nil {
+				got := &batch.Job{}
+				assertKubernetesObject(t, g, got, tt.want.j, handler.hostKube)
+			}
+			if tt.want.deleted {
+				err := handler.hostKube.Get(ctx, types.NamespacedName{Name: resourceName + "-migrate", Namespace: namespace}, &batch.Job{})
+				if !kerrors.IsNotFound(err) {
+					t.Errorf("processJobs: want changed job deleted, got error %v", err)
+				}
+			}
+			if tt.want.err == nil {
+				if diff := cmp.Diff(tt.want.refs, handler.ext.Status.ControllerRefs); diff != "" {
+					t.Errorf("processJobs controllerRefs -want, +got:\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
 type objectWithGVK interface {
 	runtime.Object
 	metav1.Object
@@ -1400,6 +1769,7 @@ func TestStackDelete(t *testing.T) {
 				// stack starts with a finalizer and a deletion timestamp
 				ext: resource(withFinalizers(stacksFinalizer), withDeletionTimestamp(tn)),
 				kube: &test.MockClient{
+					MockDeleteAllOf:  func(ctx context.Context, obj runtime.Object, opts ...client.DeleteAllOfOption) error { return nil },
 					MockStatusUpdate: func(ctx context.Context, obj runtime.Object, _ ...client.UpdateOption) error { return nil },
 				},
 				hostKube: &test.MockClient{
@@ -1422,6 +1792,7 @@ func TestStackDelete(t *testing.T) {
 				// stack starts with a finalizer and a deletion timestamp
 				ext: resource(withFinalizers(stacksFinalizer), withDeletionTimestamp(tn)),
 				kube: &test.MockClient{
+					MockDeleteAllOf:  func(ctx context.Context, obj runtime.Object, opts ...client.DeleteAllOfOption) error { return nil },
 					MockStatusUpdate: func(ctx context.Context, obj runtime.Object, _ ...client.UpdateOption) error { return nil },
 				},
 				hostKube: &test.MockClient{
@@ -1450,6 +1821,7 @@ func TestStackDelete(t *testing.T) {
 				// stack starts with a finalizer and a deletion timestamp
 				ext: resource(withFinalizers(stacksFinalizer), withDeletionTimestamp(tn)),
 				kube: &test.MockClient{
+					MockDeleteAllOf:  func(ctx context.Context, obj runtime.Object, opts ...client.DeleteAllOfOption) error { return nil },
 					MockStatusUpdate: func(ctx context.Context, obj runtime.Object, _ ...client.UpdateOption) error { return nil },
 				},
 				hostKube: &test.MockClient{
@@ -2398,7 +2770,7 @@ func Test_stackHandler_createPersonaClusterRolesCRDHandler(t *testing.T) {
 					crd(withCRDGroupKind(group, kind),
 						withCRDVersion(version))},
 			},
-			want: []rbac.ClusterRole{clusterRole(name)},
+			want: []rbac.ClusterRole{clusterRole(name, withClusterRoleRules([]rbac.PolicyRule{{Verbs: []string{"get", "list", "watch"}, APIGroups: []string{group}, Resources: []string{plural}}}))},
 		},
 		{
 			name: "WithSubresources",
@@ -2478,6 +2850,183 @@ func Test_stackHandler_createPersonaClusterRolesCRDHandler(t *testing.T) {
 	}
 }
 
+func Test_stackHandler_deleteStaleClusterRoles(t *testing.T) {
+	parentLabels := stackspkg.ParentLabels(resource())
+	current := clusterRole(roleName, withClusterRoleLabels(parentLabels))
+	currentView := clusterRole(stackspkg.PersonaRoleName(resource(), "view"), withClusterRoleLabels(parentLabels))
+	stale := clusterRole(previousRoleName, withClusterRoleLabels(parentLabels))
+	staleView := clusterRole("stack:cool-namespace:cool-stack:0.0.0:view", withClusterRoleLabels(parentLabels))
+	unrelated := clusterRole("stack:cool-namespace:other-stack:0.0.0:system")
+
+	cases := map[string]struct {
+		clientFunc func() client.Client
+		want       []string
+		wantErr    error
+	}{
+		"DeleteStaleRoles": {
+			clientFunc: func() client.Client {
+				return fake.NewFakeClient(&current, &currentView, &stale, &staleView, &unrelated)
+			},
+			want: []string{roleName, currentView.GetName(), unrelated.GetName()},
+		},
+		"ListError": {
+			clientFunc: func() client.Client {
+				return &test.MockClient{MockList: test.NewMockListFn(errBoom)}
+			},
+			wantErr: errors.Wrap(errBoom, "failed to list cluster roles"),
+		},
+		"DeleteError": {
+			clientFunc: func() client.Client {
+				return &test.MockClient{
+					MockList: func(_ context.Context, obj runtime.Object, _ ...client.ListOption) error {
+						obj.(*rbac.ClusterRoleList).Items = []rbac.ClusterRole{stale}
+						return nil
+					},
+					MockDelete: test.NewMockDeleteFn(errBoom),
+				}
+			},
+			wantErr: errors.Wrap(errBoom, "failed to delete stale cluster role"),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			h := &stackHandler{kube: tc.clientFunc(), ext: resource(), log: logging.NewNopLogger()}
+
+			err := h.deleteStaleClusterRoles(ctx)
+			if diff := cmp.Diff(tc.wantErr, err, test.EquateErrors()); diff != "" {
+				t.Errorf("deleteStaleClusterRoles(): -want error, +got error:\n%s", diff)
+			}
+			if tc.want == nil {
+				return
+			}
+
+			crs := &rbac.ClusterRoleList{}
+			if err := h.kube.List(ctx, crs); err != nil {
+				t.Fatalf("List(...): %s", err)
+			}
+			got := []string{}
+			for _, cr := range crs.Items {
+				got = append(got, cr.GetName())
+			}
+			if diff := cmp.Diff(tc.want, got, cmpopts.SortSlices(func(a, b string) bool { return a < b })); diff != "" {
+				t.Errorf("deleteStaleClusterRoles(): -want cluster roles, +got cluster roles:\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_stackHandler_deleteStaleControllers(t *testing.T) {
+	depRef := func(name string) corev1.ObjectReference {
+		return corev1.ObjectReference{Kind: "Deployment", APIVersion: "apps/v1", Name: resourceName + "-" + name, Namespace: namespace}
+	}
+	jobRef := func(name string) corev1.ObjectReference {
+		return corev1.ObjectReference{Kind: "Job", APIVersion: "batch/v1", Name: resourceName + "-" + name, Namespace: namespace}
+	}
+	dep := func(name string) *apps.Deployment {
+		return &apps.Deployment{ObjectMeta: metav1.ObjectMeta{Name: resourceName + "-" + name, Namespace: namespace}}
+	}
+	job := func(name string) *batch.Job {
+		return &batch.Job{ObjectMeta: metav1.ObjectMeta{Name: resourceName + "-" + name, Namespace: namespace}}
+	}
+	withRefs := func(refs ...corev1.ObjectReference) resourceModifier {
+		return func(r *v1alpha1.Stack) { r.Status.ControllerRefs = refs }
+	}
+	spec := v1alpha1.ControllerSpec{
+		Deployment:  &v1alpha1.ControllerDeployment{},
+		Deployments: []v1alpha1.ControllerDeployment{{Name: "webhook"}},
+		Jobs:        []v1alpha1.ControllerJob{{Name: "migrate"}},
+	}
+
+	type want struct {
+		refs        []corev1.ObjectReference
+		deployments []string
+		jobs        []string
+		err         error
+	}
+
+	cases := map[string]struct {
+		ext    *v1alpha1.Stack
+		client client.Client
+		want   want
+	}{
+		"NothingStale": {
+			ext:    resource(withControllerSpec(spec), withRefs(jobRef("migrate"), depRef("controller"), depRef("webhook"))),
+			client: fake.NewFakeClient(job("migrate"), dep("controller"), dep("webhook")),
+			want: want{
+				refs:        []corev1.ObjectReference{jobRef("migrate"), depRef("controller"), depRef("webhook")},
+				deployments: []string{resourceName + "-controller", resourceName + "-webhook"},
+				jobs:        []string{resourceName + "-migrate"},
+			},
+		},
+		"DeleteDropped": {
+			ext: resource(
+				withControllerSpec(v1alpha1.ControllerSpec{Deployment: &v1alpha1.ControllerDeployment{}}),
+				withRefs(jobRef("migrate"), depRef("controller"), depRef("webhook")),
+			),
+			client: fake.NewFakeClient(job("migrate"), dep("controller"), dep("webhook")),
+			want: want{
+				refs:        []corev1.ObjectReference{depRef("controller")},
+				deployments: []string{resourceName + "-controller"},
+				jobs:        []string{},
+			},
+		},
+		"AlreadyDeleted": {
+			ext:    resource(withRefs(depRef("webhook"))),
+			client: fake.NewFakeClient(),
+			want:   want{deployments: []string{}, jobs: []string{}},
+		},
+		"DeleteError": {
+			ext:    resource(withRefs(depRef("webhook"))),
+			client: &test.MockClient{MockDelete: test.NewMockDeleteFn(errBoom)},
+			want: want{
+				err: errors.Wrapf(errBoom, "failed to delete stale controller %s %s", "Deployment", resourceName+"-webhook"),
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			h := &stackHandler{hostKube: tc.client, ext: tc.ext, log: logging.NewNopLogger()}
+
+			err := h.deleteStaleControllers(ctx)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("deleteStaleControllers(): -want error, +got error:\n%s", diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tc.want.refs, h.ext.Status.ControllerRefs); diff != "" {
+				t.Errorf("deleteStaleControllers(): -want controller refs, +got controller refs:\n%s", diff)
+			}
+
+			deps := &apps.DeploymentList{}
+			if err := tc.client.List(ctx, deps); err != nil {
+				t.Fatalf("List(...): %s", err)
+			}
+			gotDeps := []string{}
+			for _, d := range deps.Items {
+				gotDeps = append(gotDeps, d.GetName())
+			}
+			if diff := cmp.Diff(tc.want.deployments, gotDeps, cmpopts.SortSlices(func(a, b string) bool { return a < b })); diff != "" {
+				t.Errorf("deleteStaleControllers(): -want deployments, +got deployments:\n%s", diff)
+			}
+
+			jobs := &batch.JobList{}
+			if err := tc.client.List(ctx, jobs); err != nil {
+				t.Fatalf("List(...): %s", err)
+			}
+			gotJobs := []string{}
+			for _, j := range jobs.Items {
+				gotJobs = append(gotJobs, j.GetName())
+			}
+			if diff := cmp.Diff(tc.want.jobs, gotJobs); diff != "" {
+				t.Errorf("deleteStaleControllers(): -want jobs, +got jobs:\n%s", diff)
+			}
+		})
+	}
+}
+
 func assertKubernetesObject(t *testing.T, g *GomegaWithT, got objectWithGVK, want metav1.Object, kube client.Client) {
 	n := types.NamespacedName{Name: want.GetName(), Namespace: want.GetNamespace()}
 	g.Expect(kube.Get(ctx, n, got)).NotTo(HaveOccurred())
@@ -0,0 +1,441 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stack
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+	admissionregistration "k8s.io/api/admissionregistration/v1beta1"
+	apps "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	util "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+	runtimeresource "github.com/crossplane/crossplane-runtime/pkg/resource"
+	"github.com/crossplane/crossplane/apis/stacks/v1alpha1"
+	"github.com/crossplane/crossplane/pkg/stacks"
+)
+
+const (
+	// webhookPort is the port that controller-runtime webhook servers listen
+	// on by default.
+	webhookPort = 9443
+
+	// webhookCertDir is the directory that controller-runtime webhook servers
+	// read their serving certificate from by default.
+	webhookCertDir        = "/tmp/k8s-webhook-server/serving-certs"
+	webhookCertVolumeName = "webhook-serving-cert"
+
+	// webhookCABundleKey is the key of the webhook serving certificate Secret
+	// that contains the CA bundle injected into webhook configurations. It
+	// includes the previous certificate while it remains valid, so that the
+	// webhook server may be reached while its new certificate is mounted.
+	webhookCABundleKey = "ca.crt"
+
+	webhookCertValidity    = 365 * 24 * time.Hour
+	webhookCertRenewBefore = 30 * 24 * time.Hour
+
+	// Webhook serving certificates are checked for renewal far less
+	// frequently than they expire.
+	requeueAfterOnWebhookCertCheck = 12 * time.Hour
+
+	errHostedWebhooks                 = "webhooks are not supported in host aware mode"
+	errFailedToSyncWebhookService     = "failed to sync webhook service"
+	errFailedToSyncWebhookCertificate = "failed to sync webhook serving certificate"
+	errFailedToSyncWebhookConfig      = "failed to sync webhook configuration"
+	errFailedToInjectConversionCA     = "failed to inject CA bundle into CRD conversion webhook"
+)
+
+var requeueOnWebhookCertCheck = reconcile.Result{RequeueAfter: requeueAfterOnWebhookCertCheck}
+
+// servesWebhooks returns true if the Stack has admission or conversion
+// webhooks.
+func (h *stackHandler) servesWebhooks() bool {
+	return h.ext.Spec.Webhooks != nil && h.ext.Spec.Webhooks.Deployment != ""
+}
+
+// webhookServiceName returns the name of the Service of the Stack's webhooks.
+func (h *stackHandler) webhookServiceName() string {
+	return h.controllerObjectName("webhook")
+}
+
+// webhookSecretName returns the name of the Secret that contains the serving
+// certificate of the Stack's webhooks.
+func (h *stackHandler) webhookSecretName() string {
+	return h.controllerObjectName("webhook-tls")
+}
+
+// webhookConfigurationName returns the name of the Stack's cluster scoped
+// webhook configurations.
+func (h *stackHandler) webhookConfigurationName() string {
+	return fmt.Sprintf("%s.%s.stacks.crossplane.io", h.ext.GetName(), h.ext.GetNamespace())
+}
+
+// prepareWebhookDeployment mounts the webhook serving certificate into the
+// Deployment that serves the Stack's webhooks.
+func (h *stackHandler) prepareWebhookDeployment(d *apps.Deployment) {
+	ps := &d.Spec.Template.Spec
+	ps.Volumes = append(ps.Volumes, corev1.Volume{
+		Name: webhookCertVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: h.webhookSecretName(),
+			},
+		},
+	})
+	for i := range ps.Containers {
+		ps.Containers[i].VolumeMounts = append(ps.Containers[i].VolumeMounts, corev1.VolumeMount{
+			Name:      webhookCertVolumeName,
+			ReadOnly:  true,
+			MountPath: webhookCertDir,
+		})
+	}
+}
+
+// processWebhooks creates the Service and serving certificate of the Stack's
+// webhooks, and registers them with the API server. The serving certificate
+// is renewed before it expires. The webhook configurations of a Stack that no
+// longer serves webhooks are deleted.
+func (h *stackHandler) processWebhooks(ctx context.Context) error {
+	if !h.servesWebhooks() {
+		return errors.Wrap(h.deleteWebhookConfigurations(ctx), errFailedToSyncWebhookConfig)
+	}
+	if h.hostAwareConfig != nil {
+		return errors.New(errHostedWebhooks)
+	}
+
+	if err := h.syncWebhookService(ctx); err != nil {
+		return errors.Wrap(err, errFailedToSyncWebhookService)
+	}
+
+	caBundle, err := h.syncWebhookCertificate(ctx, time.Now())
+	if err != nil {
+		return errors.Wrap(err, errFailedToSyncWebhookCertificate)
+	}
+
+	if err := h.syncWebhookConfigurations(ctx, caBundle); err != nil {
+		return errors.Wrap(err, errFailedToSyncWebhookConfig)
+	}
+
+	crds, err := h.crdsFromStack(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range crds {
+		if err := h.injectConversionCABundle(ctx, &crds[i], caBundle); err != nil {
+			return errors.Wrap(err, errFailedToInjectConversionCA)
+		}
+	}
+
+	return nil
+}
+
+func (h *stackHandler) syncWebhookService(ctx context.Context) error {
+	owner := meta.AsOwner(meta.ReferenceTo(h.ext, v1alpha1.StackGroupVersionKind))
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: h.webhookServiceName(), Namespace: h.ext.GetNamespace()}}
+
+	_, err := util.CreateOrUpdate(ctx, h.kube, svc, func() error {
+		meta.AddOwnerReference(svc, owner)
+		meta.AddLabels(svc, stacks.ParentLabels(h.ext))
+		svc.Spec.Selector = map[string]string{"app": h.controllerObjectName(h.ext.Spec.Webhooks.Deployment)}
+		svc.Spec.Ports = []corev1.ServicePort{{
+			Name:       "webhook",
+			Port:       443,
+			TargetPort: intstr.FromInt(webhookPort),
+		}}
+		return nil
+	})
+	return err
+}
+
+// syncWebhookCertificate ensures the Secret that contains the serving
+// certificate of the Stack's webhooks is valid until at least the renewal
+// period from now, and returns its CA bundle.
+func (h *stackHandler) syncWebhookCertificate(ctx context.Context, now time.Time) ([]byte, error) {
+	owner := meta.AsOwner(meta.ReferenceTo(h.ext, v1alpha1.StackGroupVersionKind))
+	s := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: h.webhookSecretName(), Namespace: h.ext.GetNamespace()}}
+	svc := h.webhookServiceName()
+	ns := h.ext.GetNamespace()
+	names := []string{svc, svc + "." + ns, svc + "." + ns + ".svc", svc + "." + ns + ".svc.cluster.local"}
+
+	_, err := util.CreateOrUpdate(ctx, h.kube, s, func() error {
+		meta.AddOwnerReference(s, owner)
+		meta.AddLabels(s, stacks.ParentLabels(h.ext))
+		s.Type = corev1.SecretTypeTLS
+
+		current := s.Data[corev1.TLSCertKey]
+		if !certificateNeedsRenewal(current, names, now) {
+			return nil
+		}
+
+		cert, key, err := newServingCertificate(names, now)
+		if err != nil {
+			return err
+		}
+		caBundle := cert
+		if old, err := parseCertificate(current); err == nil && now.Before(old.NotAfter) {
+			caBundle = append(append([]byte{}, cert...), current...)
+		}
+
+		s.Data = map[string][]byte{
+			corev1.TLSCertKey:       cert,
+			corev1.TLSPrivateKeyKey: key,
+			webhookCABundleKey:      caBundle,
+		}
+		return nil
+	})
+
+	return s.Data[webhookCABundleKey], err
+}
+
+// webhookClientConfig returns a client config that calls the Stack's webhook
+// Service at the supplied path.
+func (h *stackHandler) webhookClientConfig(path *string, caBundle []byte) admissionregistration.WebhookClientConfig {
+	return admissionregistration.WebhookClientConfig{
+		Service: &admissionregistration.ServiceReference{
+			Namespace: h.ext.GetNamespace(),
+			Name:      h.webhookServiceName(),
+			Path:      path,
+		},
+		CABundle: caBundle,
+	}
+}
+
+// syncWebhookConfigurations registers the Stack's admission webhooks with the
+// API server. A webhook may only intercept requests for the API groups of the
+// Stack's CRDs, and the webhooks of a namespaced Stack are only called for
+// requests in its namespace. Webhook configurations that the Stack no longer
+// declares are deleted.
+func (h *stackHandler) syncWebhookConfigurations(ctx context.Context, caBundle []byte) error {
+	w := h.ext.Spec.Webhooks
+	labels := stacks.ParentLabels(h.ext)
+
+	groups := map[string]bool{}
+	for _, crd := range h.ext.Spec.CRDs {
+		groups[crd.GroupVersionKind().Group] = true
+	}
+	for _, wh := range w.Validating {
+		if err := stacks.CheckWebhookRules(wh.Name, wh.Rules, groups); err != nil {
+			return err
+		}
+	}
+	for _, wh := range w.Mutating {
+		if err := stacks.CheckWebhookRules(wh.Name, wh.Rules, groups); err != nil {
+			return err
+		}
+	}
+
+	selector, err := h.webhookNamespaceSelector(ctx)
+	if err != nil {
+		return err
+	}
+
+	vwc := &admissionregistration.ValidatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: h.webhookConfigurationName()}}
+	if len(w.Validating) == 0 {
+		if err := h.kube.Delete(ctx, vwc); runtimeresource.IgnoreNotFound(err) != nil {
+			return err
+		}
+	} else if _, err := util.CreateOrUpdate(ctx, h.kube, vwc, func() error {
+		meta.AddLabels(vwc, labels)
+		vwc.Webhooks = make([]admissionregistration.ValidatingWebhook, len(w.Validating))
+		for i := range w.Validating {
+			w.Validating[i].DeepCopyInto(&vwc.Webhooks[i])
+			var path *string
+			if svc := w.Validating[i].ClientConfig.Service; svc != nil {
+				path = svc.Path
+			}
+			vwc.Webhooks[i].ClientConfig = h.webhookClientConfig(path, caBundle)
+			if selector != nil {
+				vwc.Webhooks[i].NamespaceSelector = selector.DeepCopy()
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	mwc := &admissionregistration.MutatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: h.webhookConfigurationName()}}
+	if len(w.Mutating) == 0 {
+		if err := h.kube.Delete(ctx, mwc); runtimeresource.IgnoreNotFound(err) != nil {
+			return err
+		}
+	} else if _, err := util.CreateOrUpdate(ctx, h.kube, mwc, func() error {
+		meta.AddLabels(mwc, labels)
+		mwc.Webhooks = make([]admissionregistration.MutatingWebhook, len(w.Mutating))
+		for i := range w.Mutating {
+			w.Mutating[i].DeepCopyInto(&mwc.Webhooks[i])
+			var path *string
+			if svc := w.Mutating[i].ClientConfig.Service; svc != nil {
+				path = svc.Path
+			}
+			mwc.Webhooks[i].ClientConfig = h.webhookClientConfig(path, caBundle)
+			if selector != nil {
+				mwc.Webhooks[i].NamespaceSelector = selector.DeepCopy()
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// webhookNamespaceSelector returns the namespace selector of the webhooks of a
+// namespaced Stack, which matches only the Stack's namespace. The namespace is
+// labelled so that it is matched by the selector. Nil is returned for cluster
+// scoped Stacks, whose webhooks keep the namespace selector of their package.
+func (h *stackHandler) webhookNamespaceSelector(ctx context.Context) (*metav1.LabelSelector, error) {
+	if !h.isNamespaced() {
+		return nil, nil
+	}
+
+	label := fmt.Sprintf(stacks.LabelNamespaceFmt, h.ext.GetNamespace())
+	ns := &corev1.Namespace{}
+	if err := h.kube.Get(ctx, types.NamespacedName{Name: h.ext.GetNamespace()}, ns); err != nil {
+		return nil, err
+	}
+	if ns.GetLabels()[label] != "true" {
+		patch := client.MergeFrom(ns.DeepCopy())
+		meta.AddLabels(ns, map[string]string{label: "true"})
+		if err := h.kube.Patch(ctx, ns, patch); err != nil {
+			return nil, err
+		}
+	}
+
+	return &metav1.LabelSelector{MatchLabels: map[string]string{label: "true"}}, nil
+}
+
+// deleteWebhookConfigurations deletes the Stack's webhook configurations,
+// e.g. when the Stack has been upgraded to a version without webhooks.
+func (h *stackHandler) deleteWebhookConfigurations(ctx context.Context) error {
+	om := metav1.ObjectMeta{Name: h.webhookConfigurationName()}
+	if err := h.kube.Delete(ctx, &admissionregistration.ValidatingWebhookConfiguration{ObjectMeta: om}); runtimeresource.IgnoreNotFound(err) != nil {
+		return err
+	}
+	return runtimeresource.IgnoreNotFound(h.kube.Delete(ctx, &admissionregistration.MutatingWebhookConfiguration{ObjectMeta: om}))
+}
+
+// injectConversionCABundle configures a CRD that uses a conversion webhook to
+// call the Stack's webhook Service.
+func (h *stackHandler) injectConversionCABundle(ctx context.Context, crd *apiextensions.CustomResourceDefinition, caBundle []byte) error {
+	c := crd.Spec.Conversion
+	if c == nil || c.Strategy != apiextensions.WebhookConverter || c.WebhookClientConfig == nil {
+		return nil
+	}
+
+	var path *string
+	if svc := c.WebhookClientConfig.Service; svc != nil {
+		path = svc.Path
+	}
+	want := &apiextensions.WebhookClientConfig{
+		Service: &apiextensions.ServiceReference{
+			Namespace: h.ext.GetNamespace(),
+			Name:      h.webhookServiceName(),
+			Path:      path,
+		},
+		CABundle: caBundle,
+	}
+	if c.WebhookClientConfig.Service != nil && *c.WebhookClientConfig.Service == *want.Service && bytes.Equal(c.WebhookClientConfig.CABundle, caBundle) {
+		return nil
+	}
+
+	patch := client.MergeFrom(crd.DeepCopy())
+	crd.Spec.Conversion.WebhookClientConfig = want
+	return h.kube.Patch(ctx, crd, patch)
+}
+
+// newServingCertificate returns a PEM encoded self-signed serving certificate
+// for the supplied DNS names, and its private key.
+func newServingCertificate(names []string, now time.Time) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot generate private key")
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot generate serial number")
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: names[0]},
+		DNSNames:              names,
+		NotBefore:             now.Add(-1 * time.Hour),
+		NotAfter:              now.Add(webhookCertValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot create certificate")
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot marshal private key")
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		nil
+}
+
+func parseCertificate(b []byte) (*x509.Certificate, error) {
+	p, _ := pem.Decode(b)
+	if p == nil {
+		return nil, errors.New("cannot decode PEM certificate")
+	}
+	return x509.ParseCertificate(p.Bytes)
+}
+
+// certificateNeedsRenewal returns true if the supplied PEM encoded
+// certificate is missing, invalid for any of the supplied DNS names, or due
+// to be renewed.
+func certificateNeedsRenewal(b []byte, names []string, now time.Time) bool {
+	cert, err := parseCertificate(b)
+	if err != nil {
+		return true
+	}
+	if now.Add(webhookCertRenewBefore).After(cert.NotAfter) {
+		return true
+	}
+	for _, n := range names {
+		if cert.VerifyHostname(n) != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,257 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stack
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	admissionregistration "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/crossplane/crossplane/apis/stacks/v1alpha1"
+	"github.com/crossplane/crossplane/pkg/controller/stacks/hosted"
+)
+
+func withWebhooks(w *v1alpha1.WebhooksSpec) resourceModifier {
+	return func(r *v1alpha1.Stack) { r.Spec.Webhooks = w }
+}
+
+func withCRDConversionWebhook(path string) crdModifier {
+	return func(c *apiextensionsv1beta1.CustomResourceDefinition) {
+		c.Spec.Conversion = &apiextensionsv1beta1.CustomResourceConversion{
+			Strategy: apiextensionsv1beta1.WebhookConverter,
+			WebhookClientConfig: &apiextensionsv1beta1.WebhookClientConfig{
+				Service: &apiextensionsv1beta1.ServiceReference{Namespace: "unknown", Name: "controller", Path: &path},
+			},
+		}
+	}
+}
+
+func TestCertificateNeedsRenewal(t *testing.T) {
+	now := time.Now()
+	names := []string{"svc", "svc.ns", "svc.ns.svc", "svc.ns.svc.cluster.local"}
+	cert, _, err := newServingCertificate(names, now)
+	if err != nil {
+		t.Fatalf("newServingCertificate(...): %s", err)
+	}
+
+	cases := map[string]struct {
+		cert  []byte
+		names []string
+		now   time.Time
+		want  bool
+	}{
+		"Valid":           {cert: cert, names: names, now: now, want: false},
+		"Missing":         {cert: nil, names: names, now: now, want: true},
+		"Invalid":         {cert: []byte("not a certificate"), names: names, now: now, want: true},
+		"DueForRenewal":   {cert: cert, names: names, now: now.Add(webhookCertValidity - webhookCertRenewBefore + time.Hour), want: true},
+		"DifferentNames":  {cert: cert, names: []string{"other.ns.svc"}, now: now, want: true},
+		"SubsetOfNames":   {cert: cert, names: names[:2], now: now, want: false},
+		"ExpiredEntirely": {cert: cert, names: names, now: now.Add(2 * webhookCertValidity), want: true},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := certificateNeedsRenewal(tc.cert, tc.names, tc.now)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("certificateNeedsRenewal(...): -want, +got:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestProcessWebhooks(t *testing.T) {
+	path := "/validate"
+	webhooks := &v1alpha1.WebhooksSpec{
+		Deployment: "controller",
+		Validating: []admissionregistration.ValidatingWebhook{{
+			Name: "validate.samples.upbound.io",
+			ClientConfig: admissionregistration.WebhookClientConfig{
+				Service: &admissionregistration.ServiceReference{Namespace: "unknown", Name: "controller", Path: &path},
+			},
+			Rules: []admissionregistration.RuleWithOperations{{
+				Operations: []admissionregistration.OperationType{admissionregistration.Create},
+				Rule:       admissionregistration.Rule{APIGroups: []string{"samples.upbound.io"}, Resources: []string{"mytypes"}},
+			}},
+		}},
+	}
+	otherGroup := webhooks.DeepCopy()
+	otherGroup.Validating[0].Rules[0].APIGroups = []string{""}
+	conversionCRD := crd(withCRDGroupKind("samples.upbound.io", "Mytype"), withCRDVersion("v1alpha1"), withCRDConversionWebhook("/convert"))
+	svcName := resourceName + "-webhook"
+
+	type want struct {
+		err error
+	}
+
+	cases := map[string]struct {
+		r            *v1alpha1.Stack
+		hostawareCfg *hosted.Config
+		objs         []runtime.Object
+		want         want
+	}{
+		"NoWebhooks": {
+			r: resource(),
+		},
+		"WebhooksRemoved": {
+			r: resource(),
+			objs: []runtime.Object{
+				&admissionregistration.ValidatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: resourceName + "." + namespace + ".stacks.crossplane.io"}},
+				&admissionregistration.MutatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: resourceName + "." + namespace + ".stacks.crossplane.io"}},
+			},
+		},
+		"OtherGroup": {
+			r: resource(
+				withWebhooks(otherGroup),
+				withCRDs(metav1.TypeMeta{APIVersion: "samples.upbound.io/v1alpha1", Kind: "Mytype"}),
+			),
+			want: want{err: errors.Wrap(errors.New(`webhook "validate.samples.upbound.io" rule 0 intercepts API group "", which is not an API group of the stack's CRDs`), errFailedToSyncWebhookConfig)},
+		},
+		"MutatingRemoved": {
+			r: resource(
+				withWebhooks(webhooks),
+				withCRDs(metav1.TypeMeta{APIVersion: "samples.upbound.io/v1alpha1", Kind: "Mytype"}),
+			),
+			objs: []runtime.Object{
+				&admissionregistration.MutatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: resourceName + "." + namespace + ".stacks.crossplane.io"}},
+			},
+		},
+		"Hosted": {
+			r:            resource(withWebhooks(webhooks)),
+			hostawareCfg: &hosted.Config{HostControllerNamespace: hostControllerNamespace},
+			want:         want{err: errors.New(errHostedWebhooks)},
+		},
+		"Success": {
+			r: resource(
+				withWebhooks(webhooks),
+				withCRDs(metav1.TypeMeta{APIVersion: "samples.upbound.io/v1alpha1", Kind: "Mytype"}),
+			),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := conversionCRD.DeepCopy()
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+			kube := fake.NewFakeClient(append([]runtime.Object{tc.r, c, ns}, tc.objs...)...)
+			h := &stackHandler{kube: kube, hostKube: kube, hostAwareConfig: tc.hostawareCfg, ext: tc.r}
+
+			err := h.processWebhooks(ctx)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Fatalf("processWebhooks(...): -want error, +got error:\n%s", diff)
+			}
+			if err != nil {
+				return
+			}
+
+			mwc := &admissionregistration.MutatingWebhookConfiguration{}
+			if err := kube.Get(ctx, types.NamespacedName{Name: h.webhookConfigurationName()}, mwc); !kerrors.IsNotFound(err) {
+				t.Errorf("Get(MutatingWebhookConfiguration): want not found, got %v", err)
+			}
+			if !h.servesWebhooks() {
+				vwc := &admissionregistration.ValidatingWebhookConfiguration{}
+				if err := kube.Get(ctx, types.NamespacedName{Name: h.webhookConfigurationName()}, vwc); !kerrors.IsNotFound(err) {
+					t.Errorf("Get(ValidatingWebhookConfiguration): want not found, got %v", err)
+				}
+				return
+			}
+
+			svc := &corev1.Service{}
+			if err := kube.Get(ctx, types.NamespacedName{Namespace: namespace, Name: svcName}, svc); err != nil {
+				t.Fatalf("Get(Service): %s", err)
+			}
+			if diff := cmp.Diff(map[string]string{"app": controllerDeploymentName}, svc.Spec.Selector); diff != "" {
+				t.Errorf("Service selector: -want, +got:\n%s", diff)
+			}
+
+			s := &corev1.Secret{}
+			if err := kube.Get(ctx, types.NamespacedName{Namespace: namespace, Name: resourceName + "-webhook-tls"}, s); err != nil {
+				t.Fatalf("Get(Secret): %s", err)
+			}
+			caBundle := s.Data[webhookCABundleKey]
+			if certificateNeedsRenewal(s.Data[corev1.TLSCertKey], []string{svcName + "." + namespace + ".svc"}, time.Now()) {
+				t.Errorf("serving certificate is not valid for the webhook service")
+			}
+
+			vwc := &admissionregistration.ValidatingWebhookConfiguration{}
+			if err := kube.Get(ctx, types.NamespacedName{Name: h.webhookConfigurationName()}, vwc); err != nil {
+				t.Fatalf("Get(ValidatingWebhookConfiguration): %s", err)
+			}
+			wantConfig := admissionregistration.WebhookClientConfig{
+				Service:  &admissionregistration.ServiceReference{Namespace: namespace, Name: svcName, Path: &path},
+				CABundle: caBundle,
+			}
+			if diff := cmp.Diff(wantConfig, vwc.Webhooks[0].ClientConfig); diff != "" {
+				t.Errorf("ValidatingWebhookConfiguration: -want, +got:\n%s", diff)
+			}
+
+			// The webhooks of a namespaced stack are only called for
+			// requests in its namespace.
+			label := "namespace.crossplane.io/" + namespace
+			wantSelector := &metav1.LabelSelector{MatchLabels: map[string]string{label: "true"}}
+			if diff := cmp.Diff(wantSelector, vwc.Webhooks[0].NamespaceSelector); diff != "" {
+				t.Errorf("ValidatingWebhookConfiguration namespaceSelector: -want, +got:\n%s", diff)
+			}
+			gotNS := &corev1.Namespace{}
+			if err := kube.Get(ctx, types.NamespacedName{Name: namespace}, gotNS); err != nil {
+				t.Fatalf("Get(Namespace): %s", err)
+			}
+			if gotNS.GetLabels()[label] != "true" {
+				t.Errorf("namespace was not labelled to match the webhooks' namespaceSelector: %v", gotNS.GetLabels())
+			}
+
+			got := &apiextensionsv1beta1.CustomResourceDefinition{}
+			if err := kube.Get(ctx, types.NamespacedName{Name: c.GetName()}, got); err != nil {
+				t.Fatalf("Get(CustomResourceDefinition): %s", err)
+			}
+			if cc := got.Spec.Conversion.WebhookClientConfig; cc.Service.Name != svcName || cc.Service.Namespace != namespace || *cc.Service.Path != "/convert" || !bytes.Equal(cc.CABundle, caBundle) {
+				t.Errorf("CRD conversion webhook was not configured: %+v", cc)
+			}
+
+			// A certificate that is not due for renewal is not replaced.
+			if _, err := h.syncWebhookCertificate(ctx, time.Now()); err != nil {
+				t.Fatalf("syncWebhookCertificate(...): %s", err)
+			}
+			again := &corev1.Secret{}
+			_ = kube.Get(ctx, types.NamespacedName{Namespace: namespace, Name: s.GetName()}, again)
+			if !bytes.Equal(s.Data[corev1.TLSCertKey], again.Data[corev1.TLSCertKey]) {
+				t.Errorf("serving certificate was renewed before it was due")
+			}
+
+			// A renewed certificate is added to the CA bundle alongside the
+			// certificate it replaces.
+			renewed, err := h.syncWebhookCertificate(ctx, time.Now().Add(webhookCertValidity-webhookCertRenewBefore+time.Hour))
+			if err != nil {
+				t.Fatalf("syncWebhookCertificate(...): %s", err)
+			}
+			if !bytes.HasSuffix(renewed, s.Data[corev1.TLSCertKey]) || bytes.Equal(renewed, s.Data[corev1.TLSCertKey]) {
+				t.Errorf("renewed CA bundle does not contain the new and previous certificates")
+			}
+		})
+	}
+}
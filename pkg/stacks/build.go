@@ -0,0 +1,395 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane/pkg/stacks/walker"
+)
+
+// OCI image layout media types and file names.
+const (
+	mediaTypeImageIndex    = "application/vnd.oci.image.index.v1+json"
+	mediaTypeImageManifest = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeImageConfig   = "application/vnd.oci.image.config.v1+json"
+	mediaTypeImageLayerGz  = "application/vnd.oci.image.layer.v1.tar+gzip"
+
+	ociLayoutFile    = "oci-layout"
+	ociLayoutVersion = `{"imageLayoutVersion":"1.0.0"}`
+	ociIndexFile     = "index.json"
+	ociBlobsDir      = "blobs"
+
+	annotationRefName = "org.opencontainers.image.ref.name"
+
+	// maxBaseIndexDepth limits how many image indexes will be followed to
+	// find the image manifest of a base image.
+	maxBaseIndexDepth = 4
+
+	// The platform of a stack image that has no base image. Such images
+	// contain only stack content and are never run, but an image config
+	// must specify a platform.
+	defaultImageArchitecture = "amd64"
+	defaultImageOS           = "linux"
+)
+
+// Stack content is written with fixed ownership, permissions, and timestamps
+// so that building the same content always produces the same image.
+const (
+	buildFileMode = 0644
+	buildDirMode  = 0755
+)
+
+var buildTime = time.Unix(0, 0).UTC()
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociIndex struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType,omitempty"`
+	Manifests     []ociDescriptor `json:"manifests"`
+}
+
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType,omitempty"`
+	Config        ociDescriptor   `json:"config"`
+	Layers        []ociDescriptor `json:"layers"`
+
+	// Manifests is set when the manifest is actually an image index.
+	Manifests []ociDescriptor `json:"manifests,omitempty"`
+}
+
+type ociRootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
+
+type ociImageConfig struct {
+	Architecture string            `json:"architecture"`
+	OS           string            `json:"os"`
+	Variant      string            `json:"variant,omitempty"`
+	Config       json.RawMessage   `json:"config,omitempty"`
+	RootFS       ociRootFS         `json:"rootfs"`
+	History      []json.RawMessage `json:"history,omitempty"`
+}
+
+// BuildOption modifies the behavior of Build.
+type BuildOption func(b *builder)
+
+// WithBaseImage builds the stack image on top of the image in the supplied
+// OCI image layout directory. The install job copies the stack content out of
+// the stack image using `cp`, so a stack image that will be installed must
+// have a base image that provides it.
+func WithBaseImage(dir string) BuildOption {
+	return func(b *builder) {
+		b.base = dir
+	}
+}
+
+// WithImageTag records the supplied tag as the reference name of the built
+// image in the OCI image layout index.
+func WithImageTag(tag string) BuildOption {
+	return func(b *builder) {
+		b.tag = tag
+	}
+}
+
+type builder struct {
+	fs   afero.Fs
+	base string
+	tag  string
+}
+
+// Build validates the stack package content in the src directory and, if it
+// is valid, writes a stack image to the out directory in OCI image layout
+// format. The content is written beneath RegistryDirName, in lexical order and
+// with normalised file metadata, so that building the same content always
+// produces an image with the same digest. The out directory must not exist or
+// must be empty.
+//
+// The returned ValidationReport describes any problems with the content. No
+// image is written if the content is not valid.
+func Build(fs afero.Fs, src, out, permissionScope string, log logging.Logger, opts ...BuildOption) (*ValidationReport, error) {
+	b := &builder{fs: fs}
+	for _, o := range opts {
+		o(b)
+	}
+
+	rd := &walker.ResourceDir{Base: src, Walker: afero.Afero{Fs: fs}}
+	report, err := Validate(rd, src, permissionScope, log)
+	if err != nil || !report.Valid() {
+		return report, err
+	}
+
+	if err := b.prepareOutput(out); err != nil {
+		return report, err
+	}
+
+	layer, diffID, err := b.contentLayer(src)
+	if err != nil {
+		return report, errors.Wrap(err, "cannot build stack content layer")
+	}
+
+	cfg := &ociImageConfig{
+		Architecture: defaultImageArchitecture,
+		OS:           defaultImageOS,
+		RootFS:       ociRootFS{Type: "layers"},
+	}
+	layers := []ociDescriptor{}
+	if b.base != "" {
+		if layers, err = b.copyBaseImage(out, cfg); err != nil {
+			return report, errors.Wrapf(err, "cannot use base image %q", b.base)
+		}
+	}
+
+	ld, err := b.writeBlob(out, mediaTypeImageLayerGz, layer)
+	if err != nil {
+		return report, err
+	}
+	layers = append(layers, ld)
+	cfg.RootFS.DiffIDs = append(cfg.RootFS.DiffIDs, diffID)
+	cfg.History = append(cfg.History, json.RawMessage(`{"created_by":"crossplane stack build","comment":"stack content"}`))
+
+	cb, err := json.Marshal(cfg)
+	if err != nil {
+		return report, errors.Wrap(err, "cannot marshal image config")
+	}
+	cd, err := b.writeBlob(out, mediaTypeImageConfig, cb)
+	if err != nil {
+		return report, err
+	}
+
+	mb, err := json.Marshal(&ociManifest{SchemaVersion: 2, MediaType: mediaTypeImageManifest, Config: cd, Layers: layers})
+	if err != nil {
+		return report, errors.Wrap(err, "cannot marshal image manifest")
+	}
+	md, err := b.writeBlob(out, mediaTypeImageManifest, mb)
+	if err != nil {
+		return report, err
+	}
+	if b.tag != "" {
+		md.Annotations = map[string]string{annotationRefName: b.tag}
+	}
+
+	ib, err := json.Marshal(&ociIndex{SchemaVersion: 2, MediaType: mediaTypeImageIndex, Manifests: []ociDescriptor{md}})
+	if err != nil {
+		return report, errors.Wrap(err, "cannot marshal image index")
+	}
+	if err := afero.WriteFile(fs, filepath.Join(out, ociIndexFile), ib, buildFileMode); err != nil {
+		return report, errors.Wrap(err, "cannot write image index")
+	}
+
+	log.Debug("Built stack image", "digest", md.Digest, "layout", out)
+	return report, nil
+}
+
+func (b *builder) prepareOutput(out string) error {
+	if _, err := b.fs.Stat(out); err == nil {
+		empty, err := afero.IsEmpty(b.fs, out)
+		if err != nil {
+			return errors.Wrapf(err, "cannot read output directory %q", out)
+		}
+		if !empty {
+			return errors.Errorf("output directory %q is not empty", out)
+		}
+	}
+
+	if err := b.fs.MkdirAll(filepath.Join(out, ociBlobsDir, "sha256"), buildDirMode); err != nil {
+		return errors.Wrapf(err, "cannot create output directory %q", out)
+	}
+	return errors.Wrap(afero.WriteFile(b.fs, filepath.Join(out, ociLayoutFile), []byte(ociLayoutVersion), buildFileMode), "cannot write image layout version")
+}
+
+// contentLayer returns a gzip compressed tarball of the files in src, beneath
+// RegistryDirName, and the digest of the uncompressed tarball.
+func (b *builder) contentLayer(src string) ([]byte, string, error) {
+	tb := &bytes.Buffer{}
+	tw := tar.NewWriter(tb)
+
+	root := strings.TrimPrefix(RegistryDirName, "/")
+	if err := tw.WriteHeader(buildHeader(root+"/", tar.TypeDir, 0)); err != nil {
+		return nil, "", err
+	}
+
+	// afero.Walk visits files in lexical order.
+	err := afero.Walk(b.fs, src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		name := path.Join(root, filepath.ToSlash(rel))
+
+		switch {
+		case info.IsDir():
+			return tw.WriteHeader(buildHeader(name+"/", tar.TypeDir, 0))
+		case info.Mode().IsRegular():
+			c, err := afero.ReadFile(b.fs, p)
+			if err != nil {
+				return err
+			}
+			if err := tw.WriteHeader(buildHeader(name, tar.TypeReg, int64(len(c)))); err != nil {
+				return err
+			}
+			_, err = tw.Write(c)
+			return err
+		default:
+			return errors.Errorf("%q is not a regular file or directory", p)
+		}
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, "", err
+	}
+
+	gb := &bytes.Buffer{}
+	gz, err := gzip.NewWriterLevel(gb, gzip.BestCompression)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := gz.Write(tb.Bytes()); err != nil {
+		return nil, "", err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, "", err
+	}
+	return gb.Bytes(), sha256Digest(tb.Bytes()), nil
+}
+
+func buildHeader(name string, typeflag byte, size int64) *tar.Header {
+	mode := int64(buildFileMode)
+	if typeflag == tar.TypeDir {
+		mode = buildDirMode
+	}
+	return &tar.Header{
+		Name:     name,
+		Typeflag: typeflag,
+		Mode:     mode,
+		Size:     size,
+		ModTime:  buildTime,
+		Format:   tar.FormatPAX,
+	}
+}
+
+// copyBaseImage copies the layers of the base image to the out directory,
+// returning their descriptors. The platform, runtime config, layer diff IDs,
+// and history of the base image are copied to cfg.
+func (b *builder) copyBaseImage(out string, cfg *ociImageConfig) ([]ociDescriptor, error) {
+	m := ociManifest{}
+	if err := b.readLayoutJSON(filepath.Join(b.base, ociIndexFile), &m); err != nil {
+		return nil, err
+	}
+
+	// Follow image indexes (i.e. multi-platform images) until we find an
+	// image manifest. The first image is used, as when walking an image.
+	for depth := 0; len(m.Manifests) > 0; depth++ {
+		if depth == maxBaseIndexDepth {
+			return nil, errors.Errorf("image indexes are nested more than %d deep", maxBaseIndexDepth)
+		}
+		next := ociManifest{}
+		if err := b.readLayoutJSON(b.blobPath(b.base, m.Manifests[0].Digest), &next); err != nil {
+			return nil, err
+		}
+		m = next
+	}
+
+	if err := b.readLayoutJSON(b.blobPath(b.base, m.Config.Digest), cfg); err != nil {
+		return nil, err
+	}
+	if len(cfg.RootFS.DiffIDs) != len(m.Layers) {
+		return nil, errors.Errorf("image config has %d layer diff IDs, but image manifest has %d layers", len(cfg.RootFS.DiffIDs), len(m.Layers))
+	}
+
+	for _, l := range m.Layers {
+		if err := b.copyBlob(b.blobPath(b.base, l.Digest), b.blobPath(out, l.Digest)); err != nil {
+			return nil, err
+		}
+	}
+	return m.Layers, nil
+}
+
+func (b *builder) readLayoutJSON(name string, v interface{}) error {
+	d, err := afero.ReadFile(b.fs, name)
+	if err != nil {
+		return err
+	}
+	return errors.Wrapf(json.Unmarshal(d, v), "cannot decode %q", name)
+}
+
+func (b *builder) copyBlob(from, to string) error {
+	src, err := b.fs.Open(from)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }()
+
+	dst, err := b.fs.OpenFile(to, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, buildFileMode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		return errors.Wrapf(err, "cannot copy %q", from)
+	}
+	return dst.Close()
+}
+
+// writeBlob writes the supplied content to the out directory, returning its
+// descriptor.
+func (b *builder) writeBlob(out, mediaType string, content []byte) (ociDescriptor, error) {
+	d := ociDescriptor{MediaType: mediaType, Digest: sha256Digest(content), Size: int64(len(content))}
+	err := afero.WriteFile(b.fs, b.blobPath(out, d.Digest), content, buildFileMode)
+	return d, errors.Wrapf(err, "cannot write blob %q", d.Digest)
+}
+
+// blobPath returns the path of the blob with the supplied digest within the
+// supplied OCI image layout directory, e.g. sha256:abc -> dir/blobs/sha256/abc
+func (b *builder) blobPath(dir, digest string) string {
+	return filepath.Join(dir, ociBlobsDir, filepath.FromSlash(strings.Replace(digest, ":", "/", 1)))
+}
+
+func sha256Digest(b []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(b))
+}
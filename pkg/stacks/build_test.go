@@ -0,0 +1,180 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/afero"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane/pkg/stacks/walker"
+)
+
+func buildStackFs() (afero.Fs, map[string]string) {
+	files := map[string]string{
+		"ext-dir/app.yaml":                                      simpleAppFile("Namespaced", "Application", true),
+		"ext-dir/install.yaml":                                  simpleDeploymentInstallFile("crossplane/sample-stack:latest"),
+		"ext-dir/icon.jpg":                                      "mock-icon-data",
+		filepath.Join(simpleCrdDir, "resource.yaml"):            simpleResourceFile,
+		filepath.Join(simpleCrdDir, "mytype.v1alpha1.crd.yaml"): simpleCRDFile("mytype"),
+	}
+	fs := afero.NewMemMapFs()
+	_ = fs.MkdirAll(simpleCrdDir, 0755)
+	for name, body := range files {
+		_ = afero.WriteFile(fs, name, []byte(body), 0600)
+	}
+	return fs, files
+}
+
+// baseImage writes a single layer OCI image layout to dir.
+func baseImage(fs afero.Fs, dir string) {
+	tb := &bytes.Buffer{}
+	tw := tar.NewWriter(tb)
+	_ = tw.WriteHeader(&tar.Header{Name: "bin/cp", Typeflag: tar.TypeReg, Mode: 0755, Size: 2})
+	_, _ = tw.Write([]byte("cp"))
+	_ = tw.Close()
+
+	b := &builder{fs: fs}
+	_ = fs.MkdirAll(filepath.Join(dir, ociBlobsDir, "sha256"), 0755)
+	ld, _ := b.writeBlob(dir, "application/vnd.oci.image.layer.v1.tar", tb.Bytes())
+	cfg, _ := json.Marshal(&ociImageConfig{Architecture: "arm64", OS: "linux", RootFS: ociRootFS{Type: "layers", DiffIDs: []string{ld.Digest}}})
+	cd, _ := b.writeBlob(dir, mediaTypeImageConfig, cfg)
+	m, _ := json.Marshal(&ociManifest{SchemaVersion: 2, Config: cd, Layers: []ociDescriptor{ld}})
+	md, _ := b.writeBlob(dir, mediaTypeImageManifest, m)
+	idx, _ := json.Marshal(&ociIndex{SchemaVersion: 2, Manifests: []ociDescriptor{md}})
+	_ = afero.WriteFile(fs, filepath.Join(dir, ociIndexFile), idx, 0644)
+}
+
+// readLayout returns the contents of every file in an OCI image layout.
+func readLayout(t *testing.T, fs afero.Fs, dir string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := afero.Walk(fs, dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		b, err := afero.ReadFile(fs, p)
+		files[strings.TrimPrefix(p, dir)] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("readLayout(%q): %s", dir, err)
+	}
+	return files
+}
+
+func TestBuild(t *testing.T) {
+	fs, files := buildStackFs()
+
+	first, err := Build(fs, "ext-dir", "/out/first", "Namespaced", logging.NewNopLogger(), WithImageTag("latest"))
+	if err != nil {
+		t.Fatalf("Build(...): %s", err)
+	}
+	if !first.Valid() {
+		t.Fatalf("Build(...): stack is not valid: %+v", first.Problems)
+	}
+
+	// Rebuilding content with different file modes must produce an identical
+	// image.
+	_ = fs.Chmod("ext-dir/app.yaml", 0755)
+	if _, err := Build(fs, "ext-dir", "/out/second", "Namespaced", logging.NewNopLogger(), WithImageTag("latest")); err != nil {
+		t.Fatalf("Build(...): %s", err)
+	}
+	if diff := cmp.Diff(readLayout(t, fs, "/out/first"), readLayout(t, fs, "/out/second")); diff != "" {
+		t.Errorf("Build(...): image is not reproducible: -first, +second:\n%s", diff)
+	}
+
+	got := map[string]string{}
+	ri := &walker.ResourceImage{Base: RegistryDirName, Image: "/out/first", Fs: fs}
+	ri.AddStep("*", func(path string, b []byte) error {
+		got[path] = string(b)
+		return nil
+	})
+	if err := ri.Walk(); err != nil {
+		t.Fatalf("Walk(): %s", err)
+	}
+	want := map[string]string{}
+	for name, body := range files {
+		want[filepath.Join(RegistryDirName, strings.TrimPrefix(name, "ext-dir"))] = body
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Build(...): -want image content, +got:\n%s", diff)
+	}
+
+	if _, err := Build(fs, "ext-dir", "/out/first", "Namespaced", logging.NewNopLogger()); err == nil {
+		t.Errorf("Build(...): expected error building to a directory that is not empty")
+	}
+}
+
+func TestBuildWithBaseImage(t *testing.T) {
+	fs, _ := buildStackFs()
+	baseImage(fs, "/base")
+
+	if _, err := Build(fs, "ext-dir", "/out", "Namespaced", logging.NewNopLogger(), WithBaseImage("/base")); err != nil {
+		t.Fatalf("Build(...): %s", err)
+	}
+
+	b := &builder{fs: fs}
+	idx := ociIndex{}
+	if err := b.readLayoutJSON("/out/"+ociIndexFile, &idx); err != nil {
+		t.Fatalf("readLayoutJSON(index): %s", err)
+	}
+	m := ociManifest{}
+	if err := b.readLayoutJSON(b.blobPath("/out", idx.Manifests[0].Digest), &m); err != nil {
+		t.Fatalf("readLayoutJSON(manifest): %s", err)
+	}
+	cfg := ociImageConfig{}
+	if err := b.readLayoutJSON(b.blobPath("/out", m.Config.Digest), &cfg); err != nil {
+		t.Fatalf("readLayoutJSON(config): %s", err)
+	}
+
+	if len(m.Layers) != 2 || len(cfg.RootFS.DiffIDs) != 2 {
+		t.Fatalf("Build(...): want base layer and content layer, got %d layers and %d diff IDs", len(m.Layers), len(cfg.RootFS.DiffIDs))
+	}
+	if cfg.Architecture != "arm64" {
+		t.Errorf("Build(...): want base image architecture arm64, got %q", cfg.Architecture)
+	}
+	for _, l := range m.Layers {
+		if _, err := fs.Stat(b.blobPath("/out", l.Digest)); err != nil {
+			t.Errorf("Build(...): layer %q was not written: %s", l.Digest, err)
+		}
+	}
+}
+
+func TestBuildInvalidStack(t *testing.T) {
+	fs, _ := buildStackFs()
+	_ = fs.Remove("ext-dir/app.yaml")
+
+	report, err := Build(fs, "ext-dir", "/out", "Namespaced", logging.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Build(...): %s", err)
+	}
+	if report.Valid() {
+		t.Errorf("Build(...): expected an invalid stack to be reported")
+	}
+	if _, err := fs.Stat("/out"); !os.IsNotExist(err) {
+		t.Errorf("Build(...): expected no image to be written for an invalid stack")
+	}
+}
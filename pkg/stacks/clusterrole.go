@@ -19,6 +19,9 @@ package stacks
 import (
 	"fmt"
 
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+
 	"github.com/crossplane/crossplane/apis/stacks/v1alpha1"
 )
 
@@ -45,6 +48,42 @@ const (
 	EnvironmentScoped = "environment"
 )
 
+// PersonaRoleVerbs are the verbs each persona is granted on the CRDs owned by
+// a Stack.
+var PersonaRoleVerbs = map[string][]string{
+	"admin": {"get", "list", "watch", "create", "delete", "deletecollection", "patch", "update"},
+	"edit":  {"get", "list", "watch", "create", "delete", "deletecollection", "patch", "update"},
+	"view":  {"get", "list", "watch"},
+}
+
+// PersonaRoleRules returns the rules of the ClusterRole of the supplied
+// persona, which grant the persona's verbs on each of the supplied CRDs.
+func PersonaRoleRules(crds []apiextensions.CustomResourceDefinition, persona string) []rbacv1.PolicyRule {
+	rules := []rbacv1.PolicyRule{}
+
+	for _, crd := range crds {
+		kinds := []string{crd.Spec.Names.Plural}
+
+		// Subresources may be enabled for the CRD as a whole, or for
+		// individual versions.
+		status, scale := crdSubresources(&crd)
+		if status {
+			kinds = append(kinds, crd.Spec.Names.Plural+"/status")
+		}
+		if scale {
+			kinds = append(kinds, crd.Spec.Names.Plural+"/scale")
+		}
+
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{crd.Spec.Group},
+			Resources: kinds,
+			Verbs:     PersonaRoleVerbs[persona],
+		})
+	}
+
+	return rules
+}
+
 // PersonaRoleName is a helper to ensure the persona role formatting parameters
 // are provided consistently
 func PersonaRoleName(stack *v1alpha1.Stack, persona string) string {
@@ -0,0 +1,187 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+var (
+	// constraintTermRE splits a version constraint term into its operator and
+	// version.
+	constraintTermRE = regexp.MustCompile(`^(>=|<=|!=|=|>|<|~|\^)?\s*(\S+)$`)
+
+	// constraintOperatorRE matches an operator and any space that follows it.
+	constraintOperatorRE = regexp.MustCompile(`(>=|<=|!=|=|>|<|~|\^)\s+`)
+
+	// versionCoreRE matches the numeric components at the start of a version.
+	versionCoreRE = regexp.MustCompile(`^v?([0-9]+(?:\.[0-9]+)*)(.*)$`)
+)
+
+// A VersionConstraint is a range of semantic versions, e.g. ">=1.2.0 <2.0.0".
+// A constraint consists of one or more comma or space separated terms that
+// must all be satisfied. Alternative constraints may be separated by "||".
+// Supported operators are =, !=, >, >=, <, <=, ~ (patch level changes), and ^
+// (changes that do not modify the left-most non-zero component). A version
+// without an operator must match exactly. An empty constraint or "*" matches
+// every version.
+type VersionConstraint struct {
+	raw  string
+	alts [][]constraintTerm
+}
+
+type constraintTerm struct {
+	op string
+	v  *version.Version
+}
+
+// ParseVersionConstraint parses the supplied version constraint.
+func ParseVersionConstraint(s string) (*VersionConstraint, error) {
+	c := &VersionConstraint{raw: s}
+	for _, alt := range strings.Split(s, "||") {
+		terms := []constraintTerm{}
+		for _, t := range strings.FieldsFunc(normaliseOperators(alt), func(r rune) bool { return r == ',' || r == ' ' }) {
+			if t == "*" {
+				continue
+			}
+			parsed, err := parseConstraintTerm(t)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid version constraint %q", s)
+			}
+			terms = append(terms, parsed...)
+		}
+		c.alts = append(c.alts, terms)
+	}
+	return c, nil
+}
+
+// normaliseOperators removes any space between an operator and its version,
+// so that terms may be split on spaces.
+func normaliseOperators(s string) string {
+	return constraintOperatorRE.ReplaceAllString(s, "$1")
+}
+
+func parseConstraintTerm(t string) ([]constraintTerm, error) {
+	m := constraintTermRE.FindStringSubmatch(t)
+	if m == nil {
+		return nil, errors.Errorf("cannot parse term %q", t)
+	}
+	op := m[1]
+	v, n, err := parseVersion(m[2])
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case "~":
+		// ~1.2.3 allows >=1.2.3 <1.3.0, and ~1 allows >=1.0.0 <2.0.0
+		upper := v.WithMinor(v.Minor() + 1).WithPatch(0).WithPreRelease("")
+		if n == 1 {
+			upper = v.WithMajor(v.Major() + 1).WithMinor(0).WithPatch(0).WithPreRelease("")
+		}
+		return []constraintTerm{{op: ">=", v: v}, {op: "<", v: upper}}, nil
+	case "^":
+		// ^1.2.3 allows >=1.2.3 <2.0.0, ^0.2.3 allows >=0.2.3 <0.3.0, and
+		// ^0.0.3 allows >=0.0.3 <0.0.4
+		var upper *version.Version
+		switch {
+		case v.Major() > 0 || n == 1:
+			upper = v.WithMajor(v.Major() + 1).WithMinor(0).WithPatch(0)
+		case v.Minor() > 0 || n == 2:
+			upper = v.WithMinor(v.Minor() + 1).WithPatch(0)
+		default:
+			upper = v.WithPatch(v.Patch() + 1)
+		}
+		return []constraintTerm{{op: ">=", v: v}, {op: "<", v: upper.WithPreRelease("")}}, nil
+	case "":
+		op = "="
+	}
+	return []constraintTerm{{op: op, v: v}}, nil
+}
+
+// parseVersion parses a semantic version, allowing a leading "v" and missing
+// minor or patch components. It also returns the number of components that
+// were supplied.
+func parseVersion(s string) (*version.Version, int, error) {
+	m := versionCoreRE.FindStringSubmatch(s)
+	if m == nil {
+		return nil, 0, errors.Errorf("cannot parse %q as a version", s)
+	}
+	core := strings.Split(m[1], ".")
+	n := len(core)
+	for len(core) < 3 {
+		core = append(core, "0")
+	}
+	v, err := version.ParseSemantic(strings.Join(core, ".") + m[2])
+	return v, n, err
+}
+
+// Check returns true if the supplied version satisfies the constraint.
+func (c *VersionConstraint) Check(v string) (bool, error) {
+	ver, _, err := parseVersion(v)
+	if err != nil {
+		return false, err
+	}
+
+	for _, terms := range c.alts {
+		if checkTerms(terms, ver) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func checkTerms(terms []constraintTerm, v *version.Version) bool {
+	for _, t := range terms {
+		cmp := 0
+		switch {
+		case v.LessThan(t.v):
+			cmp = -1
+		case t.v.LessThan(v):
+			cmp = 1
+		}
+
+		ok := false
+		switch t.op {
+		case "=":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the constraint as it was supplied.
+func (c *VersionConstraint) String() string {
+	return c.raw
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"testing"
+)
+
+func TestVersionConstraintCheck(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{constraint: "", version: "1.0.0", want: true},
+		{constraint: "*", version: "0.0.1", want: true},
+		{constraint: "1.2.3", version: "1.2.3", want: true},
+		{constraint: "1.2.3", version: "v1.2.3", want: true},
+		{constraint: "1.2.3", version: "1.2.4", want: false},
+		{constraint: "=1.2", version: "1.2.0", want: true},
+		{constraint: "!=1.2.3", version: "1.2.3", want: false},
+		{constraint: ">1.2.3", version: "1.2.4", want: true},
+		{constraint: ">1.2.3", version: "1.2.3", want: false},
+		{constraint: ">=1.2.0 <2.0.0", version: "1.9.9", want: true},
+		{constraint: ">=1.2.0 <2.0.0", version: "2.0.0", want: false},
+		{constraint: ">= 1.2.0, < 2.0.0", version: "1.1.9", want: false},
+		{constraint: "<=1.2.3", version: "1.2.3", want: true},
+		{constraint: "~1.2.3", version: "1.2.9", want: true},
+		{constraint: "~1.2.3", version: "1.3.0", want: false},
+		{constraint: "~1", version: "1.9.0", want: true},
+		{constraint: "^1.2.3", version: "1.9.0", want: true},
+		{constraint: "^1.2.3", version: "2.0.0", want: false},
+		{constraint: "^0.2.3", version: "0.2.9", want: true},
+		{constraint: "^0.2.3", version: "0.3.0", want: false},
+		{constraint: "^0.0.3", version: "0.0.4", want: false},
+		{constraint: ">=1.0.0", version: "1.0.0-alpha.1", want: false},
+		{constraint: "<1.0.0 || >=2.0.0", version: "2.1.0", want: true},
+		{constraint: "<1.0.0 || >=2.0.0", version: "1.1.0", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.constraint+"/"+tt.version, func(t *testing.T) {
+			c, err := ParseVersionConstraint(tt.constraint)
+			if err != nil {
+				t.Fatalf("ParseVersionConstraint(%q): %s", tt.constraint, err)
+			}
+			got, err := c.Check(tt.version)
+			if err != nil {
+				t.Fatalf("Check(%q): %s", tt.version, err)
+			}
+			if got != tt.want {
+				t.Errorf("%q.Check(%q): want %t, got %t", tt.constraint, tt.version, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseVersionConstraintError(t *testing.T) {
+	for _, c := range []string{">=one", "1.2.3.x", ">>1.0.0"} {
+		if _, err := ParseVersionConstraint(c); err == nil {
+			t.Errorf("ParseVersionConstraint(%q): want error, got nil", c)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	apiextensionsinternal "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensionsinstall "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/install"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	apiextensionsvalidation "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/validation"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// crdScheme knows how to convert between the internal, v1beta1, and v1
+// representations of a CustomResourceDefinition.
+var crdScheme = func() *runtime.Scheme {
+	s := runtime.NewScheme()
+	apiextensionsinstall.Install(s)
+	return s
+}()
+
+// decodeCRD unmarshals an apiextensions.k8s.io/v1beta1 or apiextensions.k8s.io/v1
+// CustomResourceDefinition. CRDs are always returned as v1beta1, which is
+// what the Stack Manager works with. A CRD without an apiVersion is assumed to
+// be v1beta1.
+func decodeCRD(b []byte) (*apiextensions.CustomResourceDefinition, error) {
+	tm := &metav1.TypeMeta{}
+	if err := yaml.Unmarshal(b, tm); err != nil {
+		return nil, err
+	}
+
+	crd := &apiextensions.CustomResourceDefinition{}
+	switch tm.APIVersion {
+	case apiextensions.SchemeGroupVersion.String(), "":
+		if err := yaml.Unmarshal(b, crd); err != nil {
+			return nil, err
+		}
+	case apiextensionsv1.SchemeGroupVersion.String():
+		v1 := &apiextensionsv1.CustomResourceDefinition{}
+		if err := yaml.Unmarshal(b, v1); err != nil {
+			return nil, err
+		}
+		internal := &apiextensionsinternal.CustomResourceDefinition{}
+		if err := crdScheme.Convert(v1, internal, nil); err != nil {
+			return nil, errors.Wrap(err, "cannot convert CRD from v1")
+		}
+		if err := crdScheme.Convert(internal, crd, nil); err != nil {
+			return nil, errors.Wrap(err, "cannot convert CRD to v1beta1")
+		}
+		crd.SetGroupVersionKind(apiextensions.SchemeGroupVersion.WithKind(tm.Kind))
+	default:
+		return nil, errors.Errorf("unsupported CRD apiVersion %q", tm.APIVersion)
+	}
+
+	return crd, nil
+}
+
+// crdServedVersions returns the names of every version of the CRD that is
+// served. The deprecated Spec.Version is used if no Spec.Versions are set.
+func crdServedVersions(crd *apiextensions.CustomResourceDefinition) []string {
+	if len(crd.Spec.Versions) == 0 {
+		if crd.Spec.Version == "" {
+			return []string{}
+		}
+		return []string{crd.Spec.Version}
+	}
+
+	versions := []string{}
+	for _, v := range crd.Spec.Versions {
+		if v.Served {
+			versions = append(versions, v.Name)
+		}
+	}
+	return versions
+}
+
+// crdGroupKind returns the GroupKind of the resources defined by the CRD.
+func crdGroupKind(crd *apiextensions.CustomResourceDefinition) schema.GroupKind {
+	return schema.GroupKind{Group: crd.Spec.Group, Kind: crd.Spec.Names.Kind}
+}
+
+// crdSubresources reports whether the status and scale subresources are
+// enabled for any version of the CRD.
+func crdSubresources(crd *apiextensions.CustomResourceDefinition) (status, scale bool) {
+	subs := []*apiextensions.CustomResourceSubresources{crd.Spec.Subresources}
+	for _, v := range crd.Spec.Versions {
+		subs = append(subs, v.Subresources)
+	}
+
+	for _, s := range subs {
+		if s == nil {
+			continue
+		}
+		status = status || s.Status != nil
+		scale = scale || s.Scale != nil
+	}
+	return status, scale
+}
+
+// validateCRD validates a CRD the way the API server would when the Stack
+// Manager creates it, so that a malformed CRD is rejected while the stack is
+// unpacked rather than when its objects are created. In addition to the checks
+// made by the API server for v1beta1 CRDs, any OpenAPI schema must be
+// structural, and additional printer columns must reference fields that the
+// schema describes.
+func validateCRD(crd *apiextensions.CustomResourceDefinition) error {
+	// Validate a defaulted copy, as the API server would. The CRD is emitted as
+	// it was found in the stack package.
+	defaulted := crd.DeepCopy()
+	crdScheme.Default(defaulted)
+
+	internal := &apiextensionsinternal.CustomResourceDefinition{}
+	if err := crdScheme.Convert(defaulted, internal, nil); err != nil {
+		return errors.Wrap(err, "cannot convert CRD")
+	}
+
+	// The API server records the storage version of a new CRD before it
+	// validates it.
+	for _, v := range internal.Spec.Versions {
+		if v.Storage {
+			internal.Status.StoredVersions = []string{v.Name}
+			break
+		}
+	}
+
+	errs := apiextensionsvalidation.ValidateCustomResourceDefinition(internal, apiextensions.SchemeGroupVersion)
+	if len(errs) == 0 {
+		errs = append(errs, validateCRDSchemas(internal)...)
+	}
+	return errs.ToAggregate()
+}
+
+// validateCRDSchemas validates that the schema of each version of the CRD is
+// structural, and that its printer columns reference fields in that schema.
+func validateCRDSchemas(crd *apiextensionsinternal.CustomResourceDefinition) field.ErrorList {
+	errs := field.ErrorList{}
+	spec := field.NewPath("spec")
+
+	if crd.Spec.Validation != nil {
+		errs = append(errs, validateStructuralSchema(crd.Spec.Validation.OpenAPIV3Schema, spec.Child("validation", "openAPIV3Schema"))...)
+	}
+
+	for i, v := range crd.Spec.Versions {
+		vp := spec.Child("versions").Index(i)
+		s := crd.Spec.Validation
+		if v.Schema != nil {
+			s = v.Schema
+			errs = append(errs, validateStructuralSchema(v.Schema.OpenAPIV3Schema, vp.Child("schema", "openAPIV3Schema"))...)
+		}
+
+		cols, cp := crd.Spec.AdditionalPrinterColumns, spec.Child("additionalPrinterColumns")
+		if len(v.AdditionalPrinterColumns) > 0 {
+			cols, cp = v.AdditionalPrinterColumns, vp.Child("additionalPrinterColumns")
+		}
+		if s == nil || s.OpenAPIV3Schema == nil {
+			continue
+		}
+		for j, c := range cols {
+			if !schemaHasField(s.OpenAPIV3Schema, c.JSONPath) {
+				errs = append(errs, field.Invalid(cp.Index(j).Child("JSONPath"), c.JSONPath, "must reference a field of the schema of version "+v.Name))
+			}
+		}
+	}
+
+	return errs
+}
+
+func validateStructuralSchema(s *apiextensionsinternal.JSONSchemaProps, p *field.Path) field.ErrorList {
+	if s == nil {
+		return nil
+	}
+	ss, err := structuralschema.NewStructural(s)
+	if err != nil {
+		return field.ErrorList{field.Invalid(p, "", err.Error())}
+	}
+	return structuralschema.ValidateStructural(p, ss)
+}
+
+// schemaHasField returns true if the supplied simple JSON path, e.g.
+// .spec.forProvider.region, may reference a field of the supplied schema.
+// Object metadata, and objects whose fields are not described, may contain any
+// field.
+func schemaHasField(s *apiextensionsinternal.JSONSchemaProps, path string) bool {
+	segments := strings.Split(strings.TrimPrefix(stripSubscripts(path), "."), ".")
+	if segments[0] == "metadata" {
+		return true
+	}
+
+	for _, seg := range segments {
+		// Array subscripts, e.g. conditions[0], select the items of the array.
+		name, subscripts := seg, 0
+		if i := strings.Index(seg, "["); i >= 0 {
+			name, subscripts = seg[:i], strings.Count(seg, "[")
+		}
+
+		if s.XPreserveUnknownFields != nil && *s.XPreserveUnknownFields {
+			return true
+		}
+		if len(s.Properties) == 0 {
+			return s.Type == "" || s.Type == "object"
+		}
+		p, ok := s.Properties[name]
+		if !ok {
+			return false
+		}
+		s = &p
+
+		for ; subscripts > 0; subscripts-- {
+			if s.Items == nil || s.Items.Schema == nil {
+				return true
+			}
+			s = s.Items.Schema
+		}
+	}
+	return true
+}
+
+// stripSubscripts removes the contents of the array subscripts of a JSON path,
+// which may themselves contain paths, e.g. [?(@.type=='Ready')] becomes [].
+func stripSubscripts(path string) string {
+	b := &strings.Builder{}
+	depth := 0
+	for _, r := range path {
+		switch {
+		case r == '[':
+			if depth == 0 {
+				b.WriteRune(r)
+			}
+			depth++
+		case r == ']' && depth > 0:
+			depth--
+			if depth == 0 {
+				b.WriteRune(r)
+			}
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,297 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/crossplane/crossplane/apis/stacks/v1alpha1"
+)
+
+const v1MultiVersionCRDFile = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: mytypes.samples.upbound.io
+spec:
+  group: samples.upbound.io
+  names:
+    kind: Mytype
+    listKind: MytypeList
+    plural: mytypes
+    singular: mytype
+  scope: Namespaced
+  versions:
+  - name: v1beta1
+    served: true
+    storage: true
+    subresources:
+      status: {}
+    schema:
+      openAPIV3Schema:
+        type: object
+  - name: v1alpha1
+    served: true
+    storage: false
+    schema:
+      openAPIV3Schema:
+        type: object
+  - name: v1alpha0
+    served: false
+    storage: false
+    schema:
+      openAPIV3Schema:
+        type: object
+`
+
+func TestDecodeCRD(t *testing.T) {
+	type want struct {
+		apiVersion string
+		versions   []string
+		status     bool
+		scale      bool
+		err        error
+	}
+
+	tests := []struct {
+		name string
+		file string
+		want want
+	}{
+		{
+			name: "V1Beta1",
+			file: subresourceCRDFile("mytype"),
+			want: want{
+				apiVersion: "apiextensions.k8s.io/v1beta1",
+				versions:   []string{"v1alpha1"},
+				status:     true,
+				scale:      true,
+			},
+		},
+		{
+			name: "V1MultipleVersions",
+			file: v1MultiVersionCRDFile,
+			want: want{
+				apiVersion: "apiextensions.k8s.io/v1beta1",
+				versions:   []string{"v1beta1", "v1alpha1"},
+				status:     true,
+			},
+		},
+		{
+			name: "UnsupportedAPIVersion",
+			file: "apiVersion: apiextensions.k8s.io/v2\nkind: CustomResourceDefinition\n",
+			want: want{err: errors.New(`unsupported CRD apiVersion "apiextensions.k8s.io/v2"`)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crd, err := decodeCRD([]byte(tt.file))
+			if diff := cmp.Diff(tt.want.err, err, test.EquateErrors()); diff != "" {
+				t.Fatalf("decodeCRD() -want error, +got error:\n%s", diff)
+			}
+			if err != nil {
+				return
+			}
+
+			if diff := cmp.Diff(tt.want.apiVersion, crd.APIVersion); diff != "" {
+				t.Errorf("decodeCRD() -want apiVersion, +got apiVersion:\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.want.versions, crdServedVersions(crd)); diff != "" {
+				t.Errorf("crdServedVersions() -want, +got:\n%s", diff)
+			}
+			status, scale := crdSubresources(crd)
+			if status != tt.want.status || scale != tt.want.scale {
+				t.Errorf("crdSubresources(): want status %t scale %t, got status %t scale %t", tt.want.status, tt.want.scale, status, scale)
+			}
+		})
+	}
+}
+
+const printerColumnsCRDFile = `apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: mytypes.samples.upbound.io
+spec:
+  group: samples.upbound.io
+  names:
+    kind: Mytype
+    plural: mytypes
+  scope: Namespaced
+  version: v1alpha1
+  additionalPrinterColumns:
+  - name: READY
+    type: string
+    JSONPath: .status.conditions[?(@.type=='Ready')].status
+  - name: SIZE
+    type: integer
+    JSONPath: .spec.size
+  - name: AGE
+    type: date
+    JSONPath: .metadata.creationTimestamp
+  validation:
+    openAPIV3Schema:
+      type: object
+      properties:
+        spec:
+          type: object
+          properties:
+            size:
+              type: integer
+        status:
+          type: object
+          properties:
+            conditions:
+              type: array
+              items:
+                type: object
+                properties:
+                  type:
+                    type: string
+                  status:
+                    type: string
+`
+
+func TestValidateCRD(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		want string
+	}{
+		{
+			name: "Simple",
+			file: simpleCRDFile("mytype"),
+		},
+		{
+			name: "V1MultipleVersions",
+			file: v1MultiVersionCRDFile,
+		},
+		{
+			name: "PrinterColumns",
+			file: printerColumnsCRDFile,
+		},
+		{
+			name: "WrongName",
+			file: strings.Replace(simpleCRDFile("mytype"), "name: mytypes.samples.upbound.io", "name: mytype.samples.upbound.io", 1),
+			want: `metadata.name: Invalid value: "mytype.samples.upbound.io": must be spec.names.plural+"."+spec.group`,
+		},
+		{
+			name: "InconsistentNames",
+			file: strings.Replace(simpleCRDFile("mytype"), "singular: mytype", "singular: MyType", 1),
+			want: `spec.names.singular: Invalid value: "MyType": a DNS-1035 label must consist of lower case alphanumeric characters or '-', start with an alphabetic character, and end with an alphanumeric character (e.g. 'my-name',  or 'abc-123', regex used for validation is '[a-z]([-a-z0-9]*[a-z0-9])?')`,
+		},
+		{
+			name: "NonStructuralSchema",
+			file: strings.Replace(printerColumnsCRDFile, "            size:\n              type: integer\n", "            size: {}\n", 1),
+			want: "spec.validation.openAPIV3Schema.properties[spec].properties[size].type: Required value: must not be empty for specified object fields",
+		},
+		{
+			name: "PrinterColumnMissingField",
+			file: strings.Replace(printerColumnsCRDFile, "JSONPath: .spec.size", "JSONPath: .spec.count", 1),
+			want: `spec.additionalPrinterColumns[1].JSONPath: Invalid value: ".spec.count": must reference a field of the schema of version v1alpha1`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crd, err := decodeCRD([]byte(tt.file))
+			if err != nil {
+				t.Fatalf("decodeCRD(): %s", err)
+			}
+
+			got := ""
+			if err := validateCRD(crd); err != nil {
+				got = err.Error()
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("validateCRD() -want error, +got error:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestStackPackageAddCRD(t *testing.T) {
+	sp := NewStackPackage("/", "", logging.NewNopLogger())
+	sp.SetApp(v1alpha1.AppMetadataSpec{PermissionScope: "Namespaced"})
+
+	crd, err := decodeCRD([]byte(v1MultiVersionCRDFile))
+	if err != nil {
+		t.Fatalf("decodeCRD(): %s", err)
+	}
+	if err := sp.AddCRD("/crds", crd); err != nil {
+		t.Fatalf("AddCRD(): %s", err)
+	}
+
+	// A second CRD of the same group and kind is rejected, rather than
+	// replacing the first.
+	other, err := decodeCRD([]byte(simpleCRDFile("mytype")))
+	if err != nil {
+		t.Fatalf("decodeCRD(): %s", err)
+	}
+	wantErr := errors.Errorf("CRD %q is already defined in %q", "Mytype.samples.upbound.io", "/crds")
+	if diff := cmp.Diff(wantErr, sp.AddCRD("/other", other), test.EquateErrors()); diff != "" {
+		t.Errorf("AddCRD() -want error, +got error:\n%s", diff)
+	}
+
+	wantCRDs := v1alpha1.CRDList{
+		{APIVersion: "samples.upbound.io/v1beta1", Kind: "Mytype"},
+		{APIVersion: "samples.upbound.io/v1alpha1", Kind: "Mytype"},
+	}
+	if diff := cmp.Diff(wantCRDs, sp.Stack.Spec.CRDs); diff != "" {
+		t.Errorf("AddCRD() -want CRDs, +got CRDs:\n%s", diff)
+	}
+
+	if len(sp.CRDs) != 1 {
+		t.Errorf("AddCRD(): want 1 CRD tracked by group and kind, got %d", len(sp.CRDs))
+	}
+
+	if err := sp.applyRules(); err != nil {
+		t.Fatalf("applyRules(): %s", err)
+	}
+	wantRule := rbacv1.PolicyRule{
+		APIGroups:     []string{"samples.upbound.io"},
+		ResourceNames: []string{},
+		Resources:     []string{"mytypes", "mytypes/status"},
+		Verbs:         []string{"*"},
+	}
+	found := false
+	for _, r := range sp.Stack.Spec.Permissions.Rules {
+		if cmp.Equal(wantRule, r) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("applyRules(): want rule %+v in %+v", wantRule, sp.Stack.Spec.Permissions.Rules)
+	}
+
+	// Personas are granted the subresources enabled for any version.
+	wantPersona := []rbacv1.PolicyRule{{
+		APIGroups: []string{"samples.upbound.io"},
+		Resources: []string{"mytypes", "mytypes/status"},
+		Verbs:     PersonaRoleVerbs["view"],
+	}}
+	if diff := cmp.Diff(wantPersona, PersonaRoleRules([]apiextensions.CustomResourceDefinition{*crd}, "view")); diff != "" {
+		t.Errorf("PersonaRoleRules() -want, +got:\n%s", diff)
+	}
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"github.com/pkg/errors"
+	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/version"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane/apis/stacks/v1alpha1"
+)
+
+// An InstalledPackage is a stack package that is installed, and the version of
+// the Stack it produced.
+type InstalledPackage struct {
+	// Package is the image of the stack package, e.g. crossplane/app:v0.1.0.
+	Package string
+
+	// Version is the version from the Stack's app.yaml.
+	Version string
+}
+
+// InstalledPackages returns the package and version of every StackInstall and
+// ClusterStackInstall that has produced a Stack.
+func InstalledPackages(ctx context.Context, kube client.Reader) ([]InstalledPackage, error) {
+	sl := &v1alpha1.StackList{}
+	if err := kube.List(ctx, sl); err != nil {
+		return nil, errors.Wrap(err, "Stacks could not be listed")
+	}
+
+	// A Stack shares the name and namespace of the install that produced it.
+	versions := map[types.NamespacedName]string{}
+	for _, s := range sl.Items {
+		versions[types.NamespacedName{Namespace: s.GetNamespace(), Name: s.GetName()}] = s.Spec.Version
+	}
+
+	sil := &v1alpha1.StackInstallList{}
+	if err := kube.List(ctx, sil); err != nil {
+		return nil, errors.Wrap(err, "StackInstalls could not be listed")
+	}
+	csil := &v1alpha1.ClusterStackInstallList{}
+	if err := kube.List(ctx, csil); err != nil {
+		return nil, errors.Wrap(err, "ClusterStackInstalls could not be listed")
+	}
+
+	installs := []v1alpha1.StackInstaller{}
+	for i := range sil.Items {
+		installs = append(installs, &sil.Items[i])
+	}
+	for i := range csil.Items {
+		installs = append(installs, &csil.Items[i])
+	}
+
+	pkgs := []InstalledPackage{}
+	for _, i := range installs {
+		v, ok := versions[types.NamespacedName{Namespace: i.GetNamespace(), Name: i.GetName()}]
+		if !ok || i.StackRecord() == nil {
+			continue
+		}
+		pkgs = append(pkgs, InstalledPackage{Package: i.GetPackage(), Version: v})
+	}
+	return pkgs, nil
+}
+
+// ParseCRDDependency parses a CRD dependency of the form kind.group.com or
+// kind.group.com/v1beta1 into its group, kind, and optional minimum version.
+func ParseCRDDependency(crd string) (schema.GroupKind, string, error) {
+	name, minVersion := crd, ""
+	if i := strings.Index(crd, "/"); i != -1 {
+		name, minVersion = crd[:i], crd[i+1:]
+	}
+
+	gk := schema.ParseGroupKind(name)
+	if gk.Group == "" || gk.Kind == "" {
+		return schema.GroupKind{}, "", errors.Errorf("cannot parse CustomResourceDefinition %q as Kind and Group", crd)
+	}
+	return gk, minVersion, nil
+}
+
+// ValidateDependency returns an error if the supplied dependency is malformed.
+func ValidateDependency(d v1alpha1.Dependency) error {
+	switch {
+	case d.Package != "" && d.CustomResourceDefinition != "":
+		return errors.New("dependency must specify either a package or a crd, not both")
+	case d.Package != "":
+		_, err := ParseVersionConstraint(d.Version)
+		return err
+	case d.CustomResourceDefinition != "":
+		if d.Version != "" {
+			return errors.Errorf("version constraint %q is not supported for crd dependency %q", d.Version, d.CustomResourceDefinition)
+		}
+		_, _, err := ParseCRDDependency(d.CustomResourceDefinition)
+		return err
+	}
+	return errors.New("dependency must specify a package or a crd")
+}
+
+// UnmetDependencies returns a description of each dependency that is not met
+// by the supplied installed packages and CRDs. A package dependency is met by
+// an installed package of the same repository whose version satisfies the
+// dependency's version constraint. A CRD dependency is met by a CRD of the
+// same group and kind that serves the dependency's minimum version, or any
+// later version.
+func UnmetDependencies(deps []v1alpha1.Dependency, pkgs []InstalledPackage, crds []apiextensions.CustomResourceDefinition) ([]string, error) {
+	unmet := []string{}
+	for _, d := range deps {
+		if err := ValidateDependency(d); err != nil {
+			return nil, err
+		}
+
+		if d.Package != "" {
+			met, err := packageDependencyMet(d, pkgs)
+			if err != nil {
+				return nil, err
+			}
+			if !met {
+				unmet = append(unmet, describeDependency(d))
+			}
+			continue
+		}
+
+		gk, minVersion, err := ParseCRDDependency(d.CustomResourceDefinition)
+		if err != nil {
+			return nil, err
+		}
+		if !crdDependencyMet(gk, minVersion, crds) {
+			unmet = append(unmet, describeDependency(d))
+		}
+	}
+	return unmet, nil
+}
+
+func packageDependencyMet(d v1alpha1.Dependency, pkgs []InstalledPackage) (bool, error) {
+	c, err := ParseVersionConstraint(d.Version)
+	if err != nil {
+		return false, err
+	}
+
+	want := PackageRepository(d.Package)
+	for _, p := range pkgs {
+		if PackageRepository(p.Package) != want {
+			continue
+		}
+		ok, err := c.Check(p.Version)
+		if err != nil {
+			// An installed Stack with an unparseable version cannot satisfy a
+			// version constraint, but may satisfy another installed version.
+			continue
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func crdDependencyMet(gk schema.GroupKind, minVersion string, crds []apiextensions.CustomResourceDefinition) bool {
+	for i := range crds {
+		crd := &crds[i]
+		if crd.Spec.Group != gk.Group || !crdNameMatches(crd, gk.Kind) {
+			continue
+		}
+		if minVersion == "" {
+			return true
+		}
+		for _, v := range crdServedVersions(crd) {
+			if version.CompareKubeAwareVersionStrings(v, minVersion) >= 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// crdNameMatches returns true if the supplied name is a wildcard, or matches
+// the plural, singular, or kind of the CRD. Dependencies have historically
+// used the plural resource name, which is also used for RBAC rules.
+func crdNameMatches(crd *apiextensions.CustomResourceDefinition, name string) bool {
+	n := crd.Spec.Names
+	return name == "*" || name == n.Plural || name == n.Singular || strings.EqualFold(name, n.Kind)
+}
+
+// PackageRepository returns the repository path of the supplied stack package
+// image, ignoring any registry domain, tag, or digest.
+func PackageRepository(pkg string) string {
+	named, err := reference.ParseNormalizedNamed(pkg)
+	if err != nil {
+		return pkg
+	}
+	return reference.Path(named)
+}
+
+func describeDependency(d v1alpha1.Dependency) string {
+	if d.Package == "" {
+		return fmt.Sprintf("crd %s", d.CustomResourceDefinition)
+	}
+	if d.Version == "" {
+		return fmt.Sprintf("package %s", d.Package)
+	}
+	return fmt.Sprintf("package %s %s", d.Package, d.Version)
+}
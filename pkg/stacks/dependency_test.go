@@ -0,0 +1,175 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane/crossplane/apis/stacks/v1alpha1"
+)
+
+func packageDependency(pkg, version string) v1alpha1.Dependency {
+	return v1alpha1.Dependency{Package: pkg, Version: version}
+}
+
+func crdDependency(crd string) v1alpha1.Dependency {
+	return v1alpha1.Dependency{CustomResourceDefinition: crd}
+}
+
+func TestUnmetDependencies(t *testing.T) {
+	crds := []apiextensions.CustomResourceDefinition{{
+		Spec: apiextensions.CustomResourceDefinitionSpec{
+			Group: "mystack.example.org",
+			Names: apiextensions.CustomResourceDefinitionNames{Kind: "Foo", Singular: "foo", Plural: "foos"},
+			Versions: []apiextensions.CustomResourceDefinitionVersion{
+				{Name: "v1alpha1", Served: true},
+				{Name: "v1beta1", Served: true},
+				{Name: "v1", Served: false},
+			},
+		},
+	}}
+	pkgs := []InstalledPackage{
+		{Package: "crossplane/stack-gcp:v0.6.0", Version: "0.6.0"},
+		{Package: "registry.example.org/team/app@sha256:0123456789012345678901234567890123456789012345678901234567890123", Version: "v2.1.0"},
+	}
+
+	type want struct {
+		unmet []string
+		err   error
+	}
+
+	tests := []struct {
+		name string
+		deps []v1alpha1.Dependency
+		want want
+	}{
+		{
+			name: "NoDependencies",
+			want: want{unmet: []string{}},
+		},
+		{
+			name: "PackagesMet",
+			deps: []v1alpha1.Dependency{
+				packageDependency("crossplane/stack-gcp", ">=0.5.0 <1.0.0"),
+				packageDependency("docker.io/crossplane/stack-gcp:v0.7.0", ""),
+				packageDependency("team/app", "^2.0"),
+			},
+			want: want{unmet: []string{}},
+		},
+		{
+			name: "PackagesUnmet",
+			deps: []v1alpha1.Dependency{
+				packageDependency("crossplane/stack-gcp", ">=0.7.0"),
+				packageDependency("crossplane/stack-aws", ""),
+			},
+			want: want{unmet: []string{"package crossplane/stack-gcp >=0.7.0", "package crossplane/stack-aws"}},
+		},
+		{
+			name: "CRDsMet",
+			deps: []v1alpha1.Dependency{
+				crdDependency("foos.mystack.example.org"),
+				crdDependency("Foo.mystack.example.org/v1alpha2"),
+				crdDependency("*.mystack.example.org/v1beta1"),
+			},
+			want: want{unmet: []string{}},
+		},
+		{
+			name: "CRDsUnmet",
+			deps: []v1alpha1.Dependency{
+				crdDependency("foos.mystack.example.org/v1"),
+				crdDependency("bars.mystack.example.org"),
+				crdDependency("foos.yourstack.example.org"),
+			},
+			want: want{unmet: []string{
+				"crd foos.mystack.example.org/v1",
+				"crd bars.mystack.example.org",
+				"crd foos.yourstack.example.org",
+			}},
+		},
+		{
+			name: "InvalidConstraint",
+			deps: []v1alpha1.Dependency{packageDependency("crossplane/stack-gcp", ">=zero")},
+			want: want{err: errors.Wrap(errors.New(`cannot parse "zero" as a version`), `invalid version constraint ">=zero"`)},
+		},
+		{
+			name: "InvalidCRD",
+			deps: []v1alpha1.Dependency{crdDependency("foos")},
+			want: want{err: errors.New(`cannot parse CustomResourceDefinition "foos" as Kind and Group`)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UnmetDependencies(tt.deps, pkgs, crds)
+			if diff := cmp.Diff(tt.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("UnmetDependencies() -want error, +got error:\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.want.unmet, got); diff != "" {
+				t.Errorf("UnmetDependencies() -want, +got:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestValidateDependency(t *testing.T) {
+	tests := []struct {
+		name string
+		dep  v1alpha1.Dependency
+		want error
+	}{
+		{
+			name: "Package",
+			dep:  packageDependency("crossplane/stack-gcp", "~0.6"),
+		},
+		{
+			name: "CRD",
+			dep:  crdDependency("foos.mystack.example.org/v1alpha1"),
+		},
+		{
+			name: "Empty",
+			want: errors.New("dependency must specify a package or a crd"),
+		},
+		{
+			name: "PackageAndCRD",
+			dep: v1alpha1.Dependency{
+				Package:                  "crossplane/stack-gcp",
+				CustomResourceDefinition: "foos.mystack.example.org",
+			},
+			want: errors.New("dependency must specify either a package or a crd, not both"),
+		},
+		{
+			name: "CRDWithVersion",
+			dep:  v1alpha1.Dependency{CustomResourceDefinition: "foos.mystack.example.org", Version: ">=1.0"},
+			want: errors.Errorf("version constraint %q is not supported for crd dependency %q", ">=1.0", "foos.mystack.example.org"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ValidateDependency(tt.dep)
+			if diff := cmp.Diff(tt.want, got, test.EquateErrors()); diff != "" {
+				t.Errorf("ValidateDependency() -want error, +got error:\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+
+	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
+
+	"github.com/crossplane/crossplane/pkg/stacks/walker"
+)
+
+// packageDigest computes a content-addressed digest of a stack package. Only
+// the files that make up the emitted Stack and CRDs contribute to the digest.
+// YAML files are normalised before they are hashed, so that formatting,
+// comments, and key order do not change the digest.
+type packageDigest struct {
+	baseDir string
+	files   map[string][]byte
+}
+
+func newPackageDigest(baseDir string) *packageDigest {
+	return &packageDigest{baseDir: baseDir, files: map[string][]byte{}}
+}
+
+// yamlStep wraps a Step so that the normalised content of the YAML files it
+// processes contribute to the digest. Every document of a multi-document file
+// contributes.
+func (d *packageDigest) yamlStep(step walker.Step) walker.Step {
+	return func(path string, b []byte) error {
+		if err := step(path, b); err != nil {
+			return err
+		}
+
+		// The step has accepted the file, so it is valid YAML.
+		j, err := normaliseDocuments(b)
+		if err != nil {
+			return err
+		}
+		d.add(path, j)
+		return nil
+	}
+}
+
+// normaliseDocuments returns each non-empty document of the supplied YAML or
+// JSON stream as compact JSON with sorted keys, one document per line.
+func normaliseDocuments(b []byte) ([]byte, error) {
+	out := &bytes.Buffer{}
+	d := yamlutil.NewYAMLOrJSONDecoder(bytes.NewReader(b), 4096)
+	for {
+		raw := json.RawMessage{}
+		err := d.Decode(&raw)
+		if err == io.EOF {
+			return out.Bytes(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Numbers are kept as written rather than converted to floats,
+		// which could make different numbers indistinguishable.
+		var doc interface{}
+		jd := json.NewDecoder(bytes.NewReader(raw))
+		jd.UseNumber()
+		if err := jd.Decode(&doc); err != nil {
+			return nil, err
+		}
+		if doc == nil {
+			continue
+		}
+		// Marshalling a decoded document cannot fail, and marshalled JSON
+		// never contains a newline.
+		n, _ := json.Marshal(doc)
+		out.Write(n)
+		out.WriteByte('\n')
+	}
+}
+
+// rawStep wraps a Step so that the exact content of the files it processes
+// contribute to the digest.
+func (d *packageDigest) rawStep(step walker.Step) walker.Step {
+	return func(path string, b []byte) error {
+		if err := step(path, b); err != nil {
+			return err
+		}
+		d.add(path, b)
+		return nil
+	}
+}
+
+func (d *packageDigest) add(path string, b []byte) {
+	rel, err := filepath.Rel(d.baseDir, path)
+	if err != nil {
+		rel = path
+	}
+	d.files[filepath.ToSlash(rel)] = b
+}
+
+// Sum returns the digest of all files added so far, e.g. sha256:abc. Files
+// are hashed in order of their path relative to the package base directory.
+func (d *packageDigest) Sum() string {
+	paths := make([]string, 0, len(d.files))
+	for p := range d.files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	h := sha256.New()
+	for _, p := range paths {
+		// Length prefixes keep the boundaries between files unambiguous.
+		_, _ = fmt.Fprintf(h, "%d:%s%d:", len(p), p, len(d.files[p]))
+		_, _ = h.Write(d.files[p])
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil))
+}
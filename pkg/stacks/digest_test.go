@@ -0,0 +1,247 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane/pkg/stacks/walker"
+)
+
+func TestPackageDigest(t *testing.T) {
+	noop := func(string, []byte) error { return nil }
+
+	type file struct {
+		path string
+		body string
+		raw  bool
+	}
+
+	sum := func(base string, files ...file) string {
+		d := newPackageDigest(base)
+		for _, f := range files {
+			step := d.yamlStep(noop)
+			if f.raw {
+				step = d.rawStep(noop)
+			}
+			if err := step(f.path, []byte(f.body)); err != nil {
+				t.Fatalf("step(%q): %s", f.path, err)
+			}
+		}
+		return d.Sum()
+	}
+
+	base := sum("/ext-dir",
+		file{path: "/ext-dir/app.yaml", body: "title: Sample\nversion: 0.0.1\n"},
+		file{path: "/ext-dir/icon.svg", body: "<svg/>", raw: true},
+	)
+
+	tests := []struct {
+		name  string
+		got   string
+		equal bool
+	}{
+		{
+			name: "FormattingAndKeyOrderIgnored",
+			got: sum("/ext-dir",
+				file{path: "/ext-dir/app.yaml", body: "# comment\nversion:   0.0.1\ntitle: Sample\n"},
+				file{path: "/ext-dir/icon.svg", body: "<svg/>", raw: true},
+			),
+			equal: true,
+		},
+		{
+			name: "WalkOrderIgnored",
+			got: sum("/ext-dir",
+				file{path: "/ext-dir/icon.svg", body: "<svg/>", raw: true},
+				file{path: "/ext-dir/app.yaml", body: "title: Sample\nversion: 0.0.1\n"},
+			),
+			equal: true,
+		},
+		{
+			name: "BaseDirIgnored",
+			got: sum("/.registry",
+				file{path: "/.registry/app.yaml", body: "title: Sample\nversion: 0.0.1\n"},
+				file{path: "/.registry/icon.svg", body: "<svg/>", raw: true},
+			),
+			equal: true,
+		},
+		{
+			name: "ContentChanged",
+			got: sum("/ext-dir",
+				file{path: "/ext-dir/app.yaml", body: "title: Sample\nversion: 0.0.1\n"},
+				file{path: "/ext-dir/icon.svg", body: "<svg />", raw: true},
+			),
+			equal: false,
+		},
+		{
+			name: "PathChanged",
+			got: sum("/ext-dir",
+				file{path: "/ext-dir/app.yaml", body: "title: Sample\nversion: 0.0.1\n"},
+				file{path: "/ext-dir/resources/icon.svg", body: "<svg/>", raw: true},
+			),
+			equal: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if (tt.got == base) != tt.equal {
+				t.Errorf("Sum(): want equal %t, got %q and %q", tt.equal, base, tt.got)
+			}
+		})
+	}
+}
+
+func TestPackageDigestDocuments(t *testing.T) {
+	noop := func(string, []byte) error { return nil }
+
+	sum := func(body string) string {
+		d := newPackageDigest("/ext-dir")
+		if err := d.yamlStep(noop)("/ext-dir/install.yaml", []byte(body)); err != nil {
+			t.Fatalf("step(%q): %s", body, err)
+		}
+		return d.Sum()
+	}
+
+	base := sum("kind: Deployment\n---\nkind: Job\nspec: {a: 1}\n")
+
+	tests := []struct {
+		name  string
+		got   string
+		equal bool
+	}{
+		{
+			name:  "EmptyDocumentsIgnored",
+			got:   sum("---\nkind: Deployment\n---\n---\nkind: Job\nspec: {a: 1}\n"),
+			equal: true,
+		},
+		{
+			name:  "JSONStream",
+			got:   sum(`{"kind": "Deployment"} {"spec": {"a": 1}, "kind": "Job"}`),
+			equal: true,
+		},
+		{
+			name:  "LaterDocumentChanged",
+			got:   sum("kind: Deployment\n---\nkind: Job\nspec: {a: 2}\n"),
+			equal: false,
+		},
+		{
+			name:  "DocumentAdded",
+			got:   sum("kind: Deployment\n---\nkind: Job\nspec: {a: 1}\n---\nkind: Job\n"),
+			equal: false,
+		},
+		{
+			name:  "DocumentsSplit",
+			got:   sum("kind: Deployment\n---\nkind: Job\n---\nspec: {a: 1}\n"),
+			equal: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if (tt.got == base) != tt.equal {
+				t.Errorf("Sum(): want equal %t, got %q and %q", tt.equal, base, tt.got)
+			}
+		})
+	}
+}
+
+func TestUnpackDigest(t *testing.T) {
+	digest := func(files map[string]string) string {
+		fs := afero.NewMemMapFs()
+		_ = fs.MkdirAll(simpleCrdDir, 0755)
+		_ = afero.WriteFile(fs, "ext-dir/app.yaml", []byte(simpleAppFile("Namespaced", "Application", true)), 0644)
+		_ = afero.WriteFile(fs, filepath.Join(simpleCrdDir, "mytype.v1alpha1.crd.yaml"), []byte(simpleCRDFile("mytype")+schemaCRDValidation), 0644)
+		for path, body := range files {
+			_ = afero.WriteFile(fs, path, []byte(body), 0644)
+		}
+
+		out := &bytes.Buffer{}
+		rd := &walker.ResourceDir{Base: "ext-dir", Walker: afero.Afero{Fs: fs}}
+		if err := Unpack(rd, out, "ext-dir", "Namespaced", "", logging.NewNopLogger()); err != nil {
+			t.Fatalf("Unpack(): %s", err)
+		}
+		r, err := NewObjectReader(out)
+		if err != nil {
+			t.Fatalf("NewObjectReader(): %s", err)
+		}
+		o, err := r.Read()
+		if err != nil && err != io.EOF {
+			t.Fatalf("Read(): %s", err)
+		}
+		return o.GetAnnotations()[AnnotationPackageDigest]
+	}
+
+	// Each case changes a file that contributes to the unpacked Stack or
+	// CRDs, which must change the digest.
+	tests := []struct {
+		name string
+		a    map[string]string
+		b    map[string]string
+	}{
+		{
+			name: "Group",
+			a:    map[string]string{"ext-dir/resources/samples.upbound.io/group.yaml": "title: Group Title\n"},
+			b:    map[string]string{"ext-dir/resources/samples.upbound.io/group.yaml": "title: Other Title\n"},
+		},
+		{
+			name: "Resource",
+			a:    map[string]string{filepath.Join(simpleCrdDir, "mytype.v1alpha1.resource.yaml"): "title: Resource Title\n"},
+			b:    map[string]string{filepath.Join(simpleCrdDir, "mytype.v1alpha1.resource.yaml"): "title: Other Title\n"},
+		},
+		{
+			name: "GroupLocale",
+			a:    map[string]string{"ext-dir/resources/samples.upbound.io/group.de.yaml": "title: Gruppe\n"},
+			b:    map[string]string{"ext-dir/resources/samples.upbound.io/group.de.yaml": "title: Andere Gruppe\n"},
+		},
+		{
+			name: "ResourceLocale",
+			a:    map[string]string{filepath.Join(simpleCrdDir, "mytype.v1alpha1.resource.de.yaml"): "readme: Lies mich\n"},
+			b:    map[string]string{filepath.Join(simpleCrdDir, "mytype.v1alpha1.resource.de.yaml"): "readme: Lies mich nicht\n"},
+		},
+		{
+			name: "LaterWebhook",
+			a: map[string]string{
+				"ext-dir/install.yaml":  simpleDeploymentInstallFile("crossplane/sample-stack:latest"),
+				"ext-dir/webhooks.yaml": webhookConfigurationFile("ValidatingWebhookConfiguration", "validate", "controller") + "---\n" + webhookConfigurationFile("MutatingWebhookConfiguration", "mutate", "controller"),
+			},
+			b: map[string]string{
+				"ext-dir/install.yaml":  simpleDeploymentInstallFile("crossplane/sample-stack:latest"),
+				"ext-dir/webhooks.yaml": webhookConfigurationFile("ValidatingWebhookConfiguration", "validate", "controller") + "---\n" + webhookConfigurationFile("MutatingWebhookConfiguration", "mutate", "controller") + "  failurePolicy: Ignore\n",
+			},
+		},
+		{
+			name: "LaterExample",
+			a:    map[string]string{"ext-dir/examples/a.yaml": simpleExampleFile("a") + "spec:\n  size: 1\n---\n" + simpleExampleFile("b") + "spec:\n  size: 1\n"},
+			b:    map[string]string{"ext-dir/examples/a.yaml": simpleExampleFile("a") + "spec:\n  size: 1\n---\n" + simpleExampleFile("b") + "spec:\n  size: 2\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if a, b := digest(tt.a), digest(tt.b); a == b {
+				t.Errorf("Unpack(): want different digests, got %q for both", a)
+			}
+		})
+	}
+}
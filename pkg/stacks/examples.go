@@ -0,0 +1,175 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	apiextensionsinternal "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	apiservervalidation "k8s.io/apiextensions-apiserver/pkg/apiserver/validation"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
+
+	"github.com/crossplane/crossplane/pkg/stacks/walker"
+)
+
+const (
+	// examplesDirName is the name of the directories that contain example
+	// resources. Examples may be of any kind that the stack owns, and may be
+	// placed anywhere in the stack package.
+	examplesDirName         = "examples"
+	exampleFileNamePattern  = "*.yaml"
+	annotationStackExamples = "stacks.crossplane.io/resource-examples"
+
+	// maxExamplesSize is the largest total size of the examples of a single
+	// CRD. Kubernetes limits the total size of an object's annotations to
+	// 256KiB, which the examples share with the CRD's other annotations.
+	maxExamplesSize = 64 * 1024
+)
+
+// exampleFiles wraps a Step so that it only processes files within an
+// examples directory.
+func exampleFiles(step walker.Step) walker.Step {
+	return func(path string, b []byte) error {
+		if filepath.Base(filepath.Dir(path)) != examplesDirName {
+			return nil
+		}
+		return step(path, b)
+	}
+}
+
+// exampleStep unmarshals the example resources in examples/*.yaml files, which
+// are added to the StackPackager. Files may contain multiple YAML documents.
+func exampleStep(sp StackPackager) walker.Step {
+	return func(path string, b []byte) error {
+		d := yamlutil.NewYAMLOrJSONDecoder(bytes.NewReader(b), 4096)
+		for {
+			u := &unstructured.Unstructured{}
+			err := d.Decode(&u.Object)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return errors.Wrap(err, fmt.Sprintf("invalid example %q", path))
+			}
+			if len(u.Object) == 0 {
+				continue
+			}
+			if u.GetAPIVersion() == "" || u.GetKind() == "" {
+				return errors.New(fmt.Sprintf("example %q must specify an apiVersion and kind", path))
+			}
+			sp.AddExample(path, *u)
+		}
+	}
+}
+
+// validateExample validates the supplied example against the OpenAPI schema of
+// the version of the CRD it uses.
+func validateExample(crd *apiextensions.CustomResourceDefinition, u *unstructured.Unstructured) error {
+	version := u.GroupVersionKind().Version
+
+	served := false
+	for _, v := range crdServedVersions(crd) {
+		served = served || v == version
+	}
+	if !served {
+		return errors.Errorf("version %q of kind %q is not served", version, u.GetKind())
+	}
+
+	validation := crd.Spec.Validation
+	for _, v := range crd.Spec.Versions {
+		if v.Name == version && v.Schema != nil {
+			validation = v.Schema
+		}
+	}
+	if validation == nil || validation.OpenAPIV3Schema == nil {
+		return nil
+	}
+
+	internal := &apiextensionsinternal.CustomResourceValidation{}
+	if err := crdScheme.Convert(validation, internal, nil); err != nil {
+		return errors.Wrap(err, "cannot convert CRD schema")
+	}
+	validator, _, err := apiservervalidation.NewSchemaValidator(internal)
+	if err != nil {
+		return errors.Wrap(err, "invalid CRD schema")
+	}
+	if errs := apiservervalidation.ValidateCustomResource(nil, u.UnstructuredContent(), validator); len(errs) > 0 {
+		return errs.ToAggregate()
+	}
+	return nil
+}
+
+// exampleCRD returns the key of the CRD that the supplied example is an
+// instance of, after validating it against the CRD's schema.
+func (sp *StackPackage) exampleCRD(u *unstructured.Unstructured) (string, error) {
+	gk := u.GroupVersionKind().GroupKind().String()
+	crd, ok := sp.CRDs[gk]
+	if !ok {
+		return "", errors.Errorf("kind %q is not owned by the stack", gk)
+	}
+	return gk, validateExample(&crd, u)
+}
+
+// orderedExamplePaths returns the map indexes in ascending order
+func orderedExamplePaths(m map[string][]unstructured.Unstructured) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// applyExamples validates every example against the CRD it is an instance of,
+// then annotates each CRD with its examples as a multiple document YAML
+// stream, in the order of the files they were found in.
+func (sp *StackPackage) applyExamples() error {
+	examples := map[string][]string{}
+	for _, p := range orderedExamplePaths(sp.Examples) {
+		for i := range sp.Examples[p] {
+			u := &sp.Examples[p][i]
+			gk, err := sp.exampleCRD(u)
+			if err != nil {
+				return errors.Wrap(err, fmt.Sprintf("invalid example %q", p))
+			}
+			b, err := yaml.Marshal(u.Object)
+			if err != nil {
+				return errors.Wrap(err, fmt.Sprintf("invalid example %q", p))
+			}
+			examples[gk] = append(examples[gk], strings.TrimSpace(string(b)))
+		}
+	}
+
+	for gk, e := range examples {
+		a := strings.Join(e, yamlSeparator)
+		if len(a) > maxExamplesSize {
+			return errors.Errorf("examples of kind %q are %d bytes, which exceeds the maximum of %d bytes", gk, len(a), maxExamplesSize)
+		}
+		crd := sp.CRDs[gk]
+		crd.ObjectMeta.Annotations[annotationStackExamples] = a
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/crossplane/crossplane/pkg/stacks/walker"
+)
+
+func simpleExampleFile(name string) string {
+	return fmt.Sprintf(`apiVersion: samples.upbound.io/v1alpha1
+kind: Mytype
+metadata:
+  name: %s
+`, name)
+}
+
+const schemaCRDValidation = `  validation:
+    openAPIV3Schema:
+      properties:
+        spec:
+          properties:
+            size:
+              type: integer
+          required:
+          - size
+          type: object
+      type: object
+`
+
+func TestUnpackExamples(t *testing.T) {
+	type want struct {
+		examples string
+		err      error
+	}
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  want
+	}{
+		{
+			name: "NoExamples",
+			want: want{},
+		},
+		{
+			name: "ValidExamples",
+			files: map[string]string{
+				"ext-dir/examples/b.yaml":                   "apiVersion: samples.upbound.io/v1alpha1\nkind: Mytype\nmetadata:\n  name: b\nspec:\n  size: 2\n",
+				"ext-dir/examples/a.yaml":                   "apiVersion: samples.upbound.io/v1alpha1\nkind: Mytype\nmetadata:\n  name: a\nspec:\n  size: 1\n---\napiVersion: samples.upbound.io/v1alpha1\nkind: Mytype\nmetadata:\n  name: c\nspec:\n  size: 3\n",
+				filepath.Join(simpleCrdDir, "example.yaml"): "not an example",
+			},
+			want: want{examples: strings.Join([]string{
+				"apiVersion: samples.upbound.io/v1alpha1\nkind: Mytype\nmetadata:\n  name: a\nspec:\n  size: 1",
+				"apiVersion: samples.upbound.io/v1alpha1\nkind: Mytype\nmetadata:\n  name: c\nspec:\n  size: 3",
+				"apiVersion: samples.upbound.io/v1alpha1\nkind: Mytype\nmetadata:\n  name: b\nspec:\n  size: 2",
+			}, yamlSeparator)},
+		},
+		{
+			name:  "MissingKind",
+			files: map[string]string{"ext-dir/examples/a.yaml": "apiVersion: samples.upbound.io/v1alpha1\n"},
+			want: want{err: errors.Wrap(
+				errors.New(`example "ext-dir/examples/a.yaml" must specify an apiVersion and kind`),
+				"failed to walk Stack filesystem")},
+		},
+		{
+			name:  "NotOwned",
+			files: map[string]string{"ext-dir/examples/a.yaml": "apiVersion: samples.upbound.io/v1alpha1\nkind: Othertype\n"},
+			want: want{err: errors.Wrap(
+				errors.New(`kind "Othertype.samples.upbound.io" is not owned by the stack`),
+				`invalid example "ext-dir/examples/a.yaml"`)},
+		},
+		{
+			name:  "VersionNotServed",
+			files: map[string]string{"ext-dir/examples/a.yaml": "apiVersion: samples.upbound.io/v1\nkind: Mytype\n"},
+			want: want{err: errors.Wrap(
+				errors.New(`version "v1" of kind "Mytype" is not served`),
+				`invalid example "ext-dir/examples/a.yaml"`)},
+		},
+		{
+			name:  "InvalidSchema",
+			files: map[string]string{"ext-dir/examples/a.yaml": "apiVersion: samples.upbound.io/v1alpha1\nkind: Mytype\nspec:\n  size: big\n"},
+			want: want{err: errors.Wrap(
+				errors.New(`spec.size: Invalid value: "string": spec.size in body must be of type integer: "string"`),
+				`invalid example "ext-dir/examples/a.yaml"`)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			_ = fs.MkdirAll(simpleCrdDir, 0755)
+			_ = afero.WriteFile(fs, "ext-dir/app.yaml", []byte(simpleAppFile("Namespaced", "Application", true)), 0644)
+			_ = afero.WriteFile(fs, filepath.Join(simpleCrdDir, "mytype.v1alpha1.crd.yaml"), []byte(simpleCRDFile("mytype")+schemaCRDValidation), 0644)
+			for path, content := range tt.files {
+				_ = afero.WriteFile(fs, path, []byte(content), 0644)
+			}
+
+			out := &bytes.Buffer{}
+			rd := &walker.ResourceDir{Base: "ext-dir", Walker: afero.Afero{Fs: fs}}
+			err := Unpack(rd, out, "ext-dir", "Namespaced", "", logging.NewNopLogger())
+			if diff := cmp.Diff(tt.want.err, err, test.EquateErrors()); diff != "" {
+				t.Fatalf("Unpack() -want error, +got error:\n%s", diff)
+			}
+			if err != nil {
+				return
+			}
+
+			r, err := NewObjectReader(out)
+			if err != nil {
+				t.Fatalf("NewObjectReader(): %s", err)
+			}
+			got := ""
+			for {
+				o, err := r.Read()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Read(): %s", err)
+				}
+				if o.GetKind() == "CustomResourceDefinition" {
+					got = o.GetAnnotations()[annotationStackExamples]
+				}
+			}
+			if diff := cmp.Diff(tt.want.examples, got); diff != "" {
+				t.Errorf("Unpack() examples -want, +got:\n%s", diff)
+			}
+		})
+	}
+}
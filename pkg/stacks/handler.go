@@ -0,0 +1,127 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/crossplane/crossplane/pkg/stacks/walker"
+)
+
+// An UnpackHandler processes stack package files that are not part of the
+// core stack package format, e.g. examples or policies. Handlers may annotate
+// the Stack and its CRDs, or emit extra objects, via the StackPackager.
+type UnpackHandler interface {
+	// Step processes a single file that matches the handler's pattern. Files
+	// are processed in the order they are walked, so CRDs and other package
+	// files may not have been processed yet.
+	Step(sp StackPackager, path string, b []byte) error
+
+	// Finish is called once the whole package has been walked and the core
+	// package files have been applied to the StackPackager.
+	Finish(sp StackPackager) error
+}
+
+// An UnpackStepFunc is an UnpackHandler that only processes single files.
+type UnpackStepFunc func(sp StackPackager, path string, b []byte) error
+
+// Step processes a single file.
+func (fn UnpackStepFunc) Step(sp StackPackager, path string, b []byte) error {
+	return fn(sp, path, b)
+}
+
+// Finish does nothing.
+func (fn UnpackStepFunc) Finish(_ StackPackager) error {
+	return nil
+}
+
+// A NewUnpackHandlerFn returns a new UnpackHandler. A new handler is created
+// each time a stack package is unpacked or validated.
+type NewUnpackHandlerFn func() UnpackHandler
+
+type registeredHandler struct {
+	pattern    string
+	newHandler NewUnpackHandlerFn
+}
+
+var (
+	handlersMu sync.RWMutex
+	handlers   []registeredHandler
+)
+
+// RegisterUnpackHandler registers a handler for stack package files that match
+// the supplied pattern. Patterns are matched against the name of each file,
+// e.g. policy.yaml, unless they contain a "/" in which case they are matched
+// against the path of the file relative to the base of the package, e.g.
+// examples/*.yaml. Handlers are typically registered by the init function of
+// the package that implements them.
+//
+// Files processed by registered handlers contribute to the package digest.
+func RegisterUnpackHandler(pattern string, fn NewUnpackHandlerFn) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	handlers = append(handlers, registeredHandler{pattern: pattern, newHandler: fn})
+}
+
+func registeredHandlers() []registeredHandler {
+	handlersMu.RLock()
+	defer handlersMu.RUnlock()
+	return append([]registeredHandler(nil), handlers...)
+}
+
+// boundHandler is a registered handler instantiated for a single walk of a
+// stack package.
+type boundHandler struct {
+	registeredHandler
+	handler UnpackHandler
+}
+
+// addUnpackHandlers instantiates every registered handler and adds a step for
+// each to the supplied walker. Each step is wrapped by the supplied function,
+// which may be used to record the files the handler processes.
+func addUnpackHandlers(rw walker.ResourceWalker, baseDir string, sp StackPackager, wrap func(walker.Step) walker.Step) []boundHandler {
+	bound := []boundHandler{}
+	for _, rh := range registeredHandlers() {
+		bh := boundHandler{registeredHandler: rh, handler: rh.newHandler()}
+		rw.AddStep(bh.namePattern(), wrap(bh.step(baseDir, sp)))
+		bound = append(bound, bh)
+	}
+	return bound
+}
+
+// namePattern returns the part of the pattern that the walker matches against
+// file names.
+func (bh boundHandler) namePattern() string {
+	return filepath.Base(bh.pattern)
+}
+
+func (bh boundHandler) step(baseDir string, sp StackPackager) walker.Step {
+	return func(path string, b []byte) error {
+		if strings.Contains(bh.pattern, "/") {
+			rel, err := filepath.Rel(baseDir, path)
+			if err != nil {
+				return nil
+			}
+			if ok, _ := filepath.Match(bh.pattern, filepath.ToSlash(rel)); !ok {
+				return nil
+			}
+		}
+		return bh.handler.Step(sp, path, b)
+	}
+}
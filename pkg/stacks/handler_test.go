@@ -0,0 +1,175 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/crossplane/crossplane/pkg/stacks/walker"
+)
+
+// exampleHandler emits a ConfigMap listing every example it processed, and
+// annotates the Stack with the number of examples and the mytype CRD with
+// their names.
+type exampleHandler struct {
+	paths []string
+}
+
+func (h *exampleHandler) Step(sp StackPackager, path string, b []byte) error {
+	h.paths = append(h.paths, filepath.Base(path))
+	return nil
+}
+
+func (h *exampleHandler) Finish(sp StackPackager) error {
+	sort.Strings(h.paths)
+	sp.AddAnnotations(map[string]string{"examples.example.org/count": strconv.Itoa(len(h.paths))})
+	if _, ok := sp.GetCRD(schema.GroupKind{Group: "samples.upbound.io", Kind: "Mytype"}); !ok {
+		return errors.New("missing mytype CRD")
+	}
+	if err := sp.AddCRDAnnotations(schema.GroupKind{Group: "samples.upbound.io", Kind: "Mytype"}, map[string]string{"examples.example.org/files": strings.Join(h.paths, ",")}); err != nil {
+		return err
+	}
+	sp.AddObject(&corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{Name: "examples"},
+		Data:       map[string]string{"files": strings.Join(h.paths, ",")},
+	})
+	return nil
+}
+
+// withRegisteredHandlers replaces the registered handlers, and returns a
+// function that restores them.
+func withRegisteredHandlers(rh ...registeredHandler) func() {
+	saved := handlers
+	handlers = rh
+	return func() { handlers = saved }
+}
+
+func TestUnpackHandlers(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	fs := afero.NewMemMapFs()
+	_ = fs.MkdirAll(simpleCrdDir, 0755)
+	_ = afero.WriteFile(fs, "ext-dir/app.yaml", []byte(simpleAppFile("Namespaced", "Application", true)), 0644)
+	_ = afero.WriteFile(fs, filepath.Join(simpleCrdDir, "mytype.v1alpha1.crd.yaml"), []byte(simpleCRDFile("mytype")), 0644)
+	_ = afero.WriteFile(fs, "ext-dir/examples/b.yaml", []byte(simpleExampleFile("b")), 0644)
+	_ = afero.WriteFile(fs, "ext-dir/examples/a.yaml", []byte(simpleExampleFile("a")), 0644)
+	_ = afero.WriteFile(fs, filepath.Join(simpleCrdDir, "examples", "ignored.yaml"), []byte(simpleExampleFile("ignored")), 0644)
+
+	type want struct {
+		kinds       []string
+		annotations map[string]string
+		err         error
+	}
+
+	tests := []struct {
+		name     string
+		handlers []registeredHandler
+		want     want
+	}{
+		{
+			name:     "NoHandlers",
+			handlers: nil,
+			want:     want{kinds: []string{"CustomResourceDefinition", "Stack"}},
+		},
+		{
+			name: "ExampleHandler",
+			handlers: []registeredHandler{
+				{pattern: "examples/*.yaml", newHandler: func() UnpackHandler { return &exampleHandler{} }},
+			},
+			want: want{
+				kinds: []string{"CustomResourceDefinition", "ConfigMap", "Stack"},
+				annotations: map[string]string{
+					"CustomResourceDefinition/examples.example.org/files": "a.yaml,b.yaml",
+					"Stack/examples.example.org/count":                    "2",
+				},
+			},
+		},
+		{
+			name: "StepError",
+			handlers: []registeredHandler{
+				{pattern: "*.yaml", newHandler: func() UnpackHandler {
+					return UnpackStepFunc(func(_ StackPackager, _ string, _ []byte) error { return errBoom })
+				}},
+			},
+			want: want{err: errors.Wrap(errBoom, "failed to walk Stack filesystem")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer withRegisteredHandlers(tt.handlers...)()
+
+			out := &bytes.Buffer{}
+			rd := &walker.ResourceDir{Base: "ext-dir", Walker: afero.Afero{Fs: fs}}
+			err := Unpack(rd, out, "ext-dir", "Namespaced", "", logging.NewNopLogger())
+			if diff := cmp.Diff(tt.want.err, err, test.EquateErrors()); diff != "" {
+				t.Fatalf("Unpack() -want error, +got error:\n%s", diff)
+			}
+			if err != nil {
+				return
+			}
+
+			r, err := NewObjectReader(out)
+			if err != nil {
+				t.Fatalf("NewObjectReader(): %s", err)
+			}
+			kinds := []string{}
+			annotations := map[string]string{}
+			for {
+				o, err := r.Read()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Read(): %s", err)
+				}
+				kinds = append(kinds, o.GetKind())
+				for k, v := range o.GetAnnotations() {
+					if strings.HasPrefix(k, "examples.example.org/") {
+						annotations[o.GetKind()+"/"+k] = v
+					}
+				}
+			}
+
+			if diff := cmp.Diff(tt.want.kinds, kinds); diff != "" {
+				t.Errorf("Unpack() kinds -want, +got:\n%s", diff)
+			}
+			if len(tt.want.annotations) == 0 {
+				tt.want.annotations = map[string]string{}
+			}
+			if diff := cmp.Diff(tt.want.annotations, annotations); diff != "" {
+				t.Errorf("Unpack() annotations -want, +got:\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+
+	"github.com/crossplane/crossplane/apis/stacks/v1alpha1"
+	"github.com/crossplane/crossplane/pkg/stacks/walker"
+)
+
+// Localised metadata files have the same format as the files they localise,
+// with a locale suffix before the file extension, e.g. app.de.yaml or
+// mytype.resource.pt-BR.yaml. Only the human readable fields of localised
+// files are used. A localised resource.yaml without an id or crd applies to
+// the same CRD as the unlocalised resource.yaml it sits beside.
+//
+// Localised metadata is emitted as annotations suffixed with the locale, e.g.
+// stacks.crossplane.io/resource-title.de. The UI may fall back to the
+// unlocalised annotation when no annotation exists for the viewer's locale.
+const (
+	appLocaleFileNamePattern      = "app.*.yaml"
+	groupLocaleFileNamePattern    = "group.*.yaml"
+	resourceLocaleFileNamePattern = "*resource.*.yaml"
+
+	annotationStackOverview      = "stacks.crossplane.io/stack-overview"
+	annotationStackOverviewShort = "stacks.crossplane.io/stack-overview-short"
+	annotationStackReadme        = "stacks.crossplane.io/stack-readme"
+)
+
+// localePattern matches BCP 47 style language tags, e.g. de, pt-BR, or
+// zh-Hant-TW. The tag is used as part of annotation keys, so it must consist
+// only of alphanumerics and dashes.
+var localePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8}){0,3}$`)
+
+// fileLocale returns the locale of the supplied localised metadata file, and
+// the path of the file it localises, e.g. /a/resource.de.yaml returns de and
+// /a/resource.yaml.
+func fileLocale(path string) (string, string, error) {
+	ext := filepath.Ext(path)
+	trimmed := strings.TrimSuffix(path, ext)
+	locale := strings.TrimPrefix(filepath.Ext(trimmed), ".")
+	if !localePattern.MatchString(locale) {
+		return "", "", errors.Errorf("invalid locale %q in file name %q", locale, filepath.Base(path))
+	}
+	return locale, strings.TrimSuffix(trimmed, "."+locale) + ext, nil
+}
+
+// localisedPath returns the path of the supplied metadata file localised to
+// the supplied locale, e.g. /a/resource.yaml and de returns /a/resource.de.yaml.
+func localisedPath(path, locale string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + locale + ext
+}
+
+// localeAnnotation returns the annotation key of the supplied locale.
+func localeAnnotation(key, locale string) string {
+	return key + "." + locale
+}
+
+// appLocaleStep unmarshals app.<locale>.yaml bytes to AppMetadataSpec, which
+// is added to the StackPackager.
+func appLocaleStep(sp StackPackager) walker.Step {
+	return func(path string, b []byte) error {
+		locale, _, err := fileLocale(path)
+		if err != nil {
+			return err
+		}
+		app := v1alpha1.PackageMetadataSpec{}
+		if err := yaml.Unmarshal(b, &app); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("invalid app %q", path))
+		}
+
+		sp.AddAppLocale(locale, app.AppMetadataSpec)
+		return nil
+	}
+}
+
+// groupLocaleStep unmarshals group.<locale>.yaml bytes to a StackGroup, which
+// is added to the StackPackager.
+func groupLocaleStep(sp StackPackager) walker.Step {
+	return func(path string, b []byte) error {
+		locale, _, err := fileLocale(path)
+		if err != nil {
+			return err
+		}
+		sg := StackGroup{}
+		if err := yaml.Unmarshal(b, &sg); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("invalid group %q", path))
+		}
+
+		sp.AddGroupLocale(locale, filepath.Dir(path), sg)
+		return nil
+	}
+}
+
+// resourceLocaleStep unmarshals resource.<locale>.yaml bytes to a
+// StackResource, which is added to the StackPackager by the path of the file
+// it localises.
+func resourceLocaleStep(sp StackPackager) walker.Step {
+	return func(path string, b []byte) error {
+		locale, localises, err := fileLocale(path)
+		if err != nil {
+			return err
+		}
+		sr := StackResource{}
+		if err := yaml.Unmarshal(b, &sr); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("invalid resource %q", path))
+		}
+
+		sp.AddResourceLocale(locale, localises, sr)
+		return nil
+	}
+}
+
+// AddAppLocale adds localised app metadata to the StackPackage
+func (sp *StackPackage) AddAppLocale(locale string, app v1alpha1.AppMetadataSpec) {
+	sp.AppLocales[locale] = app
+}
+
+// AddGroupLocale adds a localised group to the StackPackage
+func (sp *StackPackage) AddGroupLocale(locale, path string, sg StackGroup) {
+	if sp.GroupLocales[locale] == nil {
+		sp.GroupLocales[locale] = map[string]StackGroup{}
+	}
+	sp.GroupLocales[locale][path] = sg
+}
+
+// AddResourceLocale adds a localised resource to the StackPackage. The path
+// is that of the resource.yaml file the resource localises.
+func (sp *StackPackage) AddResourceLocale(locale, path string, sr StackResource) {
+	if sp.ResourceLocales[locale] == nil {
+		sp.ResourceLocales[locale] = map[string]StackResource{}
+	}
+	sp.ResourceLocales[locale][path] = sr
+}
+
+// locales returns the locales of all localised metadata, in ascending order.
+func (sp *StackPackage) locales() []string {
+	set := map[string]bool{}
+	for l := range sp.AppLocales {
+		set[l] = true
+	}
+	for l := range sp.GroupLocales {
+		set[l] = true
+	}
+	for l := range sp.ResourceLocales {
+		set[l] = true
+	}
+	ret := make([]string, 0, len(set))
+	for l := range set {
+		ret = append(ret, l)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// applyStackLocaleAnnotations annotates the Stack and StackDefinition with
+// the localised app metadata of each locale.
+func (sp *StackPackage) applyStackLocaleAnnotations() {
+	for locale, app := range sp.AppLocales {
+		a := map[string]string{}
+		addLocaleAnnotation(a, annotationStackTitle, locale, app.Title)
+		addLocaleAnnotation(a, annotationStackOverviewShort, locale, app.OverviewShort)
+		addLocaleAnnotation(a, annotationStackOverview, locale, app.Overview)
+		addLocaleAnnotation(a, annotationStackReadme, locale, app.Readme)
+		sp.AddAnnotations(a)
+	}
+}
+
+// applyLocaleAnnotations annotates the supplied CRD with the localised stack
+// title, and the localised group and resource metadata of each locale that
+// applies to it.
+func (sp *StackPackage) applyLocaleAnnotations(crdPath string, crd *apiextensions.CustomResourceDefinition) {
+	a := crd.ObjectMeta.Annotations
+	for _, locale := range sp.locales() {
+		addLocaleAnnotation(a, annotationStackTitle, locale, sp.AppLocales[locale].Title)
+
+		if group, ok := nearestGroup(sp.GroupLocales[locale], crdPath); ok {
+			addLocaleAnnotation(a, annotationGroupTitle, locale, group.Title)
+			addLocaleAnnotation(a, annotationGroupReadme, locale, group.Readme)
+			addLocaleAnnotation(a, annotationGroupOverview, locale, group.Overview)
+			addLocaleAnnotation(a, annotationGroupOverviewShort, locale, group.OverviewShort)
+		}
+
+		resources := sp.localisedResources(locale)
+		if paths, _ := resourceCandidates(resources, crdPath, crd); len(paths) > 0 {
+			resource := resources[paths[0]]
+			addLocaleAnnotation(a, annotationResourceTitle, locale, resource.Title)
+			addLocaleAnnotation(a, annotationResourceTitlePlural, locale, resource.TitlePlural)
+			addLocaleAnnotation(a, annotationResourceReadme, locale, resource.Readme)
+			addLocaleAnnotation(a, annotationResourceOverview, locale, resource.Overview)
+			addLocaleAnnotation(a, annotationResourceOverviewShort, locale, resource.OverviewShort)
+		}
+	}
+}
+
+// localisedResources returns the localised resources of the supplied locale.
+// Localised resources that neither reference a CRD nor specify an id apply to
+// the same CRD as the resource they localise.
+func (sp *StackPackage) localisedResources(locale string) map[string]StackResource {
+	resources := map[string]StackResource{}
+	for p, r := range sp.ResourceLocales[locale] {
+		if r.ID == "" && r.CRD == "" {
+			r.ID, r.CRD = sp.Resources[p].ID, sp.Resources[p].CRD
+		}
+		resources[p] = r
+	}
+	return resources
+}
+
+// addLocaleAnnotation adds the localised annotation of the supplied locale to
+// a, unless the value is empty.
+func addLocaleAnnotation(a map[string]string, key, locale, value string) {
+	if value == "" {
+		return
+	}
+	a[localeAnnotation(key, locale)] = value
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/crossplane/crossplane/pkg/stacks/walker"
+)
+
+func TestFileLocale(t *testing.T) {
+	type want struct {
+		locale    string
+		localises string
+		err       error
+	}
+
+	cases := map[string]struct {
+		path string
+		want want
+	}{
+		"Language": {
+			path: "/a/app.de.yaml",
+			want: want{locale: "de", localises: "/a/app.yaml"},
+		},
+		"LanguageAndRegion": {
+			path: "/a/mytype.resource.pt-BR.yaml",
+			want: want{locale: "pt-BR", localises: "/a/mytype.resource.yaml"},
+		},
+		"LanguageScriptAndRegion": {
+			path: "/a/group.zh-Hant-TW.yaml",
+			want: want{locale: "zh-Hant-TW", localises: "/a/group.yaml"},
+		},
+		"InvalidLocale": {
+			path: "/a/app.d_e.yaml",
+			want: want{err: errors.New(`invalid locale "d_e" in file name "app.d_e.yaml"`)},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			locale, localises, err := fileLocale(tc.path)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("fileLocale(...): -want error, +got error:\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want.locale, locale); diff != "" {
+				t.Errorf("fileLocale(...): -want locale, +got locale:\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want.localises, localises); diff != "" {
+				t.Errorf("fileLocale(...): -want path, +got path:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUnpackLocales(t *testing.T) {
+	fs, _ := buildStackFs()
+	files := map[string]string{
+		"ext-dir/app.de.yaml":                              "title: Beispiel\noverviewShort: Kurz\n",
+		"ext-dir/resources/group.de.yaml":                  "title: Gruppe\n",
+		filepath.Join(simpleCrdDir, "resource.de.yaml"):    "title: Meintyp\ntitlePlural: Meintypen\n",
+		filepath.Join(simpleCrdDir, "resource.ja.yaml"):    "title: マイタイプ\n",
+		filepath.Join(simpleCrdDir, "resource.fr-CA.yaml"): "id: other\ntitle: Autre\n",
+	}
+	for name, body := range files {
+		_ = afero.WriteFile(fs, name, []byte(body), 0600)
+	}
+
+	out := &bytes.Buffer{}
+	rd := &walker.ResourceDir{Base: "ext-dir", Walker: afero.Afero{Fs: fs}}
+	if err := Unpack(rd, out, "ext-dir", "Namespaced", "", logging.NewNopLogger()); err != nil {
+		t.Fatalf("Unpack(...): %s", err)
+	}
+
+	for _, want := range []string{
+		"stacks.crossplane.io/stack-title.de: Beispiel",
+		"stacks.crossplane.io/stack-overview-short.de: Kurz",
+		"stacks.crossplane.io/group-title.de: Gruppe",
+		"stacks.crossplane.io/resource-title.de: Meintyp",
+		"stacks.crossplane.io/resource-title-plural.de: Meintypen",
+		"stacks.crossplane.io/resource-title.ja: マイタイプ",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Unpack(...): output does not contain %q", want)
+		}
+	}
+	for _, unwanted := range []string{
+		"stacks.crossplane.io/stack-overview.de",
+		"stacks.crossplane.io/resource-title.fr-CA",
+	} {
+		if strings.Contains(out.String(), unwanted) {
+			t.Errorf("Unpack(...): output unexpectedly contains %q", unwanted)
+		}
+	}
+
+	report, err := Validate(&walker.ResourceDir{Base: "ext-dir", Walker: afero.Afero{Fs: fs}}, "ext-dir", "Namespaced", logging.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Validate(...): %s", err)
+	}
+	wantProblem := filepath.Join(simpleCrdDir, "resource.fr-CA.yaml")
+	found := false
+	for _, p := range report.Problems {
+		if p.Path == wantProblem {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Validate(...): want problem for unused %q, got %+v", wantProblem, report.Problems)
+	}
+}
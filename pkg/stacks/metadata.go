@@ -0,0 +1,269 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+)
+
+// Metadata files (resource.yaml, icons, and ui-schema.yaml) are associated
+// with the CRDs of a stack by the following rules:
+//
+// * A resource.yaml or ui-schema.yaml that sets crd to the name of a CRD,
+//   e.g. mytypes.samples.upbound.io, applies to that CRD only, wherever the
+//   files are in the package.
+// * Otherwise a metadata file applies to CRDs in the directory it is in, or
+//   beneath that directory. Directories are compared by whole path segments,
+//   so /foo/icon.svg does not apply to /foobar/mytype.crd.yaml.
+// * A resource.yaml without a crd reference applies to CRDs whose kind matches
+//   its id. Icon and ui-schema files apply to all CRDs if they use a global
+//   name (e.g. icon.svg), or to CRDs whose kind matches the first segment of
+//   their name (e.g. mytype.icon.svg).
+// * The nearest resource.yaml and icon are used. All applicable ui-schema
+//   files are used.
+
+// A metadataIssue describes a metadata file that does not apply to any CRD,
+// or that applies to a CRD as ambiguously as another metadata file.
+type metadataIssue struct {
+	Path    string
+	Message string
+
+	// Unused is true if the metadata file does not apply to any CRD.
+	Unused bool
+}
+
+// metadataRef is the subset of a metadata file that may reference a CRD.
+type metadataRef struct {
+	CRD string `json:"crd,omitempty"`
+}
+
+// uiSchemaCRD returns the name of the CRD the supplied ui-schema references,
+// if any. Only the first YAML document of the ui-schema is considered.
+func uiSchemaCRD(schema string) string {
+	ref := metadataRef{}
+	if err := yaml.Unmarshal([]byte(schema), &ref); err != nil {
+		return ""
+	}
+	return ref.CRD
+}
+
+// inDir reports whether path is dir or is beneath it, comparing whole path
+// segments.
+func inDir(path, dir string) bool {
+	path, dir = filepath.Clean(path), filepath.Clean(dir)
+	switch {
+	case dir == ".":
+		return !filepath.IsAbs(path)
+	case path == dir:
+		return true
+	case strings.HasSuffix(dir, string(filepath.Separator)):
+		// dir is the root directory.
+		return strings.HasPrefix(path, dir)
+	default:
+		return strings.HasPrefix(path, dir+string(filepath.Separator))
+	}
+}
+
+// pathDepth returns the number of segments in the supplied path.
+func pathDepth(path string) int {
+	return len(strings.Split(filepath.ToSlash(filepath.Clean(path)), "/"))
+}
+
+// orderMetadataPaths returns the supplied metadata file paths deepest first,
+// so that the metadata nearest a CRD is preferred. Paths of equal depth are
+// returned in descending order.
+func orderMetadataPaths(paths []string) []string {
+	sort.Slice(paths, func(i, j int) bool {
+		di, dj := pathDepth(paths[i]), pathDepth(paths[j])
+		if di != dj {
+			return di > dj
+		}
+		return paths[i] > paths[j]
+	})
+	return paths
+}
+
+// resourceCandidates returns the paths of the supplied resource.yaml files
+// that apply to the supplied CRD, best match first. The rank of each candidate
+// is also returned; two candidates of equal rank are an ambiguous match.
+func resourceCandidates(resources map[string]StackResource, crdPath string, crd *apiextensions.CustomResourceDefinition) ([]string, []int) {
+	paths := make([]string, 0, len(resources))
+	for p := range resources {
+		paths = append(paths, p)
+	}
+
+	explicit, implicit := []string{}, []string{}
+	for _, p := range orderMetadataPaths(paths) {
+		r := resources[p]
+		switch {
+		case r.CRD != "":
+			if r.CRD == crd.GetName() {
+				explicit = append(explicit, p)
+			}
+		case inDir(crdPath, filepath.Dir(p)) && strings.EqualFold(r.ID, crd.Spec.Names.Kind):
+			implicit = append(implicit, p)
+		}
+	}
+
+	// Explicit references outrank all implicit matches, which are ranked by
+	// the depth of their directory.
+	ranks := make([]int, 0, len(explicit)+len(implicit))
+	for range explicit {
+		ranks = append(ranks, 0)
+	}
+	for _, p := range implicit {
+		ranks = append(ranks, -pathDepth(p))
+	}
+	return append(explicit, implicit...), ranks
+}
+
+// nearestGroup returns the nearest of the supplied groups whose directory
+// contains the supplied CRD path, if any.
+func nearestGroup(groups map[string]StackGroup, crdPath string) (StackGroup, bool) {
+	paths := make([]string, 0, len(groups))
+	for p := range groups {
+		paths = append(paths, p)
+	}
+	for _, p := range orderMetadataPaths(paths) {
+		if inDir(crdPath, p) {
+			return groups[p], true
+		}
+	}
+	return StackGroup{}, false
+}
+
+// iconCandidates returns the paths of the icons that apply to the supplied
+// CRD, nearest first.
+func (sp *StackPackage) iconCandidates(crdPath string, crd *apiextensions.CustomResourceDefinition) []string {
+	paths := []string{}
+	for p := range sp.Icons {
+		if isMetadataApplicableToCRD(crdPath, p, iconFileGlobalNames, crd.Spec.Names.Kind) {
+			paths = append(paths, p)
+		}
+	}
+	return orderMetadataPaths(paths)
+}
+
+// uiSchemaCandidates returns the paths of the ui-schema files that apply to
+// the supplied CRD, in the order they should be concatenated.
+func (sp *StackPackage) uiSchemaCandidates(crdPath string, crd *apiextensions.CustomResourceDefinition) []string {
+	paths := []string{}
+	for _, p := range orderStringKeys(sp.UISchemas) {
+		if ref := uiSchemaCRD(sp.UISchemas[p]); ref != "" {
+			if ref == crd.GetName() {
+				paths = append(paths, p)
+			}
+			continue
+		}
+		if isMetadataApplicableToCRD(crdPath, p, uiSchemaFileGlobalNames, crd.Spec.Names.Kind) {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// metadataIssues returns an issue for each metadata file that applies to no
+// CRD, and for each resource.yaml that applies to a CRD as well as another.
+// Global icons at the base of the package describe the stack itself, and so
+// are never unused.
+func (sp *StackPackage) metadataIssues() []metadataIssue {
+	usedResources := map[string]bool{}
+	usedIcons := map[string]bool{}
+	usedUISchemas := map[string]bool{}
+	usedLocales := map[string]map[string]bool{}
+	for _, locale := range sp.locales() {
+		usedLocales[locale] = map[string]bool{}
+	}
+	ambiguous := []metadataIssue{}
+
+	for _, gk := range orderStackCRDKeys(sp.CRDs) {
+		crd := sp.CRDs[gk]
+		crdPath := sp.CRDPaths[gk]
+
+		resources, ranks := resourceCandidates(sp.Resources, crdPath, &crd)
+		for i, p := range resources {
+			usedResources[p] = true
+			if i > 0 && ranks[i] == ranks[0] {
+				ambiguous = append(ambiguous, metadataIssue{
+					Path:    p,
+					Message: fmt.Sprintf("resource applies to CRD %q, but %q is used instead", crd.GetName(), resources[0]),
+				})
+			}
+		}
+		for _, p := range sp.iconCandidates(crdPath, &crd) {
+			usedIcons[p] = true
+		}
+		for _, p := range sp.uiSchemaCandidates(crdPath, &crd) {
+			usedUISchemas[p] = true
+		}
+		for locale, used := range usedLocales {
+			localised, _ := resourceCandidates(sp.localisedResources(locale), crdPath, &crd)
+			for _, p := range localised {
+				used[p] = true
+			}
+		}
+	}
+
+	issues := []metadataIssue{}
+	for _, p := range orderStackResourceKeys(sp.Resources) {
+		if usedResources[p] {
+			continue
+		}
+		msg := fmt.Sprintf("resource id %q matches no CRD kind", sp.Resources[p].ID)
+		if ref := sp.Resources[p].CRD; ref != "" {
+			msg = fmt.Sprintf("resource crd %q matches no CRD", ref)
+		}
+		issues = append(issues, metadataIssue{Path: p, Message: msg, Unused: true})
+	}
+	for _, p := range orderStackIconKeys(sp.Icons) {
+		if usedIcons[p] || (filepath.Dir(p) == sp.baseDir && isGlobalFileName(p, iconFileGlobalNames)) {
+			continue
+		}
+		issues = append(issues, metadataIssue{Path: p, Message: "icon does not apply to any CRD", Unused: true})
+	}
+	for _, p := range orderStringKeys(sp.UISchemas) {
+		if usedUISchemas[p] {
+			continue
+		}
+		msg := "ui-schema does not apply to any CRD"
+		if ref := uiSchemaCRD(sp.UISchemas[p]); ref != "" {
+			msg = fmt.Sprintf("ui-schema crd %q matches no CRD", ref)
+		}
+		issues = append(issues, metadataIssue{Path: p, Message: msg, Unused: true})
+	}
+
+	for _, locale := range sp.locales() {
+		for _, p := range orderStackResourceKeys(sp.ResourceLocales[locale]) {
+			if usedLocales[locale][p] {
+				continue
+			}
+			issues = append(issues, metadataIssue{
+				Path:    localisedPath(p, locale),
+				Message: fmt.Sprintf("%s resource does not apply to any CRD", locale),
+				Unused:  true,
+			})
+		}
+	}
+
+	return append(issues, ambiguous...)
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+)
+
+func TestInDir(t *testing.T) {
+	cases := map[string]struct {
+		path string
+		dir  string
+		want bool
+	}{
+		"Same":          {path: "/foo", dir: "/foo", want: true},
+		"Beneath":       {path: "/foo/bar/crd.yaml", dir: "/foo", want: true},
+		"SharedPrefix":  {path: "/foobar/crd.yaml", dir: "/foo", want: false},
+		"Root":          {path: "/foo/crd.yaml", dir: "/", want: true},
+		"Relative":      {path: "ext-dir/foo/crd.yaml", dir: "ext-dir", want: true},
+		"RelativeRoot":  {path: "ext-dir/crd.yaml", dir: ".", want: true},
+		"Above":         {path: "/foo", dir: "/foo/bar", want: false},
+		"TrailingSlash": {path: "/foo/bar", dir: "/foo/", want: true},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := inDir(tc.path, tc.dir); got != tc.want {
+				t.Errorf("inDir(%q, %q): want %t, got %t", tc.path, tc.dir, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestMetadataAssociation(t *testing.T) {
+	newCRD := func(name, kind string) *apiextensions.CustomResourceDefinition {
+		crd := &apiextensions.CustomResourceDefinition{}
+		crd.SetName(name)
+		crd.Spec.Group = strings.SplitN(name, ".", 2)[1]
+		crd.Spec.Names.Kind = kind
+		return crd
+	}
+
+	type crdFile struct {
+		path string
+		crd  *apiextensions.CustomResourceDefinition
+	}
+
+	type want struct {
+		titles map[string]string
+		ui     map[string]string
+		issues []metadataIssue
+	}
+
+	cases := map[string]struct {
+		crds      []crdFile
+		resources map[string]StackResource
+		ui        map[string]string
+		want      want
+	}{
+		"PrefixSharingDirectories": {
+			crds: []crdFile{
+				{path: "/foo/mytype.crd.yaml", crd: newCRD("mytypes.samples.upbound.io", "Mytype")},
+				{path: "/foobar/mytype.crd.yaml", crd: newCRD("mytypes.other.upbound.io", "Mytype")},
+			},
+			resources: map[string]StackResource{
+				"/foo/resource.yaml":    {ID: "mytype", Title: "Foo"},
+				"/foobar/resource.yaml": {ID: "mytype", Title: "Foobar"},
+			},
+			ui: map[string]string{
+				"/foo/ui-schema.yaml": "foo: ui",
+			},
+			want: want{
+				titles: map[string]string{"mytypes.samples.upbound.io": "Foo", "mytypes.other.upbound.io": "Foobar"},
+				ui:     map[string]string{"mytypes.samples.upbound.io": "foo: ui", "mytypes.other.upbound.io": ""},
+				issues: []metadataIssue{},
+			},
+		},
+		"NearestResourceWins": {
+			crds: []crdFile{
+				{path: "/a/b/mytype.crd.yaml", crd: newCRD("mytypes.samples.upbound.io", "Mytype")},
+			},
+			resources: map[string]StackResource{
+				"/a/resource.yaml":   {ID: "mytype", Title: "Far"},
+				"/a/b/resource.yaml": {ID: "mytype", Title: "Near"},
+			},
+			want: want{
+				titles: map[string]string{"mytypes.samples.upbound.io": "Near"},
+				ui:     map[string]string{"mytypes.samples.upbound.io": ""},
+				issues: []metadataIssue{},
+			},
+		},
+		"ExplicitReference": {
+			crds: []crdFile{
+				{path: "/crds/mytype.crd.yaml", crd: newCRD("mytypes.samples.upbound.io", "Mytype")},
+				{path: "/crds/other.crd.yaml", crd: newCRD("others.samples.upbound.io", "Other")},
+			},
+			resources: map[string]StackResource{
+				"/crds/resource.yaml":        {ID: "mytype", Title: "Implicit"},
+				"/docs/mytype.resource.yaml": {CRD: "mytypes.samples.upbound.io", Title: "Explicit"},
+			},
+			ui: map[string]string{
+				"/crds/ui-schema.yaml":        "crd: others.samples.upbound.io\nother: ui",
+				"/docs/mytype.ui-schema.yaml": "crd: mytypes.samples.upbound.io\nmytype: ui",
+			},
+			want: want{
+				titles: map[string]string{"mytypes.samples.upbound.io": "Explicit", "others.samples.upbound.io": ""},
+				ui: map[string]string{
+					"mytypes.samples.upbound.io": "crd: mytypes.samples.upbound.io\nmytype: ui",
+					"others.samples.upbound.io":  "crd: others.samples.upbound.io\nother: ui",
+				},
+				issues: []metadataIssue{},
+			},
+		},
+		"AmbiguousAndUnused": {
+			crds: []crdFile{
+				{path: "/crds/mytype.crd.yaml", crd: newCRD("mytypes.samples.upbound.io", "Mytype")},
+			},
+			resources: map[string]StackResource{
+				"/crds/resource.yaml":         {ID: "mytype", Title: "Generic"},
+				"/crds/mytype.resource.yaml":  {ID: "mytype", Title: "Specific"},
+				"/crds/other.resource.yaml":   {ID: "other"},
+				"/docs/missing.resource.yaml": {CRD: "missing.samples.upbound.io"},
+			},
+			ui: map[string]string{
+				"/crds/other.ui-schema.yaml": "other: ui",
+				"/docs/ui-schema.yaml":       "crd: missing.samples.upbound.io",
+			},
+			want: want{
+				titles: map[string]string{"mytypes.samples.upbound.io": "Generic"},
+				ui:     map[string]string{"mytypes.samples.upbound.io": ""},
+				issues: []metadataIssue{
+					{Path: "/docs/missing.resource.yaml", Message: `resource crd "missing.samples.upbound.io" matches no CRD`, Unused: true},
+					{Path: "/crds/other.resource.yaml", Message: `resource id "other" matches no CRD kind`, Unused: true},
+					{Path: "/docs/ui-schema.yaml", Message: `ui-schema crd "missing.samples.upbound.io" matches no CRD`, Unused: true},
+					{Path: "/crds/other.ui-schema.yaml", Message: "ui-schema does not apply to any CRD", Unused: true},
+					{Path: "/crds/mytype.resource.yaml", Message: `resource applies to CRD "mytypes.samples.upbound.io", but "/crds/resource.yaml" is used instead`},
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			sp := NewStackPackage("/", "", logging.NewNopLogger())
+			for _, c := range tc.crds {
+				if err := sp.AddCRD(c.path, c.crd); err != nil {
+					t.Fatalf("AddCRD(...): %s", err)
+				}
+			}
+			for p, r := range tc.resources {
+				sp.AddResource(p, r)
+			}
+			for p, ui := range tc.ui {
+				sp.AddUI(p, ui)
+			}
+
+			if diff := cmp.Diff(tc.want.issues, sp.metadataIssues()); diff != "" {
+				t.Errorf("metadataIssues(): -want, +got:\n%s", diff)
+			}
+
+			sp.applyAnnotations()
+			titles := map[string]string{}
+			ui := map[string]string{}
+			for _, crd := range sp.CRDs {
+				titles[crd.GetName()] = crd.GetAnnotations()[annotationResourceTitle]
+				ui[crd.GetName()] = crd.GetAnnotations()[annotationStackUISchema]
+			}
+			if diff := cmp.Diff(tc.want.titles, titles); diff != "" {
+				t.Errorf("applyAnnotations(): -want resource titles, +got:\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want.ui, ui); diff != "" {
+				t.Errorf("applyAnnotations(): -want ui-schemas, +got:\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// Output formats supported by Unpack.
+const (
+	// OutputFormatYAML emits a stream of YAML documents.
+	OutputFormatYAML = "yaml"
+
+	// OutputFormatJSONLines emits one JSON object per line.
+	OutputFormatJSONLines = "jsonl"
+
+	// OutputFormatList emits a single Kubernetes List containing every
+	// object.
+	OutputFormatList = "list"
+
+	// OutputVersion is the version of the Unpack output. It must be changed
+	// whenever the output changes in a way that consumers must know about.
+	OutputVersion = "v1"
+
+	// outputHeaderPrefix starts the first line of all Unpack output. The
+	// remainder of the line is the format and version, e.g. "yaml/v1".
+	outputHeaderPrefix = "# stacks.crossplane.io/unpack-output: "
+)
+
+// OutputFormats are the output formats supported by Unpack.
+var OutputFormats = []string{OutputFormatYAML, OutputFormatJSONLines, OutputFormatList}
+
+// outputHeader returns the header line written before output of the supplied
+// format.
+func outputHeader(format string) string {
+	return outputHeaderPrefix + format + "/" + OutputVersion + "\n"
+}
+
+// An ObjectWriter writes the objects emitted by Unpack in a particular format.
+type ObjectWriter interface {
+	// Write an object.
+	Write(o runtime.Object) error
+
+	// Close writes any buffered objects. It does not close the underlying
+	// io.Writer.
+	Close() error
+}
+
+// NewObjectWriter returns an ObjectWriter that writes objects to w in the
+// supplied format, preceded by a header identifying the format and version.
+func NewObjectWriter(w io.Writer, format string) (ObjectWriter, error) {
+	var ow ObjectWriter
+	switch format {
+	case OutputFormatYAML:
+		ow = &yamlObjectWriter{w: w}
+	case OutputFormatJSONLines:
+		ow = &jsonLinesObjectWriter{e: json.NewEncoder(w)}
+	case OutputFormatList:
+		ow = &listObjectWriter{w: w}
+	default:
+		return nil, errors.Errorf("unknown output format %q", format)
+	}
+
+	if _, err := io.WriteString(w, outputHeader(format)); err != nil {
+		return nil, errors.Wrap(err, "could not write output header")
+	}
+
+	// The YAML stream historically starts with a document separator.
+	if format == OutputFormatYAML {
+		if _, err := io.WriteString(w, yamlSeparator); err != nil {
+			return nil, errors.Wrap(err, "could not write YAML output")
+		}
+	}
+
+	return ow, nil
+}
+
+type yamlObjectWriter struct {
+	w io.Writer
+}
+
+func (y *yamlObjectWriter) Write(o runtime.Object) error {
+	return writeYaml(y.w, o, o.GetObjectKind().GroupVersionKind().Kind)
+}
+
+func (y *yamlObjectWriter) Close() error { return nil }
+
+type jsonLinesObjectWriter struct {
+	e *json.Encoder
+}
+
+func (j *jsonLinesObjectWriter) Write(o runtime.Object) error {
+	return errors.Wrapf(j.e.Encode(o), "could not write %s as JSON", o.GetObjectKind().GroupVersionKind().Kind)
+}
+
+func (j *jsonLinesObjectWriter) Close() error { return nil }
+
+// listStart starts the output of a listObjectWriter. Items follow, and the
+// List is ended by listEnd.
+const (
+	listStart = `{"apiVersion":"v1","kind":"List","items":[`
+	listEnd   = "]}\n"
+)
+
+// A listObjectWriter writes each object as an item of a Kubernetes List as soon
+// as it is written, so that the List is never held in memory in its entirety.
+type listObjectWriter struct {
+	w     io.Writer
+	items int
+}
+
+func (l *listObjectWriter) Write(o runtime.Object) error {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return errors.Wrapf(err, "could not marshal %s", o.GetObjectKind().GroupVersionKind().Kind)
+	}
+	sep := ","
+	if l.items == 0 {
+		sep = listStart
+	}
+	l.items++
+	if _, err := io.WriteString(l.w, sep); err != nil {
+		return errors.Wrap(err, "could not write List output")
+	}
+	_, err = l.w.Write(b)
+	return errors.Wrap(err, "could not write List output")
+}
+
+func (l *listObjectWriter) Close() error {
+	end := listEnd
+	if l.items == 0 {
+		end = listStart + listEnd
+	}
+	_, err := io.WriteString(l.w, end)
+	return errors.Wrap(err, "could not write List output")
+}
+
+// An ObjectReader reads the objects emitted by Unpack.
+type ObjectReader interface {
+	// Read the next object. Returns io.EOF when no objects remain.
+	Read() (*unstructured.Unstructured, error)
+}
+
+// NewObjectReader returns an ObjectReader for the Unpack output read from r.
+// The format of the output is determined by its header. Output without a
+// header is assumed to be a YAML stream written by an older version of
+// Unpack. An error is returned if the output was written in an unknown format
+// or version.
+func NewObjectReader(r io.Reader) (ObjectReader, error) {
+	br := bufio.NewReader(r)
+	line, err := br.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "could not read output header")
+	}
+
+	if !strings.HasPrefix(line, outputHeaderPrefix) {
+		// Legacy output; put back what we read.
+		return &decoderObjectReader{d: yaml.NewYAMLOrJSONDecoder(io.MultiReader(strings.NewReader(line), br), 4096)}, nil
+	}
+
+	fv := strings.TrimSpace(strings.TrimPrefix(line, outputHeaderPrefix))
+	parts := strings.SplitN(fv, "/", 2)
+	if len(parts) != 2 || parts[1] != OutputVersion {
+		return nil, errors.Errorf("unsupported output version %q, expected format/%s", fv, OutputVersion)
+	}
+
+	switch parts[0] {
+	case OutputFormatYAML, OutputFormatJSONLines:
+		return &decoderObjectReader{d: yaml.NewYAMLOrJSONDecoder(br, 4096)}, nil
+	case OutputFormatList:
+		d := json.NewDecoder(br)
+		if err := expectDelim(d, '{'); err != nil {
+			return nil, errors.Wrap(err, "could not decode List output")
+		}
+		return &listObjectReader{d: d}, nil
+	}
+
+	return nil, errors.Errorf("unsupported output format %q", parts[0])
+}
+
+type decoderObjectReader struct {
+	d *yaml.YAMLOrJSONDecoder
+}
+
+func (r *decoderObjectReader) Read() (*unstructured.Unstructured, error) {
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := r.d.Decode(&obj); err != nil {
+			return nil, err
+		}
+		// Empty YAML documents decode to nil objects.
+		if obj != nil {
+			return obj, nil
+		}
+	}
+}
+
+// A listObjectReader decodes the items of a Kubernetes List one at a time, so
+// that the List is never held in memory in its entirety.
+type listObjectReader struct {
+	d       *json.Decoder
+	inItems bool
+	done    bool
+}
+
+func (r *listObjectReader) Read() (*unstructured.Unstructured, error) {
+	obj, err := r.read()
+	if err == io.EOF && !r.done {
+		// The List was truncated.
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "could not decode List output")
+	}
+	return obj, err
+}
+
+func (r *listObjectReader) read() (*unstructured.Unstructured, error) {
+	for !r.done {
+		if r.inItems {
+			if r.d.More() {
+				raw := json.RawMessage{}
+				if err := r.d.Decode(&raw); err != nil {
+					return nil, err
+				}
+				obj := &unstructured.Unstructured{}
+				return obj, obj.UnmarshalJSON(raw)
+			}
+			if err := expectDelim(r.d, ']'); err != nil {
+				return nil, err
+			}
+			r.inItems = false
+			continue
+		}
+
+		if !r.d.More() {
+			if err := expectDelim(r.d, '}'); err != nil {
+				return nil, err
+			}
+			r.done = true
+			continue
+		}
+		key, err := r.d.Token()
+		if err != nil {
+			return nil, err
+		}
+		if key == "items" {
+			if err := expectDelim(r.d, '['); err != nil {
+				return nil, err
+			}
+			r.inItems = true
+			continue
+		}
+		// Fields of the List other than its items are ignored.
+		if err := r.d.Decode(&json.RawMessage{}); err != nil {
+			return nil, err
+		}
+	}
+	return nil, io.EOF
+}
+
+// expectDelim consumes the next JSON token, which must be the supplied
+// delimiter.
+func expectDelim(d *json.Decoder, delim json.Delim) error {
+	t, err := d.Token()
+	if err != nil {
+		return err
+	}
+	if t != delim {
+		return errors.Errorf("expected %q, found %v", delim, t)
+	}
+	return nil
+}
+
+// WriteObjects writes every object to the ObjectWriter and closes it.
+func WriteObjects(w ObjectWriter, objs ...runtime.Object) error {
+	for _, o := range objs {
+		if err := w.Write(o); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/crossplane/crossplane/apis/stacks/v1alpha1"
+)
+
+func outputObjects() []runtime.Object {
+	return []runtime.Object{
+		&apiextensions.CustomResourceDefinition{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apiextensions.k8s.io/v1beta1", Kind: "CustomResourceDefinition"},
+			ObjectMeta: metav1.ObjectMeta{Name: "mytypes.samples.upbound.io"},
+			Spec:       apiextensions.CustomResourceDefinitionSpec{Group: "samples.upbound.io"},
+		},
+		&v1alpha1.Stack{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "stacks.crossplane.io/v1alpha1", Kind: "Stack"},
+			ObjectMeta: metav1.ObjectMeta{Name: "sample"},
+			Spec:       v1alpha1.StackSpec{AppMetadataSpec: v1alpha1.AppMetadataSpec{Title: "Sample"}},
+		},
+	}
+}
+
+func readObjects(r ObjectReader) ([]*unstructured.Unstructured, error) {
+	objs := []*unstructured.Unstructured{}
+	for {
+		o, err := r.Read()
+		if err == io.EOF {
+			return objs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, o)
+	}
+}
+
+func TestObjectWriterReader(t *testing.T) {
+	want := []*unstructured.Unstructured{}
+	for _, o := range outputObjects() {
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(o)
+		if err != nil {
+			t.Fatalf("ToUnstructured(): %s", err)
+		}
+		want = append(want, &unstructured.Unstructured{Object: u})
+	}
+
+	for _, format := range OutputFormats {
+		t.Run(format, func(t *testing.T) {
+			b := &bytes.Buffer{}
+			w, err := NewObjectWriter(b, format)
+			if err != nil {
+				t.Fatalf("NewObjectWriter(): %s", err)
+			}
+			if err := WriteObjects(w, outputObjects()...); err != nil {
+				t.Fatalf("WriteObjects(): %s", err)
+			}
+
+			if !strings.HasPrefix(b.String(), outputHeader(format)) {
+				t.Errorf("NewObjectWriter(): output does not start with header %q", outputHeader(format))
+			}
+
+			r, err := NewObjectReader(b)
+			if err != nil {
+				t.Fatalf("NewObjectReader(): %s", err)
+			}
+			got, err := readObjects(r)
+			if err != nil {
+				t.Fatalf("Read(): %s", err)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("Read() -want, +got:\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestNewObjectReader(t *testing.T) {
+	type want struct {
+		names   []string
+		err     error
+		readErr error
+	}
+
+	tests := []struct {
+		name   string
+		output string
+		want   want
+	}{
+		{
+			name:   "LegacyYAML",
+			output: "\n---\nkind: A\nmetadata:\n  name: a\n---\nkind: B\nmetadata:\n  name: b\n---\n",
+			want:   want{names: []string{"a", "b"}},
+		},
+		{
+			name:   "List",
+			output: "# stacks.crossplane.io/unpack-output: list/v1\n" + `{"apiVersion":"v1","metadata":{},"items":[{"kind":"A","metadata":{"name":"a"}},{"kind":"B","metadata":{"name":"b"}}],"kind":"List"}`,
+			want:   want{names: []string{"a", "b"}},
+		},
+		{
+			name:   "EmptyList",
+			output: "# stacks.crossplane.io/unpack-output: list/v1\n" + `{"apiVersion":"v1","kind":"List","items":[]}`,
+			want:   want{names: []string{}},
+		},
+		{
+			name:   "TruncatedList",
+			output: "# stacks.crossplane.io/unpack-output: list/v1\n" + `{"apiVersion":"v1","kind":"List","items":[{"kind":"A","metadata":{"name":"a"}}`,
+			want:   want{readErr: errors.Wrap(errors.New("unexpected end of JSON input"), "could not decode List output")},
+		},
+		{
+			name:   "Empty",
+			output: "",
+			want:   want{names: []string{}},
+		},
+		{
+			name:   "UnsupportedVersion",
+			output: "# stacks.crossplane.io/unpack-output: yaml/v2\n---\nkind: A\n",
+			want:   want{err: errors.New(`unsupported output version "yaml/v2", expected format/v1`)},
+		},
+		{
+			name:   "UnsupportedFormat",
+			output: "# stacks.crossplane.io/unpack-output: toml/v1\n",
+			want:   want{err: errors.New(`unsupported output format "toml"`)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewObjectReader(strings.NewReader(tt.output))
+			if diff := cmp.Diff(tt.want.err, err, test.EquateErrors()); diff != "" {
+				t.Fatalf("NewObjectReader() -want error, +got error:\n%s", diff)
+			}
+			if err != nil {
+				return
+			}
+
+			objs, err := readObjects(r)
+			if diff := cmp.Diff(tt.want.readErr, err, test.EquateErrors()); diff != "" {
+				t.Fatalf("Read() -want error, +got error:\n%s", diff)
+			}
+			if err != nil {
+				return
+			}
+			got := []string{}
+			for _, o := range objs {
+				got = append(got, o.GetName())
+			}
+			if diff := cmp.Diff(tt.want.names, got); diff != "" {
+				t.Errorf("Read() -want, +got:\n%v", diff)
+			}
+		})
+	}
+}
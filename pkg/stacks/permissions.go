@@ -0,0 +1,185 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	admissionregistration "k8s.io/api/admissionregistration/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+
+	"github.com/crossplane/crossplane/apis/stacks/v1alpha1"
+)
+
+// sensitiveResources are resources that may be used to escalate privileges,
+// by reading credentials or by granting further permissions.
+var sensitiveResources = map[string]bool{
+	"secrets":             true,
+	"serviceaccounts":     true,
+	"roles":               true,
+	"rolebindings":        true,
+	"clusterroles":        true,
+	"clusterrolebindings": true,
+}
+
+// PermissionsSummary returns a human-readable summary of the RBAC roles and
+// bindings that the Stack Manager creates for the supplied Stack and the CRDs
+// it owns, and of the stack's admission webhooks, followed by any permissions
+// that may allow the stack's controller to escalate its privileges.
+func PermissionsSummary(s *v1alpha1.Stack, crds []apiextensions.CustomResourceDefinition) string {
+	b := &strings.Builder{}
+	owned := map[string]bool{}
+	for _, crd := range crds {
+		owned[crd.Spec.Group] = true
+	}
+
+	warnings := []string{}
+	if rules := s.Spec.Permissions.Rules; len(rules) > 0 {
+		role := PersonaRoleName(s, "system")
+		if apiextensions.ResourceScope(s.Spec.PermissionScope) == apiextensions.ClusterScoped {
+			fmt.Fprintf(b, "ClusterRole %s is bound to ServiceAccount %s/%s in all namespaces by ClusterRoleBinding %s, granting:\n", role, s.GetNamespace(), s.GetName(), s.GetName())
+			warnings = append(warnings, "the stack's controller is granted its permissions in all namespaces")
+		} else {
+			fmt.Fprintf(b, "ClusterRole %s is bound to ServiceAccount %s/%s in namespace %s by RoleBinding %s/%s, granting:\n", role, s.GetNamespace(), s.GetName(), s.GetNamespace(), s.GetNamespace(), s.GetName())
+		}
+		for _, r := range rules {
+			fmt.Fprintf(b, "- %s\n", describeRule(r))
+			if w := escalation(r, owned); w != "" {
+				warnings = append(warnings, w)
+			}
+		}
+	}
+
+	scope := EnvironmentScoped
+	if apiextensions.ResourceScope(s.Spec.PermissionScope) != apiextensions.ClusterScoped {
+		scope = NamespaceScoped
+	}
+	personas := make([]string, 0, len(PersonaRoleVerbs))
+	for p := range PersonaRoleVerbs {
+		personas = append(personas, p)
+	}
+	sort.Strings(personas)
+	for _, p := range personas {
+		rules := PersonaRoleRules(crds, p)
+		if len(rules) == 0 {
+			continue
+		}
+		fmt.Fprintf(b, "ClusterRole %s is aggregated to the %s %s persona, granting:\n", PersonaRoleName(s, p), scope, p)
+		for _, r := range rules {
+			fmt.Fprintf(b, "- %s\n", describeRule(r))
+		}
+	}
+
+	if w := s.Spec.Webhooks; w != nil {
+		where := fmt.Sprintf("in namespace %s", s.GetNamespace())
+		if scope == EnvironmentScoped {
+			where = "in all namespaces matched by its namespace selector"
+		}
+		webhooks := func(kind, name string, rules []admissionregistration.RuleWithOperations) {
+			fmt.Fprintf(b, "%s %s is called for requests %s to:\n", kind, name, where)
+			for _, r := range rules {
+				fmt.Fprintf(b, "- %s\n", describeWebhookRule(r))
+			}
+			if scope == EnvironmentScoped {
+				warnings = append(warnings, fmt.Sprintf("%s %s is called for requests in all namespaces", kind, name))
+			}
+		}
+		for _, wh := range w.Validating {
+			webhooks("ValidatingWebhook", wh.Name, wh.Rules)
+		}
+		for _, wh := range w.Mutating {
+			webhooks("MutatingWebhook", wh.Name, wh.Rules)
+		}
+	}
+
+	if len(warnings) > 0 {
+		b.WriteString("Warnings:\n")
+		for _, w := range warnings {
+			fmt.Fprintf(b, "- %s\n", w)
+		}
+	}
+
+	return b.String()
+}
+
+// describeRule describes a PolicyRule, e.g. "get, list on secrets in the core
+// API group".
+func describeRule(r rbacv1.PolicyRule) string {
+	groups := make([]string, len(r.APIGroups))
+	for i, g := range r.APIGroups {
+		groups[i] = g
+		if g == "" {
+			groups[i] = "core"
+		}
+	}
+
+	d := fmt.Sprintf("%s on %s in API groups %s", strings.Join(r.Verbs, ", "), strings.Join(r.Resources, ", "), strings.Join(groups, ", "))
+	if len(r.ResourceNames) > 0 {
+		d += fmt.Sprintf(" named %s", strings.Join(r.ResourceNames, ", "))
+	}
+	return d
+}
+
+// describeWebhookRule describes the requests a webhook is called for, e.g.
+// "CREATE, UPDATE on mytypes in API groups samples.upbound.io".
+func describeWebhookRule(r admissionregistration.RuleWithOperations) string {
+	ops := make([]string, len(r.Operations))
+	for i, o := range r.Operations {
+		ops[i] = string(o)
+	}
+	return fmt.Sprintf("%s on %s in API groups %s", strings.Join(ops, ", "), strings.Join(r.Resources, ", "), strings.Join(r.APIGroups, ", "))
+}
+
+// escalation returns a warning if the supplied rule grants all verbs on
+// resources the stack does not own, or grants access to resources that may be
+// used to escalate privileges.
+func escalation(r rbacv1.PolicyRule, owned map[string]bool) string {
+	ownedOnly := len(r.APIGroups) > 0
+	for _, g := range r.APIGroups {
+		ownedOnly = ownedOnly && owned[g]
+	}
+	if ownedOnly {
+		return ""
+	}
+
+	if hasWildcard(r.Verbs) {
+		return "all verbs are granted on " + describeRule(r)
+	}
+	if hasWildcard(r.Resources) {
+		return "all resources are granted by " + describeRule(r)
+	}
+	for _, res := range r.Resources {
+		if sensitiveResources[res] {
+			return "access to sensitive resources is granted by " + describeRule(r)
+		}
+	}
+	return ""
+}
+
+// hasWildcard returns true if any of the supplied RBAC rule values is or
+// contains a wildcard, e.g. * or */scale.
+func hasWildcard(values []string) bool {
+	for _, v := range values {
+		if strings.Contains(v, rbacv1.ResourceAll) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	admissionregistration "k8s.io/api/admissionregistration/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/crossplane/crossplane/apis/stacks/v1alpha1"
+)
+
+func TestPermissionsSummary(t *testing.T) {
+	crds := []apiextensions.CustomResourceDefinition{{
+		Spec: apiextensions.CustomResourceDefinitionSpec{
+			Group: "samples.upbound.io",
+			Names: apiextensions.CustomResourceDefinitionNames{Plural: "mytypes"},
+		},
+	}}
+
+	stack := func(scope string, rules ...rbacv1.PolicyRule) *v1alpha1.Stack {
+		return &v1alpha1.Stack{
+			ObjectMeta: metav1.ObjectMeta{Name: "sample", Namespace: "ns"},
+			Spec: v1alpha1.StackSpec{
+				AppMetadataSpec: v1alpha1.AppMetadataSpec{
+					Version:         "0.0.1",
+					PermissionScope: scope,
+				},
+				Permissions: v1alpha1.PermissionsSpec{Rules: rules},
+			},
+		}
+	}
+
+	personas := `ClusterRole stack:ns:sample:0.0.1:admin is aggregated to the namespace admin persona, granting:
+- get, list, watch, create, delete, deletecollection, patch, update on mytypes in API groups samples.upbound.io
+ClusterRole stack:ns:sample:0.0.1:edit is aggregated to the namespace edit persona, granting:
+- get, list, watch, create, delete, deletecollection, patch, update on mytypes in API groups samples.upbound.io
+ClusterRole stack:ns:sample:0.0.1:view is aggregated to the namespace view persona, granting:
+- get, list, watch on mytypes in API groups samples.upbound.io
+`
+
+	withWebhooks := func(s *v1alpha1.Stack) *v1alpha1.Stack {
+		rule := admissionregistration.RuleWithOperations{
+			Operations: []admissionregistration.OperationType{admissionregistration.Create, admissionregistration.Update},
+			Rule:       admissionregistration.Rule{APIGroups: []string{"samples.upbound.io"}, Resources: []string{"mytypes"}},
+		}
+		s.Spec.Webhooks = &v1alpha1.WebhooksSpec{
+			Deployment: "controller",
+			Validating: []admissionregistration.ValidatingWebhook{{Name: "validate.samples.upbound.io", Rules: []admissionregistration.RuleWithOperations{rule}}},
+			Mutating:   []admissionregistration.MutatingWebhook{{Name: "mutate.samples.upbound.io", Rules: []admissionregistration.RuleWithOperations{rule}}},
+		}
+		return s
+	}
+
+	tests := []struct {
+		name  string
+		stack *v1alpha1.Stack
+		crds  []apiextensions.CustomResourceDefinition
+		want  string
+	}{
+		{
+			name:  "NoPermissions",
+			stack: stack("Namespaced"),
+			want:  "",
+		},
+		{
+			name: "NamespacedOwnedOnly",
+			stack: stack("Namespaced", rbacv1.PolicyRule{
+				APIGroups: []string{"samples.upbound.io"},
+				Resources: []string{"mytypes"},
+				Verbs:     []string{"*"},
+			}),
+			crds: crds,
+			want: `ClusterRole stack:ns:sample:0.0.1:system is bound to ServiceAccount ns/sample in namespace ns by RoleBinding ns/sample, granting:
+- * on mytypes in API groups samples.upbound.io
+` + personas,
+		},
+		{
+			name: "ClusterEscalation",
+			stack: stack("Cluster",
+				rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}},
+				rbacv1.PolicyRule{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"*"}},
+				rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get"}, ResourceNames: []string{"config"}},
+			),
+			want: `ClusterRole stack:ns:sample:0.0.1:system is bound to ServiceAccount ns/sample in all namespaces by ClusterRoleBinding sample, granting:
+- get on secrets in API groups core
+- * on deployments in API groups apps
+- get on configmaps in API groups core named config
+Warnings:
+- the stack's controller is granted its permissions in all namespaces
+- access to sensitive resources is granted by get on secrets in API groups core
+- all verbs are granted on * on deployments in API groups apps
+`,
+		},
+		{
+			name: "NamespacedWildcards",
+			stack: stack("Namespaced",
+				rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"events"}, Verbs: []string{"*"}},
+				rbacv1.PolicyRule{APIGroups: []string{"yourstack.example.org"}, Resources: []string{"*/status"}, Verbs: []string{"get"}},
+			),
+			want: `ClusterRole stack:ns:sample:0.0.1:system is bound to ServiceAccount ns/sample in namespace ns by RoleBinding ns/sample, granting:
+- * on events in API groups core
+- get on */status in API groups yourstack.example.org
+Warnings:
+- all verbs are granted on * on events in API groups core
+- all resources are granted by get on */status in API groups yourstack.example.org
+`,
+		},
+		{
+			name:  "NamespacedWebhooks",
+			stack: withWebhooks(stack("Namespaced")),
+			crds:  crds,
+			want: personas + `ValidatingWebhook validate.samples.upbound.io is called for requests in namespace ns to:
+- CREATE, UPDATE on mytypes in API groups samples.upbound.io
+MutatingWebhook mutate.samples.upbound.io is called for requests in namespace ns to:
+- CREATE, UPDATE on mytypes in API groups samples.upbound.io
+`,
+		},
+		{
+			name:  "ClusterWebhooks",
+			stack: withWebhooks(stack("Cluster")),
+			want: `ValidatingWebhook validate.samples.upbound.io is called for requests in all namespaces matched by its namespace selector to:
+- CREATE, UPDATE on mytypes in API groups samples.upbound.io
+MutatingWebhook mutate.samples.upbound.io is called for requests in all namespaces matched by its namespace selector to:
+- CREATE, UPDATE on mytypes in API groups samples.upbound.io
+Warnings:
+- ValidatingWebhook validate.samples.upbound.io is called for requests in all namespaces
+- MutatingWebhook mutate.samples.upbound.io is called for requests in all namespaces
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PermissionsSummary(tt.stack, tt.crds)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("PermissionsSummary() -want, +got:\n%s", diff)
+			}
+		})
+	}
+}
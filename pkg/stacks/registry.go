@@ -0,0 +1,467 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// dockerHubDomain is the domain of normalized Docker Hub image names,
+	// and dockerHubRegistry the domain that serves its registry API.
+	dockerHubDomain   = "docker.io"
+	dockerHubRegistry = "registry-1.docker.io"
+
+	// maxTagPages limits the number of pages of tags that are read from a
+	// registry, and maxRegistryResponseSize the size of each response.
+	maxTagPages             = 100
+	maxRegistryResponseSize = 4 << 20
+
+	// headerContentDigest is the registry response header that contains the
+	// digest of a manifest.
+	headerContentDigest = "Docker-Content-Digest"
+)
+
+// manifestMediaTypes are the manifest media types accepted when resolving a
+// tag. Image indexes are preferred, so that a tag resolves to the same digest
+// regardless of the platform of the nodes that pull it.
+var manifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+}
+
+var (
+	// linkNextRE matches the URL of the next page in a Link header.
+	linkNextRE = regexp.MustCompile(`<([^>]+)>\s*;\s*rel="?next"?`)
+
+	// challengeParamRE matches the parameters of a WWW-Authenticate challenge.
+	challengeParamRE = regexp.MustCompile(`(\w+)="([^"]*)"`)
+)
+
+// A TagLister lists the tags of the repository of a stack package image.
+type TagLister interface {
+	ListTags(ctx context.Context, image string, auth RegistryAuth) ([]string, error)
+}
+
+// A DigestResolver resolves a stack package image to the digest of its
+// manifest.
+type DigestResolver interface {
+	ResolveDigest(ctx context.Context, image string, auth RegistryAuth) (string, error)
+}
+
+// RegistryCredentials authenticate to a registry.
+type RegistryCredentials struct {
+	Username string
+	Password string
+}
+
+// RegistryAuth is the credentials for each registry, by registry domain, e.g.
+// registry.example.org:5000. Registries without credentials are accessed
+// anonymously.
+type RegistryAuth map[string]RegistryCredentials
+
+// dockerConfig is the content of a kubernetes.io/dockerconfigjson secret.
+type dockerConfig struct {
+	Auths map[string]struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Auth     string `json:"auth"`
+	} `json:"auths"`
+}
+
+// RegistryAuthFromSecrets returns the registry credentials of the supplied
+// image pull secrets. Secrets that are not of type
+// kubernetes.io/dockerconfigjson are ignored.
+func RegistryAuthFromSecrets(secrets []corev1.Secret) (RegistryAuth, error) {
+	auth := RegistryAuth{}
+	for _, s := range secrets {
+		if s.Type != corev1.SecretTypeDockerConfigJson {
+			continue
+		}
+		cfg := &dockerConfig{}
+		if err := json.Unmarshal(s.Data[corev1.DockerConfigJsonKey], cfg); err != nil {
+			return nil, errors.Wrapf(err, "cannot parse image pull secret %q", s.GetName())
+		}
+		for server, a := range cfg.Auths {
+			c := RegistryCredentials{Username: a.Username, Password: a.Password}
+			if a.Auth != "" {
+				b, err := base64.StdEncoding.DecodeString(a.Auth)
+				if err != nil {
+					return nil, errors.Wrapf(err, "cannot parse image pull secret %q", s.GetName())
+				}
+				c.Username, c.Password = splitCredentials(string(b))
+			}
+			d := registryDomain(server)
+			if _, ok := auth[d]; !ok {
+				auth[d] = c
+			}
+		}
+	}
+	return auth, nil
+}
+
+func splitCredentials(s string) (string, string) {
+	i := strings.Index(s, ":")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i+1:]
+}
+
+// registryDomain returns the domain of the registry API of the supplied
+// docker config server, which may be a URL, e.g. https://index.docker.io/v1/.
+func registryDomain(server string) string {
+	if u, err := url.Parse(server); err == nil && u.Host != "" {
+		server = u.Host
+	}
+	server = strings.SplitN(server, "/", 2)[0]
+	switch server {
+	case dockerHubDomain, "index.docker.io":
+		return dockerHubRegistry
+	}
+	return server
+}
+
+// A RegistryClient reads stack package image repositories using the Docker
+// Registry HTTP API V2. It authenticates to registries that require a bearer
+// token or basic authentication, using any credentials supplied for the
+// registry.
+type RegistryClient struct {
+	// Client is used to call the registry. http.DefaultClient is used if
+	// Client is nil.
+	Client *http.Client
+
+	// TokenRealms are the hosts of the token authentication realms, by
+	// registry domain, that may be sent the credentials of a registry whose
+	// realm is not served by the registry itself. DefaultTokenRealms are used
+	// if TokenRealms is nil.
+	TokenRealms map[string][]string
+}
+
+// DefaultTokenRealms are the hosts of the token authentication realms of well
+// known registries, by registry domain.
+var DefaultTokenRealms = map[string][]string{
+	dockerHubRegistry: {"auth.docker.io"},
+}
+
+type tagList struct {
+	Tags []string `json:"tags"`
+}
+
+type registryToken struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+}
+
+// ListTags lists the tags of the repository of the supplied image, following
+// pagination links until every tag has been listed.
+func (c *RegistryClient) ListTags(ctx context.Context, image string, auth RegistryAuth) ([]string, error) {
+	r, err := c.repository(image, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []string{}
+	next := r.url("tags/list")
+	for page := 0; next != ""; page++ {
+		if page == maxTagPages {
+			return nil, errors.Errorf("cannot list tags of %q: more than %d pages of tags", image, maxTagPages)
+		}
+
+		res, err := r.get(ctx, next)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot list tags of %q", image)
+		}
+		b, err := readRegistryResponse(res)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot list tags of %q", image)
+		}
+		list := &tagList{}
+		if err := json.Unmarshal(b, list); err != nil {
+			return nil, errors.Wrapf(err, "cannot list tags of %q: cannot decode response", image)
+		}
+		tags = append(tags, list.Tags...)
+
+		next, err = nextPage(res.Request.URL, res.Header.Get("Link"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot list tags of %q", image)
+		}
+	}
+	return tags, nil
+}
+
+// ResolveDigest returns the digest of the manifest that the tag of the
+// supplied image refers to. An untagged image refers to the latest tag. The
+// digest of an image that is already referenced by digest is returned as is.
+func (c *RegistryClient) ResolveDigest(ctx context.Context, image string, auth RegistryAuth) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot parse image %q", image)
+	}
+	if d, ok := named.(reference.Digested); ok {
+		return d.Digest().String(), nil
+	}
+	tag := "latest"
+	if t, ok := named.(reference.Tagged); ok {
+		tag = t.Tag()
+	}
+
+	r, err := c.repository(image, auth)
+	if err != nil {
+		return "", err
+	}
+	res, err := r.get(ctx, r.url("manifests/"+tag), manifestMediaTypes...)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot resolve digest of %q", image)
+	}
+	b, err := readRegistryResponse(res)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot resolve digest of %q", image)
+	}
+
+	// The digest of the manifest is computed rather than trusted, but must
+	// match the digest reported by the registry, if any.
+	d := digest.FromBytes(b)
+	if h := res.Header.Get(headerContentDigest); h != "" && h != d.String() {
+		return "", errors.Errorf("cannot resolve digest of %q: registry reported digest %s, but manifest has digest %s", image, h, d)
+	}
+	return d.String(), nil
+}
+
+// PinnedImage returns the supplied image referenced by the supplied digest,
+// retaining any tag, e.g. crossplane/sample-stack:v1.0.0@sha256:0123...
+func PinnedImage(image, dgst string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot parse image %q", image)
+	}
+	d, err := digest.Parse(dgst)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot pin image %q", image)
+	}
+	if existing, ok := named.(reference.Digested); ok {
+		if existing.Digest() != d {
+			return "", errors.Errorf("cannot pin image %q to digest %s", image, d)
+		}
+		return image, nil
+	}
+	pinned, err := reference.WithDigest(named, d)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot pin image %q", image)
+	}
+
+	// Only images that were supplied with a domain are pinned with one, so
+	// that a source can still be applied to a pinned image.
+	if strings.HasPrefix(image, reference.Domain(named)) {
+		return pinned.String(), nil
+	}
+	return reference.FamiliarString(pinned), nil
+}
+
+// repository returns a client for the repository of the supplied image.
+func (c *RegistryClient) repository(image string, auth RegistryAuth) (*registryRepository, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse image %q", image)
+	}
+	domain := registryDomain(reference.Domain(named))
+	hc := c.Client
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	realms := c.TokenRealms
+	if realms == nil {
+		realms = DefaultTokenRealms
+	}
+	r := &registryRepository{client: hc, domain: domain, path: reference.Path(named), realms: realms[domain]}
+	if creds, ok := auth[domain]; ok {
+		r.creds = &creds
+	}
+	return r, nil
+}
+
+// A registryRepository calls the registry API of a repository, remembering how
+// to authenticate to the registry once it has been challenged.
+type registryRepository struct {
+	client *http.Client
+	domain string
+	path   string
+	creds  *RegistryCredentials
+	realms []string
+
+	authorization string
+}
+
+func (r *registryRepository) url(suffix string) string {
+	return (&url.URL{Scheme: "https", Host: r.domain, Path: "/v2/" + r.path + "/" + suffix}).String()
+}
+
+// get requests the supplied URL, authenticating and retrying once if the
+// registry challenges the request.
+func (r *registryRepository) get(ctx context.Context, u string, accept ...string) (*http.Response, error) {
+	res, err := r.do(ctx, u, r.authorization, accept...)
+	if err != nil || res.StatusCode != http.StatusUnauthorized || r.authorization != "" {
+		return res, err
+	}
+	challenge := res.Header.Get("WWW-Authenticate")
+	_ = res.Body.Close()
+
+	if r.authorization, err = r.authenticate(ctx, challenge); err != nil {
+		return nil, errors.Wrapf(err, "cannot authenticate to %s", r.domain)
+	}
+	return r.do(ctx, u, r.authorization, accept...)
+}
+
+func (r *registryRepository) do(ctx context.Context, u, authorization string, accept ...string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	if len(accept) > 0 {
+		req.Header.Set("Accept", strings.Join(accept, ", "))
+	}
+	return r.client.Do(req.WithContext(ctx))
+}
+
+// authenticate returns the Authorization header that answers the supplied
+// WWW-Authenticate challenge. Bearer tokens are requested anonymously unless
+// the repository has credentials.
+func (r *registryRepository) authenticate(ctx context.Context, challenge string) (string, error) {
+	scheme := strings.ToLower(strings.SplitN(challenge, " ", 2)[0])
+	switch {
+	case scheme == "basic" && r.creds != nil:
+		return "Basic " + basicCredentials(r.creds), nil
+	case scheme == "basic":
+		return "", errors.New("registry requires credentials")
+	case scheme != "bearer":
+		return "", errors.Errorf("unsupported authentication challenge %q", challenge)
+	}
+
+	params := map[string]string{}
+	for _, m := range challengeParamRE.FindAllStringSubmatch(challenge, -1) {
+		params[strings.ToLower(m[1])] = m[2]
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", errors.Errorf("invalid authentication realm %q", params["realm"])
+	}
+	if realm.Scheme != "https" {
+		return "", errors.Errorf("authentication realm %q does not use https", params["realm"])
+	}
+	q := realm.Query()
+	for _, k := range []string{"service", "scope"} {
+		if v, ok := params[k]; ok {
+			q.Set(k, v)
+		}
+	}
+	realm.RawQuery = q.Encode()
+
+	authorization := ""
+	if r.creds != nil {
+		if !r.trustsRealm(realm.Host) {
+			return "", errors.Errorf("refusing to send credentials to authentication realm %q, which is not served by the registry", params["realm"])
+		}
+		authorization = "Basic " + basicCredentials(r.creds)
+	}
+	res, err := r.do(ctx, realm.String(), authorization)
+	if err != nil {
+		return "", err
+	}
+	b, err := readRegistryResponse(res)
+	if err != nil {
+		return "", err
+	}
+	t := &registryToken{}
+	if err := json.Unmarshal(b, t); err != nil {
+		return "", errors.Wrap(err, "cannot decode token response")
+	}
+	if t.Token != "" {
+		return "Bearer " + t.Token, nil
+	}
+	if t.AccessToken != "" {
+		return "Bearer " + t.AccessToken, nil
+	}
+	return "", errors.New("token response does not contain a token")
+}
+
+// trustsRealm returns true if the registry's credentials may be sent to a token
+// authentication realm served by the supplied host.
+func (r *registryRepository) trustsRealm(host string) bool {
+	if host == r.domain {
+		return true
+	}
+	for _, h := range r.realms {
+		if host == h {
+			return true
+		}
+	}
+	return false
+}
+
+func basicCredentials(c *RegistryCredentials) string {
+	return base64.StdEncoding.EncodeToString([]byte(c.Username + ":" + c.Password))
+}
+
+// readRegistryResponse reads the body of a successful registry response, and
+// closes it.
+func readRegistryResponse(res *http.Response) ([]byte, error) {
+	defer func() { _ = res.Body.Close() }()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("GET %s: unexpected status %s", res.Request.URL.Path, res.Status)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(res.Body, maxRegistryResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxRegistryResponseSize {
+		return nil, errors.Errorf("GET %s: response exceeds %d bytes", res.Request.URL.Path, maxRegistryResponseSize)
+	}
+	return b, nil
+}
+
+// nextPage returns the URL of the next page of a paginated response, resolved
+// against the URL of the current page, or an empty string if there is no next
+// page.
+func nextPage(current *url.URL, link string) (string, error) {
+	m := linkNextRE.FindStringSubmatch(link)
+	if m == nil {
+		return "", nil
+	}
+	next, err := current.Parse(m[1])
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid Link header %q", link)
+	}
+	return next.String(), nil
+}
@@ -0,0 +1,517 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+)
+
+const manifest = `{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.list.v2+json","manifests":[]}`
+
+// fakeRegistry serves the tags and manifests of its repositories using the
+// Docker Registry HTTP API V2. Tags are paginated pageSize tags at a time. If
+// token is set, requests require a bearer token issued by its /token endpoint.
+// If creds is set, tokens are only issued to, or if token is not set requests
+// are only served to, those credentials.
+type fakeRegistry struct {
+	repos     map[string][]string
+	manifests map[string]string
+	pageSize  int
+	token     string
+	creds     *RegistryCredentials
+
+	// contentDigest overrides the Docker-Content-Digest header of
+	// manifest responses.
+	contentDigest string
+
+	// realm overrides the token authentication realm of challenges.
+	realm string
+}
+
+func (r *fakeRegistry) basicAuthorized(req *http.Request) bool {
+	u, p, ok := req.BasicAuth()
+	return r.creds == nil || ok && u == r.creds.Username && p == r.creds.Password
+}
+
+func (r *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		if req.URL.Query().Get("service") != "fake" || req.URL.Query().Get("scope") == "" {
+			http.Error(w, "bad token request", http.StatusBadRequest)
+			return
+		}
+		if !r.basicAuthorized(req) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(registryToken{Token: r.token})
+		return
+	}
+
+	if !strings.HasPrefix(req.URL.Path, "/v2/") {
+		http.NotFound(w, req)
+		return
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	i := strings.LastIndex(path, "/tags/")
+	if j := strings.LastIndex(path, "/manifests/"); j > i {
+		i = j
+	}
+	if i < 0 {
+		http.NotFound(w, req)
+		return
+	}
+	repo := path[:i]
+
+	switch {
+	case r.token != "" && req.Header.Get("Authorization") != "Bearer "+r.token:
+		realm := r.realm
+		if realm == "" {
+			realm = fmt.Sprintf("https://%s/token", req.Host)
+		}
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q,service="fake",scope="repository:%s:pull"`, realm, repo))
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	case r.token == "" && !r.basicAuthorized(req):
+		w.Header().Set("WWW-Authenticate", `Basic realm="fake"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if strings.HasPrefix(path[i:], "/manifests/") {
+		r.serveManifest(w, req, repo+":"+strings.TrimPrefix(path[i:], "/manifests/"))
+		return
+	}
+
+	tags, ok := r.repos[repo]
+	if !ok || path[i:] != "/tags/list" {
+		http.NotFound(w, req)
+		return
+	}
+
+	start, _ := strconv.Atoi(req.URL.Query().Get("last"))
+	end := len(tags)
+	if r.pageSize > 0 && start+r.pageSize < end {
+		end = start + r.pageSize
+		w.Header().Set("Link", fmt.Sprintf(`</v2/%s/tags/list?n=%d&last=%d>; rel="next"`, repo, r.pageSize, end))
+	}
+	_ = json.NewEncoder(w).Encode(tagList{Tags: tags[start:end]})
+}
+
+func (r *fakeRegistry) serveManifest(w http.ResponseWriter, req *http.Request, ref string) {
+	m, ok := r.manifests[ref]
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	if !strings.Contains(req.Header.Get("Accept"), "application/vnd.docker.distribution.manifest.list.v2+json") {
+		http.Error(w, "manifest list not accepted", http.StatusNotAcceptable)
+		return
+	}
+	d := digest.FromString(m).String()
+	if r.contentDigest != "" {
+		d = r.contentDigest
+	}
+	w.Header().Set(headerContentDigest, d)
+	w.Header().Set("Content-Type", "application/vnd.docker.distribution.manifest.list.v2+json")
+	_, _ = w.Write([]byte(m))
+}
+
+// registryImage returns an image in the repository of the supplied fake
+// registry server.
+func registryImage(srv *httptest.Server, repo string) string {
+	return strings.TrimPrefix(srv.URL, "https://") + "/" + repo
+}
+
+func TestRegistryClientListTags(t *testing.T) {
+	tags := []string{"1.0.0", "1.0.1", "1.1.0", "2.0.0", "latest"}
+	creds := &RegistryCredentials{Username: "cool", Password: "s3cr3t"}
+
+	// The image, and therefore errors, are specific to each fake registry.
+	// Errors are wrapped with the image once it is known.
+	type want struct {
+		tags  []string
+		cause error
+	}
+
+	cases := map[string]struct {
+		registry *fakeRegistry
+		creds    *RegistryCredentials
+		want     want
+	}{
+		"SinglePage": {
+			registry: &fakeRegistry{repos: map[string][]string{"cool/stack": tags}},
+			want:     want{tags: tags},
+		},
+		"Paginated": {
+			registry: &fakeRegistry{repos: map[string][]string{"cool/stack": tags}, pageSize: 2},
+			want:     want{tags: tags},
+		},
+		"TokenAuthentication": {
+			registry: &fakeRegistry{repos: map[string][]string{"cool/stack": tags}, pageSize: 2, token: "t0k3n"},
+			want:     want{tags: tags},
+		},
+		"TokenAuthenticationWithCredentials": {
+			registry: &fakeRegistry{repos: map[string][]string{"cool/stack": tags}, token: "t0k3n", creds: creds},
+			creds:    creds,
+			want:     want{tags: tags},
+		},
+		"BasicAuthentication": {
+			registry: &fakeRegistry{repos: map[string][]string{"cool/stack": tags}, pageSize: 2, creds: creds},
+			creds:    creds,
+			want:     want{tags: tags},
+		},
+		"NoCredentials": {
+			registry: &fakeRegistry{repos: map[string][]string{"cool/stack": tags}, creds: creds},
+			want:     want{cause: errors.New("registry requires credentials")},
+		},
+		"NotFound": {
+			registry: &fakeRegistry{repos: map[string][]string{}},
+			want: want{
+				cause: errors.New("GET /v2/cool/stack/tags/list: unexpected status 404 Not Found"),
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewTLSServer(tc.registry)
+			defer srv.Close()
+
+			image := registryImage(srv, "cool/stack:1.0.0")
+			domain := strings.TrimPrefix(srv.URL, "https://")
+			auth := RegistryAuth{}
+			if tc.creds != nil {
+				auth[domain] = *tc.creds
+			}
+
+			var wantErr error
+			switch {
+			case tc.want.cause == nil:
+			case strings.HasPrefix(tc.want.cause.Error(), "GET "):
+				wantErr = errors.Wrapf(tc.want.cause, "cannot list tags of %q", image)
+			default:
+				wantErr = errors.Wrapf(errors.Wrapf(tc.want.cause, "cannot authenticate to %s", domain), "cannot list tags of %q", image)
+			}
+
+			c := &RegistryClient{Client: srv.Client()}
+			got, err := c.ListTags(context.Background(), image, auth)
+			if diff := cmp.Diff(wantErr, err, test.EquateErrors()); diff != "" {
+				t.Errorf("ListTags(...): -want error, +got error:\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want.tags, got); diff != "" {
+				t.Errorf("ListTags(...): -want, +got:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRegistryClientTokenRealm(t *testing.T) {
+	tags := []string{"1.0.0"}
+	creds := &RegistryCredentials{Username: "cool", Password: "s3cr3t"}
+
+	type want struct {
+		tags []string
+		err  string
+	}
+
+	cases := map[string]struct {
+		scheme    string
+		otherHost bool
+		trusted   bool
+		creds     *RegistryCredentials
+		want      want
+	}{
+		"SameHost": {
+			scheme: "https",
+			creds:  creds,
+			want:   want{tags: tags},
+		},
+		"Insecure": {
+			scheme: "http",
+			creds:  creds,
+			want:   want{err: "authentication realm %q does not use https"},
+		},
+		"InsecureWithoutCredentials": {
+			scheme: "http",
+			want:   want{err: "authentication realm %q does not use https"},
+		},
+		"OtherHost": {
+			scheme:    "https",
+			otherHost: true,
+			creds:     creds,
+			want:      want{err: "refusing to send credentials to authentication realm %q, which is not served by the registry"},
+		},
+		"OtherHostWithoutCredentials": {
+			scheme:    "https",
+			otherHost: true,
+			want:      want{tags: tags},
+		},
+		"TrustedOtherHost": {
+			scheme:    "https",
+			otherHost: true,
+			trusted:   true,
+			creds:     creds,
+			want:      want{tags: tags},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			registry := &fakeRegistry{repos: map[string][]string{"cool/stack": tags}, token: "t0k3n", creds: tc.creds}
+			srv := httptest.NewTLSServer(registry)
+			defer srv.Close()
+			realmSrv := httptest.NewTLSServer(registry)
+			defer realmSrv.Close()
+
+			domain := strings.TrimPrefix(srv.URL, "https://")
+			realmHost := domain
+			if tc.otherHost {
+				realmHost = strings.TrimPrefix(realmSrv.URL, "https://")
+			}
+			registry.realm = fmt.Sprintf("%s://%s/token", tc.scheme, realmHost)
+
+			image := registryImage(srv, "cool/stack:1.0.0")
+			auth := RegistryAuth{}
+			if tc.creds != nil {
+				auth[domain] = *tc.creds
+			}
+			c := &RegistryClient{Client: srv.Client(), TokenRealms: map[string][]string{}}
+			if tc.trusted {
+				c.TokenRealms[domain] = []string{realmHost}
+			}
+
+			var wantErr error
+			if tc.want.err != "" {
+				cause := errors.Errorf(tc.want.err, registry.realm)
+				wantErr = errors.Wrapf(errors.Wrapf(cause, "cannot authenticate to %s", domain), "cannot list tags of %q", image)
+			}
+
+			got, err := c.ListTags(context.Background(), image, auth)
+			if diff := cmp.Diff(wantErr, err, test.EquateErrors()); diff != "" {
+				t.Errorf("ListTags(...): -want error, +got error:\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want.tags, got); diff != "" {
+				t.Errorf("ListTags(...): -want, +got:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRegistryClientResolveDigest(t *testing.T) {
+	manifests := map[string]string{"cool/stack:1.0.0": manifest, "cool/stack:latest": manifest}
+	d := digest.FromString(manifest).String()
+	other := digest.FromString("other").String()
+
+	type want struct {
+		digest string
+		cause  error
+	}
+
+	cases := map[string]struct {
+		registry *fakeRegistry
+		repo     string
+		want     want
+	}{
+		"Tagged": {
+			registry: &fakeRegistry{manifests: manifests},
+			repo:     "cool/stack:1.0.0",
+			want:     want{digest: d},
+		},
+		"Untagged": {
+			registry: &fakeRegistry{manifests: manifests, token: "t0k3n"},
+			repo:     "cool/stack",
+			want:     want{digest: d},
+		},
+		"AlreadyPinned": {
+			registry: &fakeRegistry{},
+			repo:     "cool/stack:1.0.0@" + other,
+			want:     want{digest: other},
+		},
+		"DigestMismatch": {
+			registry: &fakeRegistry{manifests: manifests, contentDigest: other},
+			repo:     "cool/stack:1.0.0",
+			want: want{
+				cause: errors.Errorf("registry reported digest %s, but manifest has digest %s", other, d),
+			},
+		},
+		"NotFound": {
+			registry: &fakeRegistry{manifests: manifests},
+			repo:     "cool/stack:2.0.0",
+			want: want{
+				cause: errors.New("GET /v2/cool/stack/manifests/2.0.0: unexpected status 404 Not Found"),
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewTLSServer(tc.registry)
+			defer srv.Close()
+
+			image := registryImage(srv, tc.repo)
+			var wantErr error
+			switch {
+			case tc.want.cause == nil:
+			case strings.HasPrefix(tc.want.cause.Error(), "GET "):
+				wantErr = errors.Wrapf(tc.want.cause, "cannot resolve digest of %q", image)
+			default:
+				wantErr = errors.Errorf("cannot resolve digest of %q: %s", image, tc.want.cause)
+			}
+
+			c := &RegistryClient{Client: srv.Client()}
+			got, err := c.ResolveDigest(context.Background(), image, nil)
+			if diff := cmp.Diff(wantErr, err, test.EquateErrors()); diff != "" {
+				t.Errorf("ResolveDigest(...): -want error, +got error:\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want.digest, got); diff != "" {
+				t.Errorf("ResolveDigest(...): -want, +got:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPinnedImage(t *testing.T) {
+	d := digest.FromString(manifest).String()
+
+	type want struct {
+		image string
+		err   error
+	}
+
+	cases := map[string]struct {
+		image  string
+		digest string
+		want   want
+	}{
+		"Familiar": {
+			image:  "cool/stack:1.0.0",
+			digest: d,
+			want:   want{image: "cool/stack:1.0.0@" + d},
+		},
+		"WithDomain": {
+			image:  "registry.example.org:5000/cool/stack:1.0.0",
+			digest: d,
+			want:   want{image: "registry.example.org:5000/cool/stack:1.0.0@" + d},
+		},
+		"Untagged": {
+			image:  "cool/stack",
+			digest: d,
+			want:   want{image: "cool/stack@" + d},
+		},
+		"AlreadyPinned": {
+			image:  "cool/stack:1.0.0@" + d,
+			digest: d,
+			want:   want{image: "cool/stack:1.0.0@" + d},
+		},
+		"PinnedToOtherDigest": {
+			image:  "cool/stack:1.0.0@" + digest.FromString("other").String(),
+			digest: d,
+			want: want{
+				err: errors.Errorf("cannot pin image %q to digest %s", "cool/stack:1.0.0@"+digest.FromString("other").String(), d),
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := PinnedImage(tc.image, tc.digest)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("PinnedImage(...): -want error, +got error:\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want.image, got); diff != "" {
+				t.Errorf("PinnedImage(...): -want, +got:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRegistryAuthFromSecrets(t *testing.T) {
+	secret := func(name string, t corev1.SecretType, cfg string) corev1.Secret {
+		return corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Type:       t,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(cfg)},
+		}
+	}
+	auth := base64.StdEncoding.EncodeToString([]byte("cool:s3cr3t"))
+
+	type want struct {
+		auth RegistryAuth
+		err  error
+	}
+
+	cases := map[string]struct {
+		secrets []corev1.Secret
+		want    want
+	}{
+		"DockerConfig": {
+			secrets: []corev1.Secret{
+				secret("hub", corev1.SecretTypeDockerConfigJson, `{"auths":{"https://index.docker.io/v1/":{"auth":"`+auth+`"}}}`),
+				secret("private", corev1.SecretTypeDockerConfigJson, `{"auths":{"registry.example.org:5000":{"username":"u","password":"p"}}}`),
+			},
+			want: want{auth: RegistryAuth{
+				dockerHubRegistry:           {Username: "cool", Password: "s3cr3t"},
+				"registry.example.org:5000": {Username: "u", Password: "p"},
+			}},
+		},
+		"FirstSecretWins": {
+			secrets: []corev1.Secret{
+				secret("first", corev1.SecretTypeDockerConfigJson, `{"auths":{"registry.example.org":{"username":"first","password":"p"}}}`),
+				secret("second", corev1.SecretTypeDockerConfigJson, `{"auths":{"https://registry.example.org":{"username":"second","password":"p"}}}`),
+			},
+			want: want{auth: RegistryAuth{"registry.example.org": {Username: "first", Password: "p"}}},
+		},
+		"OtherSecretType": {
+			secrets: []corev1.Secret{secret("opaque", corev1.SecretTypeOpaque, `not json`)},
+			want:    want{auth: RegistryAuth{}},
+		},
+		"InvalidDockerConfig": {
+			secrets: []corev1.Secret{secret("invalid", corev1.SecretTypeDockerConfigJson, `{"auths":{"registry.example.org":{"auth":"!"}}}`)},
+			want: want{
+				err: errors.Wrapf(base64.CorruptInputError(0), "cannot parse image pull secret %q", "invalid"),
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := RegistryAuthFromSecrets(tc.secrets)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("RegistryAuthFromSecrets(...): -want error, +got error:\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want.auth, got); diff != "" {
+				t.Errorf("RegistryAuthFromSecrets(...): -want, +got:\n%s", diff)
+			}
+		})
+	}
+}
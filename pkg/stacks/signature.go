@@ -0,0 +1,206 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+
+	"github.com/crossplane/crossplane/pkg/stacks/walker"
+)
+
+const (
+	// signatureFileName is the detached signature of a stack package. Only a
+	// signature at the base of the package is used.
+	signatureFileName = "signature.yaml"
+
+	pemTypePublicKey = "PUBLIC KEY"
+)
+
+// PackageSignature is a detached signature of a stack package. This is the
+// format for signature.yaml files.
+type PackageSignature struct {
+	// Digest is the package digest that was signed, e.g. sha256:abc. It must
+	// match the digest computed while unpacking the package.
+	Digest string `json:"digest"`
+
+	// Signatures of the Digest. Only one must be verified by a trusted key.
+	Signatures []Signature `json:"signatures"`
+}
+
+// Signature is a signature of a package digest.
+type Signature struct {
+	// KeyID optionally identifies the key that made the signature. It is
+	// informational only.
+	KeyID string `json:"keyID,omitempty"`
+
+	// Signature is the base64 encoded signature. Ed25519 keys sign the digest
+	// directly, while ECDSA and RSA (PKCS #1 v1.5) keys sign its SHA-256 hash.
+	Signature string `json:"signature"`
+}
+
+// ParsePublicKeys parses every PEM encoded PKIX public key in the supplied
+// bytes.
+func ParsePublicKeys(b []byte) ([]crypto.PublicKey, error) {
+	keys := []crypto.PublicKey{}
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			return keys, nil
+		}
+		if block.Type != pemTypePublicKey {
+			continue
+		}
+		k, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot parse public key")
+		}
+		keys = append(keys, k)
+	}
+}
+
+// LoadTrustedKeys loads the PEM encoded public keys from every file in dir.
+// Hidden files, such as those Kubernetes creates when mounting a ConfigMap,
+// are ignored.
+func LoadTrustedKeys(fs afero.Fs, dir string) ([]crypto.PublicKey, error) {
+	infos, err := afero.ReadDir(fs, dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot read trusted keys directory %q", dir)
+	}
+
+	keys := []crypto.PublicKey{}
+	for _, info := range infos {
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, info.Name())
+		b, err := afero.ReadFile(fs, path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot read trusted key %q", path)
+		}
+		k, err := ParsePublicKeys(b)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid trusted key %q", path)
+		}
+		keys = append(keys, k...)
+	}
+	return keys, nil
+}
+
+// signatureVerifier verifies the signature of a stack package against a set
+// of trusted keys.
+type signatureVerifier struct {
+	baseDir  string
+	keys     []crypto.PublicKey
+	required bool
+
+	sig *PackageSignature
+}
+
+// step records the signature.yaml at the base of the stack package.
+func (v *signatureVerifier) step() walker.Step {
+	return func(path string, b []byte) error {
+		if filepath.Dir(path) != v.baseDir {
+			return nil
+		}
+
+		sig := &PackageSignature{}
+		if err := yaml.Unmarshal(b, sig); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("invalid signature %q", path))
+		}
+		v.sig = sig
+		return nil
+	}
+}
+
+// Verify that the package signature covers the supplied digest and was made
+// by one of the trusted keys. Unsigned packages are only accepted when a
+// signature is not required. Signed packages are accepted without verification
+// when no keys are trusted and a signature is not required.
+func (v *signatureVerifier) Verify(digest string) error {
+	if v.required && len(v.keys) == 0 {
+		return errors.New("a signature is required but no keys are trusted")
+	}
+
+	if v.sig == nil {
+		if v.required {
+			return errors.New("stack package is not signed")
+		}
+		return nil
+	}
+
+	if len(v.keys) == 0 {
+		return nil
+	}
+
+	if v.sig.Digest != digest {
+		return errors.Errorf("signed digest %q does not match package digest %q", v.sig.Digest, digest)
+	}
+
+	for _, s := range v.sig.Signatures {
+		b, err := base64.StdEncoding.DecodeString(s.Signature)
+		if err != nil {
+			continue
+		}
+		for _, k := range v.keys {
+			if verifySignature(k, []byte(digest), b) {
+				return nil
+			}
+		}
+	}
+
+	return errors.New("stack package is not signed by a trusted key")
+}
+
+// ecdsaSignature is an ASN.1 encoded ECDSA signature.
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+func verifySignature(key crypto.PublicKey, msg, sig []byte) bool {
+	h := sha256.Sum256(msg)
+
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, msg, sig)
+	case *ecdsa.PublicKey:
+		es := &ecdsaSignature{}
+		if rest, err := asn1.Unmarshal(sig, es); err != nil || len(rest) != 0 {
+			return false
+		}
+		return ecdsa.Verify(k, h[:], es.R, es.S)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, h[:], sig) == nil
+	}
+	return false
+}
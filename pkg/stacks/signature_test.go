@@ -0,0 +1,282 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/crossplane/crossplane/pkg/stacks/walker"
+)
+
+const testDigest = "sha256:0123456789abcdef"
+
+func mustKey(t *testing.T, kind string) (crypto.Signer, crypto.PublicKey) {
+	t.Helper()
+	switch kind {
+	case "ed25519":
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return priv, pub
+	case "ecdsa":
+		priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return priv, priv.Public()
+	default:
+		priv, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return priv, priv.Public()
+	}
+}
+
+func mustSign(t *testing.T, s crypto.Signer, digest string) string {
+	t.Helper()
+	var sig []byte
+	var err error
+	if _, ok := s.(ed25519.PrivateKey); ok {
+		sig, err = s.Sign(rand.Reader, []byte(digest), crypto.Hash(0))
+	} else {
+		h := sha256.Sum256([]byte(digest))
+		sig, err = s.Sign(rand.Reader, h[:], crypto.SHA256)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+func mustPEM(t *testing.T, k crypto.PublicKey) []byte {
+	t.Helper()
+	b, err := x509.MarshalPKIXPublicKey(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: pemTypePublicKey, Bytes: b})
+}
+
+func TestSignatureVerifierVerify(t *testing.T) {
+	edPriv, edPub := mustKey(t, "ed25519")
+	ecPriv, ecPub := mustKey(t, "ecdsa")
+	rsaPriv, rsaPub := mustKey(t, "rsa")
+	_, otherPub := mustKey(t, "ed25519")
+
+	tests := []struct {
+		name string
+		v    *signatureVerifier
+		want error
+	}{
+		{
+			name: "Ed25519",
+			v: &signatureVerifier{
+				keys: []crypto.PublicKey{otherPub, edPub},
+				sig:  &PackageSignature{Digest: testDigest, Signatures: []Signature{{Signature: mustSign(t, edPriv, testDigest)}}},
+			},
+		},
+		{
+			name: "ECDSA",
+			v: &signatureVerifier{
+				keys: []crypto.PublicKey{ecPub},
+				sig:  &PackageSignature{Digest: testDigest, Signatures: []Signature{{Signature: mustSign(t, ecPriv, testDigest)}}},
+			},
+		},
+		{
+			name: "RSA",
+			v: &signatureVerifier{
+				keys:     []crypto.PublicKey{rsaPub},
+				required: true,
+				sig:      &PackageSignature{Digest: testDigest, Signatures: []Signature{{Signature: "bm90LWEtc2lnbmF0dXJl"}, {Signature: mustSign(t, rsaPriv, testDigest)}}},
+			},
+		},
+		{
+			name: "UntrustedKey",
+			v: &signatureVerifier{
+				keys: []crypto.PublicKey{otherPub},
+				sig:  &PackageSignature{Digest: testDigest, Signatures: []Signature{{Signature: mustSign(t, edPriv, testDigest)}}},
+			},
+			want: errors.New("stack package is not signed by a trusted key"),
+		},
+		{
+			name: "DigestMismatch",
+			v: &signatureVerifier{
+				keys: []crypto.PublicKey{edPub},
+				sig:  &PackageSignature{Digest: "sha256:other", Signatures: []Signature{{Signature: mustSign(t, edPriv, "sha256:other")}}},
+			},
+			want: errors.Errorf("signed digest %q does not match package digest %q", "sha256:other", testDigest),
+		},
+		{
+			name: "UnsignedNotRequired",
+			v:    &signatureVerifier{keys: []crypto.PublicKey{edPub}},
+		},
+		{
+			name: "UnsignedRequired",
+			v:    &signatureVerifier{keys: []crypto.PublicKey{edPub}, required: true},
+			want: errors.New("stack package is not signed"),
+		},
+		{
+			name: "RequiredWithoutKeys",
+			v:    &signatureVerifier{required: true},
+			want: errors.New("a signature is required but no keys are trusted"),
+		},
+		{
+			name: "SignedWithoutKeys",
+			v: &signatureVerifier{
+				sig: &PackageSignature{Digest: "sha256:other"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.v.Verify(testDigest)
+			if diff := cmp.Diff(tt.want, got, test.EquateErrors()); diff != "" {
+				t.Errorf("Verify() -want error, +got error:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLoadTrustedKeys(t *testing.T) {
+	_, edPub := mustKey(t, "ed25519")
+	_, ecPub := mustKey(t, "ecdsa")
+
+	fs := afero.NewMemMapFs()
+	_ = fs.MkdirAll("/keys/..data", 0755)
+	_ = afero.WriteFile(fs, "/keys/team-a", append(mustPEM(t, edPub), mustPEM(t, ecPub)...), 0644)
+	_ = afero.WriteFile(fs, "/keys/..data/team-a", []byte("ignored"), 0644)
+	_ = afero.WriteFile(fs, "/keys/.hidden", []byte("ignored"), 0644)
+
+	keys, err := LoadTrustedKeys(fs, "/keys")
+	if err != nil {
+		t.Fatalf("LoadTrustedKeys(): %s", err)
+	}
+	if diff := cmp.Diff([]crypto.PublicKey{edPub, ecPub}, keys); diff != "" {
+		t.Errorf("LoadTrustedKeys() -want, +got:\n%s", diff)
+	}
+}
+
+func TestUnpackSignature(t *testing.T) {
+	priv, pub := mustKey(t, "ed25519")
+	_, otherPub := mustKey(t, "ed25519")
+
+	stackFs := func(signature string) afero.Fs {
+		fs := afero.NewMemMapFs()
+		_ = fs.MkdirAll(simpleCrdDir, 0755)
+		_ = afero.WriteFile(fs, "ext-dir/app.yaml", []byte(simpleAppFile("Namespaced", "Application", true)), 0644)
+		_ = afero.WriteFile(fs, filepath.Join(simpleCrdDir, "mytype.v1alpha1.crd.yaml"), []byte(simpleCRDFile("mytype")), 0644)
+		if signature != "" {
+			_ = afero.WriteFile(fs, "ext-dir/signature.yaml", []byte(signature), 0644)
+		}
+		return fs
+	}
+
+	unpack := func(fs afero.Fs, opts ...UnpackOption) (string, error) {
+		out := &bytes.Buffer{}
+		rd := &walker.ResourceDir{Base: "ext-dir", Walker: afero.Afero{Fs: fs}}
+		err := Unpack(rd, out, "ext-dir", "Namespaced", "", logging.NewNopLogger(), opts...)
+		return out.String(), err
+	}
+
+	// Determine the digest of the stack package so that it can be signed.
+	out, err := unpack(stackFs(""))
+	if err != nil {
+		t.Fatalf("Unpack(): %s", err)
+	}
+	r, err := NewObjectReader(bytes.NewBufferString(out))
+	if err != nil {
+		t.Fatalf("NewObjectReader(): %s", err)
+	}
+	digest := ""
+	for {
+		o, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Read(): %s", err)
+		}
+		digest = o.GetAnnotations()[AnnotationPackageDigest]
+	}
+	signature := fmt.Sprintf("digest: %s\nsignatures:\n- signature: %s\n", digest, mustSign(t, priv, digest))
+
+	type want struct {
+		output bool
+		err    error
+	}
+
+	tests := []struct {
+		name string
+		fs   afero.Fs
+		opts []UnpackOption
+		want want
+	}{
+		{
+			name: "Signed",
+			fs:   stackFs(signature),
+			opts: []UnpackOption{WithTrustedKeys(pub), WithRequireSignature()},
+			want: want{output: true},
+		},
+		{
+			name: "SignedByUntrustedKey",
+			fs:   stackFs(signature),
+			opts: []UnpackOption{WithTrustedKeys(otherPub)},
+			want: want{err: errors.Wrap(errors.New("stack package is not signed by a trusted key"), "failed to verify Stack signature")},
+		},
+		{
+			name: "Unsigned",
+			fs:   stackFs(""),
+			opts: []UnpackOption{WithTrustedKeys(pub), WithRequireSignature()},
+			want: want{err: errors.Wrap(errors.New("stack package is not signed"), "failed to verify Stack signature")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := unpack(tt.fs, tt.opts...)
+			if diff := cmp.Diff(tt.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("Unpack() -want error, +got error:\n%s", diff)
+			}
+			if (got != "") != tt.want.output {
+				t.Errorf("Unpack(): want output %t, got %q", tt.want.output, got)
+			}
+		})
+	}
+}
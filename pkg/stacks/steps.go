@@ -17,8 +17,10 @@ limitations under the License.
 package stacks
 
 import (
+	"bytes"
 	"encoding/base64"
 	"fmt"
+	"io"
 	"mime"
 	"path/filepath"
 
@@ -26,33 +28,53 @@ import (
 	"github.com/pkg/errors"
 	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
 
 	"github.com/crossplane/crossplane/apis/stacks/v1alpha1"
 	"github.com/crossplane/crossplane/pkg/stacks/walker"
 )
 
-// installStep unmarshals install.yaml bytes to API machinery Unstructured which is set on the StackPackager
+// installStep unmarshals install.yaml bytes to API machinery Unstructured
+// which are set on the StackPackager. install.yaml may contain multiple YAML
+// documents.
 func installStep(sp StackPackager) walker.Step {
 	return func(path string, b []byte) error {
-		if len(b) == 0 {
-			// Installs are optional, so if one doesn't exist, we want to skip it.
-			// Ideally we'd log some output here for humans who are debugging
+		// Installs are optional, so if one doesn't exist, we want to skip it.
+		// Ideally we'd log some output here for humans who are debugging
+		return errors.Wrap(forEachDocument(b, sp.SetInstall), fmt.Sprintf("invalid install %q", path))
+	}
+}
+
+// forEachDocument calls fn with each non-empty document of a YAML or JSON
+// stream.
+func forEachDocument(b []byte, fn func(unstructured.Unstructured) error) error {
+	d := yamlutil.NewYAMLOrJSONDecoder(bytes.NewReader(b), 4096)
+	for {
+		u := unstructured.Unstructured{}
+		err := d.Decode(&u.Object)
+		if err == io.EOF {
 			return nil
 		}
-
-		install := unstructured.Unstructured{}
-		if err := yaml.Unmarshal(b, &install); err != nil {
-			return errors.Wrap(err, fmt.Sprintf("invalid install %q", path))
+		if err != nil {
+			return err
+		}
+		if len(u.Object) == 0 {
+			continue
+		}
+		if err := fn(u); err != nil {
+			return err
 		}
-
-		err := sp.SetInstall(install)
-		return err
 	}
 }
 
 // iconStep unmarshals icon.* bytes to IconSpec which is added to the StackPackager
-func iconStep(sp StackPackager) walker.Step {
+// Icons are embedded in annotations, so icons larger than maxSize bytes are
+// rejected. A zero maxSize is not enforced.
+func iconStep(sp StackPackager, maxSize int64) walker.Step {
 	return func(path string, b []byte) error {
+		if maxSize > 0 && int64(len(b)) > maxSize {
+			return errors.Errorf("icon %q is %d bytes, which exceeds the limit of %d bytes", path, len(b), maxSize)
+		}
 		mediaType := mime.TypeByExtension(filepath.Ext(path))
 		b64data := base64.StdEncoding.EncodeToString(b)
 		icon := v1alpha1.IconSpec{
@@ -78,6 +100,29 @@ func appStep(sp StackPackager) walker.Step {
 	}
 }
 
+// permissionsStep unmarshals permissions.yaml bytes to the PermissionsSpec the
+// stack declares, which is set on the StackPackager.
+func permissionsStep(sp StackPackager) walker.Step {
+	return func(path string, b []byte) error {
+		p := v1alpha1.PermissionsSpec{}
+		if err := yaml.Unmarshal(b, &p); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("invalid permissions %q", path))
+		}
+
+		for i, r := range p.Rules {
+			if len(r.Verbs) == 0 || len(r.Resources) == 0 {
+				return errors.New(fmt.Sprintf("invalid permissions %q: rule %d must specify verbs and resources", path, i))
+			}
+			if len(r.NonResourceURLs) > 0 {
+				return errors.New(fmt.Sprintf("invalid permissions %q: rule %d must not specify nonResourceURLs", path, i))
+			}
+		}
+
+		sp.SetPermissions(p)
+		return nil
+	}
+}
+
 // behaviorStep unmarshals behavior.yaml bytes
 func behaviorStep(sp StackPackager) walker.Step {
 	return func(path string, b []byte) error {
@@ -101,11 +146,14 @@ func behaviorStep(sp StackPackager) walker.Step {
 }
 
 // crdStep unmarshals crd.yaml bytes to a Kubernetes CRD which is added to the StackPackager
+// Both apiextensions.k8s.io/v1beta1 and apiextensions.k8s.io/v1 CRDs are supported.
 func crdStep(sp StackPackager) walker.Step {
 	return func(path string, b []byte) error {
-		crd := &apiextensions.CustomResourceDefinition{}
-
-		if err := yaml.Unmarshal(b, crd); err != nil {
+		crd, err := decodeCRD(b)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("invalid crd %q", path))
+		}
+		if err := validateCRD(crd); err != nil {
 			return errors.Wrap(err, fmt.Sprintf("invalid crd %q", path))
 		}
 
@@ -116,8 +164,7 @@ func crdStep(sp StackPackager) walker.Step {
 			return errors.New(fmt.Sprintf("Stack CRD %q must be namespaced scope", path))
 		}
 
-		sp.AddCRD(filepath.Dir(path), crd)
-		return nil
+		return errors.Wrap(sp.AddCRD(filepath.Dir(path), crd), fmt.Sprintf("invalid crd %q", path))
 	}
 }
 
@@ -17,18 +17,31 @@ limitations under the License.
 package stacks
 
 import (
+	"fmt"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/crossplane/crossplane/apis/stacks/v1alpha1"
 )
 
 func TestIconStep(t *testing.T) {
 	sp := NewStackPackage("/", "crossplane/ts-controller:0.0.0", logging.NewLogrLogger(zap.Logger(true)))
-	step := iconStep(sp)
+	step := iconStep(sp, DefaultMaxIconSize)
 	step("/icon.png", []byte("base64me"))
 
+	want := errors.New(`icon "/large.icon.png" is 9 bytes, which exceeds the limit of 8 bytes`)
+	if diff := cmp.Diff(want, iconStep(sp, 8)("/large.icon.png", []byte("base64me!")), test.EquateErrors()); diff != "" {
+		t.Errorf("iconStep(...): -want error, +got error:\n%s", diff)
+	}
+
 	if len(sp.Icons) != 1 {
 		t.Errorf("iconStep(...); expected 1 icon")
 	}
@@ -56,3 +69,107 @@ func TestIconStep(t *testing.T) {
 		}
 	}
 }
+
+func TestInstallStep(t *testing.T) {
+	deployment := func(name string) string {
+		return fmt.Sprintf(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: %s
+spec:
+  template:
+    spec:
+      containers:
+      - name: %s
+        image: crossplane/sample-stack:latest
+`, name, name)
+	}
+	job := func(name string) string {
+		return fmt.Sprintf(`apiVersion: batch/v1
+kind: Job
+metadata:
+  name: %s
+spec:
+  template:
+    spec:
+      restartPolicy: Never
+      containers:
+      - name: %s
+        image: crossplane/sample-stack:latest
+`, name, name)
+	}
+	container := func(name string) corev1.PodTemplateSpec {
+		return corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: name, Image: "crossplane/sample-stack:latest"}}}}
+	}
+
+	type want struct {
+		controller v1alpha1.ControllerSpec
+		err        error
+	}
+
+	tests := []struct {
+		name    string
+		install string
+		want    want
+	}{
+		{
+			name:    "Empty",
+			install: "",
+			want:    want{},
+		},
+		{
+			name:    "SingleDeployment",
+			install: deployment("controller"),
+			want: want{controller: v1alpha1.ControllerSpec{
+				Deployment: &v1alpha1.ControllerDeployment{Spec: appsv1.DeploymentSpec{Template: container("controller")}},
+			}},
+		},
+		{
+			name:    "DeploymentsAndJobs",
+			install: job("migrate") + "---\n" + deployment("controller") + "---\n" + deployment("webhook"),
+			want: want{controller: v1alpha1.ControllerSpec{
+				Deployment: &v1alpha1.ControllerDeployment{Spec: appsv1.DeploymentSpec{Template: container("controller")}},
+				Deployments: []v1alpha1.ControllerDeployment{
+					{Name: "webhook", Spec: appsv1.DeploymentSpec{Template: container("webhook")}},
+				},
+				Jobs: []v1alpha1.ControllerJob{
+					{Name: "migrate", Spec: batchv1.JobSpec{Template: func() corev1.PodTemplateSpec {
+						p := container("migrate")
+						p.Spec.RestartPolicy = corev1.RestartPolicyNever
+						return p
+					}()}},
+				},
+			}},
+		},
+		{
+			name:    "DuplicateDeployment",
+			install: deployment("controller") + "---\n" + deployment("webhook") + "---\n" + deployment("webhook"),
+			want: want{
+				err: errors.Wrap(errors.New(`install Deployment "webhook" is not unique`), `invalid install "/install.yaml"`),
+			},
+		},
+		{
+			name:    "UnsupportedKind",
+			install: "apiVersion: v1\nkind: Service\nmetadata:\n  name: webhook\n",
+			want: want{
+				err: errors.Wrap(errors.New(`install kind "Service" is not supported, must be Deployment or Job`), `invalid install "/install.yaml"`),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sp := NewStackPackage("/", "crossplane/sample-stack:latest", logging.NewNopLogger())
+			err := installStep(sp)("/install.yaml", []byte(tt.install))
+			if diff := cmp.Diff(tt.want.err, err, test.EquateErrors()); diff != "" {
+				t.Fatalf("installStep(...): -want error, +got error:\n%s", diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.want.controller, sp.Stack.Spec.Controller); diff != "" {
+				t.Errorf("installStep(...): -want, +got:\n%s", diff)
+			}
+		})
+	}
+}
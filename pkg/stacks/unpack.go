@@ -17,6 +17,7 @@ limitations under the License.
 package stacks
 
 import (
+	"crypto"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -29,14 +30,17 @@ import (
 	"github.com/ghodss/yaml"
 	"github.com/pkg/errors"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
 	"github.com/crossplane/crossplane/apis/stacks/v1alpha1"
 	"github.com/crossplane/crossplane/pkg/stacks/walker"
 )
@@ -47,6 +51,12 @@ const (
 	groupFileName           = "group.yaml"
 	appFileName             = "app.yaml"
 	behaviorFileName        = "behavior.yaml"
+	permissionsFileName     = "permissions.yaml"
+
+	// PrimaryControllerName is the name, relative to its Stack, of the
+	// primary controller Deployment of a Stack. The Deployments and Jobs of a
+	// Stack are named after the Stack, e.g. mystack-controller.
+	PrimaryControllerName = "controller"
 
 	// StackDefinitionNamespaceEnv is an environment variable used in the
 	// StackDefinition controllers deployment to find the StackDefinition
@@ -56,6 +66,10 @@ const (
 	// StackDefinition controllers deployment to find the StackDefinition
 	StackDefinitionNameEnv = "SD_NAME"
 
+	// RegistryDirName is the directory of a stack image that contains the
+	// stack package.
+	RegistryDirName = "/.registry"
+
 	// StackImageEnv is an environment variable used by the unpack job to select
 	// the stack version if there is no version provided in the application
 	// metadata.
@@ -87,6 +101,10 @@ const (
 	annotationResourceOverview      = "stacks.crossplane.io/resource-overview"
 	annotationResourceOverviewShort = "stacks.crossplane.io/resource-overview-short"
 
+	// AnnotationPackageDigest is the content-addressed digest of the stack
+	// package that a Stack, StackDefinition, or CRD was unpacked from.
+	AnnotationPackageDigest = "stacks.crossplane.io/package-digest"
+
 	// LabelKubernetesManagedBy identifies the resource manager
 	LabelKubernetesManagedBy = "app.kubernetes.io/managed-by"
 
@@ -106,7 +124,12 @@ var (
 // StackResource provides the Stack metadata for a CRD. This is the format for resource.yaml files.
 type StackResource struct {
 	// ID refers to the CRD Kind
-	ID            string `json:"id"`
+	ID string `json:"id"`
+
+	// CRD optionally refers to the CRD by name, e.g.
+	// mytypes.samples.upbound.io. A resource that refers to a CRD applies
+	// to it wherever the resource is in the stack package.
+	CRD           string `json:"crd,omitempty"`
 	Title         string `json:"title"`
 	TitlePlural   string `json:"titlePlural"`
 	OverviewShort string `json:"overviewShort,omitempty"`
@@ -130,6 +153,7 @@ type StackPackager interface {
 	SetBehavior(v1alpha1.Behavior)
 	SetInstall(unstructured.Unstructured) error
 	SetRBAC(v1alpha1.PermissionsSpec)
+	SetPermissions(v1alpha1.PermissionsSpec)
 
 	GotApp() bool
 	IsNamespaced() bool
@@ -139,8 +163,19 @@ type StackPackager interface {
 	AddResource(string, StackResource)
 	AddIcon(string, v1alpha1.IconSpec)
 	AddUI(string, string)
-	AddCRD(string, *apiextensions.CustomResourceDefinition)
-
+	AddAppLocale(string, v1alpha1.AppMetadataSpec)
+	AddGroupLocale(string, string, StackGroup)
+	AddResourceLocale(string, string, StackResource)
+	AddCRD(string, *apiextensions.CustomResourceDefinition) error
+	AddExample(string, unstructured.Unstructured)
+	AddWebhookConfiguration(unstructured.Unstructured) error
+	AddObject(runtime.Object)
+
+	AddAnnotations(map[string]string)
+	AddCRDAnnotations(schema.GroupKind, map[string]string) error
+	GetCRD(schema.GroupKind) (*apiextensions.CustomResourceDefinition, bool)
+
+	Objects() []runtime.Object
 	Yaml() (string, error)
 }
 
@@ -156,9 +191,8 @@ type StackPackage struct {
 	// StackDefinition is the Kubernetes API Stack representation
 	StackDefinition v1alpha1.StackDefinition
 
-	// CRDs map CRD files contained within a Stack by their GVK
+	// CRDs map CRD files contained within a Stack by their GroupKind
 	CRDs map[string]apiextensions.CustomResourceDefinition
-	// TODO(displague) CRD "Version" has been deprecated in favor of multiple "Versions"
 
 	// CRDPaths map CRDs to the path they were found in
 	// Stack resources will be paired based on their path and the CRD path.
@@ -171,12 +205,32 @@ type StackPackage struct {
 	Resources map[string]StackResource
 	UISchemas map[string]string
 
+	// AppLocales, GroupLocales, and ResourceLocales are localised metadata,
+	// indexed by locale. Localised groups are indexed by the filepath where
+	// they were found, and localised resources by the filepath of the
+	// resource.yaml they localise.
+	AppLocales      map[string]v1alpha1.AppMetadataSpec
+	GroupLocales    map[string]map[string]StackGroup
+	ResourceLocales map[string]map[string]StackResource
+
+	// Examples are indexed by the filepath where they were found. A file may
+	// contain more than one example.
+	Examples map[string][]unstructured.Unstructured
+
+	// Objects are emitted alongside the Stack and its CRDs, e.g. by
+	// registered unpack handlers.
+	ExtraObjects []runtime.Object
+
 	// appSet indicates if a App has been assigned through SetApp (for use by GotApp)
 	appSet bool
 
 	// behaviorSet indicates if a Behavior has been assigned through SetBehavior (for use by GotBehavior)
 	behaviorSet bool
 
+	// permissions are the permissions declared by the permissions.yaml file
+	// of the stack, if any.
+	permissions *v1alpha1.PermissionsSpec
+
 	// baseDir is the directory that serves as the base of the stack package (it should be absolute)
 	baseDir string
 
@@ -197,31 +251,83 @@ func (sp *StackPackage) Yaml() (string, error) {
 	builder := &strings.Builder{}
 	builder.WriteString(yamlSeparator)
 
+	for _, o := range sp.Objects() {
+		if err := writeYaml(builder, o, o.GetObjectKind().GroupVersionKind().Kind); err != nil {
+			return "", err
+		}
+	}
+
+	return builder.String(), nil
+}
+
+// Objects returns the objects of the Stack Package in the order they should be
+// emitted; all CRDs managed by the Stack, followed by any extra objects, and
+// finally the Stack (or StackDefinition) itself. The Stack is emitted last
+// because its creation indicates that the install is complete.
+func (sp *StackPackage) Objects() []runtime.Object {
+	objs := []runtime.Object{}
+
 	// For testing, we want a predictable output order for CRDs
 	orderedKeys := orderStackCRDKeys(sp.CRDs)
 
 	for _, k := range orderedKeys {
 		crd := sp.CRDs[k]
-		if err := writeYaml(builder, crd, "CRD"); err != nil {
-			return "", err
-		}
+		objs = append(objs, &crd)
 	}
 
+	objs = append(objs, sp.ExtraObjects...)
+
+	if s := sp.stackObject(); s != nil {
+		objs = append(objs, s)
+	}
+
+	return objs
+}
+
+// stackObject returns the Stack, or StackDefinition, of the Stack Package. It
+// returns nil if the package has neither.
+func (sp *StackPackage) stackObject() runtime.Object {
 	if sp.GotBehavior() {
 		sp.Stack.DeepCopyIntoStackDefinition(&sp.StackDefinition)
 
 		// New Format, using 'behavior.yaml'
-		if err := writeYaml(builder, sp.StackDefinition, "StackDefinition"); err != nil {
-			return "", err
-		}
-	} else if sp.GotApp() {
+		return &sp.StackDefinition
+	}
+	if sp.GotApp() {
 		// Old Format, using 'app.yaml'
-		if err := writeYaml(builder, sp.Stack, "Stack"); err != nil {
-			return "", err
+		return &sp.Stack
+	}
+	return nil
+}
+
+// writeObjects writes the objects of the Stack Package to the supplied
+// ObjectWriter in the order returned by Objects, then closes it. Each object is
+// written as soon as it is retrieved, and each CRD and extra object is released
+// once it has been written, so that the package is not held in memory
+// alongside its output.
+func (sp *StackPackage) writeObjects(w ObjectWriter) error {
+	for _, k := range orderStackCRDKeys(sp.CRDs) {
+		crd := sp.CRDs[k]
+		if err := w.Write(&crd); err != nil {
+			return err
 		}
+		delete(sp.CRDs, k)
 	}
 
-	return builder.String(), nil
+	for i := range sp.ExtraObjects {
+		if err := w.Write(sp.ExtraObjects[i]); err != nil {
+			return err
+		}
+		sp.ExtraObjects[i] = nil
+	}
+	sp.ExtraObjects = nil
+
+	if s := sp.stackObject(); s != nil {
+		if err := w.Write(s); err != nil {
+			return err
+		}
+	}
+	return w.Close()
 }
 
 // IsNamespaced reports if the StackPackage is Namespaced (not Cluster Scoped)
@@ -324,21 +430,58 @@ func (sp *StackPackage) SetBehavior(sd v1alpha1.Behavior) {
 	sp.behaviorSet = true
 }
 
-// SetInstall sets the Stack controller's install method from a Deployment or Job
+// SetInstall adds a Deployment or Job from install.yaml to the Stack's
+// controllers. The first Deployment is the Stack's primary controller. Any
+// further Deployments, and all Jobs, must be uniquely named.
 func (sp *StackPackage) SetInstall(install unstructured.Unstructured) error {
-	if install.GetKind() == "Deployment" {
+	b, err := install.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	c := &sp.Stack.Spec.Controller
+	switch install.GetKind() {
+	case "Deployment":
 		deployment := appsv1.Deployment{}
-		b, err := install.MarshalJSON()
-		if err != nil {
+		if err := json.Unmarshal(b, &deployment); err != nil {
 			return err
 		}
-		if err := json.Unmarshal(b, &deployment); err != nil {
+
+		if c.Deployment == nil {
+			c.Deployment = &v1alpha1.ControllerDeployment{
+				Spec: deployment.Spec,
+			}
+			return nil
+		}
+
+		name := deployment.GetName()
+		if name == "" || name == PrimaryControllerName {
+			return errors.Errorf("additional install Deployments must be named, and may not be named %q", PrimaryControllerName)
+		}
+		for _, d := range c.Deployments {
+			if d.Name == name {
+				return errors.Errorf("install Deployment %q is not unique", name)
+			}
+		}
+		c.Deployments = append(c.Deployments, v1alpha1.ControllerDeployment{Name: name, Spec: deployment.Spec})
+	case "Job":
+		job := batchv1.Job{}
+		if err := json.Unmarshal(b, &job); err != nil {
 			return err
 		}
 
-		sp.Stack.Spec.Controller.Deployment = &v1alpha1.ControllerDeployment{
-			Spec: deployment.Spec,
+		name := job.GetName()
+		if name == "" {
+			return errors.New("install Jobs must be named")
+		}
+		for _, j := range c.Jobs {
+			if j.Name == name {
+				return errors.Errorf("install Job %q is not unique", name)
+			}
 		}
+		c.Jobs = append(c.Jobs, v1alpha1.ControllerJob{Name: name, Spec: job.Spec})
+	default:
+		return errors.Errorf("install kind %q is not supported, must be Deployment or Job", install.GetKind())
 	}
 	return nil
 }
@@ -348,6 +491,12 @@ func (sp *StackPackage) SetRBAC(rbac v1alpha1.PermissionsSpec) {
 	sp.Stack.Spec.Permissions = rbac
 }
 
+// SetPermissions sets the permissions that the Stack declares it needs, in
+// place of the default permissions granted to every Stack.
+func (sp *StackPackage) SetPermissions(p v1alpha1.PermissionsSpec) {
+	sp.permissions = p.DeepCopy()
+}
+
 // GotApp reveals if the AppMetadataSpec has been set
 func (sp *StackPackage) GotApp() bool {
 	return sp.appSet
@@ -394,7 +543,7 @@ func (sp *StackPackage) AddIcon(path string, icon v1alpha1.IconSpec) {
 
 // AddCRD appends a CRD to the CRDs of this StackPackage
 // The CRD will be annotated before being added and the Stack will track ownership of this CRD.
-func (sp *StackPackage) AddCRD(path string, crd *apiextensions.CustomResourceDefinition) {
+func (sp *StackPackage) AddCRD(path string, crd *apiextensions.CustomResourceDefinition) error {
 	if crd.ObjectMeta.Labels == nil {
 		crd.ObjectMeta.Labels = map[string]string{}
 	}
@@ -409,29 +558,83 @@ func (sp *StackPackage) AddCRD(path string, crd *apiextensions.CustomResourceDef
 		crd.ObjectMeta.Labels[LabelScope] = EnvironmentScoped
 	}
 
-	crdGVK := schema.GroupVersionKind{
-		Group:   crd.Spec.Group,
-		Version: crd.Spec.Version,
-		Kind:    crd.Spec.Names.Kind,
+	// CRDs are tracked by group and kind, which is what identifies them in
+	// the API server, rather than by any one of their versions. All versions
+	// of a kind must be defined by a single CRD.
+	gk := crdGroupKind(crd).String()
+	if existing, exists := sp.CRDPaths[gk]; exists {
+		return errors.Errorf("CRD %q is already defined in %q", gk, existing)
 	}
 
 	// TODO(displague) store crd and path in a single struct
-	sp.CRDs[crdGVK.String()] = *crd
-	sp.CRDPaths[crdGVK.String()] = path
+	sp.CRDs[gk] = *crd
+	sp.CRDPaths[gk] = path
+
+	// The Stack owns every served version of the CRD
+	for _, v := range crdServedVersions(crd) {
+		crdTypeMeta := metav1.TypeMeta{
+			Kind:       crd.Spec.Names.Kind,
+			APIVersion: schema.GroupVersion{Group: crd.Spec.Group, Version: v}.String(),
+		}
+		if !containsTypeMeta(sp.Stack.Spec.CRDs, crdTypeMeta) {
+			sp.Stack.Spec.CRDs = append(sp.Stack.Spec.CRDs, crdTypeMeta)
+		}
+	}
+	return nil
+}
+
+// AddExample adds an example resource to the StackPackage
+func (sp *StackPackage) AddExample(path string, u unstructured.Unstructured) {
+	sp.Examples[path] = append(sp.Examples[path], u)
+}
 
-	crdTypeMeta := metav1.TypeMeta{
-		Kind:       crdGVK.Kind,
-		APIVersion: crdGVK.GroupVersion().String(),
+// AddObject adds an extra object to be emitted with the Stack.
+func (sp *StackPackage) AddObject(o runtime.Object) {
+	sp.ExtraObjects = append(sp.ExtraObjects, o)
+}
+
+// AddAnnotations adds the supplied annotations to the Stack (or
+// StackDefinition).
+func (sp *StackPackage) AddAnnotations(a map[string]string) {
+	meta.AddAnnotations(&sp.Stack, a)
+	meta.AddAnnotations(&sp.StackDefinition, a)
+}
+
+// AddCRDAnnotations adds the supplied annotations to the CRD of the supplied
+// group and kind.
+func (sp *StackPackage) AddCRDAnnotations(gk schema.GroupKind, a map[string]string) error {
+	crd, ok := sp.CRDs[gk.String()]
+	if !ok {
+		return errors.Errorf("stack does not contain CRD %q", gk)
 	}
+	meta.AddAnnotations(&crd, a)
+	sp.CRDs[gk.String()] = crd
+	return nil
+}
 
-	sp.Stack.Spec.CRDs = append(sp.Stack.Spec.CRDs, crdTypeMeta)
+// GetCRD returns a copy of the CRD of the supplied group and kind, if the
+// stack contains it.
+func (sp *StackPackage) GetCRD(gk schema.GroupKind) (*apiextensions.CustomResourceDefinition, bool) {
+	crd, ok := sp.CRDs[gk.String()]
+	if !ok {
+		return nil, false
+	}
+	return crd.DeepCopy(), true
+}
 
+func containsTypeMeta(list v1alpha1.CRDList, tm metav1.TypeMeta) bool {
+	for _, t := range list {
+		if t == tm {
+			return true
+		}
+	}
+	return false
 }
 
 // applyAnnotations walks each discovered CRD annotates that CRD with the nearest metadata file
 func (sp *StackPackage) applyAnnotations() {
-	for gvk, crdPath := range sp.CRDPaths {
-		crd := sp.CRDs[gvk]
+	for gk, crdPath := range sp.CRDPaths {
+		crd := sp.CRDs[gk]
 
 		crd.ObjectMeta.Annotations[annotationStackTitle] = sp.Stack.Spec.AppMetadataSpec.Title
 
@@ -439,7 +642,22 @@ func (sp *StackPackage) applyAnnotations() {
 		sp.applyIconAnnotations(crdPath, &crd)
 		sp.applyResourceAnnotations(crdPath, &crd)
 		sp.applyUISchemaAnnotations(crdPath, &crd)
+		sp.applyLocaleAnnotations(crdPath, &crd)
+	}
+	sp.applyStackLocaleAnnotations()
+}
 
+// applyDigest annotates the Stack, StackDefinition, and every CRD with the
+// digest of the stack package contents
+func (sp *StackPackage) applyDigest(digest string) {
+	a := map[string]string{AnnotationPackageDigest: digest}
+	meta.AddAnnotations(&sp.Stack, a)
+	meta.AddAnnotations(&sp.StackDefinition, a)
+
+	for gk := range sp.CRDs {
+		crd := sp.CRDs[gk]
+		meta.AddAnnotations(&crd, a)
+		sp.CRDs[gk] = crd
 	}
 }
 
@@ -455,7 +673,10 @@ func generateRBAC(apiKinds []string, apiGroup string) rbacv1.PolicyRule {
 	}
 }
 
-// applyRules adds RBAC rules to the Stack for standard Stack needs and to fulfill dependencies
+// applyRules adds RBAC rules to the Stack for standard Stack needs and to fulfill dependencies.
+// If the Stack declares the permissions it needs in a permissions.yaml file
+// they are used in place of the standard and dependency rules. Owned CRDs are
+// always granted all verbs.
 func (sp *StackPackage) applyRules() error {
 	core := rbacv1.PolicyRule{
 		APIGroups:     []string{""},
@@ -468,6 +689,12 @@ func (sp *StackPackage) applyRules() error {
 	rbac := v1alpha1.PermissionsSpec{Rules: []rbacv1.PolicyRule{
 		core,
 	}}
+	if sp.permissions != nil {
+		if err := sp.checkPermissions(); err != nil {
+			return err
+		}
+		rbac.Rules = append([]rbacv1.PolicyRule{}, sp.permissions.Rules...)
+	}
 
 	// owned CRD rules
 	orderedKeys := orderStackCRDKeys(sp.CRDs)
@@ -475,13 +702,12 @@ func (sp *StackPackage) applyRules() error {
 		crd := sp.CRDs[k]
 		kinds := []string{crd.Spec.Names.Plural}
 
-		if subs := crd.Spec.Subresources; subs != nil {
-			if subs.Status != nil {
-				kinds = append(kinds, crd.Spec.Names.Plural+"/status")
-			}
-			if subs.Scale != nil {
-				kinds = append(kinds, crd.Spec.Names.Plural+"/scale")
-			}
+		status, scale := crdSubresources(&crd)
+		if status {
+			kinds = append(kinds, crd.Spec.Names.Plural+"/status")
+		}
+		if scale {
+			kinds = append(kinds, crd.Spec.Names.Plural+"/scale")
 		}
 		rule := generateRBAC(kinds, crd.Spec.Group)
 		rbac.Rules = append(rbac.Rules, rule)
@@ -491,15 +717,18 @@ func (sp *StackPackage) applyRules() error {
 	for _, dependency := range sp.Stack.Spec.DependsOn {
 		crd := dependency.CustomResourceDefinition
 		if crd != "" {
-			// versions are not allowed in RBAC PolicyRules, remove any trailing version denoted by a "/"
+			// versions are not allowed in RBAC PolicyRules, so any trailing
+			// version denoted by a "/" is ignored
 			// e.g., kind.group.com/v1alpha1 -> kind.group.com
-			if i := strings.Index(crd, "/"); i != -1 {
-				crd = crd[:i]
+			gk, _, err := ParseCRDDependency(crd)
+			if err != nil {
+				return err
 			}
 
-			gk := schema.ParseGroupKind(crd)
-			if gk.Group == "" || gk.Kind == "" {
-				return errors.New(fmt.Sprintf("cannot parse CustomResourceDefinition %q as Kind and Group", crd))
+			// Stacks that declare their permissions must declare the verbs
+			// they need on the CRDs they depend on.
+			if sp.permissions != nil {
+				continue
 			}
 			rule := generateRBAC([]string{gk.Kind}, gk.Group)
 			rbac.Rules = append(rbac.Rules, rule)
@@ -510,6 +739,78 @@ func (sp *StackPackage) applyRules() error {
 	return nil
 }
 
+// checkPermissions returns an error if the permissions declared by the Stack
+// grant access to anything other than configmaps, events, and secrets in the
+// core API group, and the CRDs the Stack owns or depends on.
+func (sp *StackPackage) checkPermissions() error {
+	allowed := map[string]map[string]bool{
+		"": {"configmaps": true, "events": true, "secrets": true},
+	}
+	allow := func(group string, resources ...string) {
+		if allowed[group] == nil {
+			allowed[group] = map[string]bool{}
+		}
+		for _, r := range resources {
+			allowed[group][r] = true
+		}
+	}
+
+	for _, crd := range sp.CRDs {
+		p := crd.Spec.Names.Plural
+		allow(crd.Spec.Group, p, p+"/status", p+"/scale")
+	}
+	for _, dependency := range sp.Stack.Spec.DependsOn {
+		if dependency.CustomResourceDefinition == "" {
+			continue
+		}
+		gk, _, err := ParseCRDDependency(dependency.CustomResourceDefinition)
+		if err != nil {
+			return err
+		}
+		// Built-in API groups, such as apps or rbac.authorization.k8s.io,
+		// cannot be depended on as though they were CRDs.
+		if isBuiltInGroup(gk.Group) {
+			return errors.Errorf("invalid permissions: dependency %q is not a CRD", dependency.CustomResourceDefinition)
+		}
+		allow(gk.Group, gk.Kind)
+	}
+
+	for i, r := range sp.permissions.Rules {
+		for _, g := range r.APIGroups {
+			for _, res := range r.Resources {
+				if !allowed[g][res] && !allowed[g][rbacv1.ResourceAll] {
+					return errors.Errorf("invalid permissions: rule %d grants access to %q in API group %q, which the Stack does not own or depend on", i, res, g)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// isBuiltInGroup returns true if the supplied API group may not be used by a
+// CRD, because it is not a domain or is reserved for Kubernetes.
+func isBuiltInGroup(group string) bool {
+	return !strings.Contains(group, ".") ||
+		group == "k8s.io" || strings.HasSuffix(group, ".k8s.io") ||
+		group == "kubernetes.io" || strings.HasSuffix(group, ".kubernetes.io")
+}
+
+// permissionWarnings returns a warning if the Stack does not declare the
+// permissions it needs, and will therefore be granted broad permissions, or
+// for each declared rule that requests wildcard verbs or resources.
+func (sp *StackPackage) permissionWarnings() []string {
+	if sp.permissions == nil {
+		return []string{fmt.Sprintf("Stack does not contain a %s file; it will be granted all verbs on configmaps, events, secrets, and the CRDs it depends on", permissionsFileName)}
+	}
+	warnings := []string{}
+	for i, r := range sp.permissions.Rules {
+		if hasWildcard(r.Verbs) || hasWildcard(r.Resources) {
+			warnings = append(warnings, fmt.Sprintf("rule %d requests wildcard verbs or resources: %s", i, describeRule(r)))
+		}
+	}
+	return warnings
+}
+
 // NewStackPackage returns a StackPackage with maps created
 func NewStackPackage(baseDir, tmplCtrlImage string, log logging.Logger) *StackPackage {
 	// create a Stack record and populate it with the relevant package contents
@@ -533,6 +834,10 @@ func NewStackPackage(baseDir, tmplCtrlImage string, log logging.Logger) *StackPa
 		Icons:                map[string]*v1alpha1.IconSpec{},
 		Resources:            map[string]StackResource{},
 		UISchemas:            map[string]string{},
+		AppLocales:           map[string]v1alpha1.AppMetadataSpec{},
+		GroupLocales:         map[string]map[string]StackGroup{},
+		ResourceLocales:      map[string]map[string]StackResource{},
+		Examples:             map[string][]unstructured.Unstructured{},
 		baseDir:              baseDir,
 		defaultTmplCtrlImage: tmplCtrlImage,
 		log:                  log,
@@ -541,26 +846,119 @@ func NewStackPackage(baseDir, tmplCtrlImage string, log logging.Logger) *StackPa
 	return sp
 }
 
+// Default limits on the stack package content read by Unpack.
+const (
+	DefaultMaxPackageSize = 64 << 20
+	DefaultMaxFileSize    = 16 << 20
+	DefaultMaxIconSize    = 128 << 10
+)
+
+// UnpackLimits constrain the size of the stack package content read by
+// Unpack, so that a pathological package cannot exhaust the memory of the
+// unpack job. A zero limit is not enforced.
+type UnpackLimits struct {
+	// MaxPackageSize is the maximum size in bytes of all package files
+	// combined.
+	MaxPackageSize int64
+
+	// MaxFileSize is the maximum size in bytes of any one package file.
+	MaxFileSize int64
+
+	// MaxIconSize is the maximum size in bytes of an icon file. Icons are
+	// embedded in the annotations of the Stack and its CRDs.
+	MaxIconSize int64
+}
+
+// DefaultUnpackLimits returns the limits Unpack enforces by default.
+func DefaultUnpackLimits() UnpackLimits {
+	return UnpackLimits{
+		MaxPackageSize: DefaultMaxPackageSize,
+		MaxFileSize:    DefaultMaxFileSize,
+		MaxIconSize:    DefaultMaxIconSize,
+	}
+}
+
+// UnpackOption modifies the behavior of Unpack.
+type UnpackOption func(*unpackOptions)
+
+type unpackOptions struct {
+	outputFormat     string
+	trustedKeys      []crypto.PublicKey
+	requireSignature bool
+	limits           UnpackLimits
+}
+
+// WithOutputFormat configures the format Unpack writes its output in. YAML is
+// written by default.
+func WithOutputFormat(format string) UnpackOption {
+	return func(o *unpackOptions) {
+		o.outputFormat = format
+	}
+}
+
+// WithTrustedKeys configures the keys Unpack trusts to sign stack packages. A
+// package that includes a signature must be signed by one of these keys.
+func WithTrustedKeys(keys ...crypto.PublicKey) UnpackOption {
+	return func(o *unpackOptions) {
+		o.trustedKeys = append(o.trustedKeys, keys...)
+	}
+}
+
+// WithRequireSignature configures Unpack to refuse stack packages that are not
+// signed by a trusted key.
+func WithRequireSignature() UnpackOption {
+	return func(o *unpackOptions) {
+		o.requireSignature = true
+	}
+}
+
+// WithLimits configures the size limits Unpack enforces on stack package
+// content. DefaultUnpackLimits are enforced by default.
+func WithLimits(l UnpackLimits) UnpackOption {
+	return func(o *unpackOptions) {
+		o.limits = l
+	}
+}
+
 // Unpack writes to `out` using custom Step functions against a ResourceWalker
 // The custom Steps process Stack resource files and the output is multiple
-// YAML documents.  CRDs container within the stack will be annotated based
-// on the other Stack resource files contained within the Stack.
+// objects in the configured output format, preceded by a header identifying
+// that format. CRDs container within the stack will be annotated based on the
+// other Stack resource files contained within the Stack.
 //
 // baseDir is expected to be an absolute path, i.e. have a root to the path,
 // at the very least "/".
-func Unpack(rw walker.ResourceWalker, out io.StringWriter, baseDir, permissionScope string, tsControllerImage string, log logging.Logger) error {
+func Unpack(rw walker.ResourceWalker, out io.Writer, baseDir, permissionScope string, tsControllerImage string, log logging.Logger, opts ...UnpackOption) error {
+	o := &unpackOptions{outputFormat: OutputFormatYAML, limits: DefaultUnpackLimits()}
+	for _, fn := range opts {
+		fn(o)
+	}
+	if ls, ok := rw.(walker.LimitSetter); ok {
+		ls.SetLimits(walker.Limits{MaxFileSize: o.limits.MaxFileSize, MaxTotalSize: o.limits.MaxPackageSize})
+	}
+
 	l := log.WithValues("operation", "unpack")
 	sp := NewStackPackage(filepath.Clean(baseDir), tsControllerImage, l)
-
-	rw.AddStep(appFileName, appStep(sp))
-	rw.AddStep(behaviorFileName, behaviorStep(sp))
-	rw.AddStep(groupFileName, groupStep(sp))
-
-	rw.AddStep(resourceFileNamePattern, resourceStep(sp))
-	rw.AddStep(crdFileNamePattern, crdStep(sp))
-	rw.AddStep(installFileName, installStep(sp))
-	rw.AddStep(iconFileNamePattern, iconStep(sp))
-	rw.AddStep(uiSchemaFileNamePattern, uiStep(sp))
+	d := newPackageDigest(filepath.Clean(baseDir))
+	v := &signatureVerifier{baseDir: filepath.Clean(baseDir), keys: o.trustedKeys, required: o.requireSignature}
+
+	rw.AddStep(appFileName, d.yamlStep(appStep(sp)))
+	rw.AddStep(behaviorFileName, d.yamlStep(behaviorStep(sp)))
+	rw.AddStep(permissionsFileName, d.yamlStep(permissionsStep(sp)))
+	rw.AddStep(groupFileName, d.yamlStep(groupStep(sp)))
+	rw.AddStep(appLocaleFileNamePattern, d.yamlStep(appLocaleStep(sp)))
+	rw.AddStep(groupLocaleFileNamePattern, d.yamlStep(groupLocaleStep(sp)))
+	rw.AddStep(resourceLocaleFileNamePattern, d.yamlStep(resourceLocaleStep(sp)))
+
+	rw.AddStep(resourceFileNamePattern, d.yamlStep(resourceStep(sp)))
+	rw.AddStep(crdFileNamePattern, d.yamlStep(crdStep(sp)))
+	rw.AddStep(installFileName, d.yamlStep(installStep(sp)))
+	rw.AddStep(webhooksFileName, d.yamlStep(webhooksStep(sp)))
+	rw.AddStep(iconFileNamePattern, d.rawStep(iconStep(sp, o.limits.MaxIconSize)))
+	rw.AddStep(uiSchemaFileNamePattern, d.rawStep(uiStep(sp)))
+	rw.AddStep(exampleFileNamePattern, exampleFiles(d.yamlStep(exampleStep(sp))))
+	rw.AddStep(signatureFileName, v.step())
+	handlers := addUnpackHandlers(rw, filepath.Clean(baseDir), sp, d.rawStep)
 
 	if err := rw.Walk(); err != nil {
 		return errors.Wrap(err, "failed to walk Stack filesystem")
@@ -577,16 +975,39 @@ func Unpack(rw walker.ResourceWalker, out io.StringWriter, baseDir, permissionSc
 	if err := sp.applyRules(); err != nil {
 		return err
 	}
+	if err := sp.applyWebhooks(); err != nil {
+		return errors.Wrap(err, "invalid webhooks")
+	}
+	for _, w := range sp.permissionWarnings() {
+		l.Info("Stack requests broad permissions", "warning", w)
+	}
+	for _, i := range sp.metadataIssues() {
+		l.Info("Stack metadata may not apply as intended", "path", i.Path, "warning", i.Message)
+	}
+
+	digest := d.Sum()
+	if err := v.Verify(digest); err != nil {
+		return errors.Wrap(err, "failed to verify Stack signature")
+	}
 
 	sp.applyAnnotations()
+	if err := sp.applyExamples(); err != nil {
+		return err
+	}
+	sp.applyDigest(digest)
 
-	yaml, err := sp.Yaml()
+	for _, h := range handlers {
+		if err := h.handler.Finish(sp); err != nil {
+			return errors.Wrapf(err, "failed to process %q files", h.pattern)
+		}
+	}
 
-	if err == nil {
-		_, err = out.WriteString(yaml)
+	w, err := NewObjectWriter(out, o.outputFormat)
+	if err != nil {
+		return err
 	}
 
-	return err
+	return sp.writeObjects(w)
 }
 
 // orderStackCRDKeys returns the map indexes in descending order
@@ -659,80 +1080,64 @@ func orderStringKeys(m map[string]string) []string {
 
 func (sp *StackPackage) applyGroupAnnotations(crdPath string, crd *apiextensions.CustomResourceDefinition) {
 	// A group among many CRDs applies to all CRDs
-	groupPathsOrdered := orderStackGroupKeys(sp.Groups)
-	for _, groupPath := range groupPathsOrdered {
-		group := sp.Groups[groupPath]
-		if strings.HasPrefix(crdPath, groupPath) {
-			crd.ObjectMeta.Annotations[annotationGroupTitle] = group.Title
-			crd.ObjectMeta.Annotations[annotationGroupCategory] = group.Category
-			crd.ObjectMeta.Annotations[annotationGroupReadme] = group.Readme
-			crd.ObjectMeta.Annotations[annotationGroupOverview] = group.Overview
-			crd.ObjectMeta.Annotations[annotationGroupOverviewShort] = group.OverviewShort
-			break
-		}
+	group, ok := nearestGroup(sp.Groups, crdPath)
+	if !ok {
+		return
 	}
-
+	crd.ObjectMeta.Annotations[annotationGroupTitle] = group.Title
+	crd.ObjectMeta.Annotations[annotationGroupCategory] = group.Category
+	crd.ObjectMeta.Annotations[annotationGroupReadme] = group.Readme
+	crd.ObjectMeta.Annotations[annotationGroupOverview] = group.Overview
+	crd.ObjectMeta.Annotations[annotationGroupOverviewShort] = group.OverviewShort
 }
 
 // applyResourceAnnotations annotates resource.yaml properties to the appropriate StackPackage CRD
-// A resource.yaml must reside in the same path or higher than the CRD and must contain an id matching
-// the CRD kind
+// A resource.yaml must either reference the CRD by name, or reside in the same path or higher than
+// the CRD and contain an id matching the CRD kind. The nearest matching resource.yaml is applied.
 func (sp *StackPackage) applyResourceAnnotations(crdPath string, crd *apiextensions.CustomResourceDefinition) {
-	// TODO(displague) which pattern should associate *resource.yaml to their matching *crd.yaml files?
-	// * resource.yaml contain "id=_kind_" (or gvk)
-	// * limit one-crd per path
-	// * file names match their CRD: [_group_]/[_kind_.[_version_.]]{resource,crd}.yaml
-	resourcePathsOrdered := orderStackResourceKeys(sp.Resources)
-	for _, resourcePath := range resourcePathsOrdered {
-		dir := filepath.Dir(resourcePath)
-		resource := sp.Resources[resourcePath]
-		if strings.HasPrefix(crdPath, dir) && strings.EqualFold(resource.ID, crd.Spec.Names.Kind) {
-			crd.ObjectMeta.Annotations[annotationResourceTitle] = resource.Title
-			crd.ObjectMeta.Annotations[annotationResourceTitlePlural] = resource.TitlePlural
-			crd.ObjectMeta.Annotations[annotationResourceCategory] = resource.Category
-			crd.ObjectMeta.Annotations[annotationResourceReadme] = resource.Readme
-			crd.ObjectMeta.Annotations[annotationResourceOverview] = resource.Overview
-			crd.ObjectMeta.Annotations[annotationResourceOverviewShort] = resource.OverviewShort
-
-			break
-		}
+	resourcePaths, _ := resourceCandidates(sp.Resources, crdPath, crd)
+	if len(resourcePaths) == 0 {
+		return
 	}
+
+	resource := sp.Resources[resourcePaths[0]]
+	crd.ObjectMeta.Annotations[annotationResourceTitle] = resource.Title
+	crd.ObjectMeta.Annotations[annotationResourceTitlePlural] = resource.TitlePlural
+	crd.ObjectMeta.Annotations[annotationResourceCategory] = resource.Category
+	crd.ObjectMeta.Annotations[annotationResourceReadme] = resource.Readme
+	crd.ObjectMeta.Annotations[annotationResourceOverview] = resource.Overview
+	crd.ObjectMeta.Annotations[annotationResourceOverviewShort] = resource.OverviewShort
 }
 
 // applyIconAnnotations annotates icon data to the appropriate StackPackage CRDs
 // An icon among many CRDs applies to all CRDs. Only the nearest ancestor icon is applied to CRDs.
 func (sp *StackPackage) applyIconAnnotations(crdPath string, crd *apiextensions.CustomResourceDefinition) {
-	iconPathsOrdered := orderStackIconKeys(sp.Icons)
-	for _, iconPath := range iconPathsOrdered {
-		if isMetadataApplicableToCRD(crdPath, iconPath, iconFileGlobalNames, crd.Spec.Names.Kind) {
-			// the current icon file is applicable to the given CRD, apply the icon to the CRD now
-			// and then break from the loop since we do not apply more than one icon per resource
-			icon := sp.Icons[iconPath]
-			crd.ObjectMeta.Annotations[annotationStackIcon] = "data:" + icon.MediaType + ";base64," + icon.Base64IconData
-			break
-		}
+	iconPaths := sp.iconCandidates(crdPath, crd)
+	if len(iconPaths) == 0 {
+		return
 	}
+
+	// we do not apply more than one icon per resource
+	icon := sp.Icons[iconPaths[0]]
+	crd.ObjectMeta.Annotations[annotationStackIcon] = "data:" + icon.MediaType + ";base64," + icon.Base64IconData
 }
 
 // applyUISchemaAnnotations annotates ui-schema.yaml contents to the appropriate StackPackage CRDs
 // Existing ui-schema annotation values are preserved. All existing and matching ui-schema.yaml files
 // will be concatenated as a multiple document YAML.
 // A ui-schema.yaml among many CRDs applies to all neighboring and descendent CRDs,
-// a _kind_.ui-schema.yaml applies to crds with a matching kind
+// a _kind_.ui-schema.yaml applies to crds with a matching kind, and a ui-schema that
+// references a CRD by name applies only to that CRD.
 func (sp *StackPackage) applyUISchemaAnnotations(crdPath string, crd *apiextensions.CustomResourceDefinition) {
-	uiPathsOrdered := orderStringKeys(sp.UISchemas)
-	for _, uiSchemaPath := range uiPathsOrdered {
-		if isMetadataApplicableToCRD(crdPath, uiSchemaPath, uiSchemaFileGlobalNames, crd.Spec.Names.Kind) {
-			// the current UI schema file is applicable to the given CRD, apply its spec content to the CRD now
-			schema := strings.Trim(sp.UISchemas[uiSchemaPath], "\n")
-
-			// TODO(displague) are there concerns about the concatenation order of ui-schema.yaml and kind.ui-schema.yaml?
-			if len(crd.ObjectMeta.Annotations[annotationStackUISchema]) > 0 {
-				appendedUI := fmt.Sprintf("%s\n---\n%s", crd.ObjectMeta.Annotations[annotationStackUISchema], schema)
-				crd.ObjectMeta.Annotations[annotationStackUISchema] = appendedUI
-			} else {
-				crd.ObjectMeta.Annotations[annotationStackUISchema] = schema
-			}
+	for _, uiSchemaPath := range sp.uiSchemaCandidates(crdPath, crd) {
+		schema := strings.Trim(sp.UISchemas[uiSchemaPath], "\n")
+
+		// TODO(displague) are there concerns about the concatenation order of ui-schema.yaml and kind.ui-schema.yaml?
+		if len(crd.ObjectMeta.Annotations[annotationStackUISchema]) > 0 {
+			appendedUI := fmt.Sprintf("%s\n---\n%s", crd.ObjectMeta.Annotations[annotationStackUISchema], schema)
+			crd.ObjectMeta.Annotations[annotationStackUISchema] = appendedUI
+		} else {
+			crd.ObjectMeta.Annotations[annotationStackUISchema] = schema
 		}
 	}
 }
@@ -740,8 +1145,7 @@ func (sp *StackPackage) applyUISchemaAnnotations(crdPath string, crd *apiextensi
 // isMetadataApplicableToCRD determines if the given metadata file path is applicable to the given CRD.
 func isMetadataApplicableToCRD(crdPath, metadataPath string, globalFileNames []string, crdKind string) bool {
 	// compare the directory of the given metadata file path to the CRDs path
-	metadataDir := filepath.Dir(metadataPath)
-	if !strings.HasPrefix(crdPath, metadataDir) {
+	if !inDir(crdPath, filepath.Dir(metadataPath)) {
 		// the CRD is not in the same directory (or a child directory) that the metadata file
 		// path is, the metadata is not applicable to this CRD
 		return false
@@ -758,9 +1162,9 @@ func isMetadataApplicableToCRD(crdPath, metadataPath string, globalFileNames []s
 		}
 	}
 
-	// check to see if the metadata file name starts with the kind of the given CRD, if it does
-	// then we consider that a match.  e.g. mytype.icon.svg is applicable to a CRD with kind mytype
-	return strings.HasPrefix(metadataBasename, strings.ToLower(crdKind)+".")
+	// check to see if the first segment of the metadata file name is the kind of the given CRD, if it
+	// is then we consider that a match.  e.g. mytype.icon.svg is applicable to a CRD with kind Mytype
+	return strings.EqualFold(strings.SplitN(metadataBasename, ".", 2)[0], crdKind)
 }
 
 // writeYaml writes the supplied object as Yaml with a separator
@@ -27,6 +27,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/pkg/errors"
 	"github.com/spf13/afero"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
@@ -54,7 +55,8 @@ readme: Resource Readme
 category: Resource Category
 `
 
-	expectedComplexDeploymentStackOutput = `
+	expectedComplexDeploymentStackOutput = `# stacks.crossplane.io/unpack-output: yaml/v1
+
 ---
 apiVersion: apiextensions.k8s.io/v1beta1
 kind: CustomResourceDefinition
@@ -66,6 +68,7 @@ metadata:
     stacks.crossplane.io/group-readme: Group Readme
     stacks.crossplane.io/group-title: Group Title
     stacks.crossplane.io/icon-data-uri: data:image/svg+xml;base64,bW9jay1pY29uLWRhdGEtc3Zn
+    stacks.crossplane.io/package-digest: sha256:801daae1a86d6227aab4adcf1bf6af04fffd796b9178ba436696c94e58a3f56c
     stacks.crossplane.io/stack-title: Sample Crossplane Stack
     stacks.crossplane.io/ui-schema: |-
       version: 0.5
@@ -104,6 +107,7 @@ kind: CustomResourceDefinition
 metadata:
   annotations:
     stacks.crossplane.io/icon-data-uri: data:image/jpeg;base64,bW9jay1pY29uLWRhdGE=
+    stacks.crossplane.io/package-digest: sha256:801daae1a86d6227aab4adcf1bf6af04fffd796b9178ba436696c94e58a3f56c
     stacks.crossplane.io/stack-title: Sample Crossplane Stack
   creationTimestamp: null
   labels:
@@ -120,8 +124,8 @@ spec:
   scope: Namespaced
   subresources:
     scale:
-      specReplicasPath: ""
-      statusReplicasPath: ""
+      specReplicasPath: .spec.replicas
+      statusReplicasPath: .status.replicas
     status: {}
   version: v1alpha1
 status:
@@ -142,6 +146,7 @@ metadata:
     stacks.crossplane.io/group-readme: Group Readme
     stacks.crossplane.io/group-title: Group Title
     stacks.crossplane.io/icon-data-uri: data:image/svg+xml;base64,bW9jay1pY29uLWRhdGEtc3Zn
+    stacks.crossplane.io/package-digest: sha256:801daae1a86d6227aab4adcf1bf6af04fffd796b9178ba436696c94e58a3f56c
     stacks.crossplane.io/resource-category: Resource Category
     stacks.crossplane.io/resource-overview: Resource Overview
     stacks.crossplane.io/resource-overview-short: Resource Short Overview
@@ -196,6 +201,7 @@ metadata:
     stacks.crossplane.io/group-readme: Group Readme
     stacks.crossplane.io/group-title: Group Title
     stacks.crossplane.io/icon-data-uri: data:image/jpeg;base64,bW9jay1pY29uLWRhdGE=
+    stacks.crossplane.io/package-digest: sha256:801daae1a86d6227aab4adcf1bf6af04fffd796b9178ba436696c94e58a3f56c
     stacks.crossplane.io/stack-title: Sample Crossplane Stack
     stacks.crossplane.io/ui-schema: |-
       version: 0.5
@@ -227,6 +233,8 @@ status:
 apiVersion: stacks.crossplane.io/v1alpha1
 kind: Stack
 metadata:
+  annotations:
+    stacks.crossplane.io/package-digest: sha256:801daae1a86d6227aab4adcf1bf6af04fffd796b9178ba436696c94e58a3f56c
   creationTimestamp: null
 spec:
   category: Category
@@ -350,7 +358,8 @@ status:
 ---
 `
 
-	expectedComplexInfraStackOutput = `
+	expectedComplexInfraStackOutput = `# stacks.crossplane.io/unpack-output: yaml/v1
+
 ---
 apiVersion: apiextensions.k8s.io/v1beta1
 kind: CustomResourceDefinition
@@ -362,6 +371,7 @@ metadata:
     stacks.crossplane.io/group-readme: Group Readme
     stacks.crossplane.io/group-title: Group Title
     stacks.crossplane.io/icon-data-uri: data:image/svg+xml;base64,bW9jay1pY29uLWRhdGEtc3Zn
+    stacks.crossplane.io/package-digest: sha256:3418939b1f2d4dbfdf7544e8d8faf1012a5ed0135b74edc8f39e35279e8fd7db
     stacks.crossplane.io/stack-title: Sample Crossplane Stack
     stacks.crossplane.io/ui-schema: |-
       version: 0.5
@@ -400,6 +410,7 @@ kind: CustomResourceDefinition
 metadata:
   annotations:
     stacks.crossplane.io/icon-data-uri: data:image/jpeg;base64,bW9jay1pY29uLWRhdGE=
+    stacks.crossplane.io/package-digest: sha256:3418939b1f2d4dbfdf7544e8d8faf1012a5ed0135b74edc8f39e35279e8fd7db
     stacks.crossplane.io/stack-title: Sample Crossplane Stack
   creationTimestamp: null
   labels:
@@ -416,8 +427,8 @@ spec:
   scope: Namespaced
   subresources:
     scale:
-      specReplicasPath: ""
-      statusReplicasPath: ""
+      specReplicasPath: .spec.replicas
+      statusReplicasPath: .status.replicas
     status: {}
   version: v1alpha1
 status:
@@ -438,6 +449,7 @@ metadata:
     stacks.crossplane.io/group-readme: Group Readme
     stacks.crossplane.io/group-title: Group Title
     stacks.crossplane.io/icon-data-uri: data:image/svg+xml;base64,c2luZ2xlLXJlc291cmNlLW1vY2staWNvbi1kYXRhLXN2Zw==
+    stacks.crossplane.io/package-digest: sha256:3418939b1f2d4dbfdf7544e8d8faf1012a5ed0135b74edc8f39e35279e8fd7db
     stacks.crossplane.io/resource-category: Resource Category
     stacks.crossplane.io/resource-overview: Resource Overview
     stacks.crossplane.io/resource-overview-short: Resource Short Overview
@@ -492,6 +504,7 @@ metadata:
     stacks.crossplane.io/group-readme: Group Readme
     stacks.crossplane.io/group-title: Group Title
     stacks.crossplane.io/icon-data-uri: data:image/jpeg;base64,bW9jay1pY29uLWRhdGE=
+    stacks.crossplane.io/package-digest: sha256:3418939b1f2d4dbfdf7544e8d8faf1012a5ed0135b74edc8f39e35279e8fd7db
     stacks.crossplane.io/stack-title: Sample Crossplane Stack
     stacks.crossplane.io/ui-schema: |-
       version: 0.5
@@ -523,6 +536,8 @@ status:
 apiVersion: stacks.crossplane.io/v1alpha1
 kind: Stack
 metadata:
+  annotations:
+    stacks.crossplane.io/package-digest: sha256:3418939b1f2d4dbfdf7544e8d8faf1012a5ed0135b74edc8f39e35279e8fd7db
   creationTimestamp: null
 spec:
   category: Category
@@ -815,7 +830,9 @@ spec:
   scope: Namespaced
   subresources:
     status: {}
-    scale: {}
+    scale:
+      specReplicasPath: .spec.replicas
+      statusReplicasPath: .status.replicas
   version: v1alpha1
 `, plural, title, title, plural, singular)
 }
@@ -828,14 +845,16 @@ configSections:
 `, name, name)
 }
 
-func expectedSimpleDeploymentStackOutput(controllerImage string) string {
-	tmpl := `
+func expectedSimpleDeploymentStackOutput(controllerImage, digest string) string {
+	tmpl := `# stacks.crossplane.io/unpack-output: yaml/v1
+
 ---
 apiVersion: apiextensions.k8s.io/v1beta1
 kind: CustomResourceDefinition
 metadata:
   annotations:
     stacks.crossplane.io/icon-data-uri: data:image/jpeg;base64,bW9jay1pY29uLWRhdGE=
+    stacks.crossplane.io/package-digest: %[2]s
     stacks.crossplane.io/stack-title: Sample Crossplane Stack
   creationTimestamp: null
   labels:
@@ -862,6 +881,8 @@ status:
 apiVersion: stacks.crossplane.io/v1alpha1
 kind: Stack
 metadata:
+  annotations:
+    stacks.crossplane.io/package-digest: %[2]s
   creationTimestamp: null
 spec:
   category: Category
@@ -892,7 +913,7 @@ spec:
                 valueFrom:
                   fieldRef:
                     fieldPath: metadata.namespace
-              %sname: sample-stack-controller
+              %[1]sname: sample-stack-controller
               resources: {}
   customresourcedefinitions:
   - apiVersion: samples.upbound.io/v1alpha1
@@ -961,20 +982,22 @@ status:
 	if controllerImage != "" {
 		// The spaces are used for formatting the next line. This is a quick and dirty way
 		// to optionally insert an additional line into the output.
-		return fmt.Sprintf(tmpl, fmt.Sprintf("image: %s\n              ", controllerImage))
+		return fmt.Sprintf(tmpl, fmt.Sprintf("image: %s\n              ", controllerImage), digest)
 	}
 
-	return fmt.Sprintf(tmpl, "")
+	return fmt.Sprintf(tmpl, "", digest)
 }
 
-func expectedSimpleBehaviorStackOutput(sourceImage string) string {
-	tmpl := `
+func expectedSimpleBehaviorStackOutput(sourceImage, digest string) string {
+	tmpl := `# stacks.crossplane.io/unpack-output: yaml/v1
+
 ---
 apiVersion: apiextensions.k8s.io/v1beta1
 kind: CustomResourceDefinition
 metadata:
   annotations:
     stacks.crossplane.io/icon-data-uri: data:image/jpeg;base64,bW9jay1pY29uLWRhdGE=
+    stacks.crossplane.io/package-digest: %[3]s
     stacks.crossplane.io/stack-title: Sample Crossplane Stack
   creationTimestamp: null
   labels:
@@ -1001,6 +1024,8 @@ status:
 apiVersion: stacks.crossplane.io/v1alpha1
 kind: StackDefinition
 metadata:
+  annotations:
+    stacks.crossplane.io/package-digest: %[3]s
   creationTimestamp: null
 spec:
   behavior:
@@ -1011,7 +1036,7 @@ spec:
       controllerImage: crossplane/ts-controller:0.0.0
       type: helm2
     source:
-      %spath: /path
+      %[1]spath: /path
   category: Category
   company: Upbound
   controller:
@@ -1046,7 +1071,7 @@ spec:
               - -R
               - /path/.
               - /behaviors
-              %sname: stack-behavior-copy-to-manager
+              %[2]sname: stack-behavior-copy-to-manager
               resources: {}
               volumeMounts:
               - mountPath: /behaviors
@@ -1121,10 +1146,10 @@ status: {}
 	if sourceImage != "" {
 		// The spaces are used for formatting the next line. This is a quick and dirty way
 		// to optionally insert an additional line into the output.
-		return fmt.Sprintf(tmpl, fmt.Sprintf("image: %s\n      ", sourceImage), fmt.Sprintf("image: %s\n              ", sourceImage))
+		return fmt.Sprintf(tmpl, fmt.Sprintf("image: %s\n      ", sourceImage), fmt.Sprintf("image: %s\n              ", sourceImage), digest)
 	}
 
-	return fmt.Sprintf(tmpl, "", "")
+	return fmt.Sprintf(tmpl, "", "", digest)
 }
 
 func TestUnpack(t *testing.T) {
@@ -1165,7 +1190,7 @@ func TestUnpack(t *testing.T) {
 				return fs
 			}(),
 			root: "ext-dir",
-			want: want{output: expectedSimpleDeploymentStackOutput("crossplane/sample-stack:latest"), err: nil},
+			want: want{output: expectedSimpleDeploymentStackOutput("crossplane/sample-stack:latest", "sha256:1d5e21f6869b094631c5c30a8009f828d8226118c0f8bbad3a8fd97bad00b06f"), err: nil},
 		},
 		{
 			name: "SimpleDeploymentStackWithNoVersionShouldHaveNoVersion",
@@ -1181,7 +1206,7 @@ func TestUnpack(t *testing.T) {
 				return fs
 			}(),
 			root: "ext-dir",
-			want: want{output: expectedSimpleDeploymentStackOutput(""), err: nil},
+			want: want{output: expectedSimpleDeploymentStackOutput("", "sha256:6efbe06bffcd034844bfca8b5fffe7328a53b92d2fac468a3f25dfad26c81be8"), err: nil},
 		},
 		{
 			name: "ReadVersionFromStackImage",
@@ -1197,7 +1222,7 @@ func TestUnpack(t *testing.T) {
 				return fs
 			}(),
 			root:       "ext-dir",
-			want:       want{output: expectedSimpleDeploymentStackOutput("crossplane/sample-stack:latest"), err: nil},
+			want:       want{output: expectedSimpleDeploymentStackOutput("crossplane/sample-stack:latest", "sha256:5e7f44cd75ca73b6cc6024072641e101b0fb4a6c8b790bdd892f5be629c1da92"), err: nil},
 			stackImage: "crossplane/sample-stack:0.0.1",
 		},
 		{
@@ -1214,7 +1239,7 @@ func TestUnpack(t *testing.T) {
 				return fs
 			}(),
 			root: "ext-dir",
-			want: want{output: expectedSimpleBehaviorStackOutput("crossplane/sample-stack-claim-test:helm2"), err: nil},
+			want: want{output: expectedSimpleBehaviorStackOutput("crossplane/sample-stack-claim-test:helm2", "sha256:92a55aa04c2c70b353bb17827a1dbb7bf16abcc90198cf0c2dfbff3e3f9b1f5a"), err: nil},
 		},
 		{
 			name: "SimpleBehaviorStackWithNoVersionShouldHaveNoVersion",
@@ -1230,7 +1255,7 @@ func TestUnpack(t *testing.T) {
 				return fs
 			}(),
 			root: "ext-dir",
-			want: want{output: expectedSimpleBehaviorStackOutput(""), err: nil},
+			want: want{output: expectedSimpleBehaviorStackOutput("", "sha256:284060b3aa2f773281dbfc6cf1bdbbdc0b1809ac342d57f6a36a77b3a027d3a9"), err: nil},
 		},
 		{
 			name: "ComplexDeploymentStack",
@@ -1366,6 +1391,165 @@ func TestUnpackCluster(t *testing.T) {
 	}
 }
 
+func TestUnpackLimits(t *testing.T) {
+	cases := map[string]struct {
+		limits UnpackLimits
+		want   error
+	}{
+		"Default": {limits: DefaultUnpackLimits()},
+		"FileTooLarge": {
+			limits: UnpackLimits{MaxFileSize: 64},
+			want:   errors.Wrap(errors.New(`file "ext-dir/app.yaml" is 1212 bytes, which exceeds the limit of 64 bytes`), "failed to walk Stack filesystem"),
+		},
+		"IconTooLarge": {
+			limits: UnpackLimits{MaxIconSize: 8},
+			want:   errors.Wrap(errors.New(`icon "ext-dir/icon.jpg" is 14 bytes, which exceeds the limit of 8 bytes`), "failed to walk Stack filesystem"),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			fs, _ := buildStackFs()
+			rd := &walker.ResourceDir{Base: "ext-dir", Walker: afero.Afero{Fs: fs}}
+			err := Unpack(rd, &bytes.Buffer{}, "ext-dir", "Namespaced", "", logging.NewNopLogger(), WithLimits(tc.limits))
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("Unpack() -want error, +got error:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestApplyRules(t *testing.T) {
+	core := rbacv1.PolicyRule{APIGroups: []string{""}, ResourceNames: []string{}, Resources: []string{"configmaps", "events", "secrets"}, Verbs: []string{"*"}}
+	owned := rbacv1.PolicyRule{APIGroups: []string{"samples.upbound.io"}, ResourceNames: []string{}, Resources: []string{"mytypes"}, Verbs: []string{"*"}}
+	dependency := rbacv1.PolicyRule{APIGroups: []string{"mystack.example.org"}, ResourceNames: []string{}, Resources: []string{"foo"}, Verbs: []string{"*"}}
+	wildcardDependency := rbacv1.PolicyRule{APIGroups: []string{"yourstack.example.org"}, ResourceNames: []string{}, Resources: []string{"*"}, Verbs: []string{"*"}}
+	secrets := rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get", "list", "watch"}}
+
+	type want struct {
+		rules    []rbacv1.PolicyRule
+		warnings []string
+		err      error
+	}
+
+	tests := []struct {
+		name        string
+		permissions string
+		want        want
+	}{
+		{
+			name: "NoPermissions",
+			want: want{
+				rules:    []rbacv1.PolicyRule{core, owned, dependency, wildcardDependency},
+				warnings: []string{"Stack does not contain a permissions.yaml file; it will be granted all verbs on configmaps, events, secrets, and the CRDs it depends on"},
+			},
+		},
+		{
+			name:        "DeclaredPermissions",
+			permissions: "rules:\n- apiGroups: ['']\n  resources: [secrets]\n  verbs: [get, list, watch]\n",
+			want: want{
+				rules:    []rbacv1.PolicyRule{secrets, owned},
+				warnings: []string{},
+			},
+		},
+		{
+			name:        "DependencyPermissions",
+			permissions: "rules:\n- apiGroups: [mystack.example.org]\n  resources: [foo]\n  verbs: [get]\n- apiGroups: [yourstack.example.org]\n  resources: [bar]\n  verbs: [get]\n",
+			want: want{
+				rules: []rbacv1.PolicyRule{
+					{APIGroups: []string{"mystack.example.org"}, Resources: []string{"foo"}, Verbs: []string{"get"}},
+					{APIGroups: []string{"yourstack.example.org"}, Resources: []string{"bar"}, Verbs: []string{"get"}},
+					owned,
+				},
+				warnings: []string{},
+			},
+		},
+		{
+			name:        "WildcardVerbs",
+			permissions: "rules:\n- apiGroups: ['']\n  resources: [secrets]\n  verbs: [get, list, watch]\n- apiGroups: ['']\n  resources: [events]\n  verbs: ['*']\n",
+			want: want{
+				rules: []rbacv1.PolicyRule{
+					secrets,
+					{APIGroups: []string{""}, Resources: []string{"events"}, Verbs: []string{"*"}},
+					owned,
+				},
+				warnings: []string{"rule 1 requests wildcard verbs or resources: * on events in API groups core"},
+			},
+		},
+		{
+			name:        "WildcardResources",
+			permissions: "rules:\n- apiGroups: [yourstack.example.org]\n  resources: ['*']\n  verbs: [get]\n",
+			want: want{
+				rules: []rbacv1.PolicyRule{
+					{APIGroups: []string{"yourstack.example.org"}, Resources: []string{"*"}, Verbs: []string{"get"}},
+					owned,
+				},
+				warnings: []string{"rule 0 requests wildcard verbs or resources: get on * in API groups yourstack.example.org"},
+			},
+		},
+		{
+			name:        "WildcardResourcesNotAllowed",
+			permissions: "rules:\n- apiGroups: ['']\n  resources: ['*']\n  verbs: [get]\n",
+			want:        want{err: errors.New(`invalid permissions: rule 0 grants access to "*" in API group "", which the Stack does not own or depend on`)},
+		},
+		{
+			name:        "WildcardAPIGroups",
+			permissions: "rules:\n- apiGroups: ['*']\n  resources: [secrets]\n  verbs: [get]\n",
+			want:        want{err: errors.New(`invalid permissions: rule 0 grants access to "secrets" in API group "*", which the Stack does not own or depend on`)},
+		},
+		{
+			name:        "NotAllowed",
+			permissions: "rules:\n- apiGroups: ['']\n  resources: [secrets]\n  verbs: [get]\n- apiGroups: ['', rbac.authorization.k8s.io]\n  resources: [secrets, clusterroles]\n  verbs: [get]\n",
+			want:        want{err: errors.New(`invalid permissions: rule 1 grants access to "clusterroles" in API group "", which the Stack does not own or depend on`)},
+		},
+		{
+			name:        "MissingVerbs",
+			permissions: "rules:\n- apiGroups: ['']\n  resources: [secrets]\n",
+			want: want{err: errors.Wrap(
+				errors.New(`invalid permissions "ext-dir/permissions.yaml": rule 0 must specify verbs and resources`),
+				"failed to walk Stack filesystem")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			_ = fs.MkdirAll(simpleCrdDir, 0755)
+			_ = afero.WriteFile(fs, "ext-dir/app.yaml", []byte(simpleAppFile("Namespaced", "Application", true)), 0644)
+			_ = afero.WriteFile(fs, filepath.Join(simpleCrdDir, "mytype.v1alpha1.crd.yaml"), []byte(simpleCRDFile("mytype")), 0644)
+			if tt.permissions != "" {
+				_ = afero.WriteFile(fs, "ext-dir/permissions.yaml", []byte(tt.permissions), 0644)
+			}
+
+			sp := NewStackPackage("ext-dir", "", logging.NewNopLogger())
+			rd := &walker.ResourceDir{Base: "ext-dir", Walker: afero.Afero{Fs: fs}}
+			rd.AddStep(appFileName, appStep(sp))
+			rd.AddStep(permissionsFileName, permissionsStep(sp))
+			rd.AddStep(crdFileNamePattern, crdStep(sp))
+
+			err := rd.Walk()
+			if err == nil {
+				err = sp.applyRules()
+			} else {
+				err = errors.Wrap(err, "failed to walk Stack filesystem")
+			}
+			if diff := cmp.Diff(tt.want.err, err, test.EquateErrors()); diff != "" {
+				t.Fatalf("applyRules() -want error, +got error:\n%s", diff)
+			}
+			if err != nil {
+				return
+			}
+
+			if diff := cmp.Diff(tt.want.rules, sp.Stack.Spec.Permissions.Rules); diff != "" {
+				t.Errorf("applyRules() -want, +got:\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.want.warnings, sp.permissionWarnings()); diff != "" {
+				t.Errorf("permissionWarnings() -want, +got:\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestOrderStackIconKeys(t *testing.T) {
 	type args struct {
 		m map[string]*v1alpha1.IconSpec
@@ -1469,6 +1653,26 @@ func TestIsMetadataApplicableToCRD(t *testing.T) {
 			},
 			want: true,
 		},
+		{
+			name: "PrefixSharingDirectoryNoMatch",
+			args: args{
+				crdPath:         "/foobar/crd.yaml",
+				metadataPath:    "/foo/icon.svg",
+				globalFileNames: iconFileGlobalNames,
+				crdKind:         "mytype",
+			},
+			want: false,
+		},
+		{
+			name: "SingleResourceFileKindCaseInsensitiveMatch",
+			args: args{
+				crdPath:         "/a/b/c/crd.yaml",
+				metadataPath:    "/a/b/c/mytype.ui-schema.yaml",
+				globalFileNames: uiSchemaFileGlobalNames,
+				crdKind:         "MyType",
+			},
+			want: true,
+		},
 		{
 			name: "SingleResourceFileKindNoMatch",
 			args: args{
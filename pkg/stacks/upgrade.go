@@ -0,0 +1,199 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"github.com/pkg/errors"
+	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+
+	"github.com/crossplane/crossplane/apis/stacks/v1alpha1"
+)
+
+// AnnotationAllowUnsafeUpgrade may be set to "true" on a StackInstall or
+// ClusterStackInstall to allow it to upgrade a stack even though the upgrade
+// makes unsafe changes to the stack's CRDs.
+const AnnotationAllowUnsafeUpgrade = "stacks.crossplane.io/allow-unsafe-upgrade"
+
+// CRDUpgradeIssues returns a description of each unsafe change the upgraded
+// CRD makes to the current CRD. An upgrade is unsafe if it narrows the scope of
+// the CRD, removes a required field from the schema of a version, or stops
+// serving a version that is served or stored while objects of the CRD exist.
+func CRDUpgradeIssues(current, upgraded *apiextensions.CustomResourceDefinition, hasObjects bool) []string {
+	issues := []string{}
+
+	if current.Spec.Scope == apiextensions.ClusterScoped && upgraded.Spec.Scope == apiextensions.NamespaceScoped {
+		issues = append(issues, fmt.Sprintf("CRD %s: scope changes from %s to %s", current.GetName(), current.Spec.Scope, upgraded.Spec.Scope))
+	}
+
+	served := map[string]bool{}
+	for _, v := range crdServedVersions(upgraded) {
+		served[v] = true
+	}
+	if hasObjects {
+		for _, v := range crdInstalledVersions(current) {
+			if !served[v] {
+				issues = append(issues, fmt.Sprintf("CRD %s: version %s is removed while objects are stored", current.GetName(), v))
+			}
+		}
+	}
+
+	for _, v := range crdServedVersions(current) {
+		if !served[v] {
+			continue
+		}
+		for _, f := range removedRequiredFields(crdSchema(current, v), crdSchema(upgraded, v), "") {
+			issues = append(issues, fmt.Sprintf("CRD %s: version %s removes required field %s", current.GetName(), v, f))
+		}
+	}
+
+	return issues
+}
+
+// crdInstalledVersions returns the names of every version of the CRD that is
+// either served, or that objects may be stored at.
+func crdInstalledVersions(crd *apiextensions.CustomResourceDefinition) []string {
+	versions := crdServedVersions(crd)
+	seen := map[string]bool{}
+	for _, v := range versions {
+		seen[v] = true
+	}
+	for _, v := range crd.Status.StoredVersions {
+		if !seen[v] {
+			seen[v] = true
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
+
+// crdSchema returns the OpenAPI schema of the named version of the CRD. The
+// CRD-wide validation schema is used if the version has no schema of its own.
+func crdSchema(crd *apiextensions.CustomResourceDefinition, version string) *apiextensions.JSONSchemaProps {
+	for _, v := range crd.Spec.Versions {
+		if v.Name == version && v.Schema != nil && v.Schema.OpenAPIV3Schema != nil {
+			return v.Schema.OpenAPIV3Schema
+		}
+	}
+	if crd.Spec.Validation == nil {
+		return nil
+	}
+	return crd.Spec.Validation.OpenAPIV3Schema
+}
+
+// removedRequiredFields returns the path of each field that is required by
+// the current schema but not described by the upgraded schema. A missing
+// upgraded schema does not constrain objects, so it removes no fields.
+func removedRequiredFields(current, upgraded *apiextensions.JSONSchemaProps, path string) []string {
+	if current == nil || upgraded == nil {
+		return nil
+	}
+
+	removed := []string{}
+	for _, name := range current.Required {
+		if _, ok := upgraded.Properties[name]; !ok {
+			removed = append(removed, path+"."+name)
+		}
+	}
+
+	names := make([]string, 0, len(current.Properties))
+	for name := range current.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		up, ok := upgraded.Properties[name]
+		if !ok {
+			continue
+		}
+		cur := current.Properties[name]
+		removed = append(removed, removedRequiredFields(&cur, &up, path+"."+name)...)
+	}
+
+	if current.Items != nil && upgraded.Items != nil {
+		removed = append(removed, removedRequiredFields(current.Items.Schema, upgraded.Items.Schema, path+"[*]")...)
+	}
+
+	return removed
+}
+
+// PackageTag returns the tag of the supplied stack package image. It returns an
+// error if the package is not tagged, or is referenced by digest.
+func PackageTag(pkg string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(pkg)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot parse package %q", pkg)
+	}
+	if _, ok := named.(reference.Digested); ok {
+		return "", errors.Errorf("package %q is referenced by digest", pkg)
+	}
+	tagged, ok := named.(reference.Tagged)
+	if !ok {
+		return "", errors.Errorf("package %q is not tagged", pkg)
+	}
+	return tagged.Tag(), nil
+}
+
+// WithPackageTag returns the supplied stack package image with its tag
+// replaced by the supplied tag.
+func WithPackageTag(pkg, tag string) (string, error) {
+	current, err := PackageTag(pkg)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(pkg, ":"+current) + ":" + tag, nil
+}
+
+// UpgradeTag returns the tag that a package tagged with the current version
+// should be upgraded to under the supplied upgrade policy. This is the tag of
+// the greatest semantic version that is newer than the current version and
+// within the range allowed by the policy. Tags that are not semantic versions,
+// and pre-release versions, are ignored. It returns false if there is no such
+// tag.
+func UpgradeTag(current string, tags []string, p v1alpha1.UpgradePolicy) (string, bool, error) {
+	cur, _, err := parseVersion(current)
+	if err != nil {
+		return "", false, errors.Wrapf(err, "cannot track upgrades of tag %q", current)
+	}
+
+	best, bestTag := cur, ""
+	for _, t := range tags {
+		v, _, err := parseVersion(t)
+		if err != nil || v.PreRelease() != "" || !best.LessThan(v) {
+			continue
+		}
+		switch p {
+		case v1alpha1.UpgradePolicyPatch:
+			if v.Major() != cur.Major() || v.Minor() != cur.Minor() {
+				continue
+			}
+		case v1alpha1.UpgradePolicyMinor:
+			if v.Major() != cur.Major() {
+				continue
+			}
+		case v1alpha1.UpgradePolicyLatest:
+		default:
+			return "", false, nil
+		}
+		best, bestTag = v, t
+	}
+	return bestTag, bestTag != "", nil
+}
@@ -0,0 +1,300 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/crossplane/crossplane/apis/stacks/v1alpha1"
+)
+
+type upgradeCRDModifier func(*apiextensions.CustomResourceDefinition)
+
+func withUpgradeCRDScope(s apiextensions.ResourceScope) upgradeCRDModifier {
+	return func(crd *apiextensions.CustomResourceDefinition) { crd.Spec.Scope = s }
+}
+
+func withUpgradeCRDVersions(v ...apiextensions.CustomResourceDefinitionVersion) upgradeCRDModifier {
+	return func(crd *apiextensions.CustomResourceDefinition) { crd.Spec.Versions = v }
+}
+
+func withUpgradeCRDStoredVersions(v ...string) upgradeCRDModifier {
+	return func(crd *apiextensions.CustomResourceDefinition) { crd.Status.StoredVersions = v }
+}
+
+func withUpgradeCRDValidation(s *apiextensions.JSONSchemaProps) upgradeCRDModifier {
+	return func(crd *apiextensions.CustomResourceDefinition) {
+		crd.Spec.Validation = &apiextensions.CustomResourceValidation{OpenAPIV3Schema: s}
+	}
+}
+
+func upgradeCRD(m ...upgradeCRDModifier) *apiextensions.CustomResourceDefinition {
+	crd := &apiextensions.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "mytypes.samples.upbound.io"},
+		Spec: apiextensions.CustomResourceDefinitionSpec{
+			Group:    "samples.upbound.io",
+			Scope:    apiextensions.ClusterScoped,
+			Versions: []apiextensions.CustomResourceDefinitionVersion{{Name: "v1", Served: true, Storage: true}},
+		},
+	}
+	for _, fn := range m {
+		fn(crd)
+	}
+	return crd
+}
+
+func TestCRDUpgradeIssues(t *testing.T) {
+	v1 := apiextensions.CustomResourceDefinitionVersion{Name: "v1", Served: true, Storage: true}
+	v2 := apiextensions.CustomResourceDefinitionVersion{Name: "v2", Served: true, Storage: true}
+	v1Unserved := apiextensions.CustomResourceDefinitionVersion{Name: "v1", Served: false}
+
+	schema := func(required ...string) *apiextensions.JSONSchemaProps {
+		s := &apiextensions.JSONSchemaProps{
+			Type: "object",
+			Properties: map[string]apiextensions.JSONSchemaProps{
+				"spec": {
+					Type:     "object",
+					Required: required,
+					Properties: map[string]apiextensions.JSONSchemaProps{
+						"items": {Type: "array", Items: &apiextensions.JSONSchemaPropsOrArray{Schema: &apiextensions.JSONSchemaProps{
+							Type:       "object",
+							Required:   []string{"name"},
+							Properties: map[string]apiextensions.JSONSchemaProps{"name": {Type: "string"}},
+						}}},
+					},
+				},
+			},
+		}
+		for _, r := range required {
+			s.Properties["spec"].Properties[r] = apiextensions.JSONSchemaProps{Type: "string"}
+		}
+		return s
+	}
+	optionalRegion := func() *apiextensions.JSONSchemaProps {
+		s := schema("region")
+		spec := s.Properties["spec"]
+		spec.Required = nil
+		s.Properties["spec"] = spec
+		return s
+	}
+	withoutItemName := func() *apiextensions.JSONSchemaProps {
+		s := schema()
+		s.Properties["spec"].Properties["items"].Items.Schema.Properties = nil
+		return s
+	}
+
+	cases := map[string]struct {
+		current    *apiextensions.CustomResourceDefinition
+		upgraded   *apiextensions.CustomResourceDefinition
+		hasObjects bool
+		want       []string
+	}{
+		"Unchanged": {
+			current:    upgradeCRD(withUpgradeCRDValidation(schema("region"))),
+			upgraded:   upgradeCRD(withUpgradeCRDValidation(schema("region"))),
+			hasObjects: true,
+			want:       []string{},
+		},
+		"ScopeWidened": {
+			current:  upgradeCRD(withUpgradeCRDScope(apiextensions.NamespaceScoped)),
+			upgraded: upgradeCRD(withUpgradeCRDScope(apiextensions.ClusterScoped)),
+			want:     []string{},
+		},
+		"ScopeNarrowed": {
+			current:  upgradeCRD(withUpgradeCRDScope(apiextensions.ClusterScoped)),
+			upgraded: upgradeCRD(withUpgradeCRDScope(apiextensions.NamespaceScoped)),
+			want:     []string{"CRD mytypes.samples.upbound.io: scope changes from Cluster to Namespaced"},
+		},
+		"VersionAdded": {
+			current:    upgradeCRD(withUpgradeCRDVersions(v1)),
+			upgraded:   upgradeCRD(withUpgradeCRDVersions(v1Unserved, v2)),
+			hasObjects: false,
+			want:       []string{},
+		},
+		"VersionRemovedWithObjects": {
+			current:    upgradeCRD(withUpgradeCRDVersions(v1)),
+			upgraded:   upgradeCRD(withUpgradeCRDVersions(v1Unserved, v2)),
+			hasObjects: true,
+			want:       []string{"CRD mytypes.samples.upbound.io: version v1 is removed while objects are stored"},
+		},
+		"StoredVersionRemovedWithObjects": {
+			current:    upgradeCRD(withUpgradeCRDVersions(v1Unserved, v2), withUpgradeCRDStoredVersions("v1", "v2")),
+			upgraded:   upgradeCRD(withUpgradeCRDVersions(v2)),
+			hasObjects: true,
+			want:       []string{"CRD mytypes.samples.upbound.io: version v1 is removed while objects are stored"},
+		},
+		"RequiredFieldOptional": {
+			current:  upgradeCRD(withUpgradeCRDValidation(schema("region"))),
+			upgraded: upgradeCRD(withUpgradeCRDValidation(optionalRegion())),
+			want:     []string{},
+		},
+		"RequiredFieldRemoved": {
+			current:  upgradeCRD(withUpgradeCRDValidation(schema("region"))),
+			upgraded: upgradeCRD(withUpgradeCRDValidation(schema())),
+			want:     []string{"CRD mytypes.samples.upbound.io: version v1 removes required field .spec.region"},
+		},
+		"RequiredItemFieldRemoved": {
+			current:  upgradeCRD(withUpgradeCRDValidation(schema())),
+			upgraded: upgradeCRD(withUpgradeCRDValidation(withoutItemName())),
+			want:     []string{"CRD mytypes.samples.upbound.io: version v1 removes required field .spec.items[*].name"},
+		},
+		"SchemaRemoved": {
+			current:  upgradeCRD(withUpgradeCRDValidation(schema("region"))),
+			upgraded: upgradeCRD(),
+			want:     []string{},
+		},
+		"VersionSchemaRemovesRequiredField": {
+			current: upgradeCRD(withUpgradeCRDVersions(apiextensions.CustomResourceDefinitionVersion{
+				Name: "v1", Served: true, Storage: true,
+				Schema: &apiextensions.CustomResourceValidation{OpenAPIV3Schema: schema("region")},
+			})),
+			upgraded: upgradeCRD(withUpgradeCRDVersions(apiextensions.CustomResourceDefinitionVersion{
+				Name: "v1", Served: true, Storage: true,
+				Schema: &apiextensions.CustomResourceValidation{OpenAPIV3Schema: schema()},
+			})),
+			want: []string{"CRD mytypes.samples.upbound.io: version v1 removes required field .spec.region"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := CRDUpgradeIssues(tc.current, tc.upgraded, tc.hasObjects)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("CRDUpgradeIssues(...): -want, +got:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWithPackageTag(t *testing.T) {
+	type want struct {
+		pkg string
+		err error
+	}
+
+	cases := map[string]struct {
+		pkg  string
+		tag  string
+		want want
+	}{
+		"DockerHub": {
+			pkg:  "cool/stack:1.0.0",
+			tag:  "1.0.1",
+			want: want{pkg: "cool/stack:1.0.1"},
+		},
+		"RegistryWithPort": {
+			pkg:  "registry.example.org:5000/cool/stack:v1.0.0",
+			tag:  "v1.0.1",
+			want: want{pkg: "registry.example.org:5000/cool/stack:v1.0.1"},
+		},
+		"NotTagged": {
+			pkg:  "cool/stack",
+			tag:  "1.0.1",
+			want: want{err: errors.New(`package "cool/stack" is not tagged`)},
+		},
+		"Digest": {
+			pkg:  "cool/stack:1.0.0@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+			tag:  "1.0.1",
+			want: want{err: errors.New(`package "cool/stack:1.0.0@sha256:0000000000000000000000000000000000000000000000000000000000000000" is referenced by digest`)},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := WithPackageTag(tc.pkg, tc.tag)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("WithPackageTag(...): -want error, +got error:\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want.pkg, got); diff != "" {
+				t.Errorf("WithPackageTag(...): -want, +got:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUpgradeTag(t *testing.T) {
+	tags := []string{"latest", "0.9.0", "1.0.0", "1.0.1", "1.0.2-rc.1", "v1.0.3", "1.1", "1.2.0", "2.0.0", "3.0.0-alpha.1"}
+
+	type want struct {
+		tag string
+		ok  bool
+		err error
+	}
+
+	cases := map[string]struct {
+		current string
+		policy  v1alpha1.UpgradePolicy
+		want    want
+	}{
+		"Manual": {
+			current: "1.0.0",
+			policy:  v1alpha1.UpgradePolicyManual,
+			want:    want{},
+		},
+		"Patch": {
+			current: "1.0.0",
+			policy:  v1alpha1.UpgradePolicyPatch,
+			want:    want{tag: "v1.0.3", ok: true},
+		},
+		"Minor": {
+			current: "1.0.0",
+			policy:  v1alpha1.UpgradePolicyMinor,
+			want:    want{tag: "1.2.0", ok: true},
+		},
+		"Latest": {
+			current: "1.0.0",
+			policy:  v1alpha1.UpgradePolicyLatest,
+			want:    want{tag: "2.0.0", ok: true},
+		},
+		"AlreadyLatest": {
+			current: "2.0.0",
+			policy:  v1alpha1.UpgradePolicyLatest,
+			want:    want{},
+		},
+		"PartialVersion": {
+			current: "v1.1",
+			policy:  v1alpha1.UpgradePolicyPatch,
+			want:    want{},
+		},
+		"NotSemanticVersion": {
+			current: "latest",
+			policy:  v1alpha1.UpgradePolicyLatest,
+			want:    want{err: errors.Wrap(errors.New(`cannot parse "latest" as a version`), `cannot track upgrades of tag "latest"`)},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			tag, ok, err := UpgradeTag(tc.current, tags, tc.policy)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("UpgradeTag(...): -want error, +got error:\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want.tag, tag); diff != "" {
+				t.Errorf("UpgradeTag(...): -want tag, +got tag:\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.want.ok, ok); diff != "" {
+				t.Errorf("UpgradeTag(...): -want ok, +got ok:\n%s", diff)
+			}
+		})
+	}
+}
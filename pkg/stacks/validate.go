@@ -0,0 +1,289 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane/pkg/stacks/walker"
+)
+
+// Supported validation report formats
+const (
+	ValidationFormatText = "text"
+	ValidationFormatJSON = "json"
+)
+
+// A ValidationProblem describes a single problem found in a stack package.
+type ValidationProblem struct {
+	// Path of the package file the problem was found in, if any.
+	Path string `json:"path,omitempty"`
+
+	// Message describes the problem.
+	Message string `json:"message"`
+}
+
+// A ValidationReport contains every problem found while validating a stack
+// package. Warnings do not make a stack package invalid, but should be
+// reviewed by its author.
+type ValidationReport struct {
+	Problems []ValidationProblem `json:"problems"`
+	Warnings []ValidationProblem `json:"warnings,omitempty"`
+}
+
+// Valid reports whether no problems were found.
+func (r *ValidationReport) Valid() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *ValidationReport) add(path, format string, a ...interface{}) {
+	r.Problems = append(r.Problems, ValidationProblem{Path: path, Message: fmt.Sprintf(format, a...)})
+}
+
+func (r *ValidationReport) warn(path, format string, a ...interface{}) {
+	r.Warnings = append(r.Warnings, ValidationProblem{Path: path, Message: fmt.Sprintf(format, a...)})
+}
+
+// Write writes the report to w in the supplied format.
+func (r *ValidationReport) Write(w io.Writer, format string) error {
+	switch format {
+	case ValidationFormatJSON:
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		return errors.Wrap(e.Encode(r), "could not write JSON validation report")
+	case ValidationFormatText, "":
+		for _, p := range r.Warnings {
+			msg := "warning: " + p.Message
+			if p.Path != "" {
+				msg = p.Path + ": " + msg
+			}
+			if _, err := fmt.Fprintln(w, msg); err != nil {
+				return errors.Wrap(err, "could not write validation report")
+			}
+		}
+		for _, p := range r.Problems {
+			msg := p.Message
+			if p.Path != "" {
+				msg = p.Path + ": " + msg
+			}
+			if _, err := fmt.Fprintln(w, msg); err != nil {
+				return errors.Wrap(err, "could not write validation report")
+			}
+		}
+		_, err := fmt.Fprintf(w, "%d problem(s) found\n", len(r.Problems))
+		return errors.Wrap(err, "could not write validation report")
+	}
+	return errors.Errorf("unknown validation report format %q", format)
+}
+
+// collectStep wraps a Step so that its errors are recorded in the report
+// rather than aborting the walk.
+func collectStep(r *ValidationReport, step walker.Step) walker.Step {
+	return func(path string, b []byte) error {
+		if err := step(path, b); err != nil {
+			r.add(path, "%s", err)
+		}
+		return nil
+	}
+}
+
+// validateCRDStep unmarshals crd.yaml bytes and records each CRD by the path
+// of the file it was found in. Scope is checked after the walk completes,
+// once the permissionScope of the stack is known.
+func validateCRDStep(r *ValidationReport, sp StackPackager, crds map[string]*apiextensions.CustomResourceDefinition) walker.Step {
+	return func(path string, b []byte) error {
+		crd, err := decodeCRD(b)
+		if err != nil {
+			r.add(path, "invalid crd: %s", err)
+			return nil
+		}
+		// Registered unpack handlers may look up the CRDs of the stack.
+		// CRDs are added by directory, as they are by Unpack, so that
+		// metadata is associated with them in the same way.
+		if err := sp.AddCRD(filepath.Dir(path), crd.DeepCopy()); err != nil {
+			r.add(path, "invalid crd: %s", err)
+			return nil
+		}
+		crds[path] = crd
+		return nil
+	}
+}
+
+// Validate walks a stack package using the same steps as Unpack and reports
+// every problem found, rather than stopping at the first one. The returned
+// error is only non-nil if the package could not be walked at all.
+//
+// An empty permissionScope skips checking the permissionScope of the stack
+// against the expected value.
+func Validate(rw walker.ResourceWalker, baseDir, permissionScope string, log logging.Logger) (*ValidationReport, error) {
+	l := log.WithValues("operation", "validate")
+	sp := NewStackPackage(filepath.Clean(baseDir), "", l)
+	r := &ValidationReport{Problems: []ValidationProblem{}}
+	crds := map[string]*apiextensions.CustomResourceDefinition{}
+
+	rw.AddStep(appFileName, collectStep(r, appStep(sp)))
+	rw.AddStep(behaviorFileName, collectStep(r, behaviorStep(sp)))
+	rw.AddStep(permissionsFileName, collectStep(r, permissionsStep(sp)))
+	rw.AddStep(groupFileName, collectStep(r, groupStep(sp)))
+	rw.AddStep(appLocaleFileNamePattern, collectStep(r, appLocaleStep(sp)))
+	rw.AddStep(groupLocaleFileNamePattern, collectStep(r, groupLocaleStep(sp)))
+	rw.AddStep(resourceLocaleFileNamePattern, collectStep(r, resourceLocaleStep(sp)))
+
+	rw.AddStep(resourceFileNamePattern, collectStep(r, resourceStep(sp)))
+	rw.AddStep(crdFileNamePattern, validateCRDStep(r, sp, crds))
+	rw.AddStep(installFileName, collectStep(r, installStep(sp)))
+	rw.AddStep(webhooksFileName, collectStep(r, webhooksStep(sp)))
+	rw.AddStep(iconFileNamePattern, collectStep(r, iconStep(sp, DefaultMaxIconSize)))
+	rw.AddStep(uiSchemaFileNamePattern, collectStep(r, uiStep(sp)))
+	rw.AddStep(exampleFileNamePattern, exampleFiles(collectStep(r, exampleStep(sp))))
+	handlers := addUnpackHandlers(rw, sp.baseDir, sp, func(s walker.Step) walker.Step { return collectStep(r, s) })
+
+	if err := rw.Walk(); err != nil {
+		return nil, errors.Wrap(err, "failed to walk Stack filesystem")
+	}
+
+	for _, h := range handlers {
+		if err := h.handler.Finish(sp); err != nil {
+			r.add(sp.baseDir, "failed to process %q files: %s", h.pattern, err)
+		}
+	}
+
+	validateApp(r, sp, permissionScope)
+	validateCRDs(r, sp, crds)
+	validateMetadata(r, sp)
+	validateExamples(r, sp)
+	validatePermissions(r, sp)
+	validateWebhooks(r, sp)
+
+	return r, nil
+}
+
+func validateApp(r *ValidationReport, sp *StackPackage, permissionScope string) {
+	if !sp.GotApp() {
+		r.add(filepath.Join(sp.baseDir, appFileName), "Stack does not contain an app.yaml file")
+		return
+	}
+
+	path := filepath.Join(sp.baseDir, appFileName)
+	scope := sp.Stack.Spec.PermissionScope
+	switch apiextensions.ResourceScope(scope) {
+	case apiextensions.NamespaceScoped, apiextensions.ClusterScoped:
+	default:
+		r.add(path, "permissionScope %q must be one of %q or %q", scope, apiextensions.NamespaceScoped, apiextensions.ClusterScoped)
+	}
+
+	if permissionScope != "" && scope != permissionScope {
+		r.add(path, "Stack permissionScope %q is not permitted by validate invocation parameters (expected %q)", scope, permissionScope)
+	}
+
+	for _, d := range sp.Stack.Spec.DependsOn {
+		if err := ValidateDependency(d); err != nil {
+			r.add(path, "invalid dependency: %s", err)
+		}
+	}
+}
+
+func validateCRDs(r *ValidationReport, sp *StackPackage, crds map[string]*apiextensions.CustomResourceDefinition) {
+	for _, path := range orderedCRDPaths(crds) {
+		crd := crds[path]
+		if crd.Spec.Group == "" || crd.Spec.Names.Kind == "" {
+			r.add(path, "CRD must specify a group and kind")
+		} else if err := validateCRD(crd); err != nil {
+			r.add(path, "invalid crd: %s", err)
+		}
+
+		crdIsNotNamespacedScope := (crd.Spec.Scope != apiextensions.NamespaceScoped) && (crd.Spec.Scope != "")
+		if sp.GotApp() && sp.IsNamespaced() && crdIsNotNamespacedScope {
+			r.add(path, "Stack CRD must be namespaced scope, found %q", crd.Spec.Scope)
+		}
+	}
+}
+
+// validateMetadata reports resource.yaml, icon, and ui-schema files that do
+// not apply to any CRD, and warns about resource.yaml files that apply to a
+// CRD as ambiguously as another.
+func validateMetadata(r *ValidationReport, sp *StackPackage) {
+	for _, i := range sp.metadataIssues() {
+		if i.Unused {
+			r.add(i.Path, "%s", i.Message)
+			continue
+		}
+		r.warn(i.Path, "%s", i.Message)
+	}
+}
+
+// validateExamples reports examples that are not valid instances of a CRD of
+// the stack.
+func validateExamples(r *ValidationReport, sp *StackPackage) {
+	for _, path := range orderedExamplePaths(sp.Examples) {
+		for i := range sp.Examples[path] {
+			if _, err := sp.exampleCRD(&sp.Examples[path][i]); err != nil {
+				r.add(path, "invalid example: %s", err)
+			}
+		}
+	}
+}
+
+// validatePermissions reports declared permissions that the stack may not be
+// granted, and warns about broad permissions requested by the stack.
+func validatePermissions(r *ValidationReport, sp *StackPackage) {
+	path := filepath.Join(sp.baseDir, permissionsFileName)
+	if sp.permissions != nil {
+		if err := sp.checkPermissions(); err != nil {
+			r.add(path, "%s", err)
+		}
+	}
+	for _, w := range sp.permissionWarnings() {
+		r.warn(path, "%s", w)
+	}
+}
+
+// validateWebhooks reports conversion webhooks that are not served by the
+// stack's webhook Deployment, and a webhook Deployment that does not exist.
+func validateWebhooks(r *ValidationReport, sp *StackPackage) {
+	if err := sp.applyWebhooks(); err != nil {
+		r.add(filepath.Join(sp.baseDir, webhooksFileName), "invalid webhooks: %s", err)
+	}
+}
+
+func isGlobalFileName(path string, globalNames []string) bool {
+	base := filepath.Base(path)
+	for _, g := range globalNames {
+		if base == g {
+			return true
+		}
+	}
+	return false
+}
+
+// orderedCRDPaths returns the map indexes in ascending order
+func orderedCRDPaths(m map[string]*apiextensions.CustomResourceDefinition) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
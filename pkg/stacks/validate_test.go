@@ -0,0 +1,228 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/afero"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane/pkg/stacks/walker"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name            string
+		fs              afero.Fs
+		permissionScope string
+		want            []ValidationProblem
+	}{
+		{
+			name: "EmptyStackDir",
+			fs: func() afero.Fs {
+				fs := afero.NewMemMapFs()
+				fs.MkdirAll("ext-dir", 0755)
+				return fs
+			}(),
+			want: []ValidationProblem{
+				{Path: "ext-dir/app.yaml", Message: "Stack does not contain an app.yaml file"},
+			},
+		},
+		{
+			name: "ValidStack",
+			fs: func() afero.Fs {
+				fs := afero.NewMemMapFs()
+				fs.MkdirAll(simpleCrdDir, 0755)
+				afero.WriteFile(fs, "ext-dir/icon.jpg", []byte("mock-icon-data"), 0644)
+				afero.WriteFile(fs, "ext-dir/app.yaml", []byte(simpleAppFile("Namespaced", "Application", true)), 0644)
+				afero.WriteFile(fs, "ext-dir/install.yaml", []byte(simpleDeploymentInstallFile("crossplane/sample-stack:latest")), 0644)
+				afero.WriteFile(fs, filepath.Join(simpleCrdDir, "resource.yaml"), []byte(simpleResourceFile), 0644)
+				afero.WriteFile(fs, filepath.Join(simpleCrdDir, "mytype.icon.svg"), []byte("mock-icon-data-svg"), 0644)
+				afero.WriteFile(fs, filepath.Join(simpleCrdDir, "mytype.v1alpha1.crd.yaml"), []byte(simpleCRDFile("mytype")), 0644)
+				return fs
+			}(),
+			permissionScope: "Namespaced",
+			want:            []ValidationProblem{},
+		},
+		{
+			name: "ManyProblems",
+			fs: func() afero.Fs {
+				fs := afero.NewMemMapFs()
+				fs.MkdirAll(simpleCrdDir, 0755)
+				afero.WriteFile(fs, "ext-dir/app.yaml", []byte(strings.Replace(simpleAppFile("Namespaced", "Application", true), "dependsOn:\n", "dependsOn:\n- package: crossplane/other-stack\n  version: '>=one'\n", 1)), 0644)
+				afero.WriteFile(fs, "ext-dir/install.yaml", []byte("{not yaml"), 0644)
+				afero.WriteFile(fs, "ext-dir/permissions.yaml", []byte("rules:\n- apiGroups: [apps]\n  resources: [deployments]\n  verbs: [get]\n"), 0644)
+				afero.WriteFile(fs, filepath.Join(simpleCrdDir, "resource.yaml"), []byte(strings.Replace(simpleResourceFile, "id: mytype", "id: othertype", 1)), 0644)
+				afero.WriteFile(fs, filepath.Join(simpleCrdDir, "unmatched.icon.svg"), []byte("mock-icon-data-svg"), 0644)
+				afero.WriteFile(fs, filepath.Join(simpleCrdDir, "unmatched.ui-schema.yaml"), []byte(simpleUIFile("mismatch")), 0644)
+				afero.WriteFile(fs, filepath.Join(simpleCrdDir, "mytype.v1alpha1.crd.yaml"), []byte(strings.Replace(simpleCRDFile("mytype"), "scope: Namespaced", "scope: Cluster", 1)), 0644)
+				afero.WriteFile(fs, "ext-dir/examples/other.yaml", []byte("apiVersion: samples.upbound.io/v1alpha1\nkind: Othertype\n"), 0644)
+				return fs
+			}(),
+			permissionScope: "Cluster",
+			want: []ValidationProblem{
+				{Path: "ext-dir/install.yaml", Message: "invalid install \"ext-dir/install.yaml\": json: line 0: invalid character 'n' looking for beginning of object key string"},
+				{Path: "ext-dir/app.yaml", Message: "Stack permissionScope \"Namespaced\" is not permitted by validate invocation parameters (expected \"Cluster\")"},
+				{Path: "ext-dir/app.yaml", Message: "invalid dependency: invalid version constraint \">=one\": cannot parse \"one\" as a version"},
+				{Path: filepath.Join(simpleCrdDir, "mytype.v1alpha1.crd.yaml"), Message: "Stack CRD must be namespaced scope, found \"Cluster\""},
+				{Path: filepath.Join(simpleCrdDir, "resource.yaml"), Message: "resource id \"othertype\" matches no CRD kind"},
+				{Path: filepath.Join(simpleCrdDir, "unmatched.icon.svg"), Message: "icon does not apply to any CRD"},
+				{Path: filepath.Join(simpleCrdDir, "unmatched.ui-schema.yaml"), Message: "ui-schema does not apply to any CRD"},
+				{Path: "ext-dir/examples/other.yaml", Message: "invalid example: kind \"Othertype.samples.upbound.io\" is not owned by the stack"},
+				{Path: "ext-dir/permissions.yaml", Message: "invalid permissions: rule 0 grants access to \"deployments\" in API group \"apps\", which the Stack does not own or depend on"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rd := &walker.ResourceDir{Base: "ext-dir", Walker: afero.Afero{Fs: tt.fs}}
+			got, err := Validate(rd, "ext-dir", tt.permissionScope, logging.NewLogrLogger(zap.Logger(true)))
+			if err != nil {
+				t.Fatalf("Validate(): %s", err)
+			}
+
+			if diff := cmp.Diff(tt.want, got.Problems); diff != "" {
+				t.Errorf("Validate() -want, +got:\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestValidationReportWrite(t *testing.T) {
+	r := &ValidationReport{
+		Problems: []ValidationProblem{{Path: "/app.yaml", Message: "bad"}, {Message: "worse"}},
+		Warnings: []ValidationProblem{{Path: "/permissions.yaml", Message: "broad"}},
+	}
+
+	cases := map[string]string{
+		ValidationFormatText: "/permissions.yaml: warning: broad\n/app.yaml: bad\nworse\n2 problem(s) found\n",
+		ValidationFormatJSON: `{
+  "problems": [
+    {
+      "path": "/app.yaml",
+      "message": "bad"
+    },
+    {
+      "message": "worse"
+    }
+  ],
+  "warnings": [
+    {
+      "path": "/permissions.yaml",
+      "message": "broad"
+    }
+  ]
+}
+`,
+	}
+
+	for format, want := range cases {
+		t.Run(format, func(t *testing.T) {
+			got := &bytes.Buffer{}
+			if err := r.Write(got, format); err != nil {
+				t.Fatalf("Write(): %s", err)
+			}
+			if diff := cmp.Diff(want, got.String()); diff != "" {
+				t.Errorf("Write() -want, +got:\n%v", diff)
+			}
+		})
+	}
+}
+
+// A metadataIssueRecorder records the metadata issues Unpack logs.
+type metadataIssueRecorder struct {
+	logging.Logger
+	issues []ValidationProblem
+}
+
+func (r *metadataIssueRecorder) Info(msg string, keysAndValues ...interface{}) {
+	if msg != "Stack metadata may not apply as intended" {
+		return
+	}
+	p := ValidationProblem{}
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		switch keysAndValues[i] {
+		case "path":
+			p.Path = keysAndValues[i+1].(string)
+		case "warning":
+			p.Message = keysAndValues[i+1].(string)
+		}
+	}
+	r.issues = append(r.issues, p)
+}
+
+func (r *metadataIssueRecorder) WithValues(keysAndValues ...interface{}) logging.Logger {
+	return r
+}
+
+func TestValidateAgreesWithUnpack(t *testing.T) {
+	groupDir := "ext-dir/resources/samples.upbound.io"
+	crdDir := filepath.Join(groupDir, "mytype/v1alpha1")
+
+	fs := afero.NewMemMapFs()
+	fs.MkdirAll(crdDir, 0755)
+	afero.WriteFile(fs, "ext-dir/app.yaml", []byte(simpleAppFile("Namespaced", "Application", true)), 0644)
+	afero.WriteFile(fs, "ext-dir/install.yaml", []byte(simpleDeploymentInstallFile("crossplane/sample-stack:latest")), 0644)
+	afero.WriteFile(fs, "ext-dir/permissions.yaml", []byte("rules:\n- apiGroups: ['']\n  resources: [secrets]\n  verbs: [get]\n"), 0644)
+	afero.WriteFile(fs, filepath.Join(crdDir, "mytype.v1alpha1.crd.yaml"), []byte(simpleCRDFile("mytype")), 0644)
+
+	// The nearest resource.yaml is used, the other is outranked.
+	afero.WriteFile(fs, "ext-dir/resources/resource.yaml", []byte(simpleResourceFile), 0644)
+	afero.WriteFile(fs, filepath.Join(crdDir, "resource.yaml"), []byte(simpleResourceFile), 0644)
+
+	// Both reference the CRD explicitly, so neither outranks the other.
+	afero.WriteFile(fs, filepath.Join(groupDir, "mytype/resource.yaml"), []byte("crd: mytypes.samples.upbound.io\n"+simpleResourceFile), 0644)
+	afero.WriteFile(fs, filepath.Join(groupDir, "other/resource.yaml"), []byte("crd: mytypes.samples.upbound.io\n"+simpleResourceFile), 0644)
+
+	// Icons and ui-schemas apply to CRDs in their directory or beneath it.
+	afero.WriteFile(fs, filepath.Join(groupDir, "mytype/mytype.icon.svg"), []byte("mock-icon-data-svg"), 0644)
+	afero.WriteFile(fs, filepath.Join(groupDir, "other/othertype.icon.svg"), []byte("mock-icon-data-svg"), 0644)
+	afero.WriteFile(fs, filepath.Join(crdDir, "nested/mytype.ui-schema.yaml"), []byte(simpleUIFile("nested")), 0644)
+
+	want := []ValidationProblem{
+		{Path: filepath.Join(groupDir, "other/othertype.icon.svg"), Message: "icon does not apply to any CRD"},
+		{Path: filepath.Join(crdDir, "nested/mytype.ui-schema.yaml"), Message: "ui-schema does not apply to any CRD"},
+		{Path: filepath.Join(groupDir, "mytype/resource.yaml"), Message: fmt.Sprintf("resource applies to CRD %q, but %q is used instead", "mytypes.samples.upbound.io", filepath.Join(groupDir, "other/resource.yaml"))},
+	}
+
+	rd := &walker.ResourceDir{Base: "ext-dir", Walker: afero.Afero{Fs: fs}}
+	report, err := Validate(rd, "ext-dir", "Namespaced", logging.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Validate(): %s", err)
+	}
+	validated := append(report.Problems, report.Warnings...)
+	if diff := cmp.Diff(want, validated); diff != "" {
+		t.Errorf("Validate() -want, +got:\n%v", diff)
+	}
+
+	log := &metadataIssueRecorder{Logger: logging.NewNopLogger()}
+	rd = &walker.ResourceDir{Base: "ext-dir", Walker: afero.Afero{Fs: fs}}
+	if err := Unpack(rd, &bytes.Buffer{}, "ext-dir", "Namespaced", "crossplane/ts-controller:0.0.0", log); err != nil {
+		t.Fatalf("Unpack(): %s", err)
+	}
+	if diff := cmp.Diff(validated, log.issues); diff != "" {
+		t.Errorf("Validate() and Unpack() disagree: -validated, +unpacked:\n%v", diff)
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package walker
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// defaultDownloadTimeout bounds how long downloading an archive may take when
+// no Client is supplied.
+const defaultDownloadTimeout = 5 * time.Minute
+
+// defaultClient is used to download archives when no Client is supplied.
+// Unlike http.DefaultClient it gives up on a server that stops responding.
+var defaultClient = &http.Client{Timeout: defaultDownloadTimeout}
+
+// ResourceArchive walks the files of a tarball served over HTTP(S). The
+// tarball may be gzip compressed. It is downloaded in its entirety and its
+// checksum verified before any of its files are walked.
+//
+// Files are passed to each Step by their path within the tarball, e.g.
+// /mystack/app.yaml. Only regular files, hard links, and symlinks to regular
+// files are walked.
+type ResourceArchive struct {
+	// URL of the tarball.
+	URL string
+
+	// SHA256 is the hex encoded SHA-256 checksum the tarball must match.
+	SHA256 string
+
+	// Base is the directory within the tarball that will be walked, e.g.
+	// "/mystack". The root of the tarball is walked if Base is empty.
+	Base string
+
+	// Client is used to download the tarball. A client that times out after
+	// five minutes is used if Client is nil.
+	Client *http.Client
+
+	// Limits constrain the size of the files within the Base directory. The
+	// MaxTotalSize limit also applies to the tarball itself.
+	Limits Limits
+
+	steps []imageStep
+}
+
+// AddStep adds a Step to the Walker
+// Each Step will be given the bytes and filepath of resource files matching the supplied name pattern
+func (ra *ResourceArchive) AddStep(pattern string, step Step) {
+	ra.steps = append(ra.steps, imageStep{pattern: pattern, step: step})
+}
+
+// SetLimits sets the size limits of the files that will be read.
+func (ra *ResourceArchive) SetLimits(l Limits) {
+	ra.Limits = l
+}
+
+// Walk downloads and verifies the tarball, then applies all of the Step
+// functions against the files of its Base directory, in lexical order.
+func (ra *ResourceArchive) Walk() error {
+	if ra.SHA256 == "" {
+		return errors.Errorf("a SHA-256 checksum is required to walk archive %q", ra.URL)
+	}
+
+	b, err := ra.download()
+	if err != nil {
+		return errors.Wrapf(err, "cannot download archive %q", ra.URL)
+	}
+
+	sum := sha256.Sum256(b)
+	if got := hex.EncodeToString(sum[:]); got != strings.ToLower(ra.SHA256) {
+		return errors.Errorf("archive %q has SHA-256 checksum %s, want %s", ra.URL, got, ra.SHA256)
+	}
+
+	base := path.Clean("/" + filepath.ToSlash(ra.Base))
+	lf := newLayerFiles()
+	if err := readLayer(bytes.NewReader(b), base, ra.Limits, lf); err != nil {
+		return errors.Wrapf(err, "cannot read archive %q", ra.URL)
+	}
+	files, err := lf.resolve(base, ra.Limits)
+	if err != nil {
+		return errors.Wrapf(err, "cannot read archive %q", ra.URL)
+	}
+	return walkFiles(files, ra.steps)
+}
+
+func (ra *ResourceArchive) client() *http.Client {
+	if ra.Client == nil {
+		return defaultClient
+	}
+	return ra.Client
+}
+
+func (ra *ResourceArchive) download() ([]byte, error) {
+	resp, err := ra.client().Get(ra.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected response status %q", resp.Status)
+	}
+
+	var r io.Reader = resp.Body
+	if max := ra.Limits.MaxTotalSize; max > 0 {
+		// Read one byte more than the limit so that an archive exactly at
+		// the limit can be told apart from one that exceeds it.
+		r = io.LimitReader(resp.Body, max+1)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if max := ra.Limits.MaxTotalSize; max > 0 && int64(len(b)) > max {
+		return nil, errors.Errorf("archive exceeds the limit of %d bytes", max)
+	}
+	return b, nil
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package walker
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestResourceArchiveWalk(t *testing.T) {
+	archive := mockGzip(mockTar(
+		tarEntry{name: "sample-stack-1.0/", typeflag: tar.TypeDir},
+		tarEntry{name: "sample-stack-1.0/README.md", body: "readme"},
+		tarEntry{name: "sample-stack-1.0/stack/app.yaml", body: "app"},
+		tarEntry{name: "sample-stack-1.0/stack/resources/crd.yaml", body: "crd"},
+		tarEntry{name: "sample-stack-1.0/stack/ui-schema.yaml", typeflag: tar.TypeSymlink, linkname: "resources/crd.yaml"},
+		tarEntry{name: "sample-stack-1.0/docs/hostname", typeflag: tar.TypeSymlink, linkname: "/etc/hostname"},
+	))
+	sum := fmt.Sprintf("%x", sha256.Sum256(archive))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sample-stack-1.0.tar.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(archive)
+	}))
+	defer srv.Close()
+
+	cases := map[string]struct {
+		path    string
+		sha256  string
+		base    string
+		limits  Limits
+		want    map[string]string
+		wantErr bool
+	}{
+		"Successful": {
+			path:   "/sample-stack-1.0.tar.gz",
+			sha256: sum,
+			base:   "/sample-stack-1.0/stack",
+			want: map[string]string{
+				"/sample-stack-1.0/stack/app.yaml":           "app",
+				"/sample-stack-1.0/stack/resources/crd.yaml": "crd",
+				"/sample-stack-1.0/stack/ui-schema.yaml":     "crd",
+			},
+		},
+		"SymlinkOutsideBase": {
+			path:    "/sample-stack-1.0.tar.gz",
+			sha256:  sum,
+			base:    "/sample-stack-1.0/docs",
+			wantErr: true,
+		},
+		"ChecksumMismatch": {
+			path:    "/sample-stack-1.0.tar.gz",
+			sha256:  fmt.Sprintf("%x", sha256.Sum256([]byte("other"))),
+			wantErr: true,
+		},
+		"ChecksumRequired": {
+			path:    "/sample-stack-1.0.tar.gz",
+			wantErr: true,
+		},
+		"NotFound": {
+			path:    "/missing.tar.gz",
+			sha256:  sum,
+			wantErr: true,
+		},
+		"ArchiveTooLarge": {
+			path:    "/sample-stack-1.0.tar.gz",
+			sha256:  sum,
+			limits:  Limits{MaxTotalSize: 16},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := map[string]string{}
+			ra := &ResourceArchive{URL: srv.URL + tc.path, SHA256: tc.sha256, Base: tc.base, Limits: tc.limits, Client: srv.Client()}
+			ra.AddStep("*", func(path string, b []byte) error {
+				got[path] = string(b)
+				return nil
+			})
+
+			err := ra.Walk()
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Walk(): expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Walk(): %s", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Walk(): -want, +got:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestResourceArchiveWalkTimeout(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	ra := &ResourceArchive{URL: srv.URL + "/stack.tar.gz", SHA256: "abc", Client: &http.Client{Timeout: 10 * time.Millisecond}}
+	if err := ra.Walk(); err == nil {
+		t.Errorf("Walk(): expected error downloading from a server that does not respond")
+	}
+}
+
+func TestResourceArchiveClient(t *testing.T) {
+	ra := &ResourceArchive{}
+	if got := ra.client(); got.Timeout == 0 {
+		t.Errorf("client(): want a client with a timeout when Client is nil")
+	}
+
+	c := &http.Client{}
+	ra = &ResourceArchive{Client: c}
+	if got := ra.client(); got != c {
+		t.Errorf("client(): want the supplied Client")
+	}
+}
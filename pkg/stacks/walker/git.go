@@ -0,0 +1,137 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package walker
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+const (
+	gitDefaultRef = "HEAD"
+	gitDir        = ".git"
+)
+
+// gitAllowedProtocols are the transports git may use to fetch a repository.
+// Notably the ext transport, which runs arbitrary commands, and the file
+// transport, which would read repositories from the filesystem of the Stack
+// Manager, are not allowed. Tests allow the file transport to fetch local
+// repositories.
+var gitAllowedProtocols = "git:http:https:ssh"
+
+// ResourceGit walks the files of a Git repository. A shallow checkout of the
+// Ref of the repository is fetched into a temporary directory, which is
+// removed once the walk is complete. The git binary must be installed.
+//
+// Files are passed to each Step by their path within the repository, e.g.
+// /mystack/app.yaml. Symbolic links are checked out as regular files whose
+// content is the link target, so that a repository cannot cause files outside
+// of it to be read.
+type ResourceGit struct {
+	// URL of the Git repository.
+	URL string
+
+	// Ref is the branch, tag, or commit to walk. The default branch of the
+	// repository is walked if Ref is empty.
+	Ref string
+
+	// Base is the directory within the repository that will be walked, e.g.
+	// "/mystack". The root of the repository is walked if Base is empty.
+	Base string
+
+	// Limits constrain the size of the files within the Base directory.
+	Limits Limits
+
+	steps []imageStep
+}
+
+// AddStep adds a Step to the Walker
+// Each Step will be given the bytes and filepath of resource files matching the supplied name pattern
+func (rg *ResourceGit) AddStep(pattern string, step Step) {
+	rg.steps = append(rg.steps, imageStep{pattern: pattern, step: step})
+}
+
+// SetLimits sets the size limits of the files that will be read.
+func (rg *ResourceGit) SetLimits(l Limits) {
+	rg.Limits = l
+}
+
+// Walk fetches the repository and applies all of the Step functions against
+// the files of its Base directory.
+func (rg *ResourceGit) Walk() error {
+	for _, arg := range []string{rg.URL, rg.Ref} {
+		// Prevent the URL or ref being interpreted as a git option.
+		if strings.HasPrefix(arg, "-") {
+			return errors.Errorf("invalid git repository or ref %q", arg)
+		}
+	}
+	ref := rg.Ref
+	if ref == "" {
+		ref = gitDefaultRef
+	}
+
+	dir, err := ioutil.TempDir("", "stack-git-")
+	if err != nil {
+		return errors.Wrap(err, "cannot create checkout directory")
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	if err := git(dir, "init", "--quiet"); err != nil {
+		return err
+	}
+	if err := git(dir, "fetch", "--quiet", "--depth=1", rg.URL, ref); err != nil {
+		return errors.Wrapf(err, "cannot fetch %q from git repository %q", ref, rg.URL)
+	}
+	if err := git(dir, "-c", "core.symlinks=false", "checkout", "--quiet", "FETCH_HEAD"); err != nil {
+		return errors.Wrapf(err, "cannot check out %q from git repository %q", ref, rg.URL)
+	}
+
+	// The repository metadata is not part of the stack package, and must not
+	// count towards the limits.
+	if err := os.RemoveAll(filepath.Join(dir, gitDir)); err != nil {
+		return errors.Wrap(err, "cannot remove git metadata")
+	}
+
+	rd := &ResourceDir{
+		Base:   path.Clean("/" + filepath.ToSlash(rg.Base)),
+		Walker: afero.Afero{Fs: afero.NewBasePathFs(afero.NewOsFs(), dir)},
+		Limits: rg.Limits,
+	}
+	for _, s := range rg.steps {
+		rd.AddStep(s.pattern, s.step)
+	}
+	return rd.Walk()
+}
+
+// git runs the git binary with the supplied arguments in the supplied
+// directory. Its output is returned as part of any error.
+func git(dir string, args ...string) error {
+	cmd := exec.Command("git", args...) // nolint:gosec
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ALLOW_PROTOCOL="+gitAllowedProtocols)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return errors.Wrapf(err, "git %s failed: %s", args[0], strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package walker
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// mockGitRepo creates a Git repository with two commits to its master
+// branch, the first of which is tagged v1. It returns the URL of the
+// repository and the commit ID of the first commit.
+func mockGitRepo(t *testing.T, dir string) (string, string) {
+	t.Helper()
+
+	run := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.org",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.org",
+		)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %s: %s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	write := func(name, body string) {
+		p := filepath.Join(dir, name)
+		_ = os.MkdirAll(filepath.Dir(p), 0755)
+		if err := ioutil.WriteFile(p, []byte(body), 0600); err != nil {
+			t.Fatalf("cannot write %q: %s", p, err)
+		}
+	}
+
+	run("init", "--quiet")
+	run("checkout", "--quiet", "-b", "master")
+	write("README.md", "readme")
+	write("stack/app.yaml", "v1-app")
+	write("stack/resources/crd.yaml", "v1-crd")
+	run("add", "-A")
+	run("commit", "--quiet", "-m", "v1")
+	run("tag", "v1")
+	first := run("rev-parse", "HEAD")
+
+	write("stack/app.yaml", "v2-app")
+	if err := os.Symlink("/etc/hostname", filepath.Join(dir, "stack/ui-schema.yaml")); err != nil {
+		t.Fatalf("cannot create symlink: %s", err)
+	}
+	run("add", "-A")
+	run("commit", "--quiet", "-m", "v2")
+
+	return "file://" + dir, first
+}
+
+func TestResourceGitWalk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stack-git-test-")
+	if err != nil {
+		t.Fatalf("cannot create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	url, first := mockGitRepo(t, dir)
+
+	allowed := gitAllowedProtocols
+	gitAllowedProtocols = "file"
+	defer func() { gitAllowedProtocols = allowed }()
+
+	cases := map[string]struct {
+		ref     string
+		base    string
+		want    map[string]string
+		wantErr bool
+	}{
+		"DefaultBranch": {
+			base: "/stack",
+			want: map[string]string{
+				"/stack/app.yaml":           "v2-app",
+				"/stack/resources/crd.yaml": "v1-crd",
+				"/stack/ui-schema.yaml":     "/etc/hostname",
+			},
+		},
+		"Tag": {
+			ref:  "v1",
+			base: "stack",
+			want: map[string]string{
+				"/stack/app.yaml":           "v1-app",
+				"/stack/resources/crd.yaml": "v1-crd",
+			},
+		},
+		"Commit": {
+			ref: first,
+			want: map[string]string{
+				"/README.md":                "readme",
+				"/stack/app.yaml":           "v1-app",
+				"/stack/resources/crd.yaml": "v1-crd",
+			},
+		},
+		"MissingRef": {
+			ref:     "v3",
+			wantErr: true,
+		},
+		"OptionRef": {
+			ref:     "--upload-pack=touch /tmp/pwned",
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := map[string]string{}
+			rg := &ResourceGit{URL: url, Ref: tc.ref, Base: tc.base}
+			rg.AddStep("*.*", func(path string, b []byte) error {
+				got[path] = string(b)
+				return nil
+			})
+
+			err := rg.Walk()
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Walk(): expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Walk(): %s", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Walk(): -want, +got:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestResourceGitFileProtocol(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stack-git-test-")
+	if err != nil {
+		t.Fatalf("cannot create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	url, _ := mockGitRepo(t, dir)
+
+	for _, u := range []string{url, dir} {
+		rg := &ResourceGit{URL: u}
+		if err := rg.Walk(); err == nil {
+			t.Errorf("Walk(): expected the repository %q on the local filesystem to be rejected", u)
+		}
+	}
+}
@@ -0,0 +1,567 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package walker
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+const (
+	dockerManifestFile = "manifest.json"
+	ociIndexFile       = "index.json"
+	ociBlobsDir        = "blobs"
+
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = whiteoutPrefix + whiteoutPrefix + ".opq"
+
+	// maxIndexDepth limits how many image indexes will be followed to find an
+	// image manifest.
+	maxIndexDepth = 4
+
+	// maxSymlinks limits how many symlinks will be followed to resolve a
+	// file, as Linux does.
+	maxSymlinks = 40
+)
+
+// dockerManifest is an entry of the manifest.json file written by
+// `docker save`.
+type dockerManifest struct {
+	Config string
+	Layers []string
+}
+
+// ociDescriptor is the subset of an OCI content descriptor needed to locate a
+// blob.
+type ociDescriptor struct {
+	Digest string `json:"digest"`
+}
+
+// ociManifest is the subset of an OCI image manifest or image index needed to
+// find the layers of an image.
+type ociManifest struct {
+	Manifests []ociDescriptor `json:"manifests,omitempty"`
+	Layers    []ociDescriptor `json:"layers,omitempty"`
+}
+
+// ResourceImage walks the files of a container image without the need for a
+// container runtime. The image may be a `docker save` tarball, an OCI image
+// layout tarball, or an OCI image layout directory. Image layers are merged in
+// order, honouring whiteout files, before the Base directory is walked.
+// Symlinks to files within the Base directory are followed, as they are by a
+// ResourceDir.
+type ResourceImage struct {
+	// Base is the directory within the image that will be walked, e.g.
+	// "/.registry". It is expected to be an absolute path.
+	Base string
+
+	// Image is the path of the image tarball or image layout directory.
+	Image string
+
+	// Fs is the filesystem the Image is read from.
+	Fs afero.Fs
+
+	// Limits constrain the size of the files within the Base directory.
+	Limits Limits
+
+	steps []imageStep
+}
+
+type imageStep struct {
+	pattern string
+	step    Step
+}
+
+// AddStep adds a Step to the Walker
+// Each Step will be given the bytes and filepath of resource files matching the supplied name pattern
+func (ri *ResourceImage) AddStep(pattern string, step Step) {
+	ri.steps = append(ri.steps, imageStep{pattern: pattern, step: step})
+}
+
+// SetLimits sets the size limits of the files that will be read.
+func (ri *ResourceImage) SetLimits(l Limits) {
+	ri.Limits = l
+}
+
+// Walk applies all of the Step functions against the files of the Base
+// directory of the merged image filesystem, in lexical order.
+func (ri *ResourceImage) Walk() error {
+	a, err := ri.openArchive()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = a.Close() }()
+
+	layers, err := imageLayers(a)
+	if err != nil {
+		return err
+	}
+
+	base := path.Clean("/" + filepath.ToSlash(ri.Base))
+	merged := newLayerFiles()
+	for _, l := range layers {
+		if err := applyLayer(a, l, base, ri.Limits, merged); err != nil {
+			return errors.Wrapf(err, "cannot apply image layer %q", l)
+		}
+	}
+
+	files, err := merged.resolve(base, ri.Limits)
+	if err != nil {
+		return err
+	}
+	return walkFiles(files, ri.steps)
+}
+
+// walkFiles applies the supplied steps to the supplied files, in the order
+// filepath.Walk would visit them.
+func walkFiles(files map[string][]byte, steps []imageStep) error {
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Slice(paths, func(i, j int) bool { return lessPath(paths[i], paths[j]) })
+
+	for _, p := range paths {
+		for _, s := range steps {
+			match, err := filepath.Match(s.pattern, path.Base(p))
+			if err != nil {
+				return err
+			}
+			if !match {
+				continue
+			}
+			if err := s.step(p, files[p]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lessPath orders paths the same way filepath.Walk visits them, i.e. by
+// comparing each path element in turn.
+func lessPath(a, b string) bool {
+	ae := strings.Split(a, "/")
+	be := strings.Split(b, "/")
+	for i := 0; i < len(ae) && i < len(be); i++ {
+		if ae[i] != be[i] {
+			return ae[i] < be[i]
+		}
+	}
+	return len(ae) < len(be)
+}
+
+// imageArchive provides access to the named files of an image tarball or
+// image layout directory.
+type imageArchive interface {
+	Open(name string) (io.ReadCloser, error)
+	Close() error
+}
+
+func (ri *ResourceImage) openArchive() (imageArchive, error) {
+	info, err := ri.Fs.Stat(ri.Image)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot stat image %q", ri.Image)
+	}
+	if info.IsDir() {
+		return &dirArchive{fs: ri.Fs, dir: ri.Image}, nil
+	}
+
+	f, err := ri.Fs.Open(ri.Image)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot open image %q", ri.Image)
+	}
+	a, err := newTarArchive(f, info.Size())
+	if err != nil {
+		_ = f.Close()
+		return nil, errors.Wrapf(err, "cannot read image tarball %q", ri.Image)
+	}
+	return a, nil
+}
+
+// dirArchive reads an image layout from a directory.
+type dirArchive struct {
+	fs  afero.Fs
+	dir string
+}
+
+func (d *dirArchive) Open(name string) (io.ReadCloser, error) {
+	return d.fs.Open(filepath.Join(d.dir, filepath.FromSlash(name)))
+}
+
+func (d *dirArchive) Close() error { return nil }
+
+// tarArchive reads an image from a tarball. Only the offsets of each entry are
+// held in memory; entries are read on demand.
+type tarArchive struct {
+	f       afero.File
+	entries map[string]*io.SectionReader
+}
+
+// countingReader counts the bytes read through it, so that the offset of each
+// tar entry can be recorded.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func newTarArchive(f afero.File, size int64) (*tarArchive, error) {
+	a := &tarArchive{f: f, entries: map[string]*io.SectionReader{}}
+	cr := &countingReader{r: f}
+	tr := tar.NewReader(cr)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		if cr.n+h.Size > size {
+			return nil, errors.Errorf("tar entry %q exceeds tarball size", h.Name)
+		}
+		a.entries[cleanArchivePath(h.Name)] = io.NewSectionReader(f, cr.n, h.Size)
+	}
+	return a, nil
+}
+
+func (a *tarArchive) Open(name string) (io.ReadCloser, error) {
+	s, ok := a.entries[cleanArchivePath(name)]
+	if !ok {
+		return nil, errors.Errorf("%q not found in image tarball", name)
+	}
+	return ioutil.NopCloser(io.NewSectionReader(s, 0, s.Size())), nil
+}
+
+func (a *tarArchive) Close() error { return a.f.Close() }
+
+// cleanArchivePath returns a relative, slash separated path suitable for
+// looking up archive entries.
+func cleanArchivePath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+}
+
+func readArchiveJSON(a imageArchive, name string, v interface{}) error {
+	rc, err := a.Open(name)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rc.Close() }()
+	return errors.Wrapf(json.NewDecoder(rc).Decode(v), "cannot decode %q", name)
+}
+
+// imageLayers returns the archive paths of the image layers, lowest first.
+// The `docker save` manifest.json is preferred when present, otherwise the OCI
+// index.json is used. When an archive contains more than one image the first
+// is used.
+func imageLayers(a imageArchive) ([]string, error) {
+	dm := []dockerManifest{}
+	if err := readArchiveJSON(a, dockerManifestFile, &dm); err == nil {
+		if len(dm) == 0 {
+			return nil, errors.Errorf("%s contains no images", dockerManifestFile)
+		}
+		return dm[0].Layers, nil
+	}
+
+	idx := ociManifest{}
+	if err := readArchiveJSON(a, ociIndexFile, &idx); err != nil {
+		return nil, errors.Wrapf(err, "image contains neither %s nor %s", dockerManifestFile, ociIndexFile)
+	}
+
+	// Follow image indexes (i.e. multi-platform images) until we find an
+	// image manifest.
+	m := idx
+	for depth := 0; len(m.Manifests) > 0; depth++ {
+		if depth == maxIndexDepth {
+			return nil, errors.Errorf("image indexes are nested more than %d deep", maxIndexDepth)
+		}
+		next := ociManifest{}
+		if err := readArchiveJSON(a, blobPath(m.Manifests[0].Digest), &next); err != nil {
+			return nil, err
+		}
+		m = next
+	}
+
+	layers := make([]string, len(m.Layers))
+	for i, l := range m.Layers {
+		layers[i] = blobPath(l.Digest)
+	}
+	return layers, nil
+}
+
+// blobPath returns the OCI image layout path of the blob with the supplied
+// digest, e.g. sha256:abc -> blobs/sha256/abc
+func blobPath(digest string) string {
+	return path.Join(ociBlobsDir, strings.Replace(digest, ":", "/", 1))
+}
+
+// layerFiles are the regular files and symlinks within the Base directory of
+// the layers merged so far.
+type layerFiles struct {
+	files map[string][]byte
+
+	// symlinks maps the path of each symlink to the absolute path of its
+	// target. Symlinks are resolved once every layer has been merged, because
+	// their targets may be added by a later layer.
+	symlinks map[string]string
+}
+
+func newLayerFiles() *layerFiles {
+	return &layerFiles{files: map[string][]byte{}, symlinks: map[string]string{}}
+}
+
+// applyLayer merges the files of the named layer that are within base into
+// lf. Whiteouts are applied before the files of the layer are added.
+// Layers may be uncompressed or gzip compressed tarballs. The limits are
+// enforced before each file is read, and against the merged files.
+func applyLayer(a imageArchive, name, base string, limits Limits, lf *layerFiles) error {
+	rc, err := a.Open(name)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rc.Close() }()
+	return readLayer(rc, base, limits, lf)
+}
+
+// readLayer merges the files of the supplied layer tarball that are within
+// base into lf, as described by applyLayer. Each entry replaces whatever a
+// lower layer had at its path, so a directory replaced by a file loses its
+// contents. Hard links must link to a file within base.
+func readLayer(rc io.Reader, base string, limits Limits, lf *layerFiles) error {
+	br := bufio.NewReader(rc)
+	var r io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = gz.Close() }()
+		r = gz
+	}
+
+	// Files added by this layer may replace existing files, so the running
+	// total is conservative until the layer has been merged.
+	total := totalSize(lf.files)
+	added := map[string][]byte{}
+	symlinks := map[string]string{}
+	links := map[string]string{}
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		p := path.Clean("/" + filepath.ToSlash(h.Name))
+		dir, file := path.Split(p)
+
+		switch {
+		case file == whiteoutOpaque:
+			lf.removeTree(path.Clean(dir), false)
+			continue
+		case strings.HasPrefix(file, whiteoutPrefix):
+			lf.removeTree(path.Join(dir, strings.TrimPrefix(file, whiteoutPrefix)), true)
+			continue
+		}
+
+		// A directory replaces a file but is merged with a directory, while
+		// anything else replaces the file or directory at its path.
+		if h.Typeflag == tar.TypeDir {
+			lf.remove(p)
+		} else {
+			lf.removeTree(p, true)
+		}
+
+		if !withinDir(p, base) {
+			continue
+		}
+
+		switch h.Typeflag {
+		case tar.TypeReg:
+			if err := limits.checkFile(p, h.Size); err != nil {
+				return err
+			}
+			total += h.Size
+			if err := limits.checkTotal(total); err != nil {
+				return err
+			}
+			b, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return errors.Wrapf(err, "cannot read %q", p)
+			}
+			added[p] = b
+		case tar.TypeSymlink:
+			symlinks[p] = path.Join(dir, h.Linkname)
+			if path.IsAbs(h.Linkname) {
+				symlinks[p] = path.Clean(h.Linkname)
+			}
+		case tar.TypeLink:
+			links[p] = path.Clean("/" + filepath.ToSlash(h.Linkname))
+		}
+	}
+
+	if err := lf.merge(base, added, symlinks, links); err != nil {
+		return err
+	}
+	return limits.checkTotal(totalSize(lf.files))
+}
+
+// merge adds the supplied files, symlinks, and hard links of a layer to lf.
+// Hard links are resolved against the merged files, so they may link to a
+// file added by a lower layer.
+func (lf *layerFiles) merge(base string, files map[string][]byte, symlinks, links map[string]string) error {
+	for p, b := range files {
+		lf.files[p] = b
+	}
+	for p, target := range symlinks {
+		lf.symlinks[p] = target
+	}
+	for p, target := range links {
+		if !withinDir(target, base) {
+			return errors.Errorf("file %q is a hard link to %q, which is outside %q", p, target, base)
+		}
+		if b, ok := lf.files[target]; ok {
+			lf.files[p] = b
+			continue
+		}
+		if t, ok := lf.symlinks[target]; ok {
+			lf.symlinks[p] = t
+			continue
+		}
+		return errors.Errorf("file %q is a hard link to %q, which does not exist", p, target)
+	}
+	return nil
+}
+
+// resolve returns the merged files, including the files that symlinks
+// resolve to. As with a ResourceDir, symlinks to directories are skipped and
+// symlinks that resolve outside base are rejected. The limits are enforced
+// against the resolved files.
+func (lf *layerFiles) resolve(base string, limits Limits) (map[string][]byte, error) {
+	files := make(map[string][]byte, len(lf.files)+len(lf.symlinks))
+	for p, b := range lf.files {
+		files[p] = b
+	}
+	for p := range lf.symlinks {
+		b, ok, err := lf.resolveSymlink(p, base)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			files[p] = b
+		}
+	}
+	return files, limits.checkTotal(totalSize(files))
+}
+
+// resolveSymlink returns the content of the file the supplied symlink
+// resolves to, or false if it resolves to a directory.
+func (lf *layerFiles) resolveSymlink(p, base string) ([]byte, bool, error) {
+	target := lf.symlinks[p]
+	for i := 0; i < maxSymlinks; i++ {
+		if target != base && !withinDir(target, base) {
+			return nil, false, errors.Errorf("file %q is a symlink to %q, which is outside %q", p, target, base)
+		}
+		if b, ok := lf.files[target]; ok {
+			return b, true, nil
+		}
+		next, ok := lf.symlinks[target]
+		if !ok {
+			if lf.isDir(target) {
+				return nil, false, nil
+			}
+			return nil, false, errors.Errorf("file %q is a symlink to %q, which does not exist", p, target)
+		}
+		target = next
+	}
+	return nil, false, errors.Errorf("cannot resolve symlink %q: too many levels of symlinks", p)
+}
+
+// isDir reports whether dir contains any files or symlinks.
+func (lf *layerFiles) isDir(dir string) bool {
+	for p := range lf.files {
+		if withinDir(p, dir) {
+			return true
+		}
+	}
+	for p := range lf.symlinks {
+		if withinDir(p, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+func totalSize(files map[string][]byte) int64 {
+	var total int64
+	for _, b := range files {
+		total += int64(len(b))
+	}
+	return total
+}
+
+// removeTree removes dir and everything beneath it from lf. The dir itself is
+// kept if inclusive is false.
+func (lf *layerFiles) removeTree(dir string, inclusive bool) {
+	for p := range lf.files {
+		if (inclusive && p == dir) || withinDir(p, dir) {
+			delete(lf.files, p)
+		}
+	}
+	for p := range lf.symlinks {
+		if (inclusive && p == dir) || withinDir(p, dir) {
+			delete(lf.symlinks, p)
+		}
+	}
+}
+
+// remove removes the file or symlink at p from lf.
+func (lf *layerFiles) remove(p string) {
+	delete(lf.files, p)
+	delete(lf.symlinks, p)
+}
+
+// withinDir reports whether p is beneath dir.
+func withinDir(p, dir string) bool {
+	if dir == "/" {
+		return p != "/"
+	}
+	return strings.HasPrefix(p, dir+"/")
+}
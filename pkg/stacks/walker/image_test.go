@@ -0,0 +1,401 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package walker
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/afero"
+)
+
+type tarEntry struct {
+	name     string
+	body     string
+	typeflag byte
+	linkname string
+}
+
+func mockTar(entries ...tarEntry) []byte {
+	b := &bytes.Buffer{}
+	tw := tar.NewWriter(b)
+	for _, e := range entries {
+		tf := e.typeflag
+		if tf == 0 {
+			tf = tar.TypeReg
+		}
+		h := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.body)), Typeflag: tf, Linkname: e.linkname}
+		if tf != tar.TypeReg {
+			h.Size = 0
+		}
+		_ = tw.WriteHeader(h)
+		if tf == tar.TypeReg {
+			_, _ = tw.Write([]byte(e.body))
+		}
+	}
+	_ = tw.Close()
+	return b.Bytes()
+}
+
+func mockGzip(b []byte) []byte {
+	out := &bytes.Buffer{}
+	gz := gzip.NewWriter(out)
+	_, _ = gz.Write(b)
+	_ = gz.Close()
+	return out.Bytes()
+}
+
+func digest(b []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(b))
+}
+
+var (
+	lowerLayer = mockTar(
+		tarEntry{name: ".registry/", typeflag: tar.TypeDir},
+		tarEntry{name: ".registry/app.yaml", body: "lower-app"},
+		tarEntry{name: ".registry/removed.yaml", body: "removed"},
+		tarEntry{name: ".registry/resources/old/crd.yaml", body: "old-crd"},
+		tarEntry{name: ".registry/resources/kept/crd.yaml", body: "kept-crd"},
+		tarEntry{name: "manager", body: "not-in-base"},
+	)
+	upperLayer = mockTar(
+		tarEntry{name: "./.registry/app.yaml", body: "upper-app"},
+		tarEntry{name: ".registry/.wh.removed.yaml"},
+		tarEntry{name: ".registry/resources/old/.wh..wh..opq"},
+		tarEntry{name: ".registry/resources/old/new.crd.yaml", body: "new-crd"},
+		tarEntry{name: ".registry/install.yaml", body: "install"},
+		tarEntry{name: ".registry/linked.crd.yaml", typeflag: tar.TypeLink, linkname: ".registry/install.yaml"},
+	)
+
+	wantFiles = map[string]string{
+		"/.registry/app.yaml":                   "upper-app",
+		"/.registry/install.yaml":               "install",
+		"/.registry/linked.crd.yaml":            "install",
+		"/.registry/resources/kept/crd.yaml":    "kept-crd",
+		"/.registry/resources/old/new.crd.yaml": "new-crd",
+	}
+	wantOrder = []string{
+		"/.registry/app.yaml",
+		"/.registry/install.yaml",
+		"/.registry/linked.crd.yaml",
+		"/.registry/resources/kept/crd.yaml",
+		"/.registry/resources/old/new.crd.yaml",
+	}
+)
+
+func dockerSaveTarball() []byte {
+	return mockTar(
+		tarEntry{name: "manifest.json", body: `[{"Config":"cfg.json","RepoTags":["stack:latest"],"Layers":["lower/layer.tar","upper/layer.tar"]}]`},
+		tarEntry{name: "upper/layer.tar", body: string(upperLayer)},
+		tarEntry{name: "lower/layer.tar", body: string(lowerLayer)},
+	)
+}
+
+// dockerSave returns a `docker save` tarball of an image with the supplied
+// layers, lowest first.
+func dockerSave(layers ...[]byte) []byte {
+	names := make([]string, len(layers))
+	entries := make([]tarEntry, 0, len(layers)+1)
+	for i, l := range layers {
+		names[i] = fmt.Sprintf("%d/layer.tar", i)
+		entries = append(entries, tarEntry{name: names[i], body: string(l)})
+	}
+	manifest := fmt.Sprintf(`[{"Config":"cfg.json","Layers":["%s"]}]`, strings.Join(names, `","`))
+	return mockTar(append(entries, tarEntry{name: "manifest.json", body: manifest})...)
+}
+
+func ociLayout() map[string][]byte {
+	lower := mockGzip(lowerLayer)
+	manifest := fmt.Sprintf(`{"layers":[{"digest":%q},{"digest":%q}]}`, digest(lower), digest(upperLayer))
+	platforms := fmt.Sprintf(`{"manifests":[{"digest":%q}]}`, digest([]byte(manifest)))
+	return map[string][]byte{
+		"oci-layout":                        []byte(`{"imageLayoutVersion":"1.0.0"}`),
+		"index.json":                        []byte(fmt.Sprintf(`{"manifests":[{"digest":%q}]}`, digest([]byte(platforms)))),
+		blobPath(digest([]byte(platforms))): []byte(platforms),
+		blobPath(digest([]byte(manifest))):  []byte(manifest),
+		blobPath(digest(lower)):             lower,
+		blobPath(digest(upperLayer)):        upperLayer,
+	}
+}
+
+func TestResourceImageWalk(t *testing.T) {
+	tests := []struct {
+		name string
+		fs   func() afero.Fs
+	}{
+		{
+			name: "DockerSaveTarball",
+			fs: func() afero.Fs {
+				fs := afero.NewMemMapFs()
+				_ = afero.WriteFile(fs, "/image", dockerSaveTarball(), 0644)
+				return fs
+			},
+		},
+		{
+			name: "OCILayoutTarball",
+			fs: func() afero.Fs {
+				entries := []tarEntry{}
+				for name, b := range ociLayout() {
+					entries = append(entries, tarEntry{name: name, body: string(b)})
+				}
+				fs := afero.NewMemMapFs()
+				_ = afero.WriteFile(fs, "/image", mockTar(entries...), 0644)
+				return fs
+			},
+		},
+		{
+			name: "OCILayoutDirectory",
+			fs: func() afero.Fs {
+				fs := afero.NewMemMapFs()
+				for name, b := range ociLayout() {
+					_ = fs.MkdirAll(filepath.Dir(filepath.Join("/image", name)), 0755)
+					_ = afero.WriteFile(fs, filepath.Join("/image", name), b, 0644)
+				}
+				return fs
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ri := &ResourceImage{Base: "/.registry", Image: "/image", Fs: tt.fs()}
+
+			gotFiles := map[string]string{}
+			gotOrder := []string{}
+			ri.AddStep("*.yaml", func(path string, b []byte) error {
+				gotFiles[path] = string(b)
+				gotOrder = append(gotOrder, path)
+				return nil
+			})
+
+			if err := ri.Walk(); err != nil {
+				t.Fatalf("Walk(): %s", err)
+			}
+			if diff := cmp.Diff(wantFiles, gotFiles); diff != "" {
+				t.Errorf("Walk(): -want files, +got files:\n%s", diff)
+			}
+			if diff := cmp.Diff(wantOrder, gotOrder); diff != "" {
+				t.Errorf("Walk(): -want order, +got order:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestResourceImageWalkLayers(t *testing.T) {
+	cases := map[string]struct {
+		layers    [][]byte
+		wantFiles map[string]string
+		wantErr   bool
+	}{
+		"Symlinks": {
+			layers: [][]byte{
+				mockTar(
+					tarEntry{name: ".registry/app.yaml", body: "app"},
+					tarEntry{name: ".registry/resources/crd.yaml", body: "crd"},
+					tarEntry{name: ".registry/relative.yaml", typeflag: tar.TypeSymlink, linkname: "resources/crd.yaml"},
+					tarEntry{name: ".registry/resources/absolute.yaml", typeflag: tar.TypeSymlink, linkname: "/.registry/app.yaml"},
+					tarEntry{name: ".registry/chained.yaml", typeflag: tar.TypeSymlink, linkname: "relative.yaml"},
+					tarEntry{name: ".registry/directory", typeflag: tar.TypeSymlink, linkname: "resources"},
+				),
+			},
+			wantFiles: map[string]string{
+				"/.registry/app.yaml":                "app",
+				"/.registry/chained.yaml":            "crd",
+				"/.registry/relative.yaml":           "crd",
+				"/.registry/resources/absolute.yaml": "app",
+				"/.registry/resources/crd.yaml":      "crd",
+			},
+		},
+		"SymlinkToUpperLayer": {
+			layers: [][]byte{
+				mockTar(tarEntry{name: ".registry/app.yaml", typeflag: tar.TypeSymlink, linkname: "real.yaml"}),
+				mockTar(tarEntry{name: ".registry/real.yaml", body: "app"}),
+			},
+			wantFiles: map[string]string{
+				"/.registry/app.yaml":  "app",
+				"/.registry/real.yaml": "app",
+			},
+		},
+		"SymlinkOutsideBase": {
+			layers: [][]byte{
+				mockTar(
+					tarEntry{name: "etc/passwd", body: "root"},
+					tarEntry{name: ".registry/app.yaml", typeflag: tar.TypeSymlink, linkname: "../etc/passwd"},
+				),
+			},
+			wantErr: true,
+		},
+		"DanglingSymlink": {
+			layers: [][]byte{
+				mockTar(tarEntry{name: ".registry/app.yaml", typeflag: tar.TypeSymlink, linkname: "missing.yaml"}),
+			},
+			wantErr: true,
+		},
+		"SymlinkLoop": {
+			layers: [][]byte{
+				mockTar(
+					tarEntry{name: ".registry/a.yaml", typeflag: tar.TypeSymlink, linkname: "b.yaml"},
+					tarEntry{name: ".registry/b.yaml", typeflag: tar.TypeSymlink, linkname: "a.yaml"},
+				),
+			},
+			wantErr: true,
+		},
+		"HardLinkOutsideBase": {
+			layers: [][]byte{
+				mockTar(
+					tarEntry{name: "app.yaml", body: "app"},
+					tarEntry{name: ".registry/app.yaml", typeflag: tar.TypeLink, linkname: "app.yaml"},
+				),
+			},
+			wantErr: true,
+		},
+		"HardLinkToLowerLayer": {
+			layers: [][]byte{
+				mockTar(tarEntry{name: ".registry/app.yaml", body: "app"}),
+				mockTar(tarEntry{name: ".registry/linked.yaml", typeflag: tar.TypeLink, linkname: ".registry/app.yaml"}),
+			},
+			wantFiles: map[string]string{
+				"/.registry/app.yaml":    "app",
+				"/.registry/linked.yaml": "app",
+			},
+		},
+		"DirectoryReplacedByFile": {
+			layers: [][]byte{
+				mockTar(
+					tarEntry{name: ".registry/resources/", typeflag: tar.TypeDir},
+					tarEntry{name: ".registry/resources/crd.yaml", body: "crd"},
+				),
+				mockTar(tarEntry{name: ".registry/resources", body: "file"}),
+			},
+			wantFiles: map[string]string{
+				"/.registry/resources": "file",
+			},
+		},
+		"DirectoryReplacedBySymlink": {
+			layers: [][]byte{
+				mockTar(
+					tarEntry{name: ".registry/old/crd.yaml", body: "old"},
+					tarEntry{name: ".registry/new/crd.yaml", body: "new"},
+				),
+				mockTar(tarEntry{name: ".registry/old", typeflag: tar.TypeSymlink, linkname: "new"}),
+			},
+			wantFiles: map[string]string{
+				"/.registry/new/crd.yaml": "new",
+			},
+		},
+		"BaseReplacedByFile": {
+			layers: [][]byte{
+				mockTar(tarEntry{name: ".registry/app.yaml", body: "app"}),
+				mockTar(tarEntry{name: ".registry", body: "file"}),
+			},
+			wantFiles: map[string]string{},
+		},
+		"FileReplacedByDirectory": {
+			layers: [][]byte{
+				mockTar(tarEntry{name: ".registry/resources", body: "file"}),
+				mockTar(
+					tarEntry{name: ".registry/resources/", typeflag: tar.TypeDir},
+					tarEntry{name: ".registry/resources/crd.yaml", body: "crd"},
+				),
+			},
+			wantFiles: map[string]string{
+				"/.registry/resources/crd.yaml": "crd",
+			},
+		},
+		"DirectoryMergedWithDirectory": {
+			layers: [][]byte{
+				mockTar(tarEntry{name: ".registry/resources/old.yaml", body: "old"}),
+				mockTar(
+					tarEntry{name: ".registry/resources/", typeflag: tar.TypeDir},
+					tarEntry{name: ".registry/resources/new.yaml", body: "new"},
+				),
+			},
+			wantFiles: map[string]string{
+				"/.registry/resources/new.yaml": "new",
+				"/.registry/resources/old.yaml": "old",
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			_ = afero.WriteFile(fs, "/image", dockerSave(tc.layers...), 0644)
+			ri := &ResourceImage{Base: "/.registry", Image: "/image", Fs: fs}
+
+			gotFiles := map[string]string{}
+			ri.AddStep("*", func(path string, b []byte) error {
+				gotFiles[path] = string(b)
+				return nil
+			})
+
+			err := ri.Walk()
+			if tc.wantErr != (err != nil) {
+				t.Fatalf("Walk(): want error %t, got %v", tc.wantErr, err)
+			}
+			if tc.wantErr {
+				return
+			}
+			if diff := cmp.Diff(tc.wantFiles, gotFiles); diff != "" {
+				t.Errorf("Walk(): -want files, +got files:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestResourceImageWalkNotAnImage(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	_ = afero.WriteFile(fs, "/image", mockTar(tarEntry{name: "hello", body: "world"}), 0644)
+	ri := &ResourceImage{Base: "/.registry", Image: "/image", Fs: fs}
+	if err := ri.Walk(); err == nil {
+		t.Errorf("Walk(): expected error walking a tarball that is not an image")
+	}
+}
+
+func TestResourceImageWalkLimits(t *testing.T) {
+	cases := map[string]struct {
+		limits  Limits
+		wantErr bool
+	}{
+		"Unlimited":       {limits: Limits{}},
+		"WithinLimits":    {limits: Limits{MaxFileSize: 9, MaxTotalSize: 64}},
+		"FileTooLarge":    {limits: Limits{MaxFileSize: 8}, wantErr: true},
+		"PackageTooLarge": {limits: Limits{MaxTotalSize: 32}, wantErr: true},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			_ = afero.WriteFile(fs, "/image", dockerSaveTarball(), 0644)
+			ri := &ResourceImage{Base: "/.registry", Image: "/image", Fs: fs}
+			ri.SetLimits(tc.limits)
+			ri.AddStep("*.yaml", func(string, []byte) error { return nil })
+
+			err := ri.Walk()
+			if tc.wantErr != (err != nil) {
+				t.Errorf("Walk(): want error %t, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
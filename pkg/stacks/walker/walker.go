@@ -19,6 +19,10 @@ package walker
 import (
 	"os"
 	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
 )
 
 // A Step is a function that takes the name and bytes of a file and processes it in some way
@@ -30,6 +34,39 @@ type ResourceWalker interface {
 	AddStep(pattern string, step Step)
 }
 
+// A LimitSetter constrains the size of the files a ResourceWalker reads.
+// ResourceWalkers that do not implement LimitSetter are not constrained.
+type LimitSetter interface {
+	SetLimits(l Limits)
+}
+
+// Limits constrain the size of the files a ResourceWalker will read, so that a
+// pathological package cannot exhaust memory. A zero limit is not enforced.
+type Limits struct {
+	// MaxFileSize is the maximum size in bytes of any one file.
+	MaxFileSize int64
+
+	// MaxTotalSize is the maximum size in bytes of all files combined.
+	MaxTotalSize int64
+}
+
+// checkFile returns an error if a file of the supplied size exceeds the limits.
+func (l Limits) checkFile(path string, size int64) error {
+	if l.MaxFileSize > 0 && size > l.MaxFileSize {
+		return errors.Errorf("file %q is %d bytes, which exceeds the limit of %d bytes", path, size, l.MaxFileSize)
+	}
+	return nil
+}
+
+// checkTotal returns an error if files of the supplied total size exceed the
+// limits.
+func (l Limits) checkTotal(size int64) error {
+	if l.MaxTotalSize > 0 && size > l.MaxTotalSize {
+		return errors.Errorf("files total at least %d bytes, which exceeds the limit of %d bytes", size, l.MaxTotalSize)
+	}
+	return nil
+}
+
 // ReadFileWalker is used to walk a file tree and read the contents of each file
 // This is used for mocking. `afero.Afero` fulfills this interface.
 // `filepath.Walk` and `ioutil.ReadFile` are functions in the core packages that fit
@@ -45,6 +82,7 @@ type ResourceDir struct {
 	// i.e. have a root to the path, at the very least "/".
 	Base    string
 	Walker  ReadFileWalker
+	Limits  Limits
 	walkers []filepath.WalkFunc
 }
 
@@ -65,15 +103,105 @@ func composeWalkers(walkers ...filepath.WalkFunc) filepath.WalkFunc {
 
 // Walk applies all of the Step functions against the Base directory
 func (rd *ResourceDir) Walk() error {
-	err := rd.Walker.Walk(rd.Base, composeWalkers(rd.walkers...))
+	walkers := append([]filepath.WalkFunc{rd.limitWalker()}, rd.walkers...)
+	err := rd.Walker.Walk(rd.Base, rd.linkWalker(composeWalkers(walkers...)))
 	return err
 }
 
+// SetLimits sets the size limits of the files that will be read.
+func (rd *ResourceDir) SetLimits(l Limits) {
+	rd.Limits = l
+}
+
+// linkWalker returns a filepath.WalkFunc that follows symlinks to files beneath
+// the Base directory, calling fn with the path of the link and the FileInfo of
+// its target, so that the target is read and subject to the limits like any
+// other file. Symlinks to directories are skipped; the directories are walked
+// at their own path. Symlinks that resolve outside the Base directory are
+// rejected.
+func (rd *ResourceDir) linkWalker(fn filepath.WalkFunc) filepath.WalkFunc {
+	return func(path string, info os.FileInfo, err error) error {
+		if info == nil || info.Mode()&os.ModeSymlink == 0 {
+			return fn(path, info, err)
+		}
+		target, err := rd.linkTarget(path)
+		if err != nil {
+			return err
+		}
+		if target.IsDir() {
+			return nil
+		}
+		return fn(path, target, nil)
+	}
+}
+
+// linkTarget returns the FileInfo of the target of the supplied symlink, which
+// must resolve to a path beneath the Base directory. Symlinks can only be
+// resolved when the Base directory is on the OS filesystem.
+func (rd *ResourceDir) linkTarget(path string) (os.FileInfo, error) {
+	base, baseOK := rd.osPath(rd.Base)
+	link, linkOK := rd.osPath(path)
+	if !baseOK || !linkOK {
+		return nil, errors.Errorf("file %q is a symlink, which is not supported", path)
+	}
+	base, err := filepath.EvalSymlinks(base)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot resolve %q", rd.Base)
+	}
+	target, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot resolve symlink %q", path)
+	}
+	if rel, err := filepath.Rel(base, target); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, errors.Errorf("file %q is a symlink to %q, which is outside %q", path, target, rd.Base)
+	}
+	info, err := os.Stat(target)
+	return info, errors.Wrapf(err, "cannot resolve symlink %q", path)
+}
+
+// osPath returns the path on the OS filesystem of the supplied path, if the
+// ResourceDir walks the OS filesystem.
+func (rd *ResourceDir) osPath(path string) (string, bool) {
+	a, ok := rd.Walker.(afero.Afero)
+	if !ok {
+		return "", false
+	}
+	switch fs := a.Fs.(type) {
+	case *afero.OsFs:
+		return path, true
+	case *afero.BasePathFs:
+		// e.g. the checkout of a ResourceGit.
+		p, err := fs.RealPath(path)
+		return p, err == nil
+	}
+	return "", false
+}
+
+// limitWalker returns a filepath.WalkFunc that enforces the limits on every
+// regular file beneath the Base directory before any Step reads it.
+func (rd *ResourceDir) limitWalker() filepath.WalkFunc {
+	var total int64
+	return func(path string, info os.FileInfo, err error) error {
+		if info.IsDir() || !info.Mode().IsRegular() {
+			return nil
+		}
+		if err := rd.Limits.checkFile(path, info.Size()); err != nil {
+			return err
+		}
+		total += info.Size()
+		return rd.Limits.checkTotal(total)
+	}
+}
+
 // AddStep adds a Step to the Walker
 // Each Step will be given the bytes and filepath of resource files matching the supplied name pattern
+// Only regular files, and symlinks to regular files, are read.
 func (rd *ResourceDir) AddStep(pattern string, step Step) {
 	wrappedStep := func(path string, info os.FileInfo, err error) error {
-		if match, err := filepath.Match(pattern, info.Name()); err != nil {
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if match, err := filepath.Match(pattern, filepath.Base(path)); err != nil {
 			return err
 		} else if match {
 			b, err := rd.Walker.ReadFile(path)
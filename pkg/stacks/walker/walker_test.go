@@ -16,7 +16,153 @@ limitations under the License.
 
 package walker
 
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+)
+
 var (
 	// Assert on test that *ResourceDir implements ResourceWalker
 	_ ResourceWalker = &ResourceDir{}
+
+	// Assert on test that *ResourceImage implements ResourceWalker
+	_ ResourceWalker = &ResourceImage{}
+
+	// Assert on test that the walkers of this package implement LimitSetter
+	_ LimitSetter = &ResourceDir{}
+	_ LimitSetter = &ResourceImage{}
+	_ LimitSetter = &ResourceGit{}
+	_ LimitSetter = &ResourceArchive{}
 )
+
+func TestResourceDirWalkLimits(t *testing.T) {
+	cases := map[string]struct {
+		limits Limits
+		want   error
+	}{
+		"Unlimited":    {limits: Limits{}},
+		"WithinLimits": {limits: Limits{MaxFileSize: 8, MaxTotalSize: 16}},
+		"FileTooLarge": {
+			limits: Limits{MaxFileSize: 7},
+			want:   errors.New(`file "/stack/app.yaml" is 8 bytes, which exceeds the limit of 7 bytes`),
+		},
+		"PackageTooLarge": {
+			limits: Limits{MaxTotalSize: 15},
+			want:   errors.New(`files total at least 16 bytes, which exceeds the limit of 15 bytes`),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			_ = afero.WriteFile(fs, "/stack/app.yaml", []byte("app: yes"), 0644)
+			_ = afero.WriteFile(fs, "/stack/crd.yaml", []byte("crd: yes"), 0644)
+
+			read := 0
+			rd := &ResourceDir{Base: "/stack", Walker: afero.Afero{Fs: fs}}
+			rd.SetLimits(tc.limits)
+			rd.AddStep("*.yaml", func(string, []byte) error {
+				read++
+				return nil
+			})
+
+			err := rd.Walk()
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("Walk(): -want error, +got error:\n%s", diff)
+			}
+			if tc.want != nil && read == 2 {
+				t.Errorf("Walk(): files were read despite exceeding the limits")
+			}
+		})
+	}
+}
+
+func TestResourceDirWalkSymlink(t *testing.T) {
+	type want struct {
+		// err returns the expected error given the paths of the link,
+		// the file outside the Base directory, and the Base directory.
+		err  func(link, outside, base string) error
+		read map[string]string
+	}
+
+	cases := map[string]struct {
+		target string
+		limits Limits
+		want   want
+	}{
+		"InTree": {
+			target: "shared/app.yaml",
+			want:   want{read: map[string]string{"app.yaml": "app: yes", "shared/app.yaml": "app: yes"}},
+		},
+		"InTreeDirectory": {
+			target: "shared",
+			want:   want{read: map[string]string{"shared/app.yaml": "app: yes"}},
+		},
+		"InTreeCountsTowardsLimits": {
+			target: "shared/app.yaml",
+			limits: Limits{MaxTotalSize: 15},
+			want: want{err: func(_, _, _ string) error {
+				return errors.New("files total at least 16 bytes, which exceeds the limit of 15 bytes")
+			}},
+		},
+		"OutsideTree": {
+			target: "../outside.yaml",
+			want: want{err: func(link, outside, base string) error {
+				return errors.Errorf("file %q is a symlink to %q, which is outside %q", link, outside, base)
+			}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "walker")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			dir, _ = filepath.EvalSymlinks(dir)
+
+			base := filepath.Join(dir, "stack")
+			outside := filepath.Join(dir, "outside.yaml")
+			if err := os.MkdirAll(filepath.Join(base, "shared"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			_ = ioutil.WriteFile(outside, []byte("secret: yes"), 0644)
+			_ = ioutil.WriteFile(filepath.Join(base, "shared", "app.yaml"), []byte("app: yes"), 0644)
+			link := filepath.Join(base, "app.yaml")
+			if err := os.Symlink(tc.target, link); err != nil {
+				t.Fatal(err)
+			}
+
+			read := map[string]string{}
+			rd := &ResourceDir{Base: base, Walker: afero.Afero{Fs: afero.NewOsFs()}, Limits: tc.limits}
+			rd.AddStep("*.yaml", func(path string, b []byte) error {
+				rel, _ := filepath.Rel(base, path)
+				read[filepath.ToSlash(rel)] = string(b)
+				return nil
+			})
+
+			var wantErr error
+			if tc.want.err != nil {
+				wantErr = tc.want.err(link, outside, base)
+			}
+			if diff := cmp.Diff(wantErr, rd.Walk(), test.EquateErrors()); diff != "" {
+				t.Errorf("Walk(): -want error, +got error:\n%s", diff)
+			}
+			if tc.want.err != nil {
+				return
+			}
+			if diff := cmp.Diff(tc.want.read, read); diff != "" {
+				t.Errorf("Walk(): -want read, +got read:\n%s", diff)
+			}
+		})
+	}
+}
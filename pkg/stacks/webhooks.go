@@ -0,0 +1,181 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	admissionregistration "k8s.io/api/admissionregistration/v1beta1"
+	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/crossplane/crossplane/apis/stacks/v1alpha1"
+	"github.com/crossplane/crossplane/pkg/stacks/walker"
+)
+
+// webhooksFileName is the package file that contains the stack's
+// ValidatingWebhookConfigurations and MutatingWebhookConfigurations. The
+// service name of each webhook is the name of the install Deployment that
+// serves it, e.g. "controller" for the primary controller. The service
+// namespace is ignored.
+const webhooksFileName = "webhooks.yaml"
+
+// webhooksStep unmarshals the webhook configurations in webhooks.yaml, which
+// are added to the StackPackager. The file may contain multiple YAML
+// documents.
+func webhooksStep(sp StackPackager) walker.Step {
+	return func(path string, b []byte) error {
+		return errors.Wrap(forEachDocument(b, sp.AddWebhookConfiguration), fmt.Sprintf("invalid webhooks %q", path))
+	}
+}
+
+// AddWebhookConfiguration adds the webhooks of a ValidatingWebhookConfiguration
+// or MutatingWebhookConfiguration to the Stack.
+func (sp *StackPackage) AddWebhookConfiguration(u unstructured.Unstructured) error {
+	b, err := u.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	w := sp.webhooks()
+	switch u.GetKind() {
+	case "ValidatingWebhookConfiguration":
+		c := admissionregistration.ValidatingWebhookConfiguration{}
+		if err := json.Unmarshal(b, &c); err != nil {
+			return err
+		}
+		for _, wh := range c.Webhooks {
+			if err := sp.setWebhookDeployment(wh.Name, wh.ClientConfig.Service, wh.ClientConfig.URL); err != nil {
+				return err
+			}
+		}
+		w.Validating = append(w.Validating, c.Webhooks...)
+	case "MutatingWebhookConfiguration":
+		c := admissionregistration.MutatingWebhookConfiguration{}
+		if err := json.Unmarshal(b, &c); err != nil {
+			return err
+		}
+		for _, wh := range c.Webhooks {
+			if err := sp.setWebhookDeployment(wh.Name, wh.ClientConfig.Service, wh.ClientConfig.URL); err != nil {
+				return err
+			}
+		}
+		w.Mutating = append(w.Mutating, c.Webhooks...)
+	default:
+		return errors.Errorf("webhooks kind %q is not supported, must be ValidatingWebhookConfiguration or MutatingWebhookConfiguration", u.GetKind())
+	}
+	return nil
+}
+
+// webhooks returns the Stack's webhooks, which are created on first use.
+func (sp *StackPackage) webhooks() *v1alpha1.WebhooksSpec {
+	if sp.Stack.Spec.Webhooks == nil {
+		sp.Stack.Spec.Webhooks = &v1alpha1.WebhooksSpec{}
+	}
+	return sp.Stack.Spec.Webhooks
+}
+
+// setWebhookDeployment records the install Deployment that serves the named
+// webhook. All of a stack's webhooks must be served by the same Deployment.
+func (sp *StackPackage) setWebhookDeployment(webhook string, svc *admissionregistration.ServiceReference, url *string) error {
+	if svc == nil || url != nil {
+		return errors.Errorf("webhook %q must be served by a service of the stack, not a URL", webhook)
+	}
+
+	w := sp.webhooks()
+	if w.Deployment != "" && w.Deployment != svc.Name {
+		return errors.Errorf("webhook %q is served by %q, but all webhooks must be served by %q", webhook, svc.Name, w.Deployment)
+	}
+	w.Deployment = svc.Name
+	return nil
+}
+
+// applyWebhooks records the Deployment that serves the conversion webhooks of
+// the stack's CRDs, and ensures that the stack's webhooks only intercept its
+// own CRDs and that the Deployment that serves them exists.
+func (sp *StackPackage) applyWebhooks() error {
+	for _, gk := range orderStackCRDKeys(sp.CRDs) {
+		c := sp.CRDs[gk].Spec.Conversion
+		if c == nil || c.Strategy != apiextensions.WebhookConverter {
+			continue
+		}
+		if c.WebhookClientConfig == nil {
+			return errors.Errorf("conversion webhook of %q must be served by a service of the stack", gk)
+		}
+		if err := sp.setWebhookDeployment(gk, convertServiceReference(c.WebhookClientConfig.Service), c.WebhookClientConfig.URL); err != nil {
+			return err
+		}
+	}
+
+	if sp.Stack.Spec.Webhooks == nil {
+		return nil
+	}
+
+	groups := map[string]bool{}
+	for _, crd := range sp.CRDs {
+		groups[crd.Spec.Group] = true
+	}
+	for _, wh := range sp.Stack.Spec.Webhooks.Validating {
+		if err := CheckWebhookRules(wh.Name, wh.Rules, groups); err != nil {
+			return err
+		}
+	}
+	for _, wh := range sp.Stack.Spec.Webhooks.Mutating {
+		if err := CheckWebhookRules(wh.Name, wh.Rules, groups); err != nil {
+			return err
+		}
+	}
+
+	name := sp.Stack.Spec.Webhooks.Deployment
+
+	c := sp.Stack.Spec.Controller
+	if name == PrimaryControllerName && c.Deployment != nil {
+		return nil
+	}
+	for _, d := range c.Deployments {
+		if d.Name == name {
+			return nil
+		}
+	}
+	return errors.Errorf("webhooks are served by install Deployment %q, which does not exist", name)
+}
+
+// CheckWebhookRules returns an error if the rules of the named webhook
+// intercept requests for any API group other than the supplied API groups of
+// the stack's CRDs.
+func CheckWebhookRules(webhook string, rules []admissionregistration.RuleWithOperations, groups map[string]bool) error {
+	for i, r := range rules {
+		if len(r.APIGroups) == 0 {
+			return errors.Errorf("webhook %q rule %d must specify the API groups of the stack's CRDs", webhook, i)
+		}
+		for _, g := range r.APIGroups {
+			if !groups[g] {
+				return errors.Errorf("webhook %q rule %d intercepts API group %q, which is not an API group of the stack's CRDs", webhook, i, g)
+			}
+		}
+	}
+	return nil
+}
+
+func convertServiceReference(s *apiextensions.ServiceReference) *admissionregistration.ServiceReference {
+	if s == nil {
+		return nil
+	}
+	return &admissionregistration.ServiceReference{Namespace: s.Namespace, Name: s.Name, Path: s.Path, Port: s.Port}
+}
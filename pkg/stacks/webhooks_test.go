@@ -0,0 +1,189 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stacks
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	admissionregistration "k8s.io/api/admissionregistration/v1beta1"
+	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/crossplane/crossplane/apis/stacks/v1alpha1"
+)
+
+func webhookConfigurationFile(kind, name, service string) string {
+	return fmt.Sprintf(`apiVersion: admissionregistration.k8s.io/v1beta1
+kind: %s
+metadata:
+  name: %s
+webhooks:
+- name: %s.samples.upbound.io
+  clientConfig:
+    service:
+      name: %s
+      namespace: unknown
+      path: /%s
+`, kind, name, name, service, name)
+}
+
+func withWebhookRule(file, group string) string {
+	return file + fmt.Sprintf(`  rules:
+  - apiGroups: [%q]
+    apiVersions: ["v1alpha1"]
+    operations: ["CREATE"]
+    resources: ["mytypes"]
+`, group)
+}
+
+func TestWebhooks(t *testing.T) {
+	path := func(p string) *string { return &p }
+	service := func(name, p string) admissionregistration.WebhookClientConfig {
+		return admissionregistration.WebhookClientConfig{
+			Service: &admissionregistration.ServiceReference{Name: name, Namespace: "unknown", Path: path(p)},
+		}
+	}
+	conversionCRD := func(service string) *apiextensions.CustomResourceDefinition {
+		crd := &apiextensions.CustomResourceDefinition{}
+		crd.Spec.Group = "samples.upbound.io"
+		crd.Spec.Names.Kind = "Mytype"
+		crd.Spec.Conversion = &apiextensions.CustomResourceConversion{
+			Strategy: apiextensions.WebhookConverter,
+			WebhookClientConfig: &apiextensions.WebhookClientConfig{
+				Service: &apiextensions.ServiceReference{Name: service, Namespace: "unknown"},
+			},
+		}
+		return crd
+	}
+
+	type want struct {
+		webhooks *v1alpha1.WebhooksSpec
+		err      error
+	}
+
+	cases := map[string]struct {
+		install  string
+		webhooks string
+		crd      *apiextensions.CustomResourceDefinition
+		want     want
+	}{
+		"NoWebhooks": {
+			install: simpleDeploymentInstallFile("crossplane/sample-stack:latest"),
+			want:    want{},
+		},
+		"ServedByPrimaryController": {
+			install: simpleDeploymentInstallFile("crossplane/sample-stack:latest"),
+			webhooks: webhookConfigurationFile("ValidatingWebhookConfiguration", "validate", "controller") + "---\n" +
+				webhookConfigurationFile("MutatingWebhookConfiguration", "mutate", "controller"),
+			crd: conversionCRD("controller"),
+			want: want{webhooks: &v1alpha1.WebhooksSpec{
+				Deployment: "controller",
+				Validating: []admissionregistration.ValidatingWebhook{{Name: "validate.samples.upbound.io", ClientConfig: service("controller", "/validate")}},
+				Mutating:   []admissionregistration.MutatingWebhook{{Name: "mutate.samples.upbound.io", ClientConfig: service("controller", "/mutate")}},
+			}},
+		},
+		"InterceptsOwnGroup": {
+			install:  simpleDeploymentInstallFile("crossplane/sample-stack:latest"),
+			webhooks: withWebhookRule(webhookConfigurationFile("ValidatingWebhookConfiguration", "validate", "controller"), "samples.upbound.io"),
+			crd:      conversionCRD("controller"),
+			want: want{webhooks: &v1alpha1.WebhooksSpec{
+				Deployment: "controller",
+				Validating: []admissionregistration.ValidatingWebhook{{
+					Name:         "validate.samples.upbound.io",
+					ClientConfig: service("controller", "/validate"),
+					Rules: []admissionregistration.RuleWithOperations{{
+						Operations: []admissionregistration.OperationType{admissionregistration.Create},
+						Rule: admissionregistration.Rule{
+							APIGroups:   []string{"samples.upbound.io"},
+							APIVersions: []string{"v1alpha1"},
+							Resources:   []string{"mytypes"},
+						},
+					}},
+				}},
+			}},
+		},
+		"InterceptsOtherGroup": {
+			install:  simpleDeploymentInstallFile("crossplane/sample-stack:latest"),
+			webhooks: withWebhookRule(webhookConfigurationFile("MutatingWebhookConfiguration", "mutate", "controller"), ""),
+			crd:      conversionCRD("controller"),
+			want: want{
+				err: errors.New(`webhook "mutate.samples.upbound.io" rule 0 intercepts API group "", which is not an API group of the stack's CRDs`),
+			},
+		},
+		"InterceptsAllGroups": {
+			install:  simpleDeploymentInstallFile("crossplane/sample-stack:latest"),
+			webhooks: withWebhookRule(webhookConfigurationFile("ValidatingWebhookConfiguration", "validate", "controller"), "*"),
+			crd:      conversionCRD("controller"),
+			want: want{
+				err: errors.New(`webhook "validate.samples.upbound.io" rule 0 intercepts API group "*", which is not an API group of the stack's CRDs`),
+			},
+		},
+		"ConversionServedByOtherDeployment": {
+			install:  simpleDeploymentInstallFile("crossplane/sample-stack:latest"),
+			webhooks: webhookConfigurationFile("ValidatingWebhookConfiguration", "validate", "controller"),
+			crd:      conversionCRD("webhook"),
+			want: want{
+				err: errors.New(`webhook "Mytype.samples.upbound.io" is served by "webhook", but all webhooks must be served by "controller"`),
+			},
+		},
+		"MissingDeployment": {
+			install:  simpleDeploymentInstallFile("crossplane/sample-stack:latest"),
+			webhooks: webhookConfigurationFile("ValidatingWebhookConfiguration", "validate", "webhook"),
+			want: want{
+				err: errors.New(`webhooks are served by install Deployment "webhook", which does not exist`),
+			},
+		},
+		"UnsupportedKind": {
+			webhooks: "apiVersion: v1\nkind: Service\nmetadata:\n  name: webhook\n",
+			want: want{
+				err: errors.Wrap(errors.New(`webhooks kind "Service" is not supported, must be ValidatingWebhookConfiguration or MutatingWebhookConfiguration`), `invalid webhooks "/webhooks.yaml"`),
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			sp := NewStackPackage("/", "crossplane/sample-stack:latest", logging.NewNopLogger())
+			if err := installStep(sp)("/install.yaml", []byte(tc.install)); err != nil {
+				t.Fatalf("installStep(...): %s", err)
+			}
+			if tc.crd != nil {
+				if err := sp.AddCRD("/mytype.crd.yaml", tc.crd); err != nil {
+					t.Fatalf("AddCRD(...): %s", err)
+				}
+			}
+
+			err := webhooksStep(sp)("/webhooks.yaml", []byte(tc.webhooks))
+			if err == nil {
+				err = sp.applyWebhooks()
+			}
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Fatalf("webhooks: -want error, +got error:\n%s", diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tc.want.webhooks, sp.Stack.Spec.Webhooks); diff != "" {
+				t.Errorf("webhooks: -want, +got:\n%s", diff)
+			}
+		})
+	}
+}